@@ -0,0 +1,536 @@
+package readconf
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"reflect"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// App loads the configuration of an application by convention:
+//
+//   - the files NAME.env and, if a profile is selected, NAME.PROFILE.env are
+//     merged from each of Dirs, if they exist;
+//   - environment variables starting with Prefix are merged last;
+//   - the configuration is reloaded when the process receives SIGHUP, when
+//     values expire, e.g. those of override sources, if WatchInterval is set,
+//     when the files change, and when sources added with Poll change.
+//
+// The fields of an App may be changed before Load is called.
+type App struct {
+	// Name of the application.
+	Name string
+	// Prefix of environment variables, NAME_ by default.
+	Prefix string
+	// Profile selects additional files, e.g. production. By default it is
+	// taken from the APP_ENV environment variable. It may reference host
+	// facts, e.g. production-${sys.os}.
+	Profile string
+	// Dirs are searched for configuration files in order, /etc/NAME and the
+	// working directory by default.
+	Dirs []string
+	// Freeze lists windows during which reloads are suppressed unless forced,
+	// e.g. during peak traffic. Reloads during a window, e.g. due to expiry,
+	// changes or signals, are delayed until the window ends.
+	Freeze []FreezeWindow
+	// Configure, if set, is called with the builder after files are merged
+	// and before the environment is, e.g. to add validators or sources.
+	Configure func(b *Builder)
+	// WatchInterval, if set, is the interval the files are polled at for
+	// changes, see Watcher. The files of the application are watched, and
+	// all files and directories read by its sources, see Report.Files.
+	// Failed reloads keep the previous configuration.
+	WatchInterval time.Duration
+
+	mu       sync.Mutex
+	reloadMu sync.Mutex // serializes builds, so that reloads apply in order
+	target   reflect.Type
+	config   interface{}
+	report   *Report
+	err      error
+	loaded   time.Time
+	onReload []func(config interface{}, err error)
+	onChange []appSubscription
+	signals  chan os.Signal
+	timer    *time.Timer
+	pending  time.Time // end of the freeze window delaying a reload
+	watcher  *Watcher
+	polls    []appPoll
+	pollers  []*Poller
+	closed   bool
+}
+
+type appPoll struct {
+	source Source
+	ttl    time.Duration
+}
+
+// delay of reloads after failed reloads of expiring values
+const _appRetry = 30 * time.Second
+
+// NewApp returns an App for the application called name.
+func NewApp(name string) *App {
+	prefix := strings.ToUpper(name)
+	prefix = strings.Map(func(r rune) rune {
+		if r == '-' || r == '.' || r == ' ' {
+			return '_'
+		}
+
+		return r
+	}, prefix)
+
+	return &App{
+		Name:    name,
+		Prefix:  prefix + `_`,
+		Profile: os.Getenv(`APP_ENV`),
+		Dirs:    []string{filepath.Join(`/etc`, name), `.`},
+	}
+}
+
+// Builder returns a builder with the sources of the application merged.
+func (a *App) Builder() *Builder {
+	b := NewBuilder()
+
+	for _, filename := range a.files() {
+		filename := filename
+		b.Optional(func(b *Builder) {
+			b.MergeFile(filename)
+		})
+	}
+
+	if a.Configure != nil {
+		a.Configure(b)
+	}
+
+	a.mu.Lock()
+	pollers := a.pollers
+	a.mu.Unlock()
+
+	for i, p := range a.polls {
+		if i < len(pollers) {
+			b.MergeSource(polledSource{pollers[i]})
+			continue
+		}
+
+		b.MergeSource(p.source)
+	}
+
+	return b.MergeEnviron(a.Prefix, os.Environ())
+}
+
+// Returns the paths of the files of the application, in order.
+func (a *App) files() []string {
+	names := []string{a.Name + `.env`}
+	if profile := expandFacts(a.Profile); profile != `` {
+		names = append(names, a.Name+`.`+profile+`.env`)
+	}
+
+	files := make([]string, 0, len(a.Dirs)*len(names))
+	for _, dir := range a.Dirs {
+		for _, name := range names {
+			files = append(files, filepath.Join(dir, name))
+		}
+	}
+
+	return files
+}
+
+// Returns the files of the application and those read by the sources of the
+// build of report.
+func (a *App) watchedFiles(report *Report) []string {
+	files := a.files()
+	for _, filename := range report.Files {
+		if !containsString(files, filename) {
+			files = append(files, filename)
+		}
+	}
+
+	return files
+}
+
+// Load builds the configuration into target and starts reloading it on
+// SIGHUP. Reloads build into a new value of the same type; use OnReload to be
+// notified of them.
+func (a *App) Load(target interface{}) error {
+	// polled sources are loaded by the build, so that pollers don't load them
+	// again until the TTL passed
+	a.mu.Lock()
+	if a.pollers == nil {
+		for _, p := range a.polls {
+			a.pollers = append(a.pollers, newPoller(p.source, p.ttl, func() {
+				a.Reload()
+			}))
+		}
+	}
+	a.mu.Unlock()
+
+	a.reloadMu.Lock()
+	defer a.reloadMu.Unlock()
+
+	report, err := a.Builder().build(target)
+	if err != nil {
+		return err
+	}
+
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	a.target = reflect.TypeOf(target).Elem()
+	a.config = target
+	a.report = report
+	a.loaded = time.Now()
+	a.closed = false
+	a.pending = time.Time{}
+	a.schedule(report, 0)
+
+	if a.WatchInterval > 0 && a.watcher == nil {
+		a.watcher = NewWatcher(a.watchedFiles(report), a.WatchInterval, 0, func() {
+			a.Reload()
+		})
+	}
+
+	for _, p := range a.pollers {
+		p.start()
+	}
+
+	if a.signals == nil && len(_reloadSignals) > 0 {
+		a.signals = make(chan os.Signal, 1)
+		signal.Notify(a.signals, _reloadSignals...)
+
+		go func(signals chan os.Signal) {
+			for range signals {
+				a.Reload()
+			}
+		}(a.signals)
+	}
+
+	return nil
+}
+
+// Poll merges source after the values of Configure and reloads the
+// configuration when the source changes, polling it every ttl, see Poller. It
+// must be called before Load.
+func (a *App) Poll(source Source, ttl time.Duration) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	a.polls = append(a.polls, appPoll{source: source, ttl: ttl})
+}
+
+// OnReload registers f to be called after every reload with the new
+// configuration, or the error that failed the reload. Reloads are serialized,
+// so f is called in their order, and must not reload the app itself.
+func (a *App) OnReload(f func(config interface{}, err error)) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	a.onReload = append(a.onReload, f)
+}
+
+// Reload builds the configuration again. The previous configuration stays in
+// use if the build fails, or if a freeze window is active, in which case a
+// *FrozenError is returned and the configuration is reloaded when the window
+// ends.
+func (a *App) Reload() (interface{}, error) {
+	if until, ok := a.frozenUntil(time.Now()); ok {
+		err := &FrozenError{Until: until}
+
+		a.mu.Lock()
+		if a.report != nil {
+			a.pending = until
+			a.schedule(a.report, 0)
+		}
+		a.mu.Unlock()
+
+		return nil, err
+	}
+
+	return a.ForceReload()
+}
+
+// ForceReload is like Reload, but reloads during freeze windows too, e.g. for
+// emergency changes.
+func (a *App) ForceReload() (interface{}, error) {
+	// concurrent reloads, e.g. by signals and the watcher, could otherwise
+	// finish out of order and replace newer configurations with older ones
+	a.reloadMu.Lock()
+	defer a.reloadMu.Unlock()
+
+	a.mu.Lock()
+	target := a.target
+	a.mu.Unlock()
+
+	if target == nil {
+		return nil, fmt.Errorf("configuration of %s is not loaded", a.Name)
+	}
+
+	config := reflect.New(target).Interface()
+
+	report, err := a.Builder().build(config)
+
+	if err != nil {
+		config = nil
+	}
+
+	a.mu.Lock()
+	a.err = err
+	previous := a.report
+	if err == nil {
+		a.config = config
+		a.report = report
+		a.loaded = time.Now()
+		a.pending = time.Time{}
+		a.schedule(report, 0)
+
+		if a.watcher != nil {
+			a.watcher.setFiles(a.watchedFiles(report))
+		}
+	} else {
+		a.schedule(a.report, _appRetry)
+	}
+	onReload := a.onReload
+	onChange := a.onChange
+	a.mu.Unlock()
+
+	for _, f := range onReload {
+		f(config, err)
+	}
+
+	if err == nil && previous != nil {
+		changes := previous.Changes(report)
+		for _, sub := range onChange {
+			if matching := changesUnder(changes, sub.prefix); len(matching) > 0 {
+				sub.f(matching)
+			}
+		}
+	}
+
+	return config, err
+}
+
+// OnChange registers f to be called after reloads that change values of keys
+// starting with prefix, e.g. LOG__, with the changes, so that only the
+// affected parts of an application need to react. An empty prefix matches all
+// keys.
+func (a *App) OnChange(prefix string, f func(changes []KeyChange)) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	a.onChange = append(a.onChange, appSubscription{prefix: normalizeKey(prefix), f: f})
+}
+
+type appSubscription struct {
+	prefix string
+	f      func(changes []KeyChange)
+}
+
+func changesUnder(changes []KeyChange, prefix string) []KeyChange {
+	var matching []KeyChange
+	for _, c := range changes {
+		if strings.HasPrefix(c.Key, prefix) {
+			matching = append(matching, c)
+		}
+	}
+
+	return matching
+}
+
+// Schedules a reload when the first value of report expires, or the reload
+// delayed by a freeze window is due, but no sooner than after min. The lock
+// must be held.
+func (a *App) schedule(report *Report, min time.Duration) {
+	if a.timer != nil {
+		a.timer.Stop()
+		a.timer = nil
+	}
+
+	next, ok := report.NextExpiry()
+	if !a.pending.IsZero() && (!ok || a.pending.Before(next)) {
+		next, ok = a.pending, true
+	}
+
+	if !ok || a.closed {
+		return
+	}
+
+	d := next.Sub(time.Now())
+	if d < min {
+		d = min
+	}
+
+	a.timer = time.AfterFunc(d, func() {
+		a.Reload()
+	})
+}
+
+// Config returns the current configuration, a pointer of the type passed to
+// Load.
+func (a *App) Config() interface{} {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	return a.config
+}
+
+// Report returns the report of the current configuration.
+func (a *App) Report() *Report {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	return a.report
+}
+
+// Close stops reloading on signals, expiry and changes.
+func (a *App) Close() {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	a.closed = true
+	if a.timer != nil {
+		a.timer.Stop()
+		a.timer = nil
+	}
+
+	if a.watcher != nil {
+		// the watcher may be reloading, which takes the lock
+		watcher := a.watcher
+		a.watcher = nil
+
+		a.mu.Unlock()
+		watcher.Close()
+		a.mu.Lock()
+	}
+
+	if a.pollers != nil {
+		pollers := a.pollers
+		a.pollers = nil
+
+		a.mu.Unlock()
+		for _, p := range pollers {
+			p.Close()
+		}
+		a.mu.Lock()
+	}
+
+	if a.signals != nil {
+		signal.Stop(a.signals)
+		close(a.signals)
+		a.signals = nil
+	}
+}
+
+// Handler returns an admin handler that describes the current configuration
+// on GET, without its values, and reloads it on POST. Reloads are forced during
+// freeze windows if the force query parameter is set. On GET, the search query
+// parameter lists the keys matching it, as matched by Report.Search.
+func (a *App) Handler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.Method {
+		case http.MethodGet:
+			if pattern := r.URL.Query().Get(`search`); pattern != `` {
+				a.serveSearch(w, pattern)
+				return
+			}
+		case http.MethodPost:
+			var err error
+			if force, _ := strconv.ParseBool(r.URL.Query().Get(`force`)); force {
+				_, err = a.ForceReload()
+			} else {
+				_, err = a.Reload()
+			}
+
+			if _, ok := err.(*FrozenError); ok {
+				http.Error(w, err.Error(), http.StatusConflict)
+				return
+			}
+		default:
+			w.Header().Set(`Allow`, `GET, POST`)
+			http.Error(w, `method not allowed`, http.StatusMethodNotAllowed)
+			return
+		}
+
+		a.mu.Lock()
+		status := appStatus{
+			Name:    a.Name,
+			Profile: a.Profile,
+			Loaded:  a.loaded,
+		}
+		if a.err != nil {
+			status.Error = a.err.Error()
+		}
+		if a.report != nil {
+			status.Keys = a.report.Keys
+			status.Origins = a.report.Origins
+			status.Warnings = a.report.Warnings
+			status.Layers = a.report.Layers
+		}
+		a.mu.Unlock()
+
+		w.Header().Set(`Content-Type`, `application/json`)
+		if status.Error != `` {
+			w.WriteHeader(http.StatusInternalServerError)
+		}
+
+		json.NewEncoder(w).Encode(status)
+	})
+}
+
+func (a *App) serveSearch(w http.ResponseWriter, pattern string) {
+	a.mu.Lock()
+	report := a.report
+	a.mu.Unlock()
+
+	infos := []KeyInfo{}
+	if report != nil {
+		var err error
+		if infos, err = report.Search(pattern); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+	}
+
+	for i := range infos {
+		infos[i].Value = ``
+	}
+
+	w.Header().Set(`Content-Type`, `application/json`)
+	json.NewEncoder(w).Encode(infos)
+}
+
+// Logger is implemented by loggers such as *log.Logger.
+type Logger interface {
+	Printf(format string, v ...interface{})
+}
+
+// LogBanner logs a summary of the current configuration to logger, see
+// Report.Banner.
+func (a *App) LogBanner(logger Logger) {
+	a.mu.Lock()
+	report := a.report
+	a.mu.Unlock()
+
+	if report == nil {
+		logger.Printf("%s: configuration not loaded", a.Name)
+		return
+	}
+
+	logger.Printf("%s", report.Banner(a.Name, expandFacts(a.Profile)))
+}
+
+type appStatus struct {
+	Name     string            `json:"name"`
+	Profile  string            `json:"profile,omitempty"`
+	Loaded   time.Time         `json:"loaded"`
+	Error    string            `json:"error,omitempty"`
+	Keys     []string          `json:"keys"`
+	Origins  map[string]Origin `json:"origins"`
+	Warnings []string          `json:"warnings,omitempty"`
+	Layers   map[string]string `json:"layers,omitempty"`
+}
@@ -0,0 +1,8 @@
+//go:build plan9 || js
+// +build plan9 js
+
+package readconf
+
+import "os"
+
+var _reloadSignals []os.Signal
@@ -0,0 +1,11 @@
+//go:build !plan9 && !js
+// +build !plan9,!js
+
+package readconf
+
+import (
+	"os"
+	"syscall"
+)
+
+var _reloadSignals = []os.Signal{syscall.SIGHUP}
@@ -0,0 +1,621 @@
+package readconf_test
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"runtime"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/tetratom/readconf"
+)
+
+func TestApp(t *testing.T) {
+	type config struct {
+		Name  string
+		Port  int
+		Debug bool `default:"false"`
+	}
+
+	dir, err := ioutil.TempDir(``, `readconf`)
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	write := func(name, data string) {
+		require.NoError(t, ioutil.WriteFile(filepath.Join(dir, name), []byte(data), 0644))
+	}
+
+	write(`my-app.env`, "NAME=app\nPORT=80")
+	write(`my-app.staging.env`, "PORT=8080")
+
+	require.NoError(t, os.Setenv(`MY_APP_DEBUG`, `true`))
+	defer os.Unsetenv(`MY_APP_DEBUG`)
+
+	app := readconf.NewApp(`my-app`)
+	app.Dirs = []string{dir}
+	app.Profile = `staging`
+	defer app.Close()
+
+	var conf config
+	require.NoError(t, app.Load(&conf))
+	require.Equal(t, config{Name: `app`, Port: 8080, Debug: true}, conf)
+	require.Equal(t, &conf, app.Config())
+
+	reloaded := []interface{}{}
+	app.OnReload(func(config interface{}, err error) {
+		reloaded = append(reloaded, config)
+	})
+
+	t.Run("reload", func(t *testing.T) {
+		write(`my-app.staging.env`, "PORT=9090")
+
+		c, err := app.Reload()
+		require.NoError(t, err)
+		require.Equal(t, &config{Name: `app`, Port: 9090, Debug: true}, c)
+		require.Equal(t, c, app.Config())
+		require.Equal(t, []interface{}{c}, reloaded)
+		require.Equal(t, 8080, conf.Port)
+	})
+
+	t.Run("failed reload", func(t *testing.T) {
+		write(`my-app.staging.env`, "PORT=many")
+
+		_, err := app.Reload()
+		require.Error(t, err)
+		require.Equal(t, 9090, app.Config().(*config).Port)
+		require.Nil(t, reloaded[len(reloaded)-1])
+	})
+
+	t.Run("handler", func(t *testing.T) {
+		write(`my-app.staging.env`, "PORT=9091")
+
+		rec := httptest.NewRecorder()
+		app.Handler().ServeHTTP(rec, httptest.NewRequest(http.MethodPost, `/`, nil))
+		require.Equal(t, http.StatusOK, rec.Code)
+
+		var status struct {
+			Name    string
+			Profile string
+			Keys    []string
+			Origins map[string]readconf.Origin
+		}
+		require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &status))
+		require.Equal(t, `my-app`, status.Name)
+		require.Equal(t, `staging`, status.Profile)
+		require.Equal(t, []string{`DEBUG`, `NAME`, `PORT`}, status.Keys)
+		require.Equal(t, readconf.OriginSet, status.Origins[`DEBUG`])
+		require.NotContains(t, rec.Body.String(), `9091`)
+		require.Equal(t, 9091, app.Config().(*config).Port)
+	})
+
+	t.Run("search", func(t *testing.T) {
+		rec := httptest.NewRecorder()
+		app.Handler().ServeHTTP(rec, httptest.NewRequest(http.MethodGet, `/?search=p*`, nil))
+		require.Equal(t, http.StatusOK, rec.Code)
+
+		var infos []readconf.KeyInfo
+		require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &infos))
+		require.Len(t, infos, 1)
+		require.Equal(t, `PORT`, infos[0].Key)
+		require.Equal(t, readconf.OriginSet, infos[0].Origin)
+		require.Equal(t, `int`, infos[0].Doc.Type)
+		require.NotContains(t, rec.Body.String(), `9091`)
+
+		rec = httptest.NewRecorder()
+		app.Handler().ServeHTTP(rec, httptest.NewRequest(http.MethodGet, `/?search=/(/`, nil))
+		require.Equal(t, http.StatusBadRequest, rec.Code)
+	})
+
+	t.Run("banner", func(t *testing.T) {
+		var buf bytes.Buffer
+		app.LogBanner(log.New(&buf, ``, 0))
+
+		fingerprint := app.Report().Fingerprint()
+		require.Len(t, fingerprint, 12)
+		require.Equal(t, "my-app: profile staging, configuration "+fingerprint+", 3 keys from 3 sources, 0 warnings\n", buf.String())
+
+		buf.Reset()
+		readconf.NewApp(`other`).LogBanner(log.New(&buf, ``, 0))
+		require.Equal(t, "other: configuration not loaded\n", buf.String())
+	})
+}
+
+func TestApp_Override(t *testing.T) {
+	type config struct {
+		Enabled bool `default:"true"`
+	}
+
+	var mu sync.Mutex
+	enabled := `true`
+
+	app := readconf.NewApp(`my-app`)
+	app.Dirs = nil
+	app.Configure = func(b *readconf.Builder) {
+		b.Override(10*time.Millisecond, func(b *readconf.Builder) {
+			mu.Lock()
+			defer mu.Unlock()
+			b.Set(`ENABLED`, enabled)
+		})
+	}
+	defer app.Close()
+
+	var conf config
+	require.NoError(t, app.Load(&conf))
+	require.True(t, conf.Enabled)
+
+	mu.Lock()
+	enabled = `false`
+	mu.Unlock()
+
+	require.Eventually(t, func() bool {
+		return !app.Config().(*config).Enabled
+	}, time.Second, 10*time.Millisecond)
+}
+
+func TestApp_Freeze(t *testing.T) {
+	type config struct {
+		Port int
+	}
+
+	port := `80`
+
+	app := readconf.NewApp(`my-app`)
+	app.Dirs = nil
+	app.Freeze = []readconf.FreezeWindow{{From: 0, To: 24 * time.Hour}}
+	app.Configure = func(b *readconf.Builder) {
+		b.Set(`PORT`, port)
+	}
+	defer app.Close()
+
+	var conf config
+	require.NoError(t, app.Load(&conf))
+
+	port = `8080`
+
+	_, err := app.Reload()
+	require.IsType(t, &readconf.FrozenError{}, err)
+	require.Equal(t, 80, app.Config().(*config).Port)
+
+	rec := httptest.NewRecorder()
+	app.Handler().ServeHTTP(rec, httptest.NewRequest(http.MethodPost, `/`, nil))
+	require.Equal(t, http.StatusConflict, rec.Code)
+
+	rec = httptest.NewRecorder()
+	app.Handler().ServeHTTP(rec, httptest.NewRequest(http.MethodPost, `/?force=1`, nil))
+	require.Equal(t, http.StatusOK, rec.Code)
+	require.Equal(t, 8080, app.Config().(*config).Port)
+}
+
+func TestApp_FreezeDelaysReloads(t *testing.T) {
+	type config struct {
+		Port int
+	}
+
+	dir, err := ioutil.TempDir(``, `readconf`)
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	filename := filepath.Join(dir, `my-app.env`)
+	require.NoError(t, ioutil.WriteFile(filename, []byte("PORT=80"), 0644))
+
+	// a window ending shortly
+	now := time.Now()
+	midnight := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, now.Location())
+	window := readconf.FreezeWindow{From: now.Sub(midnight), To: now.Sub(midnight) + 500*time.Millisecond}
+	end := midnight.Add(window.To)
+
+	app := readconf.NewApp(`my-app`)
+	app.Dirs = []string{dir}
+	app.Freeze = []readconf.FreezeWindow{window}
+	app.WatchInterval = 5 * time.Millisecond
+	defer app.Close()
+
+	var conf config
+	require.NoError(t, app.Load(&conf))
+
+	// the watcher reloads during the window, which is delayed
+	require.NoError(t, ioutil.WriteFile(filename, []byte("PORT=8080"), 0644))
+
+	require.Eventually(t, func() bool {
+		return app.Config().(*config).Port == 8080
+	}, 5*time.Second, 10*time.Millisecond)
+	require.False(t, time.Now().Before(end))
+}
+
+func TestApp_ConcurrentReloads(t *testing.T) {
+	type config struct {
+		Port int
+	}
+
+	var builds int32
+
+	app := readconf.NewApp(`my-app`)
+	app.Dirs = nil
+	app.Configure = func(b *readconf.Builder) {
+		b.MergeSource(readconf.SourceFunc(func(ctx context.Context) (readconf.Map, error) {
+			n := atomic.AddInt32(&builds, 1)
+			// later builds are faster, so they would finish first
+			time.Sleep(time.Duration(20-n) * time.Millisecond)
+			return readconf.Map{`PORT`: fmt.Sprint(n)}, nil
+		}))
+	}
+	defer app.Close()
+
+	var conf config
+	require.NoError(t, app.Load(&conf))
+
+	var ports []int
+	app.OnReload(func(value interface{}, err error) {
+		require.NoError(t, err)
+		ports = append(ports, value.(*config).Port)
+	})
+
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			app.Reload()
+		}()
+	}
+	wg.Wait()
+
+	require.Len(t, ports, 10)
+	require.True(t, sort.IntsAreSorted(ports), ports)
+	require.Equal(t, ports[9], app.Config().(*config).Port)
+}
+
+func TestApp_ProfileFacts(t *testing.T) {
+	var conf struct {
+		Port int
+	}
+
+	dir, err := ioutil.TempDir(``, `readconf`)
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	require.NoError(t, ioutil.WriteFile(filepath.Join(dir, `my-app.env`), []byte("PORT=80"), 0644))
+	require.NoError(t, ioutil.WriteFile(filepath.Join(dir, `my-app.prod-`+runtime.GOOS+`.env`), []byte("PORT=8080"), 0644))
+
+	app := readconf.NewApp(`my-app`)
+	app.Dirs = []string{dir}
+	app.Profile = `prod-${sys.os}`
+	defer app.Close()
+
+	require.NoError(t, app.Load(&conf))
+	require.Equal(t, 8080, conf.Port)
+}
+
+func TestWatcher(t *testing.T) {
+	dir, err := ioutil.TempDir(``, `readconf`)
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	filename := filepath.Join(dir, `app.env`)
+	changes := make(chan struct{}, 10)
+
+	w := readconf.NewWatcher([]string{filename}, 5*time.Millisecond, 50*time.Millisecond, func() {
+		changes <- struct{}{}
+	})
+	defer w.Close()
+
+	// rapid writes, including creating the file, cause one change
+	for i := 0; i < 5; i++ {
+		require.NoError(t, ioutil.WriteFile(filename, []byte(strings.Repeat(`x`, i+1)), 0644))
+		time.Sleep(5 * time.Millisecond)
+	}
+
+	select {
+	case <-changes:
+	case <-time.After(5 * time.Second):
+		t.Fatal(`no change`)
+	}
+
+	select {
+	case <-changes:
+		t.Fatal(`second change`)
+	case <-time.After(150 * time.Millisecond):
+	}
+
+	require.NoError(t, os.Remove(filename))
+
+	select {
+	case <-changes:
+	case <-time.After(5 * time.Second):
+		t.Fatal(`no change after removal`)
+	}
+
+	w.Close()
+	w.Close()
+}
+
+func TestApp_Watch(t *testing.T) {
+	type config struct {
+		Port int
+	}
+
+	dir, err := ioutil.TempDir(``, `readconf`)
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	filename := filepath.Join(dir, `watch-app.env`)
+	require.NoError(t, ioutil.WriteFile(filename, []byte("PORT=80"), 0644))
+
+	app := readconf.NewApp(`watch-app`)
+	app.Dirs = []string{dir}
+	app.Profile = ``
+	app.WatchInterval = 5 * time.Millisecond
+	defer app.Close()
+
+	reloads := make(chan error, 10)
+	app.OnReload(func(config interface{}, err error) {
+		reloads <- err
+	})
+
+	var conf config
+	require.NoError(t, app.Load(&conf))
+
+	reload := func() error {
+		select {
+		case err := <-reloads:
+			return err
+		case <-time.After(5 * time.Second):
+			t.Fatal(`no reload`)
+			return nil
+		}
+	}
+
+	require.NoError(t, ioutil.WriteFile(filename, []byte("PORT=8080"), 0644))
+	require.NoError(t, reload())
+	require.Equal(t, 8080, app.Config().(*config).Port)
+
+	require.NoError(t, ioutil.WriteFile(filename, []byte("PORT=invalid"), 0644))
+	require.Error(t, reload())
+	require.Equal(t, 8080, app.Config().(*config).Port)
+}
+
+func TestApp_Watch_Sources(t *testing.T) {
+	type config struct {
+		Name string
+		Port int
+	}
+
+	dir, err := ioutil.TempDir(``, `readconf`)
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	confd := filepath.Join(dir, `conf.d`)
+	require.NoError(t, os.Mkdir(confd, 0755))
+
+	mainFile := filepath.Join(dir, `main.conf`)
+	fragment := filepath.Join(dir, `fragment.conf`)
+	require.NoError(t, ioutil.WriteFile(mainFile, []byte("NAME=app\n@include fragment.conf"), 0644))
+	require.NoError(t, ioutil.WriteFile(fragment, []byte("PORT=80"), 0644))
+
+	app := readconf.NewApp(`watch-sources-app`)
+	app.Dirs = []string{dir}
+	app.Profile = ``
+	app.WatchInterval = 5 * time.Millisecond
+	app.Configure = func(b *readconf.Builder) {
+		b.MergeFile(mainFile).MergeDir(confd)
+	}
+	defer app.Close()
+
+	reloads := make(chan error, 10)
+	app.OnReload(func(config interface{}, err error) {
+		reloads <- err
+	})
+
+	var conf config
+	require.NoError(t, app.Load(&conf))
+	require.Equal(t, []string{filepath.Join(dir, `watch-sources-app.env`), mainFile, fragment, confd}, app.Report().Files)
+
+	reload := func() error {
+		select {
+		case err := <-reloads:
+			return err
+		case <-time.After(5 * time.Second):
+			t.Fatal(`no reload`)
+			return nil
+		}
+	}
+
+	require.NoError(t, ioutil.WriteFile(fragment, []byte("PORT=8080"), 0644))
+	require.NoError(t, reload())
+	require.Equal(t, 8080, app.Config().(*config).Port)
+
+	// adding a snippet changes the modification time of the directory
+	require.NoError(t, ioutil.WriteFile(filepath.Join(confd, `10-port.conf`), []byte("PORT=9090"), 0644))
+	require.NoError(t, reload())
+	require.Equal(t, 9090, app.Config().(*config).Port)
+}
+
+func TestApp_OnChange(t *testing.T) {
+	type config struct {
+		Log struct {
+			Level  string
+			Format string `default:"text"`
+		}
+		Port int
+	}
+
+	values := readconf.Map{`LOG__LEVEL`: `info`, `PORT`: `80`}
+
+	app := readconf.NewApp(`on-change-app`)
+	app.Dirs = nil
+	app.Configure = func(b *readconf.Builder) {
+		b.MergeMap(values)
+	}
+	defer app.Close()
+
+	var logChanges, allChanges [][]readconf.KeyChange
+	app.OnChange(`log__`, func(changes []readconf.KeyChange) {
+		logChanges = append(logChanges, changes)
+	})
+	app.OnChange(``, func(changes []readconf.KeyChange) {
+		allChanges = append(allChanges, changes)
+	})
+
+	var conf config
+	require.NoError(t, app.Load(&conf))
+
+	values[`PORT`] = `8080`
+	_, err := app.Reload()
+	require.NoError(t, err)
+	require.Empty(t, logChanges)
+	require.Equal(t, [][]readconf.KeyChange{{
+		{Key: `PORT`, Old: `80`, New: `8080`, HadOld: true, HasNew: true},
+	}}, allChanges)
+
+	values[`LOG__LEVEL`] = `debug`
+	values[`LOG__FORMAT`] = `json`
+	_, err = app.Reload()
+	require.NoError(t, err)
+	require.Equal(t, [][]readconf.KeyChange{{
+		{Key: `LOG__FORMAT`, Old: `text`, New: `json`, HadOld: true, HasNew: true},
+		{Key: `LOG__LEVEL`, Old: `info`, New: `debug`, HadOld: true, HasNew: true},
+	}}, logChanges)
+
+	_, err = app.Reload()
+	require.NoError(t, err)
+	require.Len(t, logChanges, 1)
+	require.Len(t, allChanges, 2)
+}
+
+func TestPoller(t *testing.T) {
+	var mu sync.Mutex
+	values := readconf.Map{`PORT`: `80`}
+	var fail bool
+
+	source := readconf.SourceFunc(func(ctx context.Context) (readconf.Map, error) {
+		mu.Lock()
+		defer mu.Unlock()
+
+		if fail {
+			return nil, errors.New(`unavailable`)
+		}
+
+		return readconf.Map{`PORT`: values[`PORT`]}, nil
+	})
+
+	set := func(port string, failing bool) {
+		mu.Lock()
+		defer mu.Unlock()
+
+		values[`PORT`] = port
+		fail = failing
+	}
+
+	changes := make(chan struct{}, 10)
+	p := readconf.NewPoller(source, 5*time.Millisecond, func() {
+		changes <- struct{}{}
+	})
+	defer p.Close()
+
+	select {
+	case <-changes:
+		t.Fatal(`change without changes`)
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	set(`8080`, false)
+
+	select {
+	case <-changes:
+	case <-time.After(5 * time.Second):
+		t.Fatal(`no change`)
+	}
+
+	// failed polls aren't changes, and values are compared with those of the
+	// last successful poll
+	set(`8080`, true)
+	time.Sleep(50 * time.Millisecond)
+	set(`8080`, false)
+
+	select {
+	case <-changes:
+		t.Fatal(`change after failure`)
+	case <-time.After(150 * time.Millisecond):
+	}
+
+	p.Close()
+	p.Close()
+
+	t.Run("hung source", func(t *testing.T) {
+		source := readconf.SourceFunc(func(ctx context.Context) (readconf.Map, error) {
+			<-ctx.Done()
+			return nil, ctx.Err()
+		})
+
+		// neither blocks on the source
+		p := readconf.NewPoller(source, time.Hour, func() {})
+		p.Close()
+	})
+}
+
+func TestApp_Poll(t *testing.T) {
+	type config struct {
+		Port int
+	}
+
+	var mu sync.Mutex
+	port := `80`
+	// loads by builds rather than polls, which time out
+	builds := 0
+
+	app := readconf.NewApp(`poll-app`)
+	app.Dirs = nil
+	app.Poll(readconf.SourceFunc(func(ctx context.Context) (readconf.Map, error) {
+		mu.Lock()
+		defer mu.Unlock()
+
+		if _, ok := ctx.Deadline(); !ok {
+			builds++
+		}
+
+		return readconf.Map{`PORT`: port}, nil
+	}), 5*time.Millisecond)
+	defer app.Close()
+
+	reloads := make(chan error, 10)
+	app.OnReload(func(config interface{}, err error) {
+		reloads <- err
+	})
+
+	var conf config
+	require.NoError(t, app.Load(&conf))
+	require.Equal(t, 80, conf.Port)
+
+	mu.Lock()
+	port = `8080`
+	mu.Unlock()
+
+	select {
+	case err := <-reloads:
+		require.NoError(t, err)
+	case <-time.After(5 * time.Second):
+		t.Fatal(`no reload`)
+	}
+
+	require.Equal(t, 8080, app.Config().(*config).Port)
+
+	// the reload took the values of the poll that found the change
+	mu.Lock()
+	require.Equal(t, 1, builds)
+	mu.Unlock()
+}
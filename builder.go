@@ -1,34 +1,94 @@
 package readconf
 
 import (
-	"bytes"
 	"fmt"
+	"io"
 	"io/ioutil"
+	"os"
+	"path/filepath"
 	"reflect"
 	"sort"
+	"strconv"
 	"strings"
-
-	"github.com/go-playground/validator/v10"
+	"time"
 )
 
 func NewBuilder() *Builder {
 	return &Builder{}
 }
 
+// Builder merges configuration values from sources and unmarshals them into
+// targets. Its methods other than the Build methods modify the builder in place
+// and return it for chaining. Build doesn't modify the builder, so values may
+// still be merged after a build, and each build only reflects the values merged
+// before it. Use Clone to derive builders from a shared base without changing
+// it.
 type Builder struct {
-	err      error
-	values   Map
-	validate *validator.Validate
+	err        error
+	sourceErrs SourceErrors
+	values     Map
+	validate   Validator
+	onMissing  []func(key string, field reflect.StructField) (string, bool)
+	transform  []func(m Map) error
+	policies   []Policy
+	expires    map[string]time.Time
+	warnings   []error
+	keys       KeyStrategy
+	layers     map[string]string
+	overrides  []override
+	instance   string
+	workers    int
+	sources    []sourceTiming
+
+	localeNumbers bool
+	strict        bool
+	ignoreEmpty   bool
+
+	// groups of sources of which one must provide keys
+	requiredSources [][]string
+
+	// see Extends
+	extends []FieldDoc
+
+	// see LargeValues
+	largeThreshold int
+	largeDir       string
+	// files of the values stored by LargeValues, by key
+	largeFiles map[string]string
+
+	// files and directories read by sources, see Report.Files
+	files []string
 }
 
+// Error returns the error that failed the builder, or the errors of the
+// sources that failed to merge as SourceErrors.
 func (b *Builder) Error() error {
-	return b.err
+	if b.err != nil {
+		return b.err
+	}
+
+	if len(b.sourceErrs) > 0 {
+		return b.sourceErrs
+	}
+
+	return nil
 }
 
 func (b *Builder) hasError() bool {
 	return b.err != nil
 }
 
+// Fail makes the builder fail with err, unless it already failed, e.g. for
+// sources implemented outside of the package.
+func (b *Builder) Fail(err error) *Builder {
+	if b.hasError() {
+		return b
+	}
+
+	b.err = err
+	return b
+}
+
 func (b *Builder) Set(k, v string) *Builder {
 	if b.hasError() {
 		return b
@@ -39,7 +99,174 @@ func (b *Builder) Set(k, v string) *Builder {
 	return b.MergeMap(m)
 }
 
-func (b *Builder) WithValidator(v *validator.Validate) *Builder {
+// OnMissing registers f to be called for keys of the target that have no value
+// before Build fails. If f returns true, the returned value is used for the key.
+// Callbacks are tried in the order they were registered.
+func (b *Builder) OnMissing(f func(key string, field reflect.StructField) (string, bool)) *Builder {
+	if b.hasError() {
+		return b
+	}
+
+	b.onMissing = append(b.onMissing, f)
+	return b
+}
+
+func (b *Builder) lookupMissing(key string, field reflect.StructField) (string, bool) {
+	for _, f := range b.onMissing {
+		if value, ok := f(key, field); ok {
+			return value, true
+		}
+	}
+
+	return ``, false
+}
+
+// AddTransform registers f to be called with the merged values once references
+// are resolved and before they are unmarshaled. f may modify the map, e.g. to
+// add computed values, or return an error to reject the configuration.
+// Transforms run in the order they were added.
+func (b *Builder) AddTransform(f func(m Map) error) *Builder {
+	if b.hasError() {
+		return b
+	}
+
+	b.transform = append(b.transform, f)
+	return b
+}
+
+// LocaleNumbers makes Build accept numbers written with comma decimal
+// separators and with thousands separators, such as 1.234,5 or 1'234.5.
+func (b *Builder) LocaleNumbers() *Builder {
+	if b.hasError() {
+		return b
+	}
+
+	b.localeNumbers = true
+	return b
+}
+
+// Strict makes Build fail with an *UnknownKeysError if values are given for
+// keys that aren't keys of the target, e.g. misspelled ones. Keys referenced
+// by other values, as in ${KEY}, are not unknown.
+func (b *Builder) Strict() *Builder {
+	if b.hasError() {
+		return b
+	}
+
+	b.strict = true
+	return b
+}
+
+// IgnoreEmpty makes empty values merged afterwards count as unset, so that they
+// don't override values merged before, e.g. when orchestrators set empty
+// environment variables. Keys that are only given empty values take their
+// defaults.
+func (b *Builder) IgnoreEmpty() *Builder {
+	if b.hasError() {
+		return b
+	}
+
+	b.ignoreEmpty = true
+	return b
+}
+
+// RequireAtLeastOneOf makes Build fail with a *NoSourceError unless one of the
+// given sources merged at least one key, e.g. to catch a missing configuration
+// mount. Sources are given by their kinds, their names or the first words of
+// their names, such as "file", "env", "file /etc/app.conf" or
+// "environment APP_". The kind "file" stands for files of any format, also
+// those of a fs.FS and directories merged by MergeKeyPerFile, and "env" for
+// environment variables.
+func (b *Builder) RequireAtLeastOneOf(sources ...string) *Builder {
+	if b.hasError() {
+		return b
+	}
+
+	b.requiredSources = append(b.requiredSources, sources)
+	return b
+}
+
+func (b *Builder) checkRequiredSources() error {
+	for _, group := range b.requiredSources {
+		found := false
+		for _, source := range b.sources {
+			for _, name := range group {
+				if source.keys > 0 && (source.name == name || strings.HasPrefix(source.name, name+` `) || sourceKind(source.name) == name) {
+					found = true
+				}
+			}
+		}
+
+		if !found {
+			return &NoSourceError{Sources: group}
+		}
+	}
+
+	return nil
+}
+
+// Returns the kind of the source named name for RequireAtLeastOneOf, file or
+// env, or nothing for other sources. Names of files start with their format,
+// e.g. "yaml file app.yaml" or "toml fs file app.toml".
+func sourceKind(name string) string {
+	words := strings.Fields(name)
+	if len(words) > 3 {
+		words = words[:3]
+	}
+
+	for _, word := range words {
+		switch word {
+		case `file`, `directory`:
+			return `file`
+		case `environment`:
+			return `env`
+		}
+	}
+
+	return ``
+}
+
+// Extends declares that the configuration extends a base schema, e.g. the
+// Describe output published by a closely related service. Keys of the schema
+// that aren't fields of the target are known, take their defaults, and make
+// Build fail with a *MissingKeysError if they are required and the sources
+// don't give them values, so that the sources cover both configurations. Keys
+// that are fields must have the type of the schema. Use ExtendSchema to
+// publish the union for services extending this one in turn.
+func (b *Builder) Extends(base []FieldDoc) *Builder {
+	if b.hasError() {
+		return b
+	}
+
+	b.extends = append(b.extends, base...)
+	return b
+}
+
+// Returns the keys of the extended schemas that aren't fields of the target.
+func (b *Builder) extendedKeys(knownFields map[string]configField, keys KeyStrategy) (map[string]FieldDoc, error) {
+	extended := map[string]FieldDoc{}
+	for _, doc := range b.extends {
+		key := keys.Normalize(doc.Key)
+
+		if field, ok := knownFields[key]; ok {
+			if t := field.value.Type().String(); t != doc.Type {
+				return nil, fmt.Errorf("configuration key \"%s\": type %s doesn't match type %s of the extended schema", key, t, doc.Type)
+			}
+
+			continue
+		}
+
+		extended[key] = doc
+	}
+
+	return extended, nil
+}
+
+// WithValidator sets the validator run against the target after values are
+// unmarshaled. Targets aren't validated by default; package
+// validatorsupport adapts a go-playground validator, which checks validate
+// tags. Errors listing fields are returned as *ValidationError.
+func (b *Builder) WithValidator(v Validator) *Builder {
 	if b.hasError() {
 		return b
 	}
@@ -48,152 +275,487 @@ func (b *Builder) WithValidator(v *validator.Validate) *Builder {
 	return b
 }
 
+// Build unmarshals the merged values into target, which must be a pointer to a
+// struct. Build doesn't modify the builder, so it may be called again with
+// other targets, e.g. for components that each take their part of a shared
+// configuration. Only keys of the target must have values.
+//
+// Values merged for KEY@TIME, where TIME is an RFC 3339 time, optionally
+// without seconds, or a date, are scheduled: once TIME has passed, they replace
+// the value of KEY, e.g. KEY@2025-07-01T00:00Z=new. Until then, the report
+// lists TIME as the expiry time of KEY, so that App reloads the configuration
+// when the value changes.
+//
+// Bool fields tagged presence:"true" are true if their keys are given with any
+// value, even an empty one or false, and false otherwise, like the feature
+// toggles of many container images.
+//
+// Fields tagged config:"NAME" have the key NAME, as it is, instead of a key
+// derived from their names, e.g. config:"DB_HOST". For struct fields, NAME is
+// the prefix of the keys of their fields. Fields tagged config:"-" are
+// skipped. Fields tagged config:",optional", or config:"NAME,optional", may
+// have no values without a default. Build leaves such fields as they are, i.e.
+// at their zero values in new structs.
 func (b *Builder) Build(target interface{}) error {
+	_, err := b.build(target)
+	return err
+}
+
+// BuildReport is like Build, but also returns the report of the build, e.g. to
+// look up resolved values of keys that aren't fields of target.
+func (b *Builder) BuildReport(target interface{}) (*Report, error) {
+	return b.build(target)
+}
+
+// BuildPrefix is like Build, but unmarshals the keys under prefix into target,
+// as if it was a field of a configuration struct at that path. Keys outside of
+// prefix may be missing, and aren't reported as unknown in Strict mode.
+func (b *Builder) BuildPrefix(prefix string, target interface{}) error {
 	if err := validateIsPointerToStruct(target); err != nil {
 		return err
 	}
 
-	if b.hasError() {
-		return b.err
+	t, err := prefixType(reflect.TypeOf(target).Elem(), prefix)
+	if err != nil {
+		return err
 	}
 
-	values := Map{}
-	knownFields := map[string]reflect.Value{}
+	v := reflect.New(t)
+	if _, err := b.buildUnder(v.Interface(), []string{prefix}); err != nil {
+		return err
+	}
 
-	// walk fields
-	if err := walkStruct(
-		target,
-		func(path []string, f reflect.StructField, v reflect.Value) (bool, error) {
-			if !v.CanSet() {
-				return false, nil
-			}
+	v = v.Elem()
+	for v.Type() != reflect.TypeOf(target).Elem() {
+		v = v.Field(0)
+	}
 
-			if tag, ok := f.Tag.Lookup(_configTag); ok && tag != `` {
-				if tag == `-` {
-					return false, nil
-				}
+	reflect.ValueOf(target).Elem().Set(v)
+	return nil
+}
 
-				path = append(path[:len(path)-1], normalizeKey(tag))
-			}
+// prefix of the keys shared by the commands of BuildCommand
+const _globalPrefix = `GLOBAL`
+
+// BuildCommand builds the configuration of a sub-command of a CLI: the keys
+// under the prefix of command are unmarshaled into target, and those under
+// GLOBAL, shared by all commands, into global, which may be nil. Both are
+// built together, so that errors list all missing keys, e.g. for a serve
+// command:
+//
+//	GLOBAL__LOG_LEVEL=debug
+//	SERVE__PORT=8080
+//	MIGRATE__DIR=migrations
+//
+// Keys of other commands may be missing, and aren't reported as unknown in
+// Strict mode.
+func (b *Builder) BuildCommand(command string, global, target interface{}) error {
+	if err := validateIsPointerToStruct(target); err != nil {
+		return err
+	}
 
-			key := structKey(path)
+	if normalizeKey(command) == _globalPrefix {
+		return fmt.Errorf("invalid command %s", command)
+	}
 
-			if canUnmarshalDirectly(v) {
-				knownFields[key] = v
+	commandType, err := prefixType(reflect.TypeOf(target).Elem(), command)
+	if err != nil {
+		return err
+	}
 
-				if tag, ok := f.Tag.Lookup(_defaultTag); ok {
-					values.Set(key, tag)
-				}
-			}
+	fields := []reflect.StructField{commandType.Field(0)}
 
-			return true, nil
-		},
-	); err != nil {
+	if global != nil {
+		if err := validateIsPointerToStruct(global); err != nil {
+			return err
+		}
+
+		globalType, err := prefixType(reflect.TypeOf(global).Elem(), _globalPrefix)
+		if err != nil {
+			return err
+		}
+
+		fields = append(fields, globalType.Field(0))
+	}
+
+	v := reflect.New(reflect.StructOf(fields))
+	if _, err := b.buildUnder(v.Interface(), []string{command, _globalPrefix}); err != nil {
 		return err
 	}
 
-	// walk structs
-	if err := walkStruct(
-		target,
-		func(path []string, f reflect.StructField, v reflect.Value) (bool, error) {
-			if !v.CanSet() {
-				return false, nil
+	v = v.Elem()
+	if global != nil {
+		reflect.ValueOf(global).Elem().Set(v.Field(1))
+	}
+
+	v = v.Field(0)
+	for v.Type() != reflect.TypeOf(target).Elem() {
+		v = v.Field(0)
+	}
+
+	reflect.ValueOf(target).Elem().Set(v)
+	return nil
+}
+
+// Returns true if key is under one of prefixes, or if there are none.
+func underPrefixes(key string, prefixes []string, keys KeyStrategy) bool {
+	if len(prefixes) == 0 {
+		return true
+	}
+
+	for _, prefix := range prefixes {
+		prefix = normalizeKey(keys.Normalize(prefix))
+		if key == prefix || strings.HasPrefix(key, prefix+_separator) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// Returns a struct type holding t at the path of prefix.
+func prefixType(t reflect.Type, prefix string) (reflect.Type, error) {
+	parts := strings.Split(normalizeKey(prefix), _separator)
+	for i := len(parts) - 1; i >= 0; i-- {
+		name := ``
+		for _, word := range strings.Split(parts[i], `_`) {
+			if word != `` {
+				name += word[:1] + strings.ToLower(word[1:])
 			}
+		}
 
-			if tag, ok := f.Tag.Lookup(_configTag); ok && tag != `` {
-				if tag == `-` {
-					return false, nil
-				}
+		if name == `` || name[0] < 'A' || name[0] > 'Z' {
+			return nil, fmt.Errorf("invalid prefix %s", prefix)
+		}
+
+		t = reflect.StructOf([]reflect.StructField{{Name: name, Type: t}})
+	}
+
+	return t, nil
+}
+
+// DryRun loads and resolves the configuration for target without modifying
+// it. The returned report describes what Build would have produced.
+func (b *Builder) DryRun(target interface{}) (*Report, error) {
+	if err := validateIsPointerToStruct(target); err != nil {
+		return nil, err
+	}
+
+	return b.build(reflect.New(reflect.TypeOf(target).Elem()).Interface())
+}
+
+func (b *Builder) build(target interface{}) (*Report, error) {
+	return b.buildUnder(target, nil)
+}
+
+// Like build, but in Strict mode only keys under prefixes, if any, are
+// reported as unknown.
+func (b *Builder) buildUnder(target interface{}, prefixes []string) (*Report, error) {
+	if err := validateIsPointerToStruct(target); err != nil {
+		return nil, err
+	}
+
+	if err := b.Error(); err != nil {
+		return nil, err
+	}
+
+	if err := b.checkRequiredSources(); err != nil {
+		return nil, err
+	}
+
+	report := &Report{}
+
+	for _, err := range b.warnings {
+		report.Warnings = append(report.Warnings, err.Error())
+	}
+
+	for _, source := range b.sources {
+		report.Sources = append(report.Sources, source.name)
+	}
+
+	for _, filename := range b.files {
+		if !containsString(report.Files, filename) {
+			report.Files = append(report.Files, filename)
+		}
+	}
+
+	if len(b.layers) > 0 {
+		report.Layers = make(map[string]string, len(b.layers))
+		for name, layer := range b.layers {
+			report.Layers[name] = layer
+		}
+	}
+
+	keys := b.keyStrategy()
+
+	knownFields, err := configFields(target, true, keys)
+	if err != nil {
+		return nil, err
+	}
+
+	values, structKeys, err := defaultValues(target, knownFields, keys)
+	if err != nil {
+		return nil, err
+	}
+
+	extended, err := b.extendedKeys(knownFields, keys)
+	if err != nil {
+		return nil, err
+	}
+
+	for key, doc := range extended {
+		if _, ok := values.Lookup(key); !ok && doc.HasDefault {
+			values.Set(key, doc.Default)
+		}
+	}
+
+	given := make(Map, len(b.values))
+	for k, v := range b.values {
+		given.Set(keys.Normalize(k), v)
+	}
+
+	given, activations, err := applySchedule(given, time.Now())
+	if err != nil {
+		return nil, err
+	}
 
-				path1 := make([]string, len(path))
-				copy(path1, path)
-				path1[len(path1)-1] = normalizeKey(tag)
-				path = path1
+	explicit := Map{}
+
+	// struct values given as JSON objects are expanded into their fields, but
+	// fields set explicitly take precedence.
+	for _, key := range structKeys {
+		value, ok := given.Lookup(key)
+		if !ok || !isJSONObject(value) {
+			continue
+		}
+
+		m := Map{}
+		if err := flattenJSON(key, []byte(value), m, keys); err != nil {
+			return nil, wrapError(err, "configuration key \"%s\"", key)
+		}
+
+		for k, v := range m {
+			explicit.Set(keys.Normalize(k), v)
+		}
+	}
+
+	explicit.Merge(given)
+
+	report.Expires = make(map[string]time.Time, len(b.expires))
+	for key, t := range b.expires {
+		report.Expires[key] = t
+	}
+
+	for key, t := range activations {
+		if expires, ok := report.Expires[key]; !ok || t.Before(expires) {
+			report.Expires[key] = t
+		}
+	}
+
+	report.Keys = make([]string, 0, len(knownFields))
+	report.Origins = make(map[string]Origin, len(knownFields))
+	report.Docs = make(map[string]FieldDoc, len(knownFields))
+	for key, field := range knownFields {
+		report.Keys = append(report.Keys, key)
+		report.Docs[key] = fieldDoc(key, field, values)
+
+		if _, ok := explicit.Lookup(key); ok {
+			report.Origins[key] = OriginSet
+		} else if _, ok := values.Lookup(key); ok {
+			report.Origins[key] = OriginDefault
+		}
+	}
+	sort.Strings(report.Keys)
+
+	// keys only given to be referenced by other values aren't unknown
+	referenced := map[string]bool{}
+	for _, m := range []Map{given, values} {
+		for _, value := range m {
+			refs, _ := parseReferences(value)
+			for _, ref := range refs {
+				referenced[normalizeKey(keys.Normalize(ref))] = true
 			}
+		}
+	}
 
-			key := structKey(path)
+	unknownKeys := []string{}
+	for key := range given {
+		if _, ok := extended[key]; ok || referenced[key] {
+			continue
+		}
 
-			if v.Type().Implements(_defaultConfigType) {
-				if m1 := v.Interface().(DefaultConfig).DefaultConfig(); m1 != nil {
-					m2 := make(Map, len(m1))
-					for k, v := range m1 {
-						if key != "" {
-							k = key + _separator + k
-						}
-						m2[k] = v
-					}
+		if _, ok := knownFields[key]; !ok && !containsString(structKeys, key) {
+			unknownKeys = append(unknownKeys, key)
+		}
+	}
+	sort.Strings(unknownKeys)
 
-					values.Merge(m2)
-				}
+	if b.strict {
+		strictKeys := []string{}
+		for _, key := range unknownKeys {
+			if underPrefixes(key, prefixes, keys) {
+				strictKeys = append(strictKeys, key)
 			}
+		}
 
-			return true, nil
-		},
-	); err != nil {
-		return err
+		if len(strictKeys) > 0 {
+			return report, &UnknownKeysError{
+				Keys:        strictKeys,
+				Suggestions: suggestKeys(strictKeys, report.Keys),
+			}
+		}
+	}
+
+	values.Merge(explicit)
+
+	// fields tagged presence:"true" are true if their keys are given, with any
+	// value, and false otherwise. Absent keys get no value, as any value, even
+	// false, would make them present when the values are merged again, e.g. by
+	// Derive or from a lockfile.
+	absent := map[string]bool{}
+	for key, field := range knownFields {
+		if field.field.Tag.Get(_presenceTag) != `true` {
+			continue
+		}
+
+		if field.value.Kind() != reflect.Bool {
+			return report, fmt.Errorf("configuration key \"%s\": presence tag on %s field", key, field.value.Type())
+		}
+
+		if _, ok := explicit.Lookup(key); ok {
+			values.Set(key, `true`)
+			continue
+		}
+
+		if value, ok := values.Lookup(key); ok {
+			if present, err := strconv.ParseBool(value); err != nil || present {
+				continue
+			}
+
+			delete(values, normalizeKey(key))
+		}
+
+		field.value.SetBool(false)
+		absent[key] = true
+		report.Origins[key] = OriginDefault
+	}
+
+	b.applyOverrides(values, report)
+
+	for _, key := range report.Keys {
+		if _, ok := values.Lookup(key); ok || absent[key] {
+			continue
+		}
+
+		if value, ok := b.lookupMissing(key, knownFields[key].field); ok {
+			values.Set(key, value)
+			report.Origins[key] = OriginMissing
+		}
 	}
 
-	values.Merge(b.values)
+	if err := resolveValueMap(values); err != nil {
+		return report, wrapError(err, "resolve values")
+	}
+
+	if err := expandNamedFiles(values, knownFields); err != nil {
+		return report, wrapError(err, "resolve values")
+	}
+
+	for _, f := range b.transform {
+		if err := f(values); err != nil {
+			return report, wrapError(err, "transform values")
+		}
+	}
+
+	if err := b.checkPolicies(values); err != nil {
+		return report, err
+	}
 
 	{
 		missingKeys := []string{}
-		for key := range knownFields {
+		for _, key := range report.Keys {
 			if _, ok := values.Lookup(key); !ok {
+				if knownFields[key].optional() || absent[key] {
+					continue
+				}
+
+				missingKeys = append(missingKeys, key)
+			} else if _, ok := report.Origins[key]; !ok {
+				report.Origins[key] = OriginTransform
+			}
+		}
+
+		for key, doc := range extended {
+			if _, ok := values.Lookup(key); !ok && doc.Required {
 				missingKeys = append(missingKeys, key)
 			}
 		}
 		sort.Strings(missingKeys)
 
 		if len(missingKeys) > 0 {
-			plural := ""
-			if len(missingKeys) > 1 {
-				plural = "s"
+			return report, &MissingKeysError{
+				Keys:        missingKeys,
+				Suggestions: suggestKeys(missingKeys, unknownKeys),
 			}
-
-			return fmt.Errorf(
-				"missing %d configuration key%s: %s",
-				len(missingKeys), plural,
-				strings.Join(missingKeys, ", "))
 		}
 	}
 
-	if err := resolveValueMap(values); err != nil {
-		return wrapError(err, "resolve values")
-	}
+	report.Values = values
 
-	for key, field := range knownFields {
-		if err := values.Unmarshal(key, field.Addr().Interface()); err != nil {
-			return wrapError(err, "unmarshal value")
+	// keys of optional fields may have no values, which leave the fields as
+	// they are
+	present := make([]string, 0, len(report.Keys))
+	for _, key := range report.Keys {
+		if _, ok := values.Lookup(key); ok {
+			present = append(present, key)
 		}
 	}
 
-	if err := b.Validator().Struct(target); err != nil {
-		if errs, ok := err.(validator.ValidationErrors); ok {
-			keys := make([]string, 0, len(errs))
+	for _, key := range present {
+		field := knownFields[key]
 
-			for _, err := range errs {
-				var key string
+		if tag, ok := field.field.Tag.Lookup(_transformTag); ok {
+			value, err := transformValue(values.Get(key), tag)
+			if err != nil {
+				return report, wrapError(err, "configuration key \"%s\"", key)
+			}
 
-				if ns := strings.SplitN(err.StructNamespace(), ".", 2); len(ns) == 2 {
-					key = ns[1]
-				} else {
-					key = ns[0]
-				}
+			values.Set(key, value)
+		}
 
-				key = stringReplaceAll(key, `.`, _separator)
-				key = normalizeKey(key)
-				keys = append(keys, key)
+		if b.localeNumbers && isNumberType(field.value.Type()) {
+			values.Set(key, normalizeLocaleNumber(values.Get(key), isFloatType(field.value.Type())))
+		}
+
+		if tag, ok := field.field.Tag.Lookup(_unitTag); ok {
+			value, err := convertUnit(values.Get(key), tag, isFloatType(field.value.Type()))
+			if err != nil {
+				return report, wrapError(err, "configuration key \"%s\"", key)
 			}
 
-			sort.Strings(keys)
+			values.Set(key, value)
+		}
 
-			return fmt.Errorf(`validation failed: %s`, strings.Join(keys, `, `))
+		if b.workers > 1 {
+			continue
 		}
 
-		return err
+		if err := values.unmarshalKey(key, field.value.Addr().Interface(), b.largeFiles); err != nil {
+			return report, &UnmarshalError{Key: key, Err: err}
+		}
 	}
 
-	return nil
+	if b.workers > 1 {
+		if err := unmarshalParallel(values, present, knownFields, b.largeFiles, b.workers); err != nil {
+			return report, err
+		}
+	}
+
+	if err := b.validateTarget(target); err != nil {
+		return report, err
+	}
+
+	return report, nil
 }
 
 func (b *Builder) MustBuild(v interface{}) {
@@ -203,111 +765,274 @@ func (b *Builder) MustBuild(v interface{}) {
 }
 
 func (b *Builder) MergeFile(filename string) *Builder {
+	return b.MergeSource(FileSource(filename))
+}
+
+// MergeDir merges the *.conf files of a directory of KEY=value lines in
+// lexical order, so that later files override earlier ones, e.g. snippets in
+// /etc/NAME/conf.d. Symlinks are followed, and hidden files are skipped. To
+// skip a missing directory, merge it within Optional.
+func (b *Builder) MergeDir(dir string) *Builder {
 	if b.hasError() {
 		return b
 	}
 
-	data, err := ioutil.ReadFile(filename)
+	// watched for snippets that are added or removed
+	b.files = append(b.files, dir)
+
+	infos, err := ioutil.ReadDir(dir)
 	if err != nil {
-		b.err = err
+		b.addSourceError(`dir `+dir, err)
 		return b
 	}
 
-	return b.MergeData(data)
+	for _, info := range infos {
+		name := info.Name()
+		if strings.HasPrefix(name, `.`) || filepath.Ext(name) != `.conf` {
+			continue
+		}
+
+		filename := filepath.Join(dir, name)
+
+		// follows symlinks, which conf.d snippets often are
+		info, err := os.Stat(filename)
+		if err != nil {
+			b.addSourceError(`file `+filename, err)
+			continue
+		}
+
+		if !info.Mode().IsRegular() {
+			continue
+		}
+
+		b.MergeFile(filename)
+	}
+
+	return b
 }
 
 func (b *Builder) MergeData(data []byte) *Builder {
+	return b.MergeSource(DataSource(data))
+}
+
+// MergeReader merges KEY=value lines read from r, like MergeData.
+func (b *Builder) MergeReader(r io.Reader) *Builder {
+	return b.MergeSource(ReaderSource(r, DataSource))
+}
+
+func (b *Builder) MergeEnviron(prefix string, env []string) *Builder {
+	return b.MergeSource(EnvironSource(prefix, env))
+}
+
+func (b *Builder) MergeMap(m Map) *Builder {
 	if b.hasError() {
 		return b
 	}
 
-	lines := bytes.Split(data, []byte("\n"))
-	m := make(Map, len(lines))
-
-	for i, line := range lines {
-		line := bytes.TrimSpace(line)
+	if b.values == nil {
+		b.values = Map{}
+	}
 
-		switch {
-		case len(line) == 0:
-			continue
-		case line[0] == '#':
+	for k, v := range m {
+		if v == `` && b.ignoreEmpty {
 			continue
 		}
 
-		kvp := bytes.SplitN(line, []byte("="), 2)
-
-		key := string(bytes.TrimSpace(kvp[0]))
-		if len(key) == 0 {
-			b.err = fmt.Errorf(`invalid empty key on line %d`, i+1)
+		v, err := b.storeValue(k, v)
+		if err != nil {
+			b.err = wrapError(err, "store value of key %s", k)
 			return b
 		}
 
-		if len(kvp) == 1 {
-			m[key] = ``
-		} else {
-			m[key] = string(bytes.TrimSpace(kvp[1]))
-		}
+		b.values[k] = v
+		delete(b.expires, normalizeKey(k))
 	}
 
-	return b.MergeMap(m)
+	return b
 }
 
-func (b *Builder) MergeEnviron(prefix string, env []string) *Builder {
+// MergeBuilder merges the values of other, as if its sources were merged at
+// this point, and adds its callbacks, transforms and policies. The validator
+// and key strategy of other, if set, replace those of b. If other failed, b
+// fails with its error, and errors of its sources are added to those of b.
+func (b *Builder) MergeBuilder(other *Builder) *Builder {
 	if b.hasError() {
 		return b
 	}
 
-	m := make(Map)
+	if other.hasError() {
+		b.err = other.err
+		return b
+	}
 
-	for _, x := range env {
-		kvp := strings.SplitN(x, "=", 2)
-		key := kvp[0]
+	b.sourceErrs = append(b.sourceErrs, other.sourceErrs...)
 
-		if !strings.HasPrefix(key, prefix) {
-			continue
+	b.warnings = append(b.warnings, other.warnings...)
+	b.MergeMap(other.values)
+
+	for key, filename := range other.largeFiles {
+		if b.largeFiles == nil {
+			b.largeFiles = map[string]string{}
 		}
+		b.largeFiles[key] = filename
+	}
 
-		key = strings.TrimPrefix(key, prefix)
+	for key, t := range other.expires {
+		b.Expire(t, key)
+	}
 
-		if len(kvp) == 1 {
-			m[key] = ""
-		} else {
-			m[key] = kvp[1]
+	for name, layer := range other.layers {
+		if b.layers == nil {
+			b.layers = map[string]string{}
 		}
+		b.layers[name] = layer
 	}
 
-	return b.MergeMap(m)
+	b.sources = append(b.sources, other.sources...)
+	b.files = append(b.files, other.files...)
+	b.overrides = append(b.overrides, other.overrides...)
+	b.onMissing = append(b.onMissing, other.onMissing...)
+	b.transform = append(b.transform, other.transform...)
+	b.policies = append(b.policies, other.policies...)
+	b.requiredSources = append(b.requiredSources, other.requiredSources...)
+	b.extends = append(b.extends, other.extends...)
+	b.localeNumbers = b.localeNumbers || other.localeNumbers
+	b.strict = b.strict || other.strict
+
+	if other.workers > b.workers {
+		b.workers = other.workers
+	}
+
+	if other.validate != nil {
+		b.validate = other.validate
+	}
+
+	if other.keys != nil {
+		b.keys = other.keys
+	}
+
+	return b
 }
 
-func (b *Builder) MergeMap(m Map) *Builder {
-	if b.hasError() {
-		return b
+// Clone returns a copy of the builder that can be modified without affecting b,
+// e.g. to derive the configuration of a test from a shared base. Sources,
+// callbacks and the validator are shared, not copied.
+func (b *Builder) Clone() *Builder {
+	c := *b
+
+	c.sourceErrs = append(SourceErrors(nil), b.sourceErrs...)
+	c.onMissing = append([]func(string, reflect.StructField) (string, bool)(nil), b.onMissing...)
+	c.transform = append([]func(Map) error(nil), b.transform...)
+	c.policies = append([]Policy(nil), b.policies...)
+	c.requiredSources = append([][]string(nil), b.requiredSources...)
+	c.extends = append([]FieldDoc(nil), b.extends...)
+	c.warnings = append([]error(nil), b.warnings...)
+	c.overrides = append([]override(nil), b.overrides...)
+	c.sources = append([]sourceTiming(nil), b.sources...)
+	c.files = append([]string(nil), b.files...)
+
+	if b.values != nil {
+		c.values = make(Map, len(b.values))
+		for k, v := range b.values {
+			c.values[k] = v
+		}
 	}
 
-	if b.values == nil {
-		b.values = Map{}
+	if b.expires != nil {
+		c.expires = make(map[string]time.Time, len(b.expires))
+		for k, t := range b.expires {
+			c.expires[k] = t
+		}
 	}
 
-	for k, v := range m {
-		b.values[k] = v
+	if b.largeFiles != nil {
+		c.largeFiles = make(map[string]string, len(b.largeFiles))
+		for k, f := range b.largeFiles {
+			c.largeFiles[k] = f
+		}
 	}
 
-	return b
+	if b.layers != nil {
+		c.layers = make(map[string]string, len(b.layers))
+		for k, v := range b.layers {
+			c.layers[k] = v
+		}
+	}
+
+	return &c
 }
 
-func (b *Builder) MapValidator(f func(v *validator.Validate)) *Builder {
+// Expire marks the merged values of keys as expiring at t, e.g. because they
+// come from a lease. Expiry times are reported by Build until a new value is
+// merged for the key.
+func (b *Builder) Expire(t time.Time, keys ...string) *Builder {
 	if b.hasError() {
 		return b
 	}
 
-	f(b.validate)
+	if b.expires == nil {
+		b.expires = map[string]time.Time{}
+	}
+
+	for _, key := range keys {
+		b.expires[normalizeKey(key)] = t
+	}
+
 	return b
 }
 
-func (b *Builder) Validator() *validator.Validate {
-	if b.validate == nil {
-		return validator.New()
+// Returns the default values of target from default tags and DefaultConfig
+// implementations, along with the keys of its struct fields.
+func defaultValues(target interface{}, knownFields map[string]configField, keys KeyStrategy) (Map, []string, error) {
+	values := Map{}
+
+	for key, field := range knownFields {
+		if tag, ok := field.field.Tag.Lookup(_defaultTag); ok {
+			values.Set(key, tag)
+		}
+	}
+
+	structKeys := []string{}
+	fieldKeys := newFieldKeys(keys)
+
+	// walk structs
+	if err := walkStruct(
+		target,
+		func(path []string, f reflect.StructField, v reflect.Value) (bool, error) {
+			if !v.CanSet() {
+				return false, nil
+			}
+
+			name, _, _ := parseConfigTag(f.Tag.Get(_configTag))
+			if name == `-` {
+				return false, nil
+			}
+
+			key := fieldKeys.key(path, f, name)
+
+			if key != "" && !canUnmarshalDirectly(v) {
+				structKeys = append(structKeys, key)
+			}
+
+			if v.Type().Implements(_defaultConfigType) {
+				if m1 := v.Interface().(DefaultConfig).DefaultConfig(); m1 != nil {
+					m2 := make(Map, len(m1))
+					for k, v := range m1 {
+						if key != "" {
+							k = keys.Join(key, k)
+						}
+						m2[k] = v
+					}
+
+					values.Merge(m2)
+				}
+			}
+
+			return true, nil
+		},
+	); err != nil {
+		return nil, nil, err
 	}
 
-	return b.validate
+	return values, structKeys, nil
 }
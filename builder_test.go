@@ -1,7 +1,29 @@
 package readconf_test
 
 import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/gob"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"reflect"
+	"runtime"
+	"strconv"
+	"strings"
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/require"
 
@@ -12,6 +34,43 @@ func b() *readconf.Builder {
 	return readconf.NewBuilder()
 }
 
+// A format registered like the YAML format of package yamlsupport, whose
+// module the tests of the package don't depend on.
+func init() {
+	readconf.RegisterFormat(readconf.FileFormat{
+		Name:       `colon`,
+		Extensions: []string{`.colon`},
+		MediaTypes: []string{`text/x-colon`},
+		Parse:      parseColon,
+		Marshal:    json.Marshal,
+	})
+}
+
+func parseColon(data []byte) readconf.Source {
+	return colonSource(data)
+}
+
+// Parses "key: value" lines.
+type colonSource []byte
+
+func (s colonSource) Load(ctx context.Context) (readconf.Map, error) {
+	m := readconf.Map{}
+	for _, line := range strings.Split(strings.TrimSpace(string(s)), "\n") {
+		parts := strings.SplitN(line, `:`, 2)
+		if len(parts) != 2 {
+			return nil, fmt.Errorf("expected key: value, got %q", line)
+		}
+
+		m.Set(strings.TrimSpace(parts[0]), strings.TrimSpace(parts[1]))
+	}
+
+	return m, nil
+}
+
+func (s colonSource) String() string {
+	return `colon`
+}
+
 func TestBuilder_ExpectStructPointer(t *testing.T) {
 	t.Run("nil target", func(t *testing.T) {
 		err := b().Build(nil)
@@ -132,6 +191,52 @@ type validationFailureConf struct {
 	Bar string `default:"a" validate:"min=2"`
 }
 
+// Checks the min and max rules of validate tags, of the lengths of strings and
+// the values of ints, as the tests of the package can't use the go-playground
+// validator of package validatorsupport.
+var limits = readconf.ValidatorFunc(func(s interface{}) error {
+	var fields []readconf.ValidationField
+	checkLimits(reflect.ValueOf(s).Elem(), ``, &fields)
+
+	if len(fields) > 0 {
+		return &readconf.ValidationError{Fields: fields}
+	}
+
+	return nil
+})
+
+func checkLimits(v reflect.Value, prefix string, fields *[]readconf.ValidationField) {
+	for i := 0; i < v.NumField(); i++ {
+		f, fv := v.Type().Field(i), v.Field(i)
+
+		if fv.Kind() == reflect.Struct {
+			checkLimits(fv, prefix+f.Name+`.`, fields)
+			continue
+		}
+
+		for _, rule := range strings.Split(f.Tag.Get(`validate`), `,`) {
+			parts := strings.SplitN(rule, `=`, 2)
+			if len(parts) != 2 {
+				continue
+			}
+
+			limit, _ := strconv.ParseInt(parts[1], 10, 64)
+
+			var n int64
+			switch fv.Kind() {
+			case reflect.String:
+				n = int64(fv.Len())
+			case reflect.Int, reflect.Int64:
+				n = fv.Int()
+			}
+
+			if parts[0] == `min` && n < limit || parts[0] == `max` && n > limit {
+				*fields = append(*fields, readconf.ValidationField{Key: prefix + f.Name, Rule: parts[0], Param: parts[1]})
+			}
+		}
+	}
+}
+
 func TestBuilder_Build(t *testing.T) {
 	t.Run("all defaults provided", func(t *testing.T) {
 		var conf configWithAllDefaults
@@ -224,16 +329,22 @@ func TestBuilder_Build(t *testing.T) {
 				Foo string `default:"aaa" validate:"min=2"`
 			}
 
-			err := b().Build(&conf)
+			err := b().WithValidator(limits).Build(&conf)
 			require.NoError(t, err)
 			require.Equal(t, `aaa`, conf.Foo)
 		})
 
 		t.Run("failure", func(t *testing.T) {
 			var conf validationFailureConf
-			err := b().Build(&conf)
+			err := b().WithValidator(limits).Build(&conf)
 			require.EqualError(t, err, "validation failed: BAR, FOO")
 		})
+
+		t.Run("none", func(t *testing.T) {
+			var conf validationFailureConf
+			require.NoError(t, b().Build(&conf))
+			require.Equal(t, `a`, conf.Foo)
+		})
 	})
 
 	t.Run("name override", func(t *testing.T) {
@@ -271,6 +382,48 @@ func TestBuilder_Build(t *testing.T) {
 			require.Equal(t, `bah`, conf.Bar)
 			require.Equal(t, `bax`, conf.Nested.Bax)
 		})
+
+		t.Run("keys", func(t *testing.T) {
+			type config struct {
+				Host   string `config:"DB_HOST"`
+				Key    string `config:"api_key"`
+				Ignore string `config:"-"`
+				Cache  struct {
+					TTL     time.Duration `config:"CACHE_TTL_SECONDS"`
+					MaxSize int
+				} `config:"MEMCACHE"`
+			}
+
+			docs, err := readconf.Describe(&config{})
+			require.NoError(t, err)
+
+			keys := []string{}
+			for _, doc := range docs {
+				keys = append(keys, doc.Key)
+			}
+			require.Equal(t, []string{`API_KEY`, `DB_HOST`, `MEMCACHE__CACHE_TTL_SECONDS`, `MEMCACHE__MAX_SIZE`}, keys)
+
+			conf := config{Ignore: `kept`}
+			require.NoError(t, b().
+				Strict().
+				MergeEnviron(`APP_`, []string{
+					`APP_DB_HOST=db`,
+					`APP_API_KEY=secret`,
+					`APP_MEMCACHE__CACHE_TTL_SECONDS=1m`,
+					`APP_MEMCACHE__MAX_SIZE=10`,
+				}).
+				Build(&conf))
+			require.Equal(t, `db`, conf.Host)
+			require.Equal(t, `secret`, conf.Key)
+			require.Equal(t, `kept`, conf.Ignore)
+			require.Equal(t, time.Minute, conf.Cache.TTL)
+			require.Equal(t, 10, conf.Cache.MaxSize)
+
+			err = b().Strict().Set(`DB_HOST`, `db`).Set(`API_KEY`, `x`).Set(`IGNORE`, `x`).
+				Set(`MEMCACHE__CACHE_TTL_SECONDS`, `1s`).Set(`MEMCACHE__MAX_SIZE`, `1`).
+				Build(&config{})
+			require.EqualError(t, err, `unknown 1 configuration key: IGNORE`)
+		})
 	})
 }
 
@@ -367,3 +520,2820 @@ func TestBuilder_MultipleRefs(t *testing.T) {
 	require.NoError(t, err)
 	require.Equal(t, `bax_bax`, conf.Baf)
 }
+
+func TestBuilder_DryRun(t *testing.T) {
+	t.Run("success", func(t *testing.T) {
+		var conf configWithPartialDefaults
+		report, err := b().
+			MergeMap(readconf.Map{
+				`FOO`:          `foofoo`,
+				`EMBEDDED_BAR`: `${BAR}9`,
+				`NESTED__FOO`:  `nested_foo`,
+			}).
+			DryRun(&conf)
+		require.NoError(t, err)
+		require.Empty(t, conf)
+		require.Equal(t, []string{
+			`BAR`, `EMBEDDED_BAR`, `EMBEDDED_FOO`, `FOO`, `NESTED__BAR`, `NESTED__FOO`,
+		}, report.Keys)
+		require.Equal(t, `19`, report.Values.Get(`EMBEDDED_BAR`))
+	})
+
+	t.Run("failure", func(t *testing.T) {
+		var conf validationFailureConf
+		report, err := b().WithValidator(limits).DryRun(&conf)
+		require.EqualError(t, err, "validation failed: BAR, FOO")
+		require.Empty(t, conf)
+		require.Equal(t, []string{`BAR`, `FOO`}, report.Keys)
+	})
+}
+
+func TestMarshal(t *testing.T) {
+	m, err := readconf.Marshal(&configWithAllDefaults{
+		Foo: "foo",
+		Bar: 1,
+		EmbeddedWithAllDefaults: EmbeddedWithAllDefaults{
+			EmbeddedFoo: "embedded",
+			EmbeddedBar: 2,
+		},
+		Nested: NestedWithAllDefaults{
+			Foo: "nested",
+			Bar: 3,
+		},
+	})
+	require.NoError(t, err)
+	require.Equal(t, readconf.Map{
+		`FOO`:          `foo`,
+		`BAR`:          `1`,
+		`EMBEDDED_FOO`: `embedded`,
+		`EMBEDDED_BAR`: `2`,
+		`NESTED__FOO`:  `nested`,
+		`NESTED__BAR`:  `3`,
+	}, m)
+}
+
+func TestMarshal_unsupported(t *testing.T) {
+	_, err := readconf.Marshal(&struct{ Reader io.Reader }{Reader: bytes.NewBufferString(`data`)})
+	require.EqualError(t, err, `configuration key "READER": can't read io.Reader of type *bytes.Buffer without consuming it`)
+
+	_, err = readconf.Marshal(&struct{ Values map[string]string }{})
+	require.EqualError(t, err, `configuration key "VALUES": unsupported type map[string]string`)
+}
+
+func TestBuilder_StructJSON(t *testing.T) {
+	type config struct {
+		Name   string
+		Limits struct {
+			CPU  int
+			Mem  string
+			Disk struct {
+				Size string `default:"10Gi"`
+			}
+		}
+	}
+
+	t.Run("expanded", func(t *testing.T) {
+		var conf config
+		err := b().
+			MergeEnviron(`APP__`, []string{
+				`APP__NAME={"not":"expanded"}`,
+				`APP__LIMITS={"cpu": 2, "mem": "1Gi", "disk": {"size": "${SIZE}"}}`,
+				`APP__SIZE=5Gi`,
+			}).
+			Build(&conf)
+		require.NoError(t, err)
+		require.Equal(t, `{"not":"expanded"}`, conf.Name)
+		require.Equal(t, 2, conf.Limits.CPU)
+		require.Equal(t, `1Gi`, conf.Limits.Mem)
+		require.Equal(t, `5Gi`, conf.Limits.Disk.Size)
+	})
+
+	t.Run("explicit keys take precedence", func(t *testing.T) {
+		var conf config
+		err := b().
+			Set(`NAME`, `name`).
+			Set(`LIMITS__MEM`, `2Gi`).
+			Set(`LIMITS`, `{"cpu": 2, "mem": "1Gi"}`).
+			Build(&conf)
+		require.NoError(t, err)
+		require.Equal(t, `2Gi`, conf.Limits.Mem)
+		require.Equal(t, `10Gi`, conf.Limits.Disk.Size)
+	})
+
+	t.Run("invalid", func(t *testing.T) {
+		var conf config
+		err := b().
+			Set(`NAME`, `name`).
+			Set(`LIMITS`, `{"cpu": 2,`).
+			Build(&conf)
+		require.EqualError(t, err, `configuration key "LIMITS": invalid JSON: unexpected EOF`)
+	})
+}
+
+func TestReport_Gob(t *testing.T) {
+	var conf configWithAllDefaults
+	report, err := b().Set(`FOO`, `foo`).DryRun(&conf)
+	require.NoError(t, err)
+
+	var buf bytes.Buffer
+	require.NoError(t, gob.NewEncoder(&buf).Encode(report))
+
+	var decoded readconf.Report
+	require.NoError(t, gob.NewDecoder(&buf).Decode(&decoded))
+	require.Equal(t, *report, decoded)
+
+	err = b().MergeMap(decoded.Values).Build(&conf)
+	require.NoError(t, err)
+	require.Equal(t, `foo`, conf.Foo)
+}
+
+func TestBuilder_MergeProvider(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("test provider is a shell script")
+	}
+
+	dir, err := filepath.Abs("testdata")
+	require.NoError(t, err)
+
+	path := os.Getenv("PATH")
+	defer os.Setenv("PATH", path)
+	require.NoError(t, os.Setenv("PATH", dir+string(os.PathListSeparator)+path))
+
+	t.Run("by name", func(t *testing.T) {
+		var conf struct {
+			Foo     string
+			Request string
+		}
+
+		err := b().MergeProvider(`test`, `foo`).Build(&conf)
+		require.NoError(t, err)
+		require.Equal(t, `foo`, conf.Foo)
+		require.JSONEq(t, `{"version": 1, "args": ["foo"]}`, conf.Request)
+	})
+
+	t.Run("by path", func(t *testing.T) {
+		var conf struct {
+			Foo string
+		}
+
+		err := b().MergeProvider(`./testdata/readconf-provider-test`, `bar`).Build(&conf)
+		require.NoError(t, err)
+		require.Equal(t, `bar`, conf.Foo)
+	})
+
+	t.Run("not found", func(t *testing.T) {
+		err := b().MergeProvider(`missing`).Error()
+		require.EqualError(t, err,
+			`provider missing: exec: "readconf-provider-missing": executable file not found in $PATH`)
+	})
+
+	t.Run("error response", func(t *testing.T) {
+		err := b().MergeProvider(`test`, `fail`).Error()
+		require.EqualError(t, err, `provider test: provider failed`)
+	})
+
+	t.Run("ttl", func(t *testing.T) {
+		var conf struct {
+			Foo string
+		}
+
+		before := time.Now()
+		report, err := b().MergeProvider(`test`, `lease`).DryRun(&conf)
+		require.NoError(t, err)
+		require.Equal(t, `leased`, report.Values.Get(`FOO`))
+		require.WithinDuration(t, before.Add(time.Minute), report.Expires[`FOO`], 5*time.Second)
+	})
+
+	t.Run("crash", func(t *testing.T) {
+		err := b().MergeProvider(`test`, `crash`).Error()
+		require.EqualError(t, err, `provider test: exit status 1: crashed`)
+	})
+
+	t.Run("unknown protocol", func(t *testing.T) {
+		err := b().MergeProvider(`test`, `future`).Error()
+		require.EqualError(t, err, `provider test: unsupported protocol version 2`)
+	})
+
+	t.Run("context", func(t *testing.T) {
+		ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+		defer cancel()
+
+		start := time.Now()
+		err := b().MergeSourceContext(ctx, readconf.ProviderSource(`test`, `hang`)).Error()
+		require.EqualError(t, err, `provider test: context deadline exceeded`)
+		require.True(t, time.Since(start) < 5*time.Second)
+	})
+}
+
+func TestBuilder_WithValidator(t *testing.T) {
+	t.Run("custom", func(t *testing.T) {
+		var conf validationFailureConf
+		var validated interface{}
+
+		err := b().
+			WithValidator(readconf.ValidatorFunc(func(s interface{}) error {
+				validated = s
+				return fmt.Errorf("custom failure")
+			})).
+			Build(&conf)
+		require.EqualError(t, err, `validation failed: custom failure`)
+		require.Same(t, &conf, validated)
+	})
+
+	t.Run("keys", func(t *testing.T) {
+		type Pool struct {
+			MaxConns int
+		}
+
+		var conf struct {
+			DB struct {
+				Pool
+				ReadTimeout time.Duration
+			}
+			Cache *struct {
+				MaxEntries int `config:"SIZE"`
+			}
+			Hosts []string
+		}
+
+		err := b().
+			MergeMap(readconf.Map{`DB__MAX_CONNS`: `1000`, `DB__READ_TIMEOUT`: `0s`, `CACHE__SIZE`: `0`, `HOSTS`: `[""]`}).
+			WithValidator(readconf.ValidatorFunc(func(s interface{}) error {
+				return &readconf.ValidationError{Fields: []readconf.ValidationField{
+					{Key: `DB.ReadTimeout`, Rule: `gt`, Param: `0`},
+					{Key: `DB.Pool.MaxConns`, Rule: `max`, Param: `100`},
+					{Key: `Hosts[0]`, Rule: `required`},
+					{Key: `Cache.MaxEntries`, Rule: `min`, Param: `1`},
+					{Key: `Unknown.Field`, Rule: `custom`},
+				}}
+			})).
+			Build(&conf)
+		require.IsType(t, &readconf.ValidationError{}, err)
+		require.Equal(t, []readconf.ValidationField{
+			{Key: `CACHE__SIZE`, Rule: `min`, Param: `1`},
+			{Key: `DB__MAX_CONNS`, Rule: `max`, Param: `100`},
+			{Key: `DB__READ_TIMEOUT`, Rule: `gt`, Param: `0`},
+			{Key: `HOSTS`, Rule: `required`},
+			{Key: `UNKNOWN__FIELD`, Rule: `custom`},
+		}, err.(*readconf.ValidationError).Fields)
+	})
+
+	t.Run("map", func(t *testing.T) {
+		var conf validationFailureConf
+
+		builder := b().MapValidator(func(v readconf.Validator) readconf.Validator {
+			require.Nil(t, v)
+			return limits
+		})
+		require.NotNil(t, builder.Validator())
+		require.EqualError(t, builder.Build(&conf), `validation failed: BAR, FOO`)
+	})
+}
+
+func TestBuilder_OnMissing(t *testing.T) {
+	var conf configWithPartialDefaults
+	var asked []string
+
+	err := b().
+		Set(`FOO`, `foo`).
+		OnMissing(func(key string, field reflect.StructField) (string, bool) {
+			asked = append(asked, key+`:`+field.Name)
+			if key == `EMBEDDED_BAR` {
+				return `${BAR}0`, true
+			}
+
+			return ``, false
+		}).
+		OnMissing(func(key string, field reflect.StructField) (string, bool) {
+			return `nested`, key == `NESTED__FOO`
+		}).
+		Build(&conf)
+	require.NoError(t, err)
+	require.Equal(t, []string{`EMBEDDED_BAR:EmbeddedBar`, `NESTED__FOO:Foo`}, asked)
+	require.Equal(t, 10, conf.EmbeddedBar)
+	require.Equal(t, `nested`, conf.Nested.Foo)
+
+	err = b().
+		OnMissing(func(key string, field reflect.StructField) (string, bool) {
+			return ``, false
+		}).
+		Build(&conf)
+	require.EqualError(t, err, `missing 3 configuration keys: EMBEDDED_BAR, FOO, NESTED__FOO`)
+}
+
+func TestBuilder_UnsupportedFields(t *testing.T) {
+	t.Run("empty interface", func(t *testing.T) {
+		var conf struct {
+			Foo interface{}
+		}
+
+		err := b().Set(`FOO`, `foo`).Build(&conf)
+		require.NoError(t, err)
+		require.Equal(t, `foo`, conf.Foo)
+	})
+
+	t.Run("non-empty interface", func(t *testing.T) {
+		var conf struct {
+			Foo fmt.Stringer
+		}
+
+		err := b().Set(`FOO`, `foo`).Build(&conf)
+		require.EqualError(t, err,
+			`unmarshal value: configuration key "FOO": unsupported type fmt.Stringer`)
+	})
+
+	t.Run("pointers", func(t *testing.T) {
+		var conf struct {
+			Foo    *int
+			Nested *struct {
+				Bar *string `default:"bar"`
+			}
+		}
+
+		err := b().Set(`FOO`, `1`).Build(&conf)
+		require.NoError(t, err)
+		require.Equal(t, 1, *conf.Foo)
+		require.Equal(t, `bar`, *conf.Nested.Bar)
+	})
+
+	t.Run("channel", func(t *testing.T) {
+		var conf struct {
+			Foo chan int
+		}
+
+		err := b().Set(`FOO`, `1`).Build(&conf)
+		require.EqualError(t, err,
+			`unmarshal value: configuration key "FOO": unsupported type chan int`)
+	})
+}
+
+type leafPoint struct {
+	X, Y int
+}
+
+func init() {
+	readconf.RegisterLeaf(leafPoint{}, func(s string) (interface{}, error) {
+		var p leafPoint
+		_, err := fmt.Sscanf(s, "%d,%d", &p.X, &p.Y)
+		return p, err
+	})
+}
+
+func (p *leafPoint) String() string {
+	return fmt.Sprintf("%d,%d", p.X, p.Y)
+}
+
+func TestBuilder_Leaves(t *testing.T) {
+	type config struct {
+		Time     time.Time
+		URL      url.URL
+		URLPtr   *url.URL
+		Duration time.Duration
+		Point    leafPoint
+	}
+
+	var conf config
+	err := b().
+		MergeMap(readconf.Map{
+			`TIME`:     `2020-01-02T03:04:05Z`,
+			`URL`:      `https://example.com/foo?bar=1`,
+			`URL_PTR`:  `https://example.com`,
+			`DURATION`: `1m30s`,
+			`POINT`:    `1,2`,
+		}).
+		Build(&conf)
+	require.NoError(t, err)
+	require.Equal(t, time.Date(2020, 1, 2, 3, 4, 5, 0, time.UTC), conf.Time)
+	require.Equal(t, `example.com`, conf.URL.Host)
+	require.Equal(t, `https://example.com`, conf.URLPtr.String())
+	require.Equal(t, 90*time.Second, conf.Duration)
+	require.Equal(t, leafPoint{1, 2}, conf.Point)
+
+	m, err := readconf.Marshal(&conf)
+	require.NoError(t, err)
+	require.Equal(t, readconf.Map{
+		`TIME`:     `2020-01-02T03:04:05Z`,
+		`URL`:      `https://example.com/foo?bar=1`,
+		`URL_PTR`:  `https://example.com`,
+		`DURATION`: `1m30s`,
+		`POINT`:    `1,2`,
+	}, m)
+
+	err = b().MergeMap(m).Set(`DURATION`, `1 hour`).Build(&conf)
+	require.EqualError(t, err,
+		`unmarshal value: configuration key "DURATION": time: unknown unit " hour" in duration "1 hour"`)
+}
+
+func TestBuilder_Slices(t *testing.T) {
+	type config struct {
+		Hosts     []string
+		Ports     []int
+		Timeouts  []time.Duration
+		Matrix    [][]int
+		Empty     []string
+		Data      []byte
+		Separated []string
+	}
+
+	var conf config
+	err := b().
+		MergeEnviron(`APP_`, []string{
+			`APP_HOSTS=["a.example.com", "b.example.com"]`,
+			`APP_PORTS=[80, 443]`,
+			`APP_TIMEOUTS=["1s", "2m"]`,
+			`APP_MATRIX=[[1, 2], [3]]`,
+			`APP_EMPTY=`,
+			`APP_DATA=data`,
+			`APP_SEPARATED=a, b,c`,
+		}).
+		Build(&conf)
+	require.NoError(t, err)
+	require.Equal(t, config{
+		Hosts:     []string{`a.example.com`, `b.example.com`},
+		Ports:     []int{80, 443},
+		Timeouts:  []time.Duration{time.Second, 2 * time.Minute},
+		Matrix:    [][]int{{1, 2}, {3}},
+		Empty:     []string{},
+		Data:      []byte(`data`),
+		Separated: []string{`a`, `b`, `c`},
+	}, conf)
+
+	m, err := readconf.Marshal(&conf)
+	require.NoError(t, err)
+	require.Equal(t, `["a.example.com","b.example.com"]`, m[`HOSTS`])
+	require.Equal(t, `["[\"1\",\"2\"]","[\"3\"]"]`, m[`MATRIX`])
+
+	var conf2 config
+	require.NoError(t, b().MergeMap(m).Build(&conf2))
+	require.Equal(t, conf, conf2)
+
+	err = b().MergeMap(m).Set(`PORTS`, `[80, "http"]`).Build(&conf2)
+	require.EqualError(t, err,
+		`unmarshal value: configuration key "PORTS": item 1: strconv.ParseInt: parsing "http": invalid syntax`)
+
+	err = b().MergeMap(m).Set(`PORTS`, `[80,`).Build(&conf2)
+	require.EqualError(t, err,
+		`unmarshal value: configuration key "PORTS": invalid JSON: unexpected EOF`)
+}
+
+func TestBuilder_AddTransform(t *testing.T) {
+	var conf struct {
+		Host string
+		Port int
+		Addr string
+	}
+
+	build := func(host string) error {
+		return b().
+			Set(`HOST`, host).
+			Set(`PORT`, `80`).
+			Set(`NAME`, `${HOST}`).
+			AddTransform(func(m readconf.Map) error {
+				m.Set(`HOST`, strings.ToLower(m.Get(`HOST`)))
+				return nil
+			}).
+			AddTransform(func(m readconf.Map) error {
+				m.Set(`ADDR`, m.Get(`HOST`)+`:`+m.Get(`PORT`))
+				return nil
+			}).
+			AddTransform(func(m readconf.Map) error {
+				if m.Get(`NAME`) == `localhost` {
+					return fmt.Errorf("localhost is not allowed")
+				}
+
+				return nil
+			}).
+			Build(&conf)
+	}
+
+	require.NoError(t, build(`Example.COM`))
+	require.Equal(t, `example.com`, conf.Host)
+	require.Equal(t, `example.com:80`, conf.Addr)
+
+	require.EqualError(t, build(`localhost`), `transform values: localhost is not allowed`)
+
+	report, err := b().
+		Set(`HOST`, `example.com`).
+		Set(`PORT`, `80`).
+		AddTransform(func(m readconf.Map) error {
+			m.Set(`ADDR`, m.Get(`HOST`))
+			return nil
+		}).
+		DryRun(&conf)
+	require.NoError(t, err)
+	require.Equal(t, readconf.OriginTransform, report.Origins[`ADDR`])
+}
+
+func TestBuilder_AddPolicy(t *testing.T) {
+	var conf struct {
+		Env   string
+		Debug bool
+		Port  int
+	}
+
+	noDebugInProd := readconf.PolicyFunc(func(m readconf.Map) ([]string, error) {
+		if m.Get(`ENV`) == `prod` && m.Get(`DEBUG`) == `true` {
+			return []string{`debug must be disabled in prod`}, nil
+		}
+
+		return nil, nil
+	})
+
+	privilegedPort := readconf.PolicyFunc(func(m readconf.Map) ([]string, error) {
+		if port, _ := strconv.Atoi(m.Get(`PORT`)); port < 1024 {
+			return []string{`port must not be privileged`}, nil
+		}
+
+		return nil, nil
+	})
+
+	build := func(env, debug, port string) error {
+		return b().
+			Set(`ENV`, env).
+			Set(`DEBUG`, debug).
+			Set(`PORT`, port).
+			AddPolicy(noDebugInProd).
+			AddPolicy(privilegedPort).
+			Build(&conf)
+	}
+
+	require.NoError(t, build(`dev`, `true`, `8080`))
+	require.NoError(t, build(`prod`, `false`, `8080`))
+
+	err := build(`prod`, `true`, `80`)
+	require.EqualError(t, err,
+		`2 policy violations: debug must be disabled in prod; port must not be privileged`)
+	require.IsType(t, &readconf.PolicyError{}, err)
+
+	err = b().
+		Set(`ENV`, `dev`).
+		Set(`DEBUG`, `true`).
+		Set(`PORT`, `8080`).
+		AddPolicy(readconf.PolicyFunc(func(m readconf.Map) ([]string, error) {
+			return nil, fmt.Errorf("policy unavailable")
+		})).
+		Build(&conf)
+	require.EqualError(t, err, `evaluate policy: policy unavailable`)
+}
+
+func TestBuilder_Tiers(t *testing.T) {
+	type config struct {
+		Foo    string `default:"default"`
+		Nested struct {
+			Bar int `default:"0"`
+		}
+	}
+
+	t.Run("optional", func(t *testing.T) {
+		var conf config
+		report, err := b().
+			Optional(func(b *readconf.Builder) {
+				b.MergeFile(`testdata/missing.env`)
+			}).
+			Optional(func(b *readconf.Builder) {
+				b.MergeFile(`testdata/config.env`)
+			}).
+			DryRun(&conf)
+		require.NoError(t, err)
+		require.Empty(t, report.Warnings)
+		require.Equal(t, `foo from file`, report.Values.Get(`FOO`))
+
+		report, err = b().
+			Optional(func(b *readconf.Builder) {
+				b.MergeFile(`testdata/missing.env`).MergeFile(`testdata/config.env`)
+			}).
+			DryRun(&conf)
+		require.NoError(t, err)
+		require.Equal(t, `foo from file`, report.Values.Get(`FOO`))
+
+		err = b().
+			Optional(func(b *readconf.Builder) {
+				b.MergeFile(`testdata`)
+			}).
+			Build(&conf)
+		require.EqualError(t, err, `file testdata: read testdata: is a directory`)
+	})
+
+	t.Run("best effort", func(t *testing.T) {
+		var conf config
+		report, err := b().
+			BestEffort(func(b *readconf.Builder) {
+				b.MergeFile(`testdata/config.env`).MergeData([]byte(`=invalid`))
+			}).
+			BestEffort(func(b *readconf.Builder) {
+				b.Set(`NESTED__BAR`, `2`)
+			}).
+			DryRun(&conf)
+		require.NoError(t, err)
+		require.Equal(t, []string{`data: invalid empty key on line 1`}, report.Warnings)
+		require.Equal(t, `default`, report.Values.Get(`FOO`))
+		require.Equal(t, `2`, report.Values.Get(`NESTED__BAR`))
+	})
+
+	t.Run("required", func(t *testing.T) {
+		var conf config
+		err := b().MergeFile(`testdata/missing.env`).Build(&conf)
+		require.EqualError(t, err, `file testdata/missing.env: open testdata/missing.env: no such file or directory`)
+	})
+}
+
+func TestBuilder_TransformTag(t *testing.T) {
+	var conf struct {
+		Level string   `transform:"trim,lower"`
+		Hosts []string `transform:"trim"`
+		Mode  string   `transform:"mirror"`
+	}
+
+	err := b().
+		Set(`LEVEL`, `  DEBUG `).
+		Set(`HOSTS`, ` a,b `).
+		Set(`MODE`, `x`).
+		Build(&conf)
+	require.EqualError(t, err, `configuration key "MODE": unknown transform "mirror"`)
+	require.Equal(t, `debug`, conf.Level)
+	require.Equal(t, []string{`a`, `b`}, conf.Hosts)
+}
+
+func TestBuilder_Integers(t *testing.T) {
+	type config struct {
+		Int    int
+		Int8   int8
+		Int16  int16
+		Int32  int32
+		Uint   uint
+		Uint8  uint8
+		Uint16 uint16
+		Uint64 uint64
+	}
+
+	var conf config
+	err := b().
+		MergeMap(readconf.Map{
+			`INT`:    `1_000_000`,
+			`INT8`:   `-0x80`,
+			`INT16`:  `0o777`,
+			`INT32`:  `0b1010`,
+			`UINT`:   `42`,
+			`UINT8`:  `0xff`,
+			`UINT16`: `65_535`,
+			`UINT64`: `0xFFFF_FFFF_FFFF_FFFF`,
+		}).
+		Build(&conf)
+	require.NoError(t, err)
+	require.Equal(t, config{
+		Int:    1000000,
+		Int8:   -128,
+		Int16:  511,
+		Int32:  10,
+		Uint:   42,
+		Uint8:  255,
+		Uint16: 65535,
+		Uint64: 1<<64 - 1,
+	}, conf)
+
+	m, err := readconf.Marshal(&conf)
+	require.NoError(t, err)
+	require.Equal(t, `18446744073709551615`, m[`UINT64`])
+
+	err = b().MergeMap(m).Set(`UINT8`, `256`).Build(&conf)
+	require.EqualError(t, err,
+		`unmarshal value: configuration key "UINT8": value 256 out of range for 8-bit unsigned integer`)
+}
+
+func TestBuilder_FileMode(t *testing.T) {
+	var conf struct {
+		SocketMode os.FileMode `default:"0660"`
+		DirMode    os.FileMode
+	}
+
+	err := b().Set(`DIR_MODE`, `755`).Build(&conf)
+	require.NoError(t, err)
+	require.Equal(t, os.FileMode(0660), conf.SocketMode)
+	require.Equal(t, os.FileMode(0755), conf.DirMode)
+
+	m, err := readconf.Marshal(&conf)
+	require.NoError(t, err)
+	require.Equal(t, readconf.Map{`SOCKET_MODE`: `0660`, `DIR_MODE`: `0755`}, m)
+}
+
+func TestBuilder_Floats(t *testing.T) {
+	var conf struct {
+		Factor     float32
+		SampleRate float64 `unit:"ratio"`
+		Throttle   float64 `unit:"percent"`
+	}
+
+	err := b().
+		Set(`FACTOR`, `1.5`).
+		Set(`SAMPLE_RATE`, `25%`).
+		Set(`THROTTLE`, `80%`).
+		Build(&conf)
+	require.NoError(t, err)
+	require.Equal(t, float32(1.5), conf.Factor)
+	require.Equal(t, 0.25, conf.SampleRate)
+	require.Equal(t, 80.0, conf.Throttle)
+
+	m, err := readconf.Marshal(&conf)
+	require.NoError(t, err)
+	require.Equal(t, readconf.Map{`FACTOR`: `1.5`, `SAMPLE_RATE`: `0.25`, `THROTTLE`: `80`}, m)
+
+	err = b().MergeMap(m).Set(`FACTOR`, `1e39`).Build(&conf)
+	require.EqualError(t, err,
+		`unmarshal value: configuration key "FACTOR": strconv.ParseFloat: parsing "1e39": value out of range`)
+}
+
+func TestBuilder_LocaleNumbers(t *testing.T) {
+	type config struct {
+		Budget   float64
+		Requests int
+		Name     string
+		Timeout  time.Duration
+	}
+
+	values := readconf.Map{
+		`BUDGET`:   `1.234,50`,
+		`REQUESTS`: `10.000`,
+		`NAME`:     `1.000`,
+		`TIMEOUT`:  `1.5s`,
+	}
+
+	var conf config
+	err := b().MergeMap(values).LocaleNumbers().Build(&conf)
+	require.NoError(t, err)
+	require.Equal(t, config{
+		Budget:   1234.5,
+		Requests: 10000,
+		Name:     `1.000`,
+		Timeout:  1500 * time.Millisecond,
+	}, conf)
+
+	err = b().MergeMap(values).Build(&conf)
+	require.EqualError(t, err,
+		`unmarshal value: configuration key "BUDGET": strconv.ParseFloat: parsing "1.234,50": invalid syntax`)
+}
+
+func TestBuilder_Decimals(t *testing.T) {
+	type config struct {
+		Price    big.Rat
+		Fee      *big.Rat
+		Supply   big.Int
+		Rate     big.Float
+		Discount big.Rat `unit:"ratio"`
+	}
+
+	var conf config
+	err := b().
+		MergeMap(readconf.Map{
+			`PRICE`:    `19.99`,
+			`FEE`:      `0.10`,
+			`SUPPLY`:   `123456789012345678901234567890`,
+			`RATE`:     `1.5`,
+			`DISCOUNT`: `15%`,
+		}).
+		Build(&conf)
+	require.NoError(t, err)
+	require.Equal(t, `1999/100`, conf.Price.String())
+	require.Equal(t, `1/10`, conf.Fee.String())
+	require.Equal(t, `123456789012345678901234567890`, conf.Supply.String())
+	require.Equal(t, `1.5`, conf.Rate.String())
+	require.Equal(t, `3/20`, conf.Discount.String())
+	require.Equal(t, `0.15`, conf.Discount.FloatString(2))
+
+	m, err := readconf.Marshal(&conf)
+	require.NoError(t, err)
+	require.Equal(t, readconf.Map{
+		`PRICE`:    `1999/100`,
+		`FEE`:      `1/10`,
+		`SUPPLY`:   `123456789012345678901234567890`,
+		`RATE`:     `1.5`,
+		`DISCOUNT`: `3/20`,
+	}, m)
+
+	var conf2 config
+	require.NoError(t, b().MergeMap(m).Build(&conf2))
+	require.Zero(t, conf.Price.Cmp(&conf2.Price))
+}
+
+type dottedKeys struct{}
+
+func (dottedKeys) FieldKey(name string) string {
+	return readconf.DefaultKeyStrategy().FieldKey(name)
+}
+
+func (dottedKeys) Join(keys ...string) string {
+	return strings.Join(keys, `.`)
+}
+
+func (dottedKeys) Normalize(key string) string {
+	return strings.ToUpper(strings.Replace(strings.TrimSpace(key), `-`, `_`, -1))
+}
+
+func TestBuilder_WithKeyStrategy(t *testing.T) {
+	type config struct {
+		Name string
+		DB   struct {
+			MaxConns int `validate:"max=100"`
+			Port     int `default:"5432"`
+		}
+	}
+
+	t.Run("keys", func(t *testing.T) {
+		var conf config
+		report, err := b().
+			WithKeyStrategy(dottedKeys{}).
+			MergeData([]byte("name=app\ndb.max-conns=10")).
+			DryRun(&conf)
+		require.NoError(t, err)
+		require.Equal(t, []string{`DB.MAX_CONNS`, `DB.PORT`, `NAME`}, report.Keys)
+
+		require.NoError(t, b().
+			WithKeyStrategy(dottedKeys{}).
+			Set(`db`, `{"max-conns": 10}`).
+			Set(`name`, `app`).
+			Build(&conf))
+		require.Equal(t, 10, conf.DB.MaxConns)
+		require.Equal(t, 5432, conf.DB.Port)
+	})
+
+	t.Run("validation", func(t *testing.T) {
+		var conf config
+		err := b().
+			WithKeyStrategy(dottedKeys{}).
+			WithValidator(limits).
+			MergeData([]byte("name=app\ndb.max-conns=1000")).
+			Build(&conf)
+		require.EqualError(t, err, `validation failed: DB.MAX_CONNS`)
+	})
+
+	t.Run("nested sources", func(t *testing.T) {
+		for name, source := range map[string]readconf.Source{
+			`json`: readconf.JSONSource([]byte(`{"name": "app", "db": {"max-conns": 10}}`)),
+			`toml`: readconf.TOMLSource([]byte("name = 'app'\n[db]\nmax-conns = 10")),
+			`ini`:  readconf.INISource([]byte("name = app\n[db]\nmax-conns = 10")),
+		} {
+			var conf config
+			err := b().WithKeyStrategy(dottedKeys{}).MergeSource(source).Build(&conf)
+			require.NoError(t, err, name)
+			require.Equal(t, 10, conf.DB.MaxConns, name)
+		}
+	})
+
+	t.Run("describe and marshal", func(t *testing.T) {
+		docs, err := b().WithKeyStrategy(dottedKeys{}).Describe(&config{})
+		require.NoError(t, err)
+		require.Len(t, docs, 3)
+		require.Equal(t, `DB.PORT`, docs[1].Key)
+		require.Equal(t, `5432`, docs[1].Default)
+
+		conf := config{Name: `app`}
+		conf.DB.MaxConns = 10
+		m, err := b().WithKeyStrategy(dottedKeys{}).Marshal(&conf)
+		require.NoError(t, err)
+		require.Equal(t, `10`, m.Get(`DB.MAX_CONNS`))
+
+		om, err := b().WithKeyStrategy(dottedKeys{}).MarshalOrdered(&conf)
+		require.NoError(t, err)
+		require.Equal(t, []string{`NAME`, `DB.MAX_CONNS`, `DB.PORT`}, om.Keys())
+	})
+
+	t.Run("secrets", func(t *testing.T) {
+		var conf struct {
+			DB struct {
+				Login string `secret:"true"`
+			}
+		}
+
+		data, err := b().
+			WithKeyStrategy(dottedKeys{}).
+			Set(`db.login`, `admin:hunter2`).
+			DebugBundle(&conf)
+		require.NoError(t, err)
+		require.NotContains(t, string(data), `hunter2`)
+
+		require.NoError(t, b().
+			WithKeyStrategy(dottedKeys{}).
+			Set(`db.login`, `admin:hunter2`).
+			Build(&conf))
+		require.NoError(t, b().WithKeyStrategy(dottedKeys{}).Zeroize(&conf))
+		require.Empty(t, conf.DB.Login)
+	})
+}
+
+func TestBuilder_MergeBuilder(t *testing.T) {
+	type config struct {
+		Name  string
+		Port  int
+		Debug bool
+	}
+
+	base := func() *readconf.Builder {
+		return b().
+			Set(`NAME`, `base`).
+			Set(`PORT`, `80`).
+			AddTransform(func(m readconf.Map) error {
+				m.Set(`DEBUG`, `true`)
+				return nil
+			})
+	}
+
+	t.Run("values and transforms", func(t *testing.T) {
+		var conf config
+		require.NoError(t, b().
+			Set(`NAME`, `overridden`).
+			MergeBuilder(base()).
+			Set(`PORT`, `8080`).
+			Build(&conf))
+		require.Equal(t, config{Name: `base`, Port: 8080, Debug: true}, conf)
+	})
+
+	t.Run("validator", func(t *testing.T) {
+		var conf config
+		err := b().
+			MergeBuilder(base().WithValidator(readconf.ValidatorFunc(func(interface{}) error {
+				return fmt.Errorf("rejected")
+			}))).
+			Build(&conf)
+		require.EqualError(t, err, `validation failed: rejected`)
+	})
+
+	t.Run("error", func(t *testing.T) {
+		var conf config
+		err := b().
+			MergeBuilder(base().MergeFile(`testdata/does-not-exist`)).
+			Build(&conf)
+		require.Error(t, err)
+	})
+}
+
+func TestBuilder_MergeFlags(t *testing.T) {
+	var conf struct {
+		Name string `default:"app"`
+		DB   struct {
+			MaxConns int `default:"10"`
+			Host     string
+		}
+	}
+
+	fs := flag.NewFlagSet(`test`, flag.ContinueOnError)
+	fs.String(`name`, `flag default`, ``)
+	fs.Int(`db.max-conns`, 0, ``)
+	fs.String(`db.host`, ``, ``)
+	require.NoError(t, fs.Parse([]string{`-db.max-conns=20`, `-db.host`, `localhost`}))
+
+	require.NoError(t, b().MergeFlags(fs).Build(&conf))
+	require.Equal(t, `app`, conf.Name)
+	require.Equal(t, 20, conf.DB.MaxConns)
+	require.Equal(t, `localhost`, conf.DB.Host)
+}
+
+func TestDefineFlags(t *testing.T) {
+	type config struct {
+		Name string `default:"app"`
+		DB   struct {
+			MaxConns int `default:"10" usage:"maximum number of connections"`
+			Host     string
+		}
+	}
+
+	var conf config
+
+	fs := flag.NewFlagSet(`test`, flag.ContinueOnError)
+	require.NoError(t, readconf.DefineFlags(fs, &conf))
+	require.Equal(t, `10`, fs.Lookup(`db.max-conns`).DefValue)
+	require.Equal(t, `maximum number of connections (int)`, fs.Lookup(`db.max-conns`).Usage)
+	require.Equal(t, `string, required`, fs.Lookup(`db.host`).Usage)
+	require.NotNil(t, fs.Lookup(`name`))
+
+	require.NoError(t, fs.Parse([]string{`-db.host=localhost`}))
+	require.NoError(t, b().Set(`NAME`, `other`).MergeFlags(fs).Build(&conf))
+	require.Equal(t, `other`, conf.Name)
+	require.Equal(t, 10, conf.DB.MaxConns)
+	require.Equal(t, `localhost`, conf.DB.Host)
+
+	require.Equal(t, `DB__MAX_CONNS`, readconf.FlagKey(readconf.FlagName(`DB__MAX_CONNS`)))
+}
+
+func TestBuilder_BuildMultipleTargets(t *testing.T) {
+	type server struct {
+		Port int
+		Name string `default:"server"`
+	}
+
+	type worker struct {
+		Queue string
+		Name  string `default:"worker"`
+	}
+
+	builder := b().
+		Set(`PORT`, `8080`).
+		Set(`QUEUE`, `jobs`).
+		AddTransform(func(m readconf.Map) error {
+			m.Set(`NAME`, m.Get(`NAME`)+`-1`)
+			return nil
+		})
+
+	var s server
+	require.NoError(t, builder.Build(&s))
+	require.Equal(t, server{Port: 8080, Name: `server-1`}, s)
+
+	var w worker
+	require.NoError(t, builder.Build(&w))
+	require.Equal(t, worker{Queue: `jobs`, Name: `worker-1`}, w)
+
+	var other struct {
+		Port  int
+		Token string
+	}
+	require.EqualError(t, builder.Build(&other), `missing 1 configuration key: TOKEN`)
+
+	require.NoError(t, builder.Build(&s))
+	require.Equal(t, server{Port: 8080, Name: `server-1`}, s)
+}
+
+func TestBuilder_BuildPrefix(t *testing.T) {
+	type plugin struct {
+		Endpoint string
+		Retries  int `default:"3"`
+	}
+
+	builder := b().
+		Set(`PLUGINS__SEARCH__ENDPOINT`, `http://search`).
+		Set(`PLUGINS__SEARCH__RETRIES`, `5`).
+		Set(`PLUGINS__MAIL`, `{"endpoint": "smtp://mail"}`)
+
+	var search plugin
+	require.NoError(t, builder.BuildPrefix(`plugins__search`, &search))
+	require.Equal(t, plugin{Endpoint: `http://search`, Retries: 5}, search)
+
+	var mail plugin
+	require.NoError(t, builder.BuildPrefix(`PLUGINS__MAIL`, &mail))
+	require.Equal(t, plugin{Endpoint: `smtp://mail`, Retries: 3}, mail)
+
+	var cache plugin
+	require.EqualError(t, builder.BuildPrefix(`PLUGINS__CACHE`, &cache),
+		`missing 1 configuration key: PLUGINS__CACHE__ENDPOINT`)
+}
+
+func TestBuilder_OptionalFields(t *testing.T) {
+	type config struct {
+		Name    string
+		Region  string         `config:",optional"`
+		Zone    string         `config:"AZ,optional"`
+		Tags    []string       `config:",optional"`
+		Timeout *time.Duration `config:",optional"`
+	}
+
+	var conf config
+	report, err := b().Set(`NAME`, `app`).BuildReport(&conf)
+	require.NoError(t, err)
+	require.Equal(t, config{Name: `app`}, conf)
+	_, ok := report.Values.Lookup(`REGION`)
+	require.False(t, ok)
+
+	conf = config{}
+	require.NoError(t, b().
+		Parallel(2).
+		Set(`NAME`, `app`).
+		Set(`REGION`, `eu`).
+		Set(`AZ`, `eu-1a`).
+		Set(`TIMEOUT`, `1s`).
+		Build(&conf))
+	require.Equal(t, `eu`, conf.Region)
+	require.Equal(t, `eu-1a`, conf.Zone)
+	require.Equal(t, time.Second, *conf.Timeout)
+
+	require.EqualError(t, b().Build(&config{}), `missing 1 configuration key: NAME`)
+
+	docs, err := readconf.Describe(&config{})
+	require.NoError(t, err)
+	require.Equal(t, readconf.FieldDoc{Key: `AZ`, Type: `string`}, docs[0])
+
+	var invalid struct {
+		Name string `config:",optionl"`
+	}
+	require.EqualError(t, b().Build(&invalid), `field Name: unknown option optionl of config tag`)
+}
+
+func TestBuilder_BuildCommand(t *testing.T) {
+	type global struct {
+		LogLevel string `default:"info"`
+	}
+
+	type serve struct {
+		Port int
+	}
+
+	type migrate struct {
+		Dir   string
+		Steps int `default:"1"`
+	}
+
+	builder := b().
+		Set(`GLOBAL__LOG_LEVEL`, `debug`).
+		Set(`SERVE__PORT`, `8080`).
+		Set(`MIGRATE__DIR`, `migrations`)
+
+	var g global
+	var s serve
+	require.NoError(t, builder.BuildCommand(`serve`, &g, &s))
+	require.Equal(t, global{LogLevel: `debug`}, g)
+	require.Equal(t, serve{Port: 8080}, s)
+
+	var m migrate
+	require.NoError(t, builder.BuildCommand(`migrate`, nil, &m))
+	require.Equal(t, migrate{Dir: `migrations`, Steps: 1}, m)
+
+	t.Run("nested command", func(t *testing.T) {
+		var s serve
+		require.NoError(t, b().Set(`DB__MIGRATE__PORT`, `1`).BuildCommand(`db__migrate`, nil, &s))
+		require.Equal(t, serve{Port: 1}, s)
+	})
+
+	t.Run("missing keys", func(t *testing.T) {
+		type global struct {
+			Token string
+		}
+
+		var g global
+		var s serve
+		require.EqualError(t, b().BuildCommand(`serve`, &g, &s),
+			`missing 2 configuration keys: GLOBAL__TOKEN, SERVE__PORT`)
+	})
+
+	t.Run("invalid command", func(t *testing.T) {
+		var s serve
+		require.EqualError(t, builder.BuildCommand(`global`, nil, &s), `invalid command global`)
+		require.EqualError(t, builder.BuildCommand(`1`, nil, &s), `invalid prefix 1`)
+	})
+}
+
+type benchConfig struct {
+	Name     string        `default:"app"`
+	Port     int           `default:"8080"`
+	Timeout  time.Duration `default:"5s"`
+	Debug    bool
+	Tags     []string
+	Database struct {
+		Host     string
+		Port     int `default:"5432"`
+		MaxConns int `default:"10"`
+		User     string
+		Password string
+	}
+	Cache struct {
+		URL *url.URL
+		TTL time.Duration `default:"1m"`
+	}
+}
+
+func BenchmarkBuilder_Build(b *testing.B) {
+	builder := readconf.NewBuilder().MergeData([]byte(
+		"DEBUG=true\nTAGS=a,b,c\nDATABASE__HOST=localhost\nDATABASE__USER=app\n" +
+			"DATABASE__PASSWORD=secret\nCACHE__URL=redis://localhost:6379\n"))
+
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		var conf benchConfig
+		if err := builder.Build(&conf); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func TestBuilder_Parallel(t *testing.T) {
+	fields := make([]reflect.StructField, 200)
+	values := readconf.Map{}
+	for i := range fields {
+		fields[i] = reflect.StructField{Name: fmt.Sprintf("Field%d", i), Type: reflect.TypeOf(0)}
+		values.Set(fmt.Sprintf("FIELD%d", i), strconv.Itoa(i))
+	}
+
+	typ := reflect.StructOf(fields)
+
+	conf := reflect.New(typ)
+	require.NoError(t, b().MergeMap(values).Parallel(8).Build(conf.Interface()))
+	for i := range fields {
+		require.Equal(t, i, int(conf.Elem().Field(i).Int()))
+	}
+
+	values.Set(`FIELD150`, `many`)
+	values.Set(`FIELD120`, `more`)
+	err := b().MergeMap(values).Parallel(8).Build(reflect.New(typ).Interface())
+	require.EqualError(t, err, `unmarshal value: configuration key "FIELD120": strconv.ParseInt: parsing "more": invalid syntax`)
+}
+
+func BenchmarkBuilder_BuildParallel(b *testing.B) {
+	builder := readconf.NewBuilder().MergeData([]byte(
+		"DEBUG=true\nTAGS=a,b,c\nDATABASE__HOST=localhost\nDATABASE__USER=app\n" +
+			"DATABASE__PASSWORD=secret\nCACHE__URL=redis://localhost:6379\n")).
+		Parallel(4)
+
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		var conf benchConfig
+		if err := builder.Build(&conf); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkBuilder_MergeFile(b *testing.B) {
+	dir, err := ioutil.TempDir(``, `readconf`)
+	if err != nil {
+		b.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	var data bytes.Buffer
+	for i := 0; i < 1000; i++ {
+		fmt.Fprintf(&data, "# setting %d\nKEY_%d = value %d\n", i, i, i)
+	}
+
+	filename := filepath.Join(dir, `large.env`)
+	if err := ioutil.WriteFile(filename, data.Bytes(), 0644); err != nil {
+		b.Fatal(err)
+	}
+
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		if err := readconf.NewBuilder().MergeFile(filename).Error(); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func TestBuilder_Secret(t *testing.T) {
+	type config struct {
+		User     string
+		Password readconf.Secret
+		Token    *readconf.Secret
+	}
+
+	var conf config
+	require.NoError(t, b().
+		Set(`USER`, `app`).
+		Set(`PASSWORD`, `hunter2`).
+		Set(`TOKEN`, `t0k3n`).
+		Build(&conf))
+
+	password, err := conf.Password.Reveal()
+	require.NoError(t, err)
+	require.Equal(t, `hunter2`, password)
+
+	var used []byte
+	require.NoError(t, conf.Token.Use(func(value []byte) {
+		require.Equal(t, `t0k3n`, string(value))
+		used = value
+	}))
+	require.Equal(t, make([]byte, 5), used)
+
+	for _, format := range []string{`%s`, `%v`, `%+v`, `%#v`} {
+		require.NotContains(t, fmt.Sprintf(format, conf), `hunter2`, format)
+	}
+	require.Contains(t, fmt.Sprintf(`%v`, conf), `[secret]`)
+
+	m, err := readconf.Marshal(&conf)
+	require.NoError(t, err)
+	require.Equal(t, `hunter2`, m.Get(`PASSWORD`))
+
+	var zero readconf.Secret
+	require.True(t, zero.IsZero())
+	require.False(t, conf.Password.IsZero())
+}
+
+func TestZeroize(t *testing.T) {
+	type config struct {
+		User     string
+		Password string `secret:"true"`
+		Key      []byte `secret:"true"`
+		Token    *readconf.Secret
+		API      struct {
+			Secret readconf.Secret
+		}
+	}
+
+	var conf config
+	require.NoError(t, b().
+		Set(`USER`, `app`).
+		Set(`PASSWORD`, `hunter2`).
+		Set(`KEY`, `0123456789`).
+		Set(`TOKEN`, `t0k3n`).
+		Set(`API__SECRET`, `s3cr3t`).
+		Build(&conf))
+
+	key := conf.Key
+	require.NoError(t, readconf.Zeroize(&conf))
+
+	require.Equal(t, `app`, conf.User)
+	require.Equal(t, ``, conf.Password)
+	require.Nil(t, conf.Key)
+	require.Equal(t, make([]byte, 10), key)
+	require.True(t, conf.Token.IsZero())
+	require.True(t, conf.API.Secret.IsZero())
+
+	var invalid struct {
+		Port int `secret:"true"`
+	}
+	require.EqualError(t, readconf.Zeroize(&invalid), `configuration key "PORT": can't zeroize int`)
+}
+
+func TestBuilder_HostFacts(t *testing.T) {
+	var conf struct {
+		Instance string
+		Workers  int
+		Platform string
+		Override string
+	}
+
+	hostname, err := os.Hostname()
+	require.NoError(t, err)
+
+	require.NoError(t, b().
+		Set(`INSTANCE`, `${sys.hostname}-${SYS.PID}`).
+		Set(`WORKERS`, `${sys.num_cpu}`).
+		Set(`PLATFORM`, `${sys.os}/${sys.arch}`).
+		Set(`OVERRIDE`, `${SYS.OS}`).
+		Set(`SYS.OS`, `plan10`).
+		Build(&conf))
+
+	require.Equal(t, fmt.Sprintf("%s-%d", hostname, os.Getpid()), conf.Instance)
+	require.Equal(t, runtime.NumCPU(), conf.Workers)
+	require.Equal(t, runtime.GOOS+`/`+runtime.GOARCH, conf.Platform)
+	require.Equal(t, `plan10`, conf.Override)
+}
+
+type staticSource readconf.Map
+
+func (s staticSource) Load(ctx context.Context) (readconf.Map, error) {
+	return readconf.Map(s), ctx.Err()
+}
+
+func TestBuilder_MergeSource(t *testing.T) {
+	var conf struct {
+		Name string
+		Port int
+		Host string
+	}
+
+	require.NoError(t, b().
+		MergeSource(
+			readconf.DataSource([]byte("NAME=app\nPORT=80")),
+			staticSource{`PORT`: `8080`},
+			readconf.SourceFunc(func(ctx context.Context) (readconf.Map, error) {
+				return readconf.Map{`HOST`: `localhost`}, nil
+			})).
+		Build(&conf))
+	require.Equal(t, `app`, conf.Name)
+	require.Equal(t, 8080, conf.Port)
+	require.Equal(t, `localhost`, conf.Host)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	err := b().MergeSourceContext(ctx, staticSource{`PORT`: `8080`}).Build(&conf)
+	require.EqualError(t, err, `readconf_test.staticSource: context canceled`)
+
+	err = b().MergeSource(readconf.FileSource(`testdata/does-not-exist`)).Build(&conf)
+	errs, ok := err.(readconf.SourceErrors)
+	require.True(t, ok)
+	require.Len(t, errs, 1)
+	require.Equal(t, `file testdata/does-not-exist`, errs[0].Source)
+	require.True(t, os.IsNotExist(errs[0].Err))
+}
+
+func TestBuilder_SourceErrors(t *testing.T) {
+	var conf struct {
+		Name string
+		Port int
+	}
+
+	t.Run("collects all", func(t *testing.T) {
+		builder := b().
+			MergeFile(`testdata/does-not-exist`).
+			MergeData([]byte("NAME=app")).
+			MergeData([]byte("=80")).
+			MergeProvider(`missing`)
+
+		err := builder.Build(&conf)
+		require.EqualError(t, err, `3 sources failed: `+
+			`file testdata/does-not-exist: open testdata/does-not-exist: no such file or directory; `+
+			`data: invalid empty key on line 1; `+
+			`provider missing: exec: "readconf-provider-missing": executable file not found in $PATH`)
+		require.Equal(t, err, builder.Error())
+	})
+
+	t.Run("optional", func(t *testing.T) {
+		err := b().
+			Optional(func(b *readconf.Builder) {
+				b.MergeFile(`testdata/does-not-exist`).MergeData([]byte("=80"))
+			}).
+			Build(&conf)
+		require.EqualError(t, err, `data: invalid empty key on line 1`)
+	})
+
+	t.Run("none", func(t *testing.T) {
+		builder := b().MergeData([]byte("NAME=app\nPORT=80"))
+		require.NoError(t, builder.Error())
+		require.NoError(t, builder.Build(&conf))
+	})
+}
+
+func TestErrorsAsJSON(t *testing.T) {
+	t.Run("missing keys", func(t *testing.T) {
+		var conf struct {
+			Foo string
+			Bar string
+		}
+
+		err := b().Build(&conf)
+		_, ok := err.(*readconf.MissingKeysError)
+		require.True(t, ok)
+		require.JSONEq(t, `{
+			"kind": "missing_keys",
+			"message": "missing 2 configuration keys: BAR, FOO",
+			"keys": [{"key": "BAR", "problem": "missing"}, {"key": "FOO", "problem": "missing"}]
+		}`, string(readconf.ErrorsAsJSON(err)))
+	})
+
+	t.Run("unmarshal", func(t *testing.T) {
+		var conf struct {
+			Port int
+		}
+
+		err := b().MergeMap(readconf.Map{`PORT`: `http`}).Build(&conf)
+		require.JSONEq(t, `{
+			"kind": "unmarshal",
+			"message": "unmarshal value: configuration key \"PORT\": strconv.ParseInt: parsing \"http\": invalid syntax",
+			"keys": [{"key": "PORT", "problem": "strconv.ParseInt: parsing \"http\": invalid syntax"}]
+		}`, string(readconf.ErrorsAsJSON(err)))
+
+		err = b().Parallel(4).MergeMap(readconf.Map{`PORT`: `http`}).Build(&conf)
+		uerr, ok := err.(*readconf.UnmarshalError)
+		require.True(t, ok)
+		require.Equal(t, `PORT`, uerr.Key)
+	})
+
+	t.Run("validation", func(t *testing.T) {
+		var conf struct {
+			Port int    `validate:"min=1"`
+			Host string `validate:"min=3"`
+		}
+
+		err := b().WithValidator(limits).MergeMap(readconf.Map{`PORT`: `0`, `HOST`: `-`}).Build(&conf)
+		require.JSONEq(t, `{
+			"kind": "validation",
+			"message": "validation failed: HOST, PORT",
+			"keys": [
+				{"key": "HOST", "problem": "failed rule min=3", "rule": "min", "param": "3"},
+				{"key": "PORT", "problem": "failed rule min=1", "rule": "min", "param": "1"}
+			]
+		}`, string(readconf.ErrorsAsJSON(err)))
+	})
+
+	t.Run("sources", func(t *testing.T) {
+		err := b().MergeData([]byte("=1")).Error()
+		require.JSONEq(t, `{
+			"kind": "sources",
+			"message": "data: invalid empty key on line 1",
+			"keys": [{"source": "data", "problem": "invalid empty key on line 1"}]
+		}`, string(readconf.ErrorsAsJSON(err)))
+	})
+
+	t.Run("other", func(t *testing.T) {
+		require.JSONEq(t, `{"kind": "other", "message": "boom"}`,
+			string(readconf.ErrorsAsJSON(fmt.Errorf("boom"))))
+		require.Nil(t, readconf.ErrorsAsJSON(nil))
+	})
+}
+
+func TestBuilder_MergeJSON(t *testing.T) {
+	var conf struct {
+		Name     string
+		Database struct {
+			Host string
+			Port int
+			Pool struct {
+				MaxIdle int
+			}
+		}
+		Ports []int
+		Tags  []string
+		Ratio float64
+		Big   uint64
+		Debug bool
+		Empty string
+	}
+
+	t.Run("file", func(t *testing.T) {
+		report, err := b().MergeJSONFile(`testdata/config.json`).BuildReport(&conf)
+		require.NoError(t, err)
+		require.Equal(t, `app`, conf.Name)
+		require.Equal(t, `db.local`, conf.Database.Host)
+		require.Equal(t, 5432, conf.Database.Port)
+		require.Equal(t, 2, conf.Database.Pool.MaxIdle)
+		require.Equal(t, []int{80, 443}, conf.Ports)
+		require.Equal(t, []string{`a`, `b`}, conf.Tags)
+		require.Equal(t, 0.5, conf.Ratio)
+		require.Equal(t, uint64(18446744073709551615), conf.Big)
+		require.True(t, conf.Debug)
+		require.Equal(t, ``, conf.Empty)
+
+		require.Equal(t, `18446744073709551615`, report.Values.Get(`BIG`))
+		require.Equal(t, `true`, report.Values.Get(`DEBUG`))
+		require.Equal(t, `[80,443]`, report.Values.Get(`PORTS`))
+	})
+
+	t.Run("errors", func(t *testing.T) {
+		err := b().MergeJSON([]byte(`[1, 2]`)).Error()
+		require.EqualError(t, err,
+			`json: invalid JSON: json: cannot unmarshal array into Go value of type map[string]interface {}`)
+
+		err = b().MergeJSONFile(`testdata/missing.json`).Error()
+		require.EqualError(t, err,
+			`json file testdata/missing.json: open testdata/missing.json: no such file or directory`)
+	})
+}
+
+func TestBuilder_Suggestions(t *testing.T) {
+	var conf struct {
+		Database struct {
+			Host string
+			Port int `default:"5432"`
+		}
+	}
+
+	err := b().MergeMap(readconf.Map{`DATABSE__HOST`: `db`}).Build(&conf)
+	require.EqualError(t, err,
+		`missing 1 configuration key: DATABASE__HOST (did you mean DATABSE__HOST?)`)
+}
+
+func TestBuilder_Strict(t *testing.T) {
+	var conf struct {
+		Database struct {
+			Host string
+			Port int `default:"5432"`
+		}
+	}
+
+	t.Run("unknown keys", func(t *testing.T) {
+		err := b().
+			Strict().
+			MergeMap(readconf.Map{`DATABASE__HOST`: `db`, `DATABASE_PORT`: `1`, `DEBUG`: `true`}).
+			Build(&conf)
+		require.EqualError(t, err,
+			`unknown 2 configuration keys: DATABASE_PORT (did you mean DATABASE__PORT?), DEBUG`)
+		require.JSONEq(t, `{
+			"kind": "unknown_keys",
+			"message": "unknown 2 configuration keys: DATABASE_PORT (did you mean DATABASE__PORT?), DEBUG",
+			"keys": [
+				{"key": "DATABASE_PORT", "problem": "unknown", "suggestion": "DATABASE__PORT"},
+				{"key": "DEBUG", "problem": "unknown"}
+			]
+		}`, string(readconf.ErrorsAsJSON(err)))
+	})
+
+	t.Run("environment typo", func(t *testing.T) {
+		var conf struct {
+			DB struct {
+				Port int `default:"5432"`
+			}
+		}
+
+		err := b().
+			Strict().
+			MergeEnviron(`APP_`, []string{`APP_DB__PRT=5433`, `OTHER=1`}).
+			Build(&conf)
+		require.EqualError(t, err, `unknown 1 configuration key: DB__PRT (did you mean DB__PORT?)`)
+
+		require.IsType(t, &readconf.UnknownKeysError{}, err)
+		require.Equal(t, []string{`DB__PRT`}, err.(*readconf.UnknownKeysError).Keys)
+	})
+
+	t.Run("references", func(t *testing.T) {
+		var conf struct {
+			URL string
+		}
+
+		err := b().
+			Strict().
+			Set(`HOST`, `x`).
+			Set(`URL`, `http://${HOST}`).
+			Build(&conf)
+		require.NoError(t, err)
+		require.Equal(t, `http://x`, conf.URL)
+	})
+
+	t.Run("prefix", func(t *testing.T) {
+		var conf struct {
+			Host string
+		}
+
+		builder := b().
+			Strict().
+			MergeMap(readconf.Map{`DATABASE__HOST`: `db`, `CACHE__URL`: `redis://cache`})
+		require.NoError(t, builder.BuildPrefix(`DATABASE`, &conf))
+		require.Equal(t, `db`, conf.Host)
+
+		builder.Set(`DATABASE__HOTS`, `db`)
+		require.EqualError(t, builder.BuildPrefix(`DATABASE`, &conf),
+			`unknown 1 configuration key: DATABASE__HOTS (did you mean DATABASE__HOST?)`)
+	})
+
+	t.Run("command", func(t *testing.T) {
+		var global struct {
+			LogLevel string
+		}
+		var serve struct {
+			Port int
+		}
+
+		builder := b().
+			Strict().
+			MergeMap(readconf.Map{`GLOBAL__LOG_LEVEL`: `debug`, `SERVE__PORT`: `8080`, `MIGRATE__DIR`: `migrations`})
+		require.NoError(t, builder.BuildCommand(`serve`, &global, &serve))
+
+		builder.Set(`GLOBAL__LOG_LEVL`, `info`)
+		require.EqualError(t, builder.BuildCommand(`serve`, &global, &serve),
+			`unknown 1 configuration key: GLOBAL__LOG_LEVL (did you mean GLOBAL__LOG_LEVEL?)`)
+	})
+
+	t.Run("struct keys", func(t *testing.T) {
+		err := b().
+			Strict().
+			MergeMap(readconf.Map{`DATABASE`: `{"host": "db"}`}).
+			Build(&conf)
+		require.NoError(t, err)
+		require.Equal(t, `db`, conf.Database.Host)
+	})
+}
+
+func TestBuilder_MergeTOML(t *testing.T) {
+	var conf struct {
+		Name     string
+		Started  time.Time
+		Ratio    float64
+		Debug    bool
+		Database struct {
+			Host string
+			Port int
+			Pool struct {
+				MaxIdle int
+			}
+		}
+		Servers string
+	}
+
+	t.Run("file", func(t *testing.T) {
+		report, err := b().MergeTOMLFile(`testdata/config.toml`).BuildReport(&conf)
+		require.NoError(t, err)
+		require.Equal(t, `app`, conf.Name)
+		require.True(t, time.Date(1979, 5, 27, 15, 32, 0, 0, time.UTC).Equal(conf.Started))
+		require.Equal(t, 0.5, conf.Ratio)
+		require.True(t, conf.Debug)
+		require.Equal(t, `db.local`, conf.Database.Host)
+		require.Equal(t, 5432, conf.Database.Port)
+		require.Equal(t, 2, conf.Database.Pool.MaxIdle)
+		require.JSONEq(t, `[{"name": "a", "ports": [80, 443]}, {"name": "b", "ports": [8080]}]`, conf.Servers)
+
+		require.Equal(t, `1979-05-27T07:32:00-08:00`, report.Values.Get(`STARTED`))
+	})
+
+	t.Run("errors", func(t *testing.T) {
+		err := b().MergeTOML([]byte("a = 1\na = 2")).Error()
+		require.EqualError(t, err, `toml: duplicate key a on line 2`)
+
+		err = b().MergeTOMLFile(`testdata/missing.toml`).Error()
+		require.EqualError(t, err,
+			`toml file testdata/missing.toml: open testdata/missing.toml: no such file or directory`)
+	})
+}
+
+func TestBuilder_MergeINI(t *testing.T) {
+	var conf struct {
+		Name     string
+		Database struct {
+			Host     string
+			Port     int
+			Password string
+			Pool     struct {
+				MaxIdle int
+			}
+		}
+		Cache struct {
+			URL string
+		}
+	}
+
+	t.Run("file", func(t *testing.T) {
+		err := b().MergeINIFile(`testdata/config.ini`).Build(&conf)
+		require.NoError(t, err)
+		require.Equal(t, `app`, conf.Name)
+		require.Equal(t, `db.local`, conf.Database.Host)
+		require.Equal(t, 5432, conf.Database.Port)
+		require.Equal(t, `p=ss; word`, conf.Database.Password)
+		require.Equal(t, 2, conf.Database.Pool.MaxIdle)
+		require.Equal(t, `redis://cache`, conf.Cache.URL)
+	})
+
+	t.Run("errors", func(t *testing.T) {
+		err := b().MergeINI([]byte("[database")).Error()
+		require.EqualError(t, err, `ini: invalid section on line 1`)
+
+		err = b().MergeINI([]byte("[a..b]")).Error()
+		require.EqualError(t, err, `ini: invalid section on line 1`)
+
+		err = b().MergeINI([]byte("[a]\n= 1")).Error()
+		require.EqualError(t, err, `ini: invalid empty key on line 2`)
+
+		err = b().MergeINIFile(`testdata/missing.ini`).Error()
+		require.EqualError(t, err,
+			`ini file testdata/missing.ini: open testdata/missing.ini: no such file or directory`)
+	})
+}
+
+func TestWriteError(t *testing.T) {
+	type config struct {
+		Database struct {
+			Host string
+			Port int `validate:"min=1"`
+		}
+	}
+
+	var conf config
+
+	var buf bytes.Buffer
+
+	err := b().MergeMap(readconf.Map{`DATABSE__HOST`: `db`, `DATABASE__PORT`: `1`}).Build(&conf)
+	require.NoError(t, readconf.WriteError(&buf, err))
+	require.Equal(t, ""+
+		"missing 1 configuration key:\n"+
+		"  DATABASE__HOST (did you mean DATABSE__HOST?)\n",
+		buf.String())
+
+	buf.Reset()
+	require.NoError(t, readconf.WriteError(&buf, err, readconf.WithColor(readconf.ColorAlways)))
+	require.Equal(t, ""+
+		"missing 1 configuration key:\n"+
+		"  \x1b[31mDATABASE__HOST\x1b[0m (did you mean \x1b[32mDATABSE__HOST\x1b[0m?)\n",
+		buf.String())
+
+	buf.Reset()
+	err = b().WithValidator(limits).MergeMap(readconf.Map{`DATABASE__HOST`: `db`, `DATABASE__PORT`: `0`}).Build(&conf)
+	require.NoError(t, readconf.WriteError(&buf, err, readconf.WithColor(readconf.ColorNever)))
+	require.Equal(t, "validation failed:\n  DATABASE__PORT: min=1\n", buf.String())
+
+	buf.Reset()
+	require.NoError(t, readconf.WriteError(&buf, fmt.Errorf("boom")))
+	require.Equal(t, "boom\n", buf.String())
+}
+
+func TestBuilder_MergeDotenv(t *testing.T) {
+	var conf struct {
+		Name        string
+		Greeting    string
+		Literal     string
+		URL         string
+		Port        int
+		Empty       string
+		QuotedEmpty string
+		Cert        string
+		After       int
+		Ref         string
+	}
+
+	t.Run("file", func(t *testing.T) {
+		err := b().MergeDotenvFile(`testdata/config.dotenv`).Build(&conf)
+		require.NoError(t, err)
+		require.Equal(t, `app`, conf.Name)
+		require.Equal(t, "hello\nworld", conf.Greeting)
+		require.Equal(t, `no\nescapes`, conf.Literal)
+		require.Equal(t, `http://host/#anchor`, conf.URL)
+		require.Equal(t, 8080, conf.Port)
+		require.Equal(t, ``, conf.Empty)
+		require.Equal(t, ``, conf.QuotedEmpty)
+		require.Equal(t, "-----BEGIN-----\nabc\n-----END-----", conf.Cert)
+		require.Equal(t, 1, conf.After)
+		require.Equal(t, `app-1`, conf.Ref)
+	})
+
+	t.Run("errors", func(t *testing.T) {
+		for _, tt := range []struct {
+			in  string
+			err string
+		}{
+			{"A=1\nB", `dotenv: missing = on line 2`},
+			{"A=1\n\nB C=1", `dotenv: invalid key "B C" on line 3`},
+			{"=1", `dotenv: invalid key "" on line 1`},
+			{"A=\"x\n\nB=1", `dotenv: unterminated quoted value on line 1`},
+			{"A=\"x\ny\"\nB='1' x", `dotenv: unexpected characters after quoted value on line 3`},
+		} {
+			err := b().MergeDotenv([]byte(tt.in)).Error()
+			require.EqualError(t, err, tt.err, tt.in)
+		}
+
+		err := b().MergeDotenvFile(`testdata/missing.env`).Error()
+		require.EqualError(t, err,
+			`dotenv file testdata/missing.env: open testdata/missing.env: no such file or directory`)
+	})
+}
+
+func TestBuilder_Lock(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("test provider is a shell script")
+	}
+
+	type config struct {
+		Foo    string
+		Nested struct {
+			Bar int
+			Baz string `default:"baz"`
+		}
+		Leased string `config:"LEASED"`
+	}
+
+	dir, err := ioutil.TempDir(``, `readconf`)
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	filename := filepath.Join(dir, `config.lock`)
+
+	builder := b().
+		MergeFile(`testdata/config.env`).
+		MergeProvider(`./testdata/readconf-provider-test`, `lease`).
+		AddTransform(func(m readconf.Map) error {
+			m.Set(`LEASED`, m.Get(`FOO`))
+			return nil
+		}).
+		MergeMap(readconf.Map{`EXTRA`: `1`})
+
+	lock, err := builder.Lock(&config{})
+	require.NoError(t, err)
+
+	data, err := ioutil.ReadFile(`testdata/config.env`)
+	require.NoError(t, err)
+
+	require.Equal(t, []readconf.LockedSource{
+		{Name: `file testdata/config.env`, Version: fmt.Sprintf("sha256:%x", sha256.Sum256(data))},
+		{Name: `provider ./testdata/readconf-provider-test`, Version: `7`},
+	}, lock.Sources)
+	require.Equal(t, `leased`, lock.Values.Get(`LEASED`))
+	require.Equal(t, `baz`, lock.Values.Get(`NESTED__BAZ`))
+	require.Equal(t, `1`, lock.Values.Get(`EXTRA`))
+
+	require.NoError(t, lock.WriteFile(filename))
+
+	fi, err := os.Stat(filename)
+	require.NoError(t, err)
+	require.Equal(t, os.FileMode(0600), fi.Mode().Perm())
+
+	read, err := readconf.ReadLockfile(filename)
+	require.NoError(t, err)
+	require.Equal(t, lock.Values, read.Values)
+	require.Equal(t, lock.Sources, read.Sources)
+	require.True(t, lock.Created.Equal(read.Created))
+
+	var live, replayed config
+	require.NoError(t, builder.Build(&live))
+	require.NoError(t, b().MergeLockfile(filename).Build(&replayed))
+	require.Equal(t, live, replayed)
+
+	t.Run("includes", func(t *testing.T) {
+		mainFile := filepath.Join(dir, `main.conf`)
+		fragment := filepath.Join(dir, `fragment.conf`)
+		require.NoError(t, ioutil.WriteFile(mainFile, []byte("@include fragment.conf"), 0644))
+		require.NoError(t, ioutil.WriteFile(fragment, []byte("FOO=foo\nNESTED__BAR=1\nLEASED=x"), 0644))
+
+		var conf config
+		lock, err := b().MergeFile(mainFile).Lock(&conf)
+		require.NoError(t, err)
+
+		require.NoError(t, ioutil.WriteFile(fragment, []byte("FOO=changed\nNESTED__BAR=1\nLEASED=x"), 0644))
+		changed, err := b().MergeFile(mainFile).Lock(&conf)
+		require.NoError(t, err)
+		require.NotEqual(t, lock.Sources[0].Version, changed.Sources[0].Version)
+	})
+
+	require.NoError(t, ioutil.WriteFile(filename, []byte(`{"version": 2}`), 0600))
+	err = b().MergeLockfile(filename).Error()
+	require.EqualError(t, err, `lockfile `+filename+`: unsupported lockfile version 2`)
+}
+
+type failingReader struct{}
+
+func (failingReader) Read(p []byte) (int, error) {
+	return 0, fmt.Errorf("broken pipe")
+}
+
+func TestBuilder_MergeReader(t *testing.T) {
+	var conf struct {
+		Name     string
+		Port     int
+		Database struct {
+			Host string
+		}
+	}
+
+	t.Run("formats", func(t *testing.T) {
+		for name, builder := range map[string]*readconf.Builder{
+			`data`:   b().MergeReader(strings.NewReader("NAME=app\nPORT=80\nDATABASE__HOST=db")),
+			`colon`:  b().MergeSource(readconf.ReaderSource(strings.NewReader("name: app\nport: 80\ndatabase__host: db"), parseColon)),
+			`json`:   b().MergeJSONReader(strings.NewReader(`{"name": "app", "port": 80, "database": {"host": "db"}}`)),
+			`toml`:   b().MergeTOMLReader(strings.NewReader("name = 'app'\nport = 80\n[database]\nhost = 'db'")),
+			`ini`:    b().MergeINIReader(strings.NewReader("name = app\nport = 80\n[database]\nhost = db")),
+			`dotenv`: b().MergeDotenvReader(strings.NewReader("export NAME=app\nPORT=80\nDATABASE__HOST='db'")),
+		} {
+			conf.Name, conf.Port, conf.Database.Host = ``, 0, ``
+			require.NoError(t, builder.Build(&conf), name)
+			require.Equal(t, `app`, conf.Name, name)
+			require.Equal(t, 80, conf.Port, name)
+			require.Equal(t, `db`, conf.Database.Host, name)
+		}
+	})
+
+	t.Run("errors", func(t *testing.T) {
+		err := b().MergeSource(readconf.ReaderSource(strings.NewReader("- a"), parseColon)).Error()
+		require.EqualError(t, err, `colon reader: expected key: value, got "- a"`)
+
+		err = b().MergeReader(failingReader{}).Error()
+		require.EqualError(t, err, `data reader: broken pipe`)
+	})
+
+	t.Run("lock", func(t *testing.T) {
+		lock, err := b().
+			MergeReader(strings.NewReader("NAME=app\nPORT=80\nDATABASE__HOST=db")).
+			Lock(&conf)
+		require.NoError(t, err)
+		require.Len(t, lock.Sources, 1)
+		require.Equal(t, `data reader`, lock.Sources[0].Name)
+		require.True(t, strings.HasPrefix(lock.Sources[0].Version, `sha256:`))
+	})
+}
+
+func TestBuilder_Replay(t *testing.T) {
+	type config struct {
+		Name string
+		Port int
+	}
+
+	dir, err := ioutil.TempDir(``, `readconf`)
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	configFile := filepath.Join(dir, `app.env`)
+	lockFile := filepath.Join(dir, `app.lock`)
+
+	require.NoError(t, ioutil.WriteFile(configFile, []byte("NAME=app\nPORT=80"), 0600))
+
+	lock, err := b().MergeFile(configFile).Lock(&config{})
+	require.NoError(t, err)
+	require.NoError(t, lock.WriteFile(lockFile))
+
+	t.Run("no drift", func(t *testing.T) {
+		var conf config
+		drift, err := b().MergeFile(configFile).Replay(lockFile, &conf)
+		require.NoError(t, err)
+		require.True(t, drift.IsZero())
+		require.Equal(t, config{Name: `app`, Port: 80}, conf)
+	})
+
+	t.Run("drift", func(t *testing.T) {
+		require.NoError(t, ioutil.WriteFile(configFile, []byte("NAME=app\nPORT=8080\nDEBUG=true"), 0600))
+
+		var conf config
+		drift, err := b().
+			MergeFile(configFile).
+			MergeData([]byte("NAME=app")).
+			Replay(lockFile, &conf)
+		require.NoError(t, err)
+		require.False(t, drift.IsZero())
+		require.Equal(t, config{Name: `app`, Port: 80}, conf)
+
+		require.Equal(t, []readconf.ValueDrift{
+			{Key: `DEBUG`, Live: `true`, InLive: true},
+			{Key: `PORT`, Locked: `80`, Live: `8080`, InLock: true, InLive: true},
+		}, drift.Values)
+
+		require.Len(t, drift.Sources, 2)
+		require.Equal(t, `file `+configFile, drift.Sources[0].Name)
+		require.Equal(t, lock.Sources[0].Version, drift.Sources[0].Locked)
+		require.NotEqual(t, drift.Sources[0].Locked, drift.Sources[0].Live)
+		require.Equal(t, readconf.SourceDrift{Name: `data`, InLive: true}, drift.Sources[1])
+	})
+
+	t.Run("presence", func(t *testing.T) {
+		type config struct {
+			Name  string
+			Debug bool `presence:"true"`
+		}
+
+		lockFile := filepath.Join(dir, `presence.lock`)
+
+		lock, err := b().Set(`NAME`, `app`).Lock(&config{})
+		require.NoError(t, err)
+		require.Equal(t, readconf.Map{`NAME`: `app`}, lock.Values)
+		require.NoError(t, lock.WriteFile(lockFile))
+
+		conf := config{Debug: true}
+		drift, err := b().Set(`NAME`, `app`).Replay(lockFile, &conf)
+		require.NoError(t, err)
+		require.True(t, drift.IsZero())
+		require.Equal(t, config{Name: `app`}, conf)
+
+		drift, err = b().Set(`NAME`, `app`).Set(`DEBUG`, `false`).Replay(lockFile, &conf)
+		require.NoError(t, err)
+		require.Equal(t, []readconf.ValueDrift{{Key: `DEBUG`, Live: `true`, InLive: true}}, drift.Values)
+	})
+
+	t.Run("large values", func(t *testing.T) {
+		type config struct {
+			Bundle string
+			Schema io.Reader
+		}
+
+		lockFile := filepath.Join(dir, `large.lock`)
+		bundle := strings.Repeat("-----BEGIN CERTIFICATE-----\n", 100)
+		large := func() *readconf.Builder {
+			return b().LargeValues(1024, dir).Set(`BUNDLE`, bundle).Set(`SCHEMA`, bundle)
+		}
+
+		lock, err := large().Lock(&config{})
+		require.NoError(t, err)
+		require.Equal(t, readconf.Map{`BUNDLE`: bundle, `SCHEMA`: bundle}, lock.Values)
+		require.NoError(t, lock.WriteFile(lockFile))
+
+		var conf config
+		drift, err := large().Replay(lockFile, &conf)
+		require.NoError(t, err)
+		require.True(t, drift.IsZero())
+		require.Equal(t, bundle, conf.Bundle)
+
+		data, err := ioutil.ReadAll(conf.Schema)
+		require.NoError(t, err)
+		require.Equal(t, bundle, string(data))
+	})
+
+	t.Run("live fails", func(t *testing.T) {
+		require.NoError(t, ioutil.WriteFile(configFile, []byte("NAME=app\nPORT=many"), 0600))
+
+		var conf config
+		_, err := b().MergeFile(configFile).Replay(lockFile, &conf)
+		require.EqualError(t, err,
+			`live: unmarshal value: configuration key "PORT": strconv.ParseInt: parsing "many": invalid syntax`)
+		require.Equal(t, config{Name: `app`, Port: 80}, conf)
+	})
+}
+
+func TestBuilder_MergeDir(t *testing.T) {
+	dir, err := ioutil.TempDir(``, `readconf`)
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	for name, data := range map[string]string{
+		`10-base.conf`:   "NAME=base\nPORT=80\nDEBUG=false",
+		`available/port`: "PORT=8080",
+		`99-debug.conf`:  "DEBUG=true",
+		`.hidden.conf`:   "NAME=hidden",
+		`30-name.conf~`:  "NAME=backup",
+		`README`:         "NAME=readme",
+		`50-sub.conf/x`:  "",
+		`40-latest.conf`: "NAME=latest",
+	} {
+		filename := filepath.Join(dir, filepath.FromSlash(name))
+		require.NoError(t, os.MkdirAll(filepath.Dir(filename), 0700))
+		require.NoError(t, ioutil.WriteFile(filename, []byte(data), 0600))
+	}
+
+	// snippets are often enabled by linking them
+	require.NoError(t, os.Symlink(filepath.Join(dir, `available`, `port`), filepath.Join(dir, `20-port.conf`)))
+
+	var conf struct {
+		Name  string
+		Port  int
+		Debug bool
+	}
+
+	report, err := b().MergeDir(dir).BuildReport(&conf)
+	require.NoError(t, err)
+	require.Equal(t, `latest`, conf.Name)
+	require.Equal(t, 8080, conf.Port)
+	require.True(t, conf.Debug)
+	require.Equal(t, `latest`, report.Values.Get(`NAME`))
+
+	err = b().MergeDir(filepath.Join(dir, `missing`)).Error()
+	require.Error(t, err)
+	require.True(t, strings.HasPrefix(err.Error(), `dir `+filepath.Join(dir, `missing`)+`: `))
+
+	err = b().
+		Optional(func(b *readconf.Builder) {
+			b.MergeDir(filepath.Join(dir, `missing`))
+		}).
+		MergeDir(dir).
+		Build(&conf)
+	require.NoError(t, err)
+
+	require.NoError(t, os.Symlink(filepath.Join(dir, `missing`), filepath.Join(dir, `60-broken.conf`)))
+	err = b().MergeDir(dir).Error()
+	require.Error(t, err)
+	require.True(t, strings.HasPrefix(err.Error(), `file `+filepath.Join(dir, `60-broken.conf`)+`: `), err.Error())
+}
+
+func TestBuilder_Clone(t *testing.T) {
+	type Config struct {
+		Name string
+		Port int `default:"80"`
+	}
+
+	base := b().Set(`NAME`, `base`)
+
+	t.Run("derived builders don't affect the base", func(t *testing.T) {
+		derived := base.Clone().Set(`NAME`, `derived`).Set(`PORT`, `8080`)
+
+		var conf Config
+		require.NoError(t, derived.Build(&conf))
+		require.Equal(t, Config{Name: `derived`, Port: 8080}, conf)
+
+		conf = Config{}
+		require.NoError(t, base.Build(&conf))
+		require.Equal(t, Config{Name: `base`, Port: 80}, conf)
+	})
+
+	t.Run("builds reflect values merged before them", func(t *testing.T) {
+		b := base.Clone()
+
+		var conf1, conf2 Config
+		require.NoError(t, b.Build(&conf1))
+		require.NoError(t, b.Set(`PORT`, `443`).Build(&conf2))
+		require.Equal(t, Config{Name: `base`, Port: 80}, conf1)
+		require.Equal(t, Config{Name: `base`, Port: 443}, conf2)
+	})
+
+	t.Run("errors are kept", func(t *testing.T) {
+		failed := b().MergeFile(`testdata/missing`)
+		require.Error(t, failed.Clone().Error())
+
+		require.NoError(t, b().Clone().Error())
+	})
+}
+
+func TestBuilder_MergeFile_Include(t *testing.T) {
+	type Config struct {
+		Name   string
+		Port   int
+		Debug  bool
+		Region string
+	}
+
+	t.Run("includes are merged in place", func(t *testing.T) {
+		var conf Config
+		require.NoError(t, b().MergeFile(`testdata/include/base.conf`).Build(&conf))
+		require.Equal(t, Config{Name: `base`, Port: 443, Debug: false, Region: `eu`}, conf)
+	})
+
+	t.Run("cycles fail", func(t *testing.T) {
+		err := b().MergeFile(`testdata/include/cycle-a.conf`).Error()
+		require.Error(t, err)
+		require.Contains(t, err.Error(), `include cycle: `)
+		require.Contains(t, err.Error(), filepath.Join(`include`, `cycle-a.conf`)+` -> `)
+	})
+
+	t.Run("missing includes fail even if optional", func(t *testing.T) {
+		err := b().
+			Optional(func(b *readconf.Builder) {
+				b.MergeFile(`testdata/include/broken.conf`)
+			}).
+			Error()
+		require.Error(t, err)
+		require.Contains(t, err.Error(), `include missing.conf on line 1: `)
+	})
+
+	t.Run("data doesn't support includes", func(t *testing.T) {
+		err := b().MergeData([]byte("@include base.conf")).Error()
+		require.EqualError(t, err, `data: include base.conf on line 1: includes are only supported in files`)
+	})
+}
+
+func TestBuilder_Build_Schedule(t *testing.T) {
+	var conf struct {
+		Name  string
+		Port  int
+		Debug bool `default:"false"`
+	}
+
+	report, err := b().
+		MergeData([]byte(strings.Join([]string{
+			`NAME=old`,
+			`NAME@2001-01-01T00:00Z=scheduled`,
+			`NAME@2002-01-01=latest`,
+			`PORT=80`,
+			`PORT@2999-01-01T00:00:00Z=443`,
+			`PORT@2998-01-01T00:00+02:00=8080`,
+			`DEBUG@2001-01-01=true`,
+		}, "\n"))).
+		BuildReport(&conf)
+	require.NoError(t, err)
+	require.Equal(t, `latest`, conf.Name)
+	require.Equal(t, 80, conf.Port)
+	require.True(t, conf.Debug)
+	require.Equal(t, map[string]time.Time{
+		`PORT`: time.Date(2997, 12, 31, 22, 0, 0, 0, time.UTC),
+	}, utcTimes(report.Expires))
+
+	err = b().Set(`NAME@tomorrow`, `x`).Set(`PORT`, `1`).Build(&conf)
+	require.EqualError(t, err, `invalid activation time of key NAME@TOMORROW`)
+}
+
+func utcTimes(m map[string]time.Time) map[string]time.Time {
+	out := make(map[string]time.Time, len(m))
+	for k, t := range m {
+		out[k] = t.UTC()
+	}
+	return out
+}
+
+func TestBuilder_Build_Composite(t *testing.T) {
+	type config struct {
+		Limit   readconf.RateLimitConfig
+		Breaker readconf.CircuitBreakerConfig
+	}
+
+	var conf config
+	require.NoError(t, b().Build(&conf))
+	require.Equal(t, readconf.RateLimitConfig{Rate: 10, Burst: 1}, conf.Limit)
+	require.Equal(t, 100*time.Millisecond, conf.Limit.Interval())
+	require.Equal(t, readconf.CircuitBreakerConfig{MaxFailures: 5, Timeout: time.Minute, MaxRequests: 1}, conf.Breaker)
+	require.False(t, conf.Breaker.ReadyToTrip(4))
+	require.True(t, conf.Breaker.ReadyToTrip(5))
+
+	require.NoError(t, b().
+		Set(`LIMIT__RATE`, `0.5`).
+		Set(`BREAKER__TIMEOUT`, `5s`).
+		Build(&conf))
+	require.Equal(t, 2*time.Second, conf.Limit.Interval())
+	require.Equal(t, 5*time.Second, conf.Breaker.Timeout)
+}
+
+func TestBuilder_MergeURL(t *testing.T) {
+	var conf struct {
+		Name string
+		Port int
+	}
+
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get(`Authorization`) != `Bearer token` {
+			http.Error(w, `unauthorized`, http.StatusUnauthorized)
+			return
+		}
+
+		switch r.URL.Path {
+		case `/app.json`:
+			w.Header().Set(`ETag`, `"v1"`)
+			fmt.Fprint(w, `{"name": "json", "port": 80}`)
+		case `/app`:
+			w.Header().Set(`Content-Type`, `text/x-colon; charset=utf-8`)
+			fmt.Fprint(w, "name: colon\nport: 81\n")
+		default:
+			w.Header().Set(`Content-Type`, `text/plain`)
+			fmt.Fprint(w, "NAME=env\nPORT=82\n")
+		}
+	})
+
+	server := httptest.NewServer(handler)
+	defer server.Close()
+
+	auth := readconf.WithHeader(`Authorization`, `Bearer token`)
+	ctx := context.Background()
+
+	t.Run("by extension", func(t *testing.T) {
+		lock, err := b().MergeURL(ctx, server.URL+`/app.json`, auth).Lock(&conf)
+		require.NoError(t, err)
+		require.Equal(t, readconf.Map{`NAME`: `json`, `PORT`: `80`}, lock.Values)
+		require.Equal(t, []readconf.LockedSource{{Name: `url ` + server.URL + `/app.json`, Version: `"v1"`}}, lock.Sources)
+	})
+
+	t.Run("by content type", func(t *testing.T) {
+		require.NoError(t, b().MergeURL(ctx, server.URL+`/app`, auth).Build(&conf))
+		require.Equal(t, `colon`, conf.Name)
+		require.Equal(t, 81, conf.Port)
+
+		require.NoError(t, b().MergeURL(ctx, server.URL+`/app.conf`, auth).Build(&conf))
+		require.Equal(t, `env`, conf.Name)
+		require.Equal(t, 82, conf.Port)
+	})
+
+	t.Run("status", func(t *testing.T) {
+		err := b().MergeURL(ctx, server.URL+`/app?token=secret`).Build(&conf)
+		require.EqualError(t, err, `url `+server.URL+`/app: unexpected status 401 Unauthorized`)
+	})
+
+	t.Run("checksum", func(t *testing.T) {
+		sum := fmt.Sprintf("sha256:%x", sha256.Sum256([]byte("NAME=env\nPORT=82\n")))
+
+		err := b().MergeURL(ctx, server.URL+`/app.conf`, auth, readconf.WithChecksum(sum)).Build(&conf)
+		require.NoError(t, err)
+		require.Equal(t, `env`, conf.Name)
+
+		err = b().MergeURL(ctx, server.URL+`/app.conf`, auth, readconf.WithChecksum(`sha256:`+strings.ToUpper(sum[7:]))).Build(&conf)
+		require.NoError(t, err)
+
+		other := fmt.Sprintf("sha256:%x", sha256.Sum256(nil))
+		err = b().MergeURL(ctx, server.URL+`/app.conf`, auth, readconf.WithChecksum(other)).Build(&conf)
+		require.EqualError(t, err, `url `+server.URL+`/app.conf: checksum mismatch: expected `+other+`, got `+sum)
+
+		err = b().MergeURL(ctx, server.URL+`/app.conf`, auth, readconf.WithChecksum(`md5:abc`)).Build(&conf)
+		require.EqualError(t, err, `url `+server.URL+`/app.conf: unsupported checksum md5:abc`)
+	})
+
+	t.Run("tls", func(t *testing.T) {
+		server := httptest.NewTLSServer(handler)
+		defer server.Close()
+
+		err := b().MergeURL(ctx, server.URL+`/app`, auth).Build(&conf)
+		require.Error(t, err)
+
+		pool := x509.NewCertPool()
+		pool.AddCert(server.Certificate())
+
+		err = b().
+			MergeURL(ctx, server.URL+`/app`, auth, readconf.WithTLSConfig(&tls.Config{RootCAs: pool})).
+			Build(&conf)
+		require.NoError(t, err)
+		require.Equal(t, `colon`, conf.Name)
+	})
+
+	t.Run("timeout", func(t *testing.T) {
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			time.Sleep(100 * time.Millisecond)
+		}))
+		defer server.Close()
+
+		err := b().MergeURL(ctx, server.URL, readconf.WithTimeout(time.Millisecond)).Build(&conf)
+		require.Error(t, err)
+	})
+
+	t.Run("redacted errors", func(t *testing.T) {
+		server := httptest.NewServer(handler)
+		rawURL := strings.Replace(server.URL, `://`, `://app:hunter2@`, 1) + `/app?token=secret`
+		server.Close()
+
+		err := b().MergeURL(ctx, rawURL).Build(&conf)
+		require.Error(t, err)
+		require.Contains(t, err.Error(), server.URL+`/app`)
+		require.NotContains(t, err.Error(), `hunter2`)
+		require.NotContains(t, err.Error(), `secret`)
+	})
+}
+
+func TestBuilder_Build_HTTPConfig(t *testing.T) {
+	type config struct {
+		Server readconf.HTTPServerConfig
+		Client readconf.HTTPClientConfig
+	}
+
+	var conf config
+
+	require.NoError(t, b().
+		Set(`SERVER__ADDR`, `:9090`).
+		Set(`CLIENT__TIMEOUT`, `5s`).
+		Set(`CLIENT__PROXY`, `http://proxy:3128`).
+		Build(&conf))
+
+	server := &http.Server{}
+	conf.Server.Apply(server)
+	require.Equal(t, `:9090`, server.Addr)
+	require.Equal(t, 10*time.Second, server.ReadHeaderTimeout)
+	require.Equal(t, 2*time.Minute, server.IdleTimeout)
+	require.Equal(t, 1<<20, server.MaxHeaderBytes)
+
+	client := conf.Client.Build()
+	require.Equal(t, 5*time.Second, client.Timeout)
+
+	transport := client.Transport.(*http.Transport)
+	require.Equal(t, 100, transport.MaxIdleConns)
+	require.Equal(t, 90*time.Second, transport.IdleConnTimeout)
+
+	proxy, err := transport.Proxy(httptest.NewRequest(http.MethodGet, `http://example.com`, nil))
+	require.NoError(t, err)
+	require.Equal(t, `http://proxy:3128`, proxy.String())
+}
+
+func TestBuilder_Build_GRPCConfig(t *testing.T) {
+	type config struct {
+		Server  readconf.GRPCServerConfig
+		Backend readconf.GRPCClientConfig
+	}
+
+	var conf config
+	require.NoError(t, b().
+		Set(`BACKEND__TARGET`, `dns:///backend:443`).
+		Set(`BACKEND__TLS__SERVER_NAME`, `backend`).
+		Build(&conf))
+	require.Equal(t, `:9090`, conf.Server.Addr)
+	require.Equal(t, 4<<20, conf.Server.MaxRecvMsgSize)
+	require.Equal(t, 2*time.Hour, conf.Server.KeepaliveTime)
+	require.Equal(t, 20*time.Second, conf.Backend.KeepaliveTimeout)
+
+	tlsConfig, err := conf.Backend.TLS.Load()
+	require.NoError(t, err)
+	require.Equal(t, `backend`, tlsConfig.ServerName)
+	require.Nil(t, tlsConfig.RootCAs)
+
+	tlsConfig, err = readconf.TLSConfig{CAFile: `testdata/ca.pem`}.Load()
+	require.NoError(t, err)
+	require.NotNil(t, tlsConfig.ClientCAs)
+	require.Equal(t, tls.RequireAndVerifyClientCert, tlsConfig.ClientAuth)
+
+	tlsConfig, err = readconf.TLSConfig{CAFile: `testdata/ca.pem`, ClientAuth: `verify-if-given`}.Load()
+	require.NoError(t, err)
+	require.Equal(t, tls.VerifyClientCertIfGiven, tlsConfig.ClientAuth)
+
+	_, err = readconf.TLSConfig{ClientAuth: `always`}.Load()
+	require.EqualError(t, err, `unknown client auth always`)
+
+	_, err = readconf.TLSConfig{CAFile: `testdata/config.json`}.Load()
+	require.EqualError(t, err, `no certificates in testdata/config.json`)
+
+	_, err = readconf.TLSConfig{CertFile: `testdata/missing.pem`, KeyFile: `testdata/missing.pem`}.Load()
+	require.Error(t, err)
+}
+
+func TestNames(t *testing.T) {
+	type config struct {
+		Name string `default:"app"`
+		DB   struct {
+			MaxConns int    `default:"10"`
+			Host     string `config:"address"`
+		}
+		HTTPPort int `default:"80"`
+	}
+
+	names, err := readconf.Names(&config{}, `APP_`)
+	require.NoError(t, err)
+	require.Equal(t, []readconf.KeyNames{
+		{Key: `DB__ADDRESS`, Env: `APP_DB__ADDRESS`, Flag: `db.address`},
+		{Key: `DB__MAX_CONNS`, Env: `APP_DB__MAX_CONNS`, Flag: `db.max-conns`},
+		{Key: `HTTP_PORT`, Env: `APP_HTTP_PORT`, Flag: `http-port`},
+		{Key: `NAME`, Env: `APP_NAME`, Flag: `name`},
+	}, names)
+
+	require.Equal(t, `DB__MAX_CONNS`, readconf.StructKey(`DB`, `MaxConns`))
+	require.Equal(t, `HTTP_PORT`, readconf.StructKey(`HTTPPort`))
+
+	values := map[string]string{
+		`DB__ADDRESS`:   `localhost`,
+		`DB__MAX_CONNS`: `20`,
+		`HTTP_PORT`:     `8080`,
+		`NAME`:          `other`,
+	}
+
+	var data bytes.Buffer
+	env := []string{}
+	args := []string{}
+	for _, n := range names {
+		fmt.Fprintf(&data, "%s=%s\n", n.Key, values[n.Key])
+		env = append(env, n.Env+`=`+values[n.Key])
+		args = append(args, `-`+n.Flag+`=`+values[n.Key])
+	}
+
+	fs := flag.NewFlagSet(`test`, flag.ContinueOnError)
+	require.NoError(t, readconf.DefineFlags(fs, &config{}))
+	require.NoError(t, fs.Parse(args))
+
+	var fromData, fromEnv, fromFlags config
+	require.NoError(t, b().MergeData(data.Bytes()).Build(&fromData))
+	require.NoError(t, b().MergeEnviron(`APP_`, env).Build(&fromEnv))
+	require.NoError(t, b().MergeFlags(fs).Build(&fromFlags))
+
+	require.Equal(t, `localhost`, fromData.DB.Host)
+	require.Equal(t, 8080, fromData.HTTPPort)
+	require.Equal(t, fromData, fromEnv)
+	require.Equal(t, fromData, fromFlags)
+}
+
+func TestBuilder_LargeValues(t *testing.T) {
+	dir, err := ioutil.TempDir(``, `readconf`)
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	bundle := strings.Repeat("-----BEGIN CERTIFICATE-----\n", 100)
+
+	var conf struct {
+		Bundle io.Reader
+		Copy   string
+		Small  io.Reader
+		Schema io.Reader `default:"{}"`
+	}
+
+	report, err := b().
+		LargeValues(1024, dir).
+		Set(`BUNDLE`, bundle).
+		Set(`COPY`, bundle).
+		Set(`SMALL`, `small`).
+		BuildReport(&conf)
+	require.NoError(t, err)
+
+	files, err := ioutil.ReadDir(dir)
+	require.NoError(t, err)
+	require.Len(t, files, 1)
+	require.Equal(t, os.FileMode(0600), files[0].Mode().Perm())
+	require.True(t, len(report.Values.Get(`BUNDLE`)) < 1024)
+
+	for _, r := range []io.Reader{conf.Bundle, conf.Small, conf.Schema} {
+		require.NotNil(t, r)
+	}
+
+	data, err := ioutil.ReadAll(conf.Bundle)
+	require.NoError(t, err)
+	require.Equal(t, bundle, string(data))
+	require.Equal(t, bundle, conf.Copy)
+
+	data, err = ioutil.ReadAll(conf.Small)
+	require.NoError(t, err)
+	require.Equal(t, `small`, string(data))
+
+	data, err = ioutil.ReadAll(conf.Schema)
+	require.NoError(t, err)
+	require.Equal(t, `{}`, string(data))
+
+	m, err := readconf.Marshal(&conf)
+	require.NoError(t, err)
+	require.Equal(t, bundle, m.Get(`BUNDLE`))
+	require.Equal(t, `small`, m.Get(`SMALL`))
+	require.Equal(t, `{}`, m.Get(`SCHEMA`))
+
+	err = b().LargeValues(1, filepath.Join(dir, `missing`)).Set(`BUNDLE`, bundle).Error()
+	require.Error(t, err)
+	require.True(t, strings.HasPrefix(err.Error(), `store value of key BUNDLE: `), err.Error())
+
+	t.Run("reused", func(t *testing.T) {
+		next, err := b().
+			LargeValues(1024, dir).
+			Set(`BUNDLE`, bundle).
+			Set(`COPY`, bundle).
+			Set(`SMALL`, `small`).
+			BuildReport(&conf)
+		require.NoError(t, err)
+		require.Empty(t, report.Changes(next))
+
+		files, err := ioutil.ReadDir(dir)
+		require.NoError(t, err)
+		require.Len(t, files, 1)
+	})
+
+	t.Run("references from sources", func(t *testing.T) {
+		reference := report.Values.Get(`BUNDLE`)
+
+		var conf struct {
+			Name string
+		}
+
+		for _, builder := range []*readconf.Builder{
+			b().MergeJSON([]byte(`{"name": "\u0000readconf-external:/etc/hostname"}`)),
+			b().LargeValues(1024, dir).Set(`NAME`, reference),
+		} {
+			require.NoError(t, builder.Build(&conf))
+			require.True(t, strings.HasPrefix(conf.Name, "\x00readconf-external:"), conf.Name)
+		}
+	})
+}
+
+func TestBuilder_RequireAtLeastOneOf(t *testing.T) {
+	var conf struct {
+		Name string `default:"app"`
+	}
+
+	err := b().
+		RequireAtLeastOneOf(`file`, `environment`).
+		Optional(func(b *readconf.Builder) {
+			b.MergeFile(`testdata/missing.conf`)
+		}).
+		MergeEnviron(`APP_`, []string{`OTHER_NAME=x`}).
+		Build(&conf)
+	require.EqualError(t, err, `no keys from any of the sources file, environment`)
+	require.IsType(t, &readconf.NoSourceError{}, err)
+	require.JSONEq(t, `{
+		"kind": "no_source",
+		"message": "no keys from any of the sources file, environment",
+		"keys": [
+			{"source": "file", "problem": "no keys"},
+			{"source": "environment", "problem": "no keys"}
+		]
+	}`, string(readconf.ErrorsAsJSON(err)))
+
+	require.NoError(t, b().
+		RequireAtLeastOneOf(`file`, `environment`).
+		MergeEnviron(`APP_`, []string{`APP_NAME=x`}).
+		Build(&conf))
+
+	require.NoError(t, b().
+		RequireAtLeastOneOf(`file testdata/config.env`).
+		MergeFile(`testdata/config.env`).
+		Build(&conf))
+
+	err = b().
+		RequireAtLeastOneOf(`file /etc/app.conf`).
+		MergeFile(`testdata/config.env`).
+		Build(&conf)
+	require.EqualError(t, err, `no keys from any of the sources file /etc/app.conf`)
+
+	t.Run("kinds", func(t *testing.T) {
+		require.NoError(t, b().
+			RequireAtLeastOneOf(`file`, `env`).
+			MergeJSONFile(`testdata/config.json`).
+			Build(&conf))
+
+		require.NoError(t, b().
+			RequireAtLeastOneOf(`file`, `env`).
+			MergeEnviron(`APP_`, []string{`APP_NAME=x`}).
+			Build(&conf))
+
+		err := b().
+			RequireAtLeastOneOf(`file`, `env`).
+			MergeEnviron(`APP_`, []string{`OTHER_NAME=x`}).
+			Set(`NAME`, `x`).
+			Build(&conf)
+		require.EqualError(t, err, `no keys from any of the sources file, env`)
+	})
+}
+
+func TestBuilder_MergeKeyPerFile(t *testing.T) {
+	if runtime.GOOS == `windows` {
+		t.Skip(`symlinks`)
+	}
+
+	dir, err := ioutil.TempDir(``, `readconf`)
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	// the layout of Kubernetes volumes
+	data := filepath.Join(dir, `..2024_01_01_00_00_00.1`)
+	require.NoError(t, os.MkdirAll(filepath.Join(data, `nested`), 0700))
+	require.NoError(t, ioutil.WriteFile(filepath.Join(data, `NAME`), []byte(`app`), 0600))
+	require.NoError(t, ioutil.WriteFile(filepath.Join(data, `db.max-conns`), []byte(`20`), 0600))
+	require.NoError(t, ioutil.WriteFile(filepath.Join(data, `db.password`), []byte("secret\n"), 0600))
+	require.NoError(t, os.Symlink(filepath.Base(data), filepath.Join(dir, `..data`)))
+	for _, name := range []string{`NAME`, `db.max-conns`, `db.password`, `nested`} {
+		require.NoError(t, os.Symlink(filepath.Join(`..data`, name), filepath.Join(dir, name)))
+	}
+
+	var conf struct{}
+	lock, err := b().MergeKeyPerFile(dir).Lock(&conf)
+	require.NoError(t, err)
+	require.Equal(t, readconf.Map{
+		`NAME`:          `app`,
+		`DB__MAX_CONNS`: `20`,
+		`DB__PASSWORD`:  "secret\n",
+	}, lock.Values)
+	require.Equal(t, []readconf.LockedSource{{
+		Name:    `directory ` + dir,
+		Version: filepath.Base(data),
+	}}, lock.Sources)
+
+	err = b().MergeKeyPerFile(filepath.Join(dir, `missing`)).Error()
+	require.Error(t, err)
+	require.True(t, strings.HasPrefix(err.Error(), `directory `+filepath.Join(dir, `missing`)+`: `))
+}
+
+func TestBuilder_IgnoreEmpty(t *testing.T) {
+	type config struct {
+		Host string
+		Port int `default:"80"`
+		Path string
+	}
+
+	env := []string{`APP_HOST=`, `APP_PORT=`, `APP_PATH=`}
+
+	var conf config
+	err := b().
+		MergeData([]byte("HOST=localhost\nPATH=/")).
+		MergeEnviron(`APP_`, env).
+		Build(&conf)
+	require.IsType(t, &readconf.UnmarshalError{}, err)
+
+	err = b().
+		MergeData([]byte("HOST=localhost\nPATH=/")).
+		IgnoreEmpty().
+		MergeEnviron(`APP_`, env).
+		Set(`PATH`, `/api`).
+		Build(&conf)
+	require.NoError(t, err)
+	require.Equal(t, config{Host: `localhost`, Port: 80, Path: `/api`}, conf)
+
+	err = b().
+		IgnoreEmpty().
+		MergeEnviron(`APP_`, env).
+		Build(&conf)
+	require.IsType(t, &readconf.MissingKeysError{}, err)
+	require.Equal(t, []string{`HOST`, `PATH`}, err.(*readconf.MissingKeysError).Keys)
+}
+
+func TestBuilder_Build_Presence(t *testing.T) {
+	type config struct {
+		Debug   bool `presence:"true"`
+		Verbose bool `presence:"true"`
+		Trace   bool `presence:"true" default:"true"`
+	}
+
+	var conf config
+	report, err := b().MergeEnviron(`APP_`, []string{`APP_DEBUG=`}).BuildReport(&conf)
+	require.NoError(t, err)
+	require.Equal(t, config{Debug: true, Verbose: false, Trace: true}, conf)
+	require.Equal(t, readconf.OriginSet, report.Origins[`DEBUG`])
+	require.Equal(t, readconf.OriginDefault, report.Origins[`VERBOSE`])
+
+	require.NoError(t, b().MergeEnviron(`APP_`, []string{`APP_VERBOSE=false`, `APP_TRACE=`}).Build(&conf))
+	require.Equal(t, config{Debug: false, Verbose: true, Trace: true}, conf)
+
+	docs, err := readconf.Describe(&conf)
+	require.NoError(t, err)
+	require.Equal(t, readconf.FieldDoc{Key: `DEBUG`, Type: `bool`, Default: `false`, HasDefault: true}, docs[0])
+
+	var invalid struct {
+		Name string `presence:"true"`
+	}
+	err = b().Build(&invalid)
+	require.EqualError(t, err, `configuration key "NAME": presence tag on string field`)
+}
+
+func TestBuilder_NamedFiles(t *testing.T) {
+	dir, err := ioutil.TempDir(``, `readconf`)
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	write := func(name, data string) {
+		require.NoError(t, ioutil.WriteFile(filepath.Join(dir, name), []byte(data), 0644))
+	}
+
+	write(`b.pem`, `bbb`)
+	write(`a.pem`, `aaa`)
+	write(`c.key`, `ccc`)
+	require.NoError(t, os.Mkdir(filepath.Join(dir, `d.pem`), 0755))
+
+	type config struct {
+		Certs []readconf.NamedFile
+		Keys  []readconf.NamedFile `default:""`
+	}
+
+	var conf config
+	report, err := b().
+		Set(`CERTS`, filepath.Join(dir, `*.pem`)+`,`+filepath.Join(dir, `a.*`)).
+		BuildReport(&conf)
+	require.NoError(t, err)
+	require.Len(t, conf.Certs, 2)
+	require.Empty(t, conf.Keys)
+
+	require.Equal(t, readconf.NamedFile{
+		Name: `a.pem`,
+		Path: filepath.Join(dir, `a.pem`),
+		Hash: `sha256:9834876dcfb05cb167a5c24953eba58c4ac89b1adf57f28f2f9d09af107ee8f0`,
+		Data: []byte(`aaa`),
+	}, conf.Certs[0])
+	require.Equal(t, `b.pem`, conf.Certs[1].Name)
+
+	t.Run("marshal", func(t *testing.T) {
+		m, err := readconf.Marshal(&conf)
+		require.NoError(t, err)
+		require.Equal(t, `[`+strconv.Quote(filepath.Join(dir, `a.pem`))+`,`+strconv.Quote(filepath.Join(dir, `b.pem`))+`]`, m.Get(`CERTS`))
+
+		var next config
+		require.NoError(t, b().MergeMap(m).Build(&next))
+		require.Equal(t, conf, next)
+	})
+
+	t.Run("changes", func(t *testing.T) {
+		write(`b.pem`, `BBB`)
+
+		next, err := b().Set(`CERTS`, filepath.Join(dir, `*.pem`)).BuildReport(&config{})
+		require.NoError(t, err)
+
+		changes := report.Changes(next)
+		require.Len(t, changes, 1)
+		require.Equal(t, `CERTS`, changes[0].Key)
+	})
+
+	t.Run("paths", func(t *testing.T) {
+		var conf config
+		require.NoError(t, b().Set(`CERTS`, `[]`).Set(`KEYS`, `[`+strconv.Quote(filepath.Join(dir, `c.key`))+`]`).Build(&conf))
+		require.Empty(t, conf.Certs)
+		require.Len(t, conf.Keys, 1)
+		require.Equal(t, []byte(`ccc`), conf.Keys[0].Data)
+	})
+
+	t.Run("pattern list", func(t *testing.T) {
+		var conf config
+		patterns := `[` + strconv.Quote(filepath.Join(dir, `*.key`)) + `,` + strconv.Quote(filepath.Join(dir, `b.*`)) + `]`
+		require.NoError(t, b().Set(`CERTS`, patterns).Build(&conf))
+		require.Len(t, conf.Certs, 2)
+		require.Equal(t, `c.key`, conf.Certs[0].Name)
+		require.Equal(t, `b.pem`, conf.Certs[1].Name)
+	})
+
+	t.Run("invalid pattern", func(t *testing.T) {
+		err := b().Set(`CERTS`, `[`).Build(&config{})
+		require.Error(t, err)
+		require.Contains(t, err.Error(), `configuration key "CERTS"`)
+
+		err = b().Set(`CERTS`, filepath.Join(dir, `[`)).Build(&config{})
+		require.Error(t, err)
+		require.Contains(t, err.Error(), `resolve values: configuration key "CERTS": pattern `)
+	})
+}
@@ -0,0 +1,147 @@
+package readconf
+
+import (
+	"fmt"
+	"hash/fnv"
+	"os"
+)
+
+const (
+	// LayerStable is the layer of a Canary rollout selected for instances
+	// outside the canary.
+	LayerStable = `stable`
+	// LayerCanary is the layer of a Canary rollout selected for instances in
+	// the canary.
+	LayerCanary = `canary`
+)
+
+// Instance sets the identity of the running instance used by Canary, the
+// hostname by default.
+func (b *Builder) Instance(id string) *Builder {
+	if b.hasError() {
+		return b
+	}
+
+	b.instance = id
+	return b
+}
+
+// Canary merges the sources added by canary on percent percent of instances,
+// and those added by stable on the others. Instances are selected by a hash of
+// their identity and name, so an instance keeps its layer as percent grows,
+// and different rollouts select different instances. The selected layer is
+// reported in Report.Layers under name.
+func (b *Builder) Canary(name string, percent float64, stable, canary func(b *Builder)) *Builder {
+	if b.hasError() {
+		return b
+	}
+
+	instance, err := b.instanceID()
+	if err != nil {
+		b.err = wrapError(err, "canary %s", name)
+		return b
+	}
+
+	layer, f := LayerStable, stable
+	if canaryBucket(name, instance) < percent {
+		layer, f = LayerCanary, canary
+	}
+
+	b.setLayer(name, layer)
+
+	return b.mergeTier(f, false, func(err error) bool {
+		return false
+	})
+}
+
+// Variant is a candidate value of a key in an Experiment.
+type Variant struct {
+	// Name identifies the variant in Report.Layers, the value if empty.
+	Name  string
+	Value string
+	// Weight is the share of instances selecting the variant, relative to
+	// the weights of the other variants.
+	Weight float64
+}
+
+// Experiment sets the value of key to one of variants, selected by weight like
+// the layers of Canary, so that every instance keeps its variant while the
+// weights stay the same. The selected variant is reported in Report.Layers
+// under key.
+func (b *Builder) Experiment(key string, variants ...Variant) *Builder {
+	if b.hasError() {
+		return b
+	}
+
+	total := 0.0
+	for _, v := range variants {
+		if v.Weight < 0 {
+			b.err = fmt.Errorf("experiment %s: negative weight of variant %s", key, v.name())
+			return b
+		}
+
+		total += v.Weight
+	}
+
+	if total == 0 {
+		b.err = fmt.Errorf("experiment %s: no variant with a weight", key)
+		return b
+	}
+
+	instance, err := b.instanceID()
+	if err != nil {
+		b.err = wrapError(err, "experiment %s", key)
+		return b
+	}
+
+	bucket := canaryBucket(normalizeKey(key), instance) / 100 * total
+
+	selected := variants[0]
+	for _, v := range variants {
+		if v.Weight == 0 {
+			continue
+		}
+
+		selected = v
+		if bucket < v.Weight {
+			break
+		}
+		bucket -= v.Weight
+	}
+
+	b.setLayer(normalizeKey(key), selected.name())
+	return b.Set(key, selected.Value)
+}
+
+func (v Variant) name() string {
+	if v.Name == `` {
+		return v.Value
+	}
+
+	return v.Name
+}
+
+// Returns the identity of the instance, see Instance.
+func (b *Builder) instanceID() (string, error) {
+	if b.instance != `` {
+		return b.instance, nil
+	}
+
+	return os.Hostname()
+}
+
+func (b *Builder) setLayer(name, layer string) {
+	if b.layers == nil {
+		b.layers = map[string]string{}
+	}
+	b.layers[name] = layer
+}
+
+// Returns the bucket of an instance in a rollout, in [0, 100).
+func canaryBucket(name, instance string) float64 {
+	h := fnv.New32a()
+	h.Write([]byte(name))
+	h.Write([]byte{0})
+	h.Write([]byte(instance))
+	return float64(h.Sum32()%10000) / 100
+}
@@ -0,0 +1,188 @@
+package main
+
+import (
+	"bytes"
+	"flag"
+	"fmt"
+	"go/ast"
+	"go/format"
+	"go/parser"
+	"go/token"
+	"io/ioutil"
+	"os"
+	"reflect"
+	"strconv"
+	"strings"
+
+	"github.com/tetratom/readconf"
+)
+
+func gen(args []string) error {
+	fs := flag.NewFlagSet(`gen`, flag.ExitOnError)
+	out := fs.String(`o`, ``, "write the code to `file` instead of standard output")
+	fs.Parse(args)
+
+	if fs.NArg() < 2 {
+		usage()
+	}
+
+	fset := token.NewFileSet()
+	file, err := parser.ParseFile(fset, fs.Arg(0), nil, 0)
+	if err != nil {
+		return err
+	}
+
+	structs := map[string]*ast.StructType{}
+	ast.Inspect(file, func(n ast.Node) bool {
+		if spec, ok := n.(*ast.TypeSpec); ok {
+			if st, ok := spec.Type.(*ast.StructType); ok {
+				structs[spec.Name.Name] = st
+			}
+		}
+
+		return true
+	})
+
+	var buf bytes.Buffer
+	fmt.Fprintf(&buf, "// Code generated by readconf gen. DO NOT EDIT.\n\n")
+	fmt.Fprintf(&buf, "package %s\n\n", file.Name.Name)
+	fmt.Fprintf(&buf, "import \"github.com/tetratom/readconf/tinyconf\"\n")
+
+	for _, name := range fs.Args()[1:] {
+		st, ok := structs[name]
+		if !ok {
+			return fmt.Errorf("struct type %s not found in %s", name, fs.Arg(0))
+		}
+
+		g := generator{structs: structs, buf: &buf}
+
+		fmt.Fprintf(&buf, "\n// ConfigFields returns the fields of the configuration for tinyconf.Build.\n")
+		fmt.Fprintf(&buf, "func (c *%s) ConfigFields() []tinyconf.Field {\n\treturn []tinyconf.Field{\n", name)
+		if err := g.fields(st, `c`, nil, []string{name}); err != nil {
+			return err
+		}
+		fmt.Fprintf(&buf, "\t}\n}\n")
+	}
+
+	src, err := format.Source(buf.Bytes())
+	if err != nil {
+		return err
+	}
+
+	if *out == `` {
+		_, err = os.Stdout.Write(src)
+		return err
+	}
+
+	return ioutil.WriteFile(*out, src, 0644)
+}
+
+// Writes the fields of ConfigFields methods for structs declared in a file.
+type generator struct {
+	structs map[string]*ast.StructType
+	buf     *bytes.Buffer
+}
+
+// Writes the fields of st, at expr, whose keys start with the keys of path.
+// types holds the struct types the fields are nested in, to detect cycles.
+func (g generator) fields(st *ast.StructType, expr string, path, types []string) error {
+	for _, field := range st.Fields.List {
+		tag := reflect.StructTag(``)
+		if field.Tag != nil {
+			s, err := strconv.Unquote(field.Tag.Value)
+			if err != nil {
+				return err
+			}
+			tag = reflect.StructTag(s)
+		}
+
+		names := make([]string, 0, len(field.Names))
+		for _, ident := range field.Names {
+			names = append(names, ident.Name)
+		}
+
+		embedded := len(names) == 0
+		if embedded {
+			ident, ok := field.Type.(*ast.Ident)
+			if !ok {
+				return fmt.Errorf("%s: unsupported embedded field", strings.Join(types, `.`))
+			}
+
+			names = append(names, ident.Name)
+		}
+
+		for _, name := range names {
+			if !ast.IsExported(name) {
+				continue
+			}
+
+			key := readconf.StructKey(name)
+
+			options := strings.Split(tag.Get(`config`), `,`)
+			tagName, optional := options[0], false
+			for _, option := range options[1:] {
+				if option != `optional` {
+					return fmt.Errorf("%s.%s: unknown option %s of config tag", strings.Join(types, `.`), name, option)
+				}
+
+				optional = true
+			}
+
+			switch {
+			case tagName == `-`:
+				continue
+			case tagName != ``:
+				key = strings.ToUpper(tagName)
+			}
+
+			fieldPath := path
+			if !embedded {
+				fieldPath = append(path[:len(path):len(path)], key)
+			}
+
+			fieldExpr := expr + `.` + name
+
+			if st, typeName := g.structType(field.Type); st != nil {
+				for _, t := range types {
+					if t == typeName && typeName != `` {
+						return fmt.Errorf("cyclic struct type %s at %s", typeName, strings.Join(types, `.`))
+					}
+				}
+
+				if err := g.fields(st, fieldExpr, fieldPath, append(types[:len(types):len(types)], typeName)); err != nil {
+					return err
+				}
+
+				continue
+			}
+
+			if _, ok := field.Type.(*ast.StarExpr); ok {
+				return fmt.Errorf("%s.%s: pointer fields are not supported", strings.Join(types, `.`), name)
+			}
+
+			fmt.Fprintf(g.buf, "\t\t{Key: %s, Value: &%s", strconv.Quote(strings.Join(fieldPath, `__`)), fieldExpr)
+			if value, ok := tag.Lookup(`default`); ok {
+				fmt.Fprintf(g.buf, ", Default: %s, HasDefault: true", strconv.Quote(value))
+			}
+			if optional {
+				fmt.Fprintf(g.buf, ", Optional: true")
+			}
+			fmt.Fprintf(g.buf, "},\n")
+		}
+	}
+
+	return nil
+}
+
+// Returns the struct type of expr and its name, if it is a struct declared
+// inline or in the file.
+func (g generator) structType(expr ast.Expr) (*ast.StructType, string) {
+	switch t := expr.(type) {
+	case *ast.StructType:
+		return t, ``
+	case *ast.Ident:
+		return g.structs[t.Name], t.Name
+	default:
+		return nil, ``
+	}
+}
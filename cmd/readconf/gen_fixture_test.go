@@ -0,0 +1,28 @@
+package main
+
+import "time"
+
+// types that gen_test.go generates ConfigFields methods for
+
+type genConfig struct {
+	Name     string
+	Interval time.Duration `default:"1s"`
+	WiFi     struct {
+		SSID     string
+		Password string `config:",optional"`
+	}
+	DB      genDatabase `config:"STORE"`
+	Ignored string      `config:"-"`
+	GenEmbedded
+
+	internal string
+}
+
+type genDatabase struct {
+	Host     string `default:"localhost"`
+	MaxConns int    `default:"10"`
+}
+
+type GenEmbedded struct {
+	LogLevel string `config:"LOG_LEVEL" default:"info"`
+}
@@ -0,0 +1,61 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/tetratom/readconf"
+)
+
+var _generatedField = regexp.MustCompile(`\{Key: ("[^"]*"), Value: [^,}]+(?:, Default: ("(?:[^"\\]|\\.)*"), HasDefault: true)?`)
+
+func TestGen(t *testing.T) {
+	dir, err := ioutil.TempDir(``, `readconf`)
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	out := filepath.Join(dir, `config_gen.go`)
+	require.NoError(t, gen([]string{`-o`, out, `gen_fixture_test.go`, `genConfig`}))
+
+	src, err := ioutil.ReadFile(out)
+	require.NoError(t, err)
+
+	generated := map[string]string{}
+	for _, m := range _generatedField.FindAllStringSubmatch(string(src), -1) {
+		key, err := strconv.Unquote(m[1])
+		require.NoError(t, err)
+
+		def := `-`
+		if m[2] != `` {
+			def, err = strconv.Unquote(m[2])
+			require.NoError(t, err)
+		}
+
+		generated[key] = def
+	}
+
+	docs, err := readconf.Describe(&genConfig{})
+	require.NoError(t, err)
+
+	described := map[string]string{}
+	for _, doc := range docs {
+		def := `-`
+		if doc.HasDefault {
+			def = doc.Default
+		}
+
+		described[doc.Key] = def
+	}
+
+	require.Equal(t, described, generated)
+	require.Len(t, generated, 7)
+
+	err = gen([]string{`gen_fixture_test.go`, `genMissing`})
+	require.EqualError(t, err, `struct type genMissing not found in gen_fixture_test.go`)
+}
@@ -0,0 +1,115 @@
+// Command readconf provides tooling for readconf configuration files.
+//
+// Usage:
+//
+//	readconf rewrite [-o out] file OLD=NEW...
+//	readconf search file pattern
+//	readconf gen [-o out] file Type...
+//
+// rewrite renames keys in a configuration file, keeping comments intact. The
+// file is rewritten in place unless -o is given.
+//
+// search prints the keys of a configuration file matching pattern, with their
+// values. Patterns are globs, or regular expressions enclosed in slashes.
+//
+// gen generates ConfigFields methods for the named struct types declared in a
+// Go file, so that tinyconf can build them without reflection, e.g. with
+// TinyGo. Nested structs must be declared inline or in the same file.
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"strings"
+
+	"github.com/tetratom/readconf"
+)
+
+func main() {
+	if len(os.Args) < 2 {
+		usage()
+	}
+
+	switch os.Args[1] {
+	case `rewrite`:
+		if err := rewrite(os.Args[2:]); err != nil {
+			fmt.Fprintln(os.Stderr, "readconf:", err)
+			os.Exit(1)
+		}
+	case `search`:
+		if err := search(os.Args[2:]); err != nil {
+			fmt.Fprintln(os.Stderr, "readconf:", err)
+			os.Exit(1)
+		}
+	case `gen`:
+		if err := gen(os.Args[2:]); err != nil {
+			fmt.Fprintln(os.Stderr, "readconf:", err)
+			os.Exit(1)
+		}
+	default:
+		usage()
+	}
+}
+
+func usage() {
+	fmt.Fprintln(os.Stderr, "usage: readconf rewrite [-o out] file OLD=NEW...")
+	fmt.Fprintln(os.Stderr, "       readconf search file pattern")
+	fmt.Fprintln(os.Stderr, "       readconf gen [-o out] file Type...")
+	os.Exit(2)
+}
+
+func rewrite(args []string) error {
+	fs := flag.NewFlagSet(`rewrite`, flag.ExitOnError)
+	out := fs.String(`o`, ``, "write the result to `file` instead of rewriting in place")
+	fs.Parse(args)
+
+	if fs.NArg() < 2 {
+		usage()
+	}
+
+	in := fs.Arg(0)
+	if *out == `` {
+		*out = in
+	}
+
+	rules := make([]readconf.RenameRule, 0, fs.NArg()-1)
+	for _, arg := range fs.Args()[1:] {
+		kvp := strings.SplitN(arg, "=", 2)
+		if len(kvp) != 2 || kvp[0] == `` || kvp[1] == `` {
+			return fmt.Errorf("invalid rename rule %q, expected OLD=NEW", arg)
+		}
+
+		rules = append(rules, readconf.RenameRule{From: kvp[0], To: kvp[1]})
+	}
+
+	return readconf.Rewrite(rules, in, *out)
+}
+
+func search(args []string) error {
+	if len(args) != 2 {
+		usage()
+	}
+
+	data, err := ioutil.ReadFile(args[0])
+	if err != nil {
+		return err
+	}
+
+	m, err := readconf.ParseData(data)
+	if err != nil {
+		return err
+	}
+
+	infos, err := m.Map().Search(args[1])
+	if err != nil {
+		return err
+	}
+
+	for _, info := range infos {
+		fmt.Printf("%s=%s\n", info.Key, info.Value)
+	}
+
+	return nil
+}
@@ -0,0 +1,76 @@
+// Package cobrasupport binds configuration structs to the flags of cobra
+// commands, or of any pflag.FlagSet, without depending on those packages.
+package cobrasupport
+
+import "github.com/tetratom/readconf"
+
+// FlagSet holds the methods of *pflag.FlagSet used by Bind, e.g. of
+// cmd.Flags() of a cobra command.
+type FlagSet interface {
+	String(name, value, usage string) *string
+	Changed(name string) bool
+}
+
+// Flags are the flags bound to the configuration keys of a target.
+type Flags struct {
+	fs     FlagSet
+	keys   []string
+	names  []string
+	values []*string
+}
+
+// Bind defines a string flag on fs for every configuration key of target,
+// named by Name, with the default value of the key and the usage of its
+// field's usage tag:
+//
+//	flags, err := cobrasupport.Bind(cmd.Flags(), &conf)
+//	...
+//	cmd.RunE = func(cmd *cobra.Command, args []string) error {
+//		return readconf.NewBuilder().
+//			MergeFile("app.conf").
+//			MergeEnviron("APP_", os.Environ()).
+//			MergeBuilder(flags.Builder()).
+//			Build(&conf)
+//	}
+func Bind(fs FlagSet, target interface{}) (*Flags, error) {
+	docs, err := readconf.Describe(target)
+	if err != nil {
+		return nil, err
+	}
+
+	f := &Flags{fs: fs}
+	for _, doc := range docs {
+		usage := doc.Usage
+		if usage == `` {
+			usage = doc.Type
+		}
+
+		name := Name(doc.Key)
+		f.keys = append(f.keys, doc.Key)
+		f.names = append(f.names, name)
+		f.values = append(f.values, fs.String(name, doc.Default, usage))
+	}
+
+	return f, nil
+}
+
+// Builder returns a builder holding the values of the flags that were set on
+// the command line, to be merged last so that they take precedence over files
+// and the environment.
+func (f *Flags) Builder() *readconf.Builder {
+	b := readconf.NewBuilder()
+	for i, name := range f.names {
+		if f.fs.Changed(name) {
+			b.Set(f.keys[i], *f.values[i])
+		}
+	}
+
+	return b
+}
+
+// Name returns the flag name of a configuration key, the same as
+// readconf.FlagName, e.g. db.max-conns for DB__MAX_CONNS, so that commands
+// using the flag package and cobra commands have the same flags.
+func Name(key string) string {
+	return readconf.FlagName(key)
+}
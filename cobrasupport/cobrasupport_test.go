@@ -0,0 +1,53 @@
+package cobrasupport_test
+
+import (
+	"flag"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/tetratom/readconf"
+	"github.com/tetratom/readconf/cobrasupport"
+)
+
+// Implements FlagSet like *pflag.FlagSet.
+type flagSet struct {
+	*flag.FlagSet
+}
+
+func (fs flagSet) Changed(name string) bool {
+	changed := false
+	fs.Visit(func(f *flag.Flag) {
+		changed = changed || f.Name == name
+	})
+	return changed
+}
+
+func TestBind(t *testing.T) {
+	var conf struct {
+		Name string `default:"app" usage:"name of the application"`
+		DB   struct {
+			Host     string
+			MaxConns int `default:"10"`
+		}
+	}
+
+	fs := flagSet{flag.NewFlagSet(`test`, flag.ContinueOnError)}
+	flags, err := cobrasupport.Bind(fs, &conf)
+	require.NoError(t, err)
+	require.Equal(t, `name of the application`, fs.Lookup(`name`).Usage)
+	require.Equal(t, `10`, fs.Lookup(`db.max-conns`).DefValue)
+	require.Equal(t, `string`, fs.Lookup(`db.host`).Usage)
+
+	require.NoError(t, fs.Parse([]string{`--db.host=localhost`, `--name`, `flag`}))
+
+	err = readconf.NewBuilder().
+		Set(`DB__HOST`, `env`).
+		Set(`DB__MAX_CONNS`, `20`).
+		MergeBuilder(flags.Builder()).
+		Build(&conf)
+	require.NoError(t, err)
+	require.Equal(t, `flag`, conf.Name)
+	require.Equal(t, `localhost`, conf.DB.Host)
+	require.Equal(t, 20, conf.DB.MaxConns)
+}
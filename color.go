@@ -0,0 +1,93 @@
+package readconf
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"strings"
+)
+
+// ColorMode selects whether WriteDescribe, Report.Write and WriteError
+// highlight their output with ANSI colors.
+type ColorMode int
+
+const (
+	// ColorAuto uses colors if the output is a terminal and the NO_COLOR
+	// environment variable is not set.
+	ColorAuto ColorMode = iota
+	ColorAlways
+	ColorNever
+)
+
+// WriteOption configures WriteDescribe, Report.Write and WriteError.
+type WriteOption func(o *writeOptions)
+
+// WithColor sets the ColorMode, ColorAuto by default.
+func WithColor(mode ColorMode) WriteOption {
+	return func(o *writeOptions) {
+		o.color = mode
+	}
+}
+
+type writeOptions struct {
+	color ColorMode
+}
+
+// ANSI color codes, all of the same length so that colored rows stay aligned
+const (
+	_colorNone    = "\x1b[39m"
+	_colorRed     = "\x1b[31m"
+	_colorGreen   = "\x1b[32m"
+	_colorYellow  = "\x1b[33m"
+	_colorMagenta = "\x1b[35m"
+	_colorReset   = "\x1b[0m"
+)
+
+// Returns true if output to w should be colored.
+func useColor(w io.Writer, opts []WriteOption) bool {
+	o := writeOptions{}
+	for _, opt := range opts {
+		opt(&o)
+	}
+
+	switch o.color {
+	case ColorAlways:
+		return true
+	case ColorNever:
+		return false
+	}
+
+	if os.Getenv(`NO_COLOR`) != `` {
+		return false
+	}
+
+	f, ok := w.(*os.File)
+	if !ok {
+		return false
+	}
+
+	fi, err := f.Stat()
+	return err == nil && fi.Mode()&os.ModeCharDevice != 0
+}
+
+// Writes a row of tab-separated cells, in color if enabled.
+func writeRow(w io.Writer, enabled bool, color string, cells ...string) {
+	row := strings.Join(cells, "\t")
+	if enabled {
+		if color == `` {
+			color = _colorNone
+		}
+
+		row = color + row + _colorReset
+	}
+
+	fmt.Fprintln(w, row)
+}
+
+func paint(enabled bool, color, s string) string {
+	if !enabled {
+		return s
+	}
+
+	return color + s + _colorReset
+}
@@ -4,6 +4,7 @@ package readconf
 
 import (
 	"fmt"
+	"os"
 	"strings"
 )
 
@@ -19,3 +20,12 @@ func wrapError(err error, msg string, args ...interface{}) error {
 func stringReplaceAll(s, old, new string) string {
 	return strings.ReplaceAll(s, old, new)
 }
+
+func isNotExist(err error) bool {
+	return os.IsNotExist(err)
+}
+
+// errors.Is doesn't exist before Go 1.13, so nothing calls Is methods
+func errorIs(err, target error) bool {
+	return err == target
+}
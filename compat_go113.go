@@ -3,7 +3,9 @@
 package readconf
 
 import (
+	"errors"
 	"fmt"
+	"os"
 	"strings"
 )
 
@@ -19,3 +21,11 @@ func wrapError(err error, msg string, args ...interface{}) error {
 func stringReplaceAll(s, old, new string) string {
 	return strings.ReplaceAll(s, old, new)
 }
+
+func isNotExist(err error) bool {
+	return errors.Is(err, os.ErrNotExist)
+}
+
+func errorIs(err, target error) bool {
+	return errors.Is(err, target)
+}
@@ -0,0 +1,256 @@
+package readconf
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"io/ioutil"
+	"math"
+	"net"
+	"net/http"
+	"net/url"
+	"time"
+)
+
+// RateLimitConfig configures a token bucket rate limiter, e.g. of
+// golang.org/x/time/rate:
+//
+//	limiter := rate.NewLimiter(rate.Limit(conf.Limit.Rate), conf.Limit.Burst)
+type RateLimitConfig struct {
+	// Rate is the number of events allowed per second.
+	Rate float64 `default:"10" validate:"gt=0"`
+	// Burst is the number of events allowed at once.
+	Burst int `default:"1" validate:"gte=1"`
+}
+
+// Interval returns the time between events at the configured rate.
+func (c RateLimitConfig) Interval() time.Duration {
+	if c.Rate <= 0 {
+		return time.Duration(math.MaxInt64)
+	}
+
+	return time.Duration(float64(time.Second) / c.Rate)
+}
+
+// CircuitBreakerConfig configures a circuit breaker, e.g. of
+// github.com/sony/gobreaker:
+//
+//	breaker := gobreaker.NewCircuitBreaker(gobreaker.Settings{
+//		Name:        "db",
+//		MaxRequests: conf.Breaker.MaxRequests,
+//		Interval:    conf.Breaker.Interval,
+//		Timeout:     conf.Breaker.Timeout,
+//		ReadyToTrip: func(counts gobreaker.Counts) bool {
+//			return conf.Breaker.ReadyToTrip(counts.ConsecutiveFailures)
+//		},
+//	})
+type CircuitBreakerConfig struct {
+	// MaxFailures is the number of consecutive failures that open the
+	// breaker.
+	MaxFailures uint32 `default:"5" validate:"gte=1"`
+	// Timeout is how long the breaker stays open before letting requests
+	// through again.
+	Timeout time.Duration `default:"60s" validate:"gt=0"`
+	// MaxRequests is the number of requests let through while half-open.
+	MaxRequests uint32 `default:"1" validate:"gte=1"`
+	// Interval is the period after which failure counts are cleared while
+	// closed, never if 0.
+	Interval time.Duration `default:"0s" validate:"gte=0"`
+}
+
+// ReadyToTrip returns true if the number of consecutive failures opens the
+// breaker.
+func (c CircuitBreakerConfig) ReadyToTrip(consecutiveFailures uint32) bool {
+	return consecutiveFailures >= c.MaxFailures
+}
+
+// HTTPServerConfig configures an http.Server, see Apply.
+type HTTPServerConfig struct {
+	Addr              string        `default:":8080" validate:"required"`
+	ReadTimeout       time.Duration `default:"30s" validate:"gte=0"`
+	ReadHeaderTimeout time.Duration `default:"10s" validate:"gte=0"`
+	WriteTimeout      time.Duration `default:"30s" validate:"gte=0"`
+	IdleTimeout       time.Duration `default:"2m" validate:"gte=0"`
+	MaxHeaderBytes    int           `default:"1048576" validate:"gt=0"`
+}
+
+// Apply sets the address, timeouts and header limit of s.
+func (c HTTPServerConfig) Apply(s *http.Server) {
+	s.Addr = c.Addr
+	s.ReadTimeout = c.ReadTimeout
+	s.ReadHeaderTimeout = c.ReadHeaderTimeout
+	s.WriteTimeout = c.WriteTimeout
+	s.IdleTimeout = c.IdleTimeout
+	s.MaxHeaderBytes = c.MaxHeaderBytes
+}
+
+// HTTPClientConfig configures an http.Client, see Build. The defaults are
+// those of http.DefaultTransport, with a timeout of requests.
+type HTTPClientConfig struct {
+	// Timeout limits the time of requests, including reading the response.
+	Timeout               time.Duration `default:"30s" validate:"gte=0"`
+	DialTimeout           time.Duration `default:"30s" validate:"gte=0"`
+	TLSHandshakeTimeout   time.Duration `default:"10s" validate:"gte=0"`
+	ResponseHeaderTimeout time.Duration `default:"0s" validate:"gte=0"`
+	IdleConnTimeout       time.Duration `default:"90s" validate:"gte=0"`
+	MaxIdleConns          int           `default:"100" validate:"gte=0"`
+	MaxIdleConnsPerHost   int           `default:"2" validate:"gte=0"`
+	MaxConnsPerHost       int           `default:"0" validate:"gte=0"`
+	// Proxy is the URL of the proxy of all requests. If empty, the proxy is
+	// taken from the environment.
+	Proxy string `default:"" validate:"omitempty,url"`
+}
+
+// Build returns a client with a new transport configured by c. If Proxy isn't
+// a valid URL, requests fail.
+func (c HTTPClientConfig) Build() *http.Client {
+	proxy := http.ProxyFromEnvironment
+	if c.Proxy != `` {
+		u, err := url.Parse(c.Proxy)
+		proxy = func(*http.Request) (*url.URL, error) {
+			return u, err
+		}
+	}
+
+	dialer := &net.Dialer{Timeout: c.DialTimeout, KeepAlive: 30 * time.Second}
+
+	return &http.Client{
+		Timeout: c.Timeout,
+		Transport: &http.Transport{
+			Proxy:                 proxy,
+			DialContext:           dialer.DialContext,
+			TLSHandshakeTimeout:   c.TLSHandshakeTimeout,
+			ResponseHeaderTimeout: c.ResponseHeaderTimeout,
+			IdleConnTimeout:       c.IdleConnTimeout,
+			MaxIdleConns:          c.MaxIdleConns,
+			MaxIdleConnsPerHost:   c.MaxIdleConnsPerHost,
+			MaxConnsPerHost:       c.MaxConnsPerHost,
+		},
+	}
+}
+
+// TLSConfig refers to the files of a TLS configuration, see Load.
+type TLSConfig struct {
+	// CertFile and KeyFile hold the PEM encoded certificate and key presented
+	// to peers, if any.
+	CertFile string `default:""`
+	KeyFile  string `default:"" validate:"required_with=CertFile"`
+	// CAFile holds the PEM encoded certificates of the authorities trusted to
+	// verify peers, the system's if empty.
+	CAFile string `default:""`
+	// ServerName overrides the name verified in server certificates.
+	ServerName string `default:""`
+	// ClientAuth is the policy of servers for client certificates: none,
+	// request, require, verify-if-given or require-and-verify. If empty,
+	// servers require and verify client certificates if CAFile is set, and
+	// don't ask for them otherwise. Clients ignore it.
+	ClientAuth string `default:"" validate:"omitempty,oneof=none request require verify-if-given require-and-verify"`
+}
+
+var _clientAuthTypes = map[string]tls.ClientAuthType{
+	`none`:               tls.NoClientCert,
+	`request`:            tls.RequestClientCert,
+	`require`:            tls.RequireAnyClientCert,
+	`verify-if-given`:    tls.VerifyClientCertIfGiven,
+	`require-and-verify`: tls.RequireAndVerifyClientCert,
+}
+
+// Load reads the files of c and returns a TLS configuration using them.
+func (c TLSConfig) Load() (*tls.Config, error) {
+	config := &tls.Config{ServerName: c.ServerName}
+
+	if c.CertFile != `` {
+		cert, err := tls.LoadX509KeyPair(c.CertFile, c.KeyFile)
+		if err != nil {
+			return nil, err
+		}
+
+		config.Certificates = []tls.Certificate{cert}
+	}
+
+	if c.CAFile != `` {
+		data, err := ioutil.ReadFile(c.CAFile)
+		if err != nil {
+			return nil, err
+		}
+
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(data) {
+			return nil, fmt.Errorf("no certificates in %s", c.CAFile)
+		}
+
+		config.RootCAs = pool
+		config.ClientCAs = pool
+		config.ClientAuth = tls.RequireAndVerifyClientCert
+	}
+
+	if c.ClientAuth != `` {
+		clientAuth, ok := _clientAuthTypes[c.ClientAuth]
+		if !ok {
+			return nil, fmt.Errorf("unknown client auth %s", c.ClientAuth)
+		}
+
+		config.ClientAuth = clientAuth
+	}
+
+	return config, nil
+}
+
+// GRPCServerConfig configures a gRPC server, e.g. of google.golang.org/grpc:
+//
+//	tlsConfig, err := conf.GRPC.TLS.Load()
+//	...
+//	server := grpc.NewServer(
+//		grpc.Creds(credentials.NewTLS(tlsConfig)),
+//		grpc.MaxRecvMsgSize(conf.GRPC.MaxRecvMsgSize),
+//		grpc.MaxSendMsgSize(conf.GRPC.MaxSendMsgSize),
+//		grpc.KeepaliveParams(keepalive.ServerParameters{
+//			MaxConnectionIdle: conf.GRPC.MaxConnectionIdle,
+//			MaxConnectionAge:  conf.GRPC.MaxConnectionAge,
+//			Time:              conf.GRPC.KeepaliveTime,
+//			Timeout:           conf.GRPC.KeepaliveTimeout,
+//		}),
+//	)
+type GRPCServerConfig struct {
+	Addr              string        `default:":9090" validate:"required"`
+	MaxRecvMsgSize    int           `default:"4194304" validate:"gt=0"`
+	MaxSendMsgSize    int           `default:"2147483647" validate:"gt=0"`
+	MaxConnectionIdle time.Duration `default:"0s" validate:"gte=0"`
+	MaxConnectionAge  time.Duration `default:"0s" validate:"gte=0"`
+	KeepaliveTime     time.Duration `default:"2h" validate:"gte=0"`
+	KeepaliveTimeout  time.Duration `default:"20s" validate:"gte=0"`
+
+	// Insecure serves without TLS.
+	Insecure bool `default:"false"`
+	TLS      TLSConfig
+}
+
+// GRPCClientConfig configures a gRPC client connection, e.g. of
+// google.golang.org/grpc:
+//
+//	tlsConfig, err := conf.Backend.TLS.Load()
+//	...
+//	conn, err := grpc.Dial(conf.Backend.Target,
+//		grpc.WithTransportCredentials(credentials.NewTLS(tlsConfig)),
+//		grpc.WithDefaultCallOptions(
+//			grpc.MaxCallRecvMsgSize(conf.Backend.MaxRecvMsgSize),
+//			grpc.MaxCallSendMsgSize(conf.Backend.MaxSendMsgSize),
+//		),
+//		grpc.WithKeepaliveParams(keepalive.ClientParameters{
+//			Time:                conf.Backend.KeepaliveTime,
+//			Timeout:             conf.Backend.KeepaliveTimeout,
+//			PermitWithoutStream: conf.Backend.PermitWithoutStream,
+//		}),
+//	)
+type GRPCClientConfig struct {
+	Target              string        `validate:"required"`
+	MaxRecvMsgSize      int           `default:"4194304" validate:"gt=0"`
+	MaxSendMsgSize      int           `default:"2147483647" validate:"gt=0"`
+	KeepaliveTime       time.Duration `default:"0s" validate:"gte=0"`
+	KeepaliveTimeout    time.Duration `default:"20s" validate:"gte=0"`
+	PermitWithoutStream bool          `default:"false"`
+
+	// Insecure connects without TLS.
+	Insecure bool `default:"false"`
+	TLS      TLSConfig
+}
@@ -1,7 +1,15 @@
 package readconf
 
 const (
-	_configTag  = `config`
-	_defaultTag = `default`
-	_separator  = `__`
+	_configTag    = `config`
+	_defaultTag   = `default`
+	_transformTag = `transform`
+	_unitTag      = `unit`
+	_secretTag    = `secret`
+	_usageTag     = `usage`
+	_presenceTag  = `presence`
+	_separator    = `__`
+
+	// maximum nesting depth of configuration structs
+	_maxDepth = 32
 )
@@ -0,0 +1,22 @@
+//go:build go1.21
+// +build go1.21
+
+package readconf
+
+import (
+	"context"
+)
+
+type contextKey[T any] struct{}
+
+// NewContext returns a copy of ctx carrying cfg. The configuration can be
+// retrieved with FromContext using the same type T.
+func NewContext[T any](ctx context.Context, cfg T) context.Context {
+	return context.WithValue(ctx, contextKey[T]{}, cfg)
+}
+
+// FromContext returns the configuration of type T carried by ctx, if any.
+func FromContext[T any](ctx context.Context) (T, bool) {
+	cfg, ok := ctx.Value(contextKey[T]{}).(T)
+	return cfg, ok
+}
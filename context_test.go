@@ -0,0 +1,32 @@
+//go:build go1.21
+// +build go1.21
+
+package readconf_test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/tetratom/readconf"
+)
+
+func TestContext(t *testing.T) {
+	conf := &configWithAllDefaults{Foo: "foo"}
+	other := NestedWithAllDefaults{Foo: "nested"}
+
+	ctx := readconf.NewContext(context.Background(), conf)
+	ctx = readconf.NewContext(ctx, other)
+
+	got, ok := readconf.FromContext[*configWithAllDefaults](ctx)
+	require.True(t, ok)
+	require.Same(t, conf, got)
+
+	nested, ok := readconf.FromContext[NestedWithAllDefaults](ctx)
+	require.True(t, ok)
+	require.Equal(t, other, nested)
+
+	_, ok = readconf.FromContext[configWithAllDefaults](ctx)
+	require.False(t, ok)
+}
@@ -0,0 +1,163 @@
+package readconf
+
+import (
+	"encoding/json"
+	"net/url"
+	"os"
+	"reflect"
+	"regexp"
+	"runtime"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// names of keys and environment variables whose values are redacted
+var _sensitiveKey = regexp.MustCompile(`(?i)pass|secret|token|key|credential|private`)
+
+const _redacted = `[redacted]`
+
+type sourceTiming struct {
+	name     string
+	version  string
+	keys     int
+	duration time.Duration
+}
+
+// Records how long merging a source took, the version of its values and their
+// number of keys, if it succeeded.
+func (b *Builder) timeSource(name, version string, keys int, start time.Time) {
+	if b.hasError() {
+		return
+	}
+
+	b.sources = append(b.sources, sourceTiming{name: name, version: version, keys: keys, duration: time.Since(start)})
+}
+
+type debugBundle struct {
+	Time        time.Time         `json:"time"`
+	GoVersion   string            `json:"go_version"`
+	Host        Map               `json:"host"`
+	Error       string            `json:"error,omitempty"`
+	Values      Map               `json:"values"`
+	Origins     map[string]Origin `json:"origins"`
+	Expires     map[string]string `json:"expires,omitempty"`
+	Warnings    []string          `json:"warnings,omitempty"`
+	Layers      map[string]string `json:"layers,omitempty"`
+	Sources     []debugSource     `json:"sources"`
+	Environment Map               `json:"environment"`
+}
+
+type debugSource struct {
+	Name     string `json:"name"`
+	Version  string `json:"version,omitempty"`
+	Duration string `json:"duration"`
+}
+
+// DebugBundle returns a JSON document describing the configuration built for
+// target, to attach to support requests: the effective values and their
+// origins, how long sources took to merge, facts about the host and a
+// snapshot of the environment. Secret fields and values of keys and variables
+// that look sensitive, such as passwords and tokens, are redacted. target
+// isn't modified, and a failed build is included in the bundle.
+func (b *Builder) DebugBundle(target interface{}) ([]byte, error) {
+	if err := validateIsPointerToStruct(target); err != nil {
+		return nil, err
+	}
+
+	bundle := debugBundle{
+		Time:        time.Now(),
+		GoVersion:   runtime.Version(),
+		Host:        HostFacts(),
+		Values:      Map{},
+		Environment: Map{},
+	}
+
+	report, err := b.DryRun(target)
+	if err != nil {
+		bundle.Error = err.Error()
+	}
+
+	secrets := map[string]bool{}
+	if fields, err := configFields(reflect.New(reflect.TypeOf(target).Elem()).Interface(), true, b.keyStrategy()); err == nil {
+		for key, field := range fields {
+			secrets[key] = isSecretField(field)
+		}
+	}
+
+	if report != nil {
+		for key, value := range report.Values {
+			bundle.Values[key] = redactValue(key, value, secrets[key])
+		}
+
+		bundle.Origins = report.Origins
+		bundle.Warnings = report.Warnings
+		bundle.Layers = report.Layers
+
+		if len(report.Expires) > 0 {
+			bundle.Expires = make(map[string]string, len(report.Expires))
+			for key, t := range report.Expires {
+				bundle.Expires[key] = t.Format(time.RFC3339)
+			}
+		}
+	}
+
+	for _, source := range b.sources {
+		bundle.Sources = append(bundle.Sources, debugSource{
+			Name:     source.name,
+			Version:  source.version,
+			Duration: source.duration.String(),
+		})
+	}
+
+	for _, kv := range os.Environ() {
+		kvp := strings.SplitN(kv, `=`, 2)
+		if len(kvp) != 2 {
+			continue
+		}
+
+		bundle.Environment[kvp[0]] = redactValue(kvp[0], kvp[1], false)
+	}
+
+	return json.MarshalIndent(bundle, ``, `  `)
+}
+
+// Returns true for Secret fields and fields tagged secret:"true".
+func isSecretField(field configField) bool {
+	secret, _ := strconv.ParseBool(field.field.Tag.Get(_secretTag))
+	t := field.value.Type()
+	if t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+
+	return secret || t == reflect.TypeOf(Secret{})
+}
+
+// Returns value, or a placeholder if it is secret or its key looks sensitive.
+// Passwords of URLs are redacted.
+func redactValue(key, value string, secret bool) string {
+	if secret || _sensitiveKey.MatchString(key) {
+		return _redacted
+	}
+
+	return redactURL(value)
+}
+
+// Redacts the password of s if it is a URL with one.
+func redactURL(s string) string {
+	if !strings.Contains(s, `://`) {
+		return s
+	}
+
+	u, err := url.Parse(s)
+	if err != nil || u.User == nil {
+		return s
+	}
+
+	if _, ok := u.User.Password(); !ok {
+		return s
+	}
+
+	u.User = url.UserPassword(u.User.Username(), `redacted`)
+	return u.String()
+}
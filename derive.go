@@ -0,0 +1,75 @@
+//go:build go1.21
+// +build go1.21
+
+package readconf
+
+import (
+	"fmt"
+	"reflect"
+)
+
+// Derive returns a copy of the built configuration parent with overrides
+// applied. The copy is unmarshaled and validated like a regular build, but no
+// sources are read again. parent may be a struct or a pointer to one. Use
+// DeriveWith if parent was built with a validator, key strategy or transforms
+// of its own.
+func Derive[T any](parent T, overrides Map) (T, error) {
+	return DeriveWith(NewBuilder(), parent, overrides)
+}
+
+// DeriveWith is like Derive, but builds the copy with a clone of b, the
+// builder parent was built with, so that its validator, key strategy,
+// transforms and policies apply to the copy too. b isn't modified.
+func DeriveWith[T any](b *Builder, parent T, overrides Map) (T, error) {
+	base, err := deriveBuilder(b, parent)
+	if err != nil {
+		var zero T
+		return zero, err
+	}
+
+	return deriveFrom[T](base, overrides)
+}
+
+// Returns a clone of b with the values of parent merged, which copies of
+// parent are derived from by deriveFrom.
+func deriveBuilder[T any](b *Builder, parent T) (*Builder, error) {
+	source := interface{}(&parent)
+	if pv := reflect.ValueOf(&parent).Elem(); pv.Kind() == reflect.Ptr {
+		if pv.IsNil() {
+			return nil, fmt.Errorf("expected non-nil parent")
+		}
+
+		source = parent
+	}
+
+	values, err := b.Marshal(source)
+	if err != nil {
+		return nil, err
+	}
+
+	return b.Clone().MergeMap(values), nil
+}
+
+// Builds a copy of the parent of base with overrides applied. base isn't
+// modified.
+func deriveFrom[T any](base *Builder, overrides Map) (T, error) {
+	var zero, derived T
+
+	// the target to build the copy into
+	target := interface{}(&derived)
+	if t := reflect.TypeOf(&derived).Elem(); t.Kind() == reflect.Ptr {
+		derived = reflect.New(t.Elem()).Interface().(T)
+		target = derived
+	}
+
+	c := base.Clone()
+	for k, v := range overrides {
+		c.Set(k, v)
+	}
+
+	if err := c.Build(target); err != nil {
+		return zero, err
+	}
+
+	return derived, nil
+}
@@ -0,0 +1,96 @@
+//go:build go1.21
+// +build go1.21
+
+package readconf_test
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/tetratom/readconf"
+)
+
+func TestDerive(t *testing.T) {
+	parent := configWithAllDefaults{
+		Foo: "foo",
+		Bar: 1,
+		EmbeddedWithAllDefaults: EmbeddedWithAllDefaults{
+			EmbeddedFoo: "embedded",
+			EmbeddedBar: 2,
+		},
+		Nested: NestedWithAllDefaults{
+			Foo: "nested",
+			Bar: 3,
+		},
+	}
+
+	t.Run("overrides", func(t *testing.T) {
+		derived, err := readconf.Derive(parent, readconf.Map{
+			`bar`:         `10`,
+			`NESTED__FOO`: `${FOO}_derived`,
+		})
+		require.NoError(t, err)
+		require.Equal(t, configWithAllDefaults{
+			Foo:                     "foo",
+			Bar:                     10,
+			EmbeddedWithAllDefaults: parent.EmbeddedWithAllDefaults,
+			Nested: NestedWithAllDefaults{
+				Foo: "foo_derived",
+				Bar: 3,
+			},
+		}, derived)
+		require.Equal(t, 1, parent.Bar)
+	})
+
+	t.Run("pointer", func(t *testing.T) {
+		derived, err := readconf.Derive(&parent, readconf.Map{`bar`: `10`})
+		require.NoError(t, err)
+		require.Equal(t, 10, derived.Bar)
+		require.Equal(t, `nested`, derived.Nested.Foo)
+		require.Equal(t, 1, parent.Bar)
+
+		_, err = readconf.Derive((*configWithAllDefaults)(nil), nil)
+		require.EqualError(t, err, `expected non-nil parent`)
+	})
+
+	t.Run("builder", func(t *testing.T) {
+		var validated int
+		builder := readconf.NewBuilder().
+			WithKeyStrategy(dottedKeys{}).
+			WithValidator(readconf.ValidatorFunc(func(s interface{}) error {
+				validated++
+				return nil
+			}))
+
+		derived, err := readconf.DeriveWith(builder, parent, readconf.Map{`nested.bar`: `30`})
+		require.NoError(t, err)
+		require.Equal(t, 30, derived.Nested.Bar)
+		require.Equal(t, `nested`, derived.Nested.Foo)
+		require.Equal(t, 1, validated)
+	})
+
+	t.Run("presence", func(t *testing.T) {
+		type config struct {
+			Name  string
+			Debug bool `presence:"true"`
+		}
+
+		derived, err := readconf.Derive(config{Name: `a`}, readconf.Map{`NAME`: `b`})
+		require.NoError(t, err)
+		require.Equal(t, config{Name: `b`}, derived)
+
+		derived, err = readconf.Derive(config{Name: `a`, Debug: true}, nil)
+		require.NoError(t, err)
+		require.Equal(t, config{Name: `a`, Debug: true}, derived)
+	})
+
+	t.Run("validation", func(t *testing.T) {
+		derived, err := readconf.DeriveWith(
+			readconf.NewBuilder().WithValidator(limits),
+			validationFailureConf{Foo: "foo", Bar: "bar"},
+			readconf.Map{`FOO`: `f`})
+		require.EqualError(t, err, "validation failed: FOO")
+		require.Empty(t, derived)
+	})
+}
@@ -0,0 +1,180 @@
+package readconf
+
+import (
+	"fmt"
+	"reflect"
+	"sort"
+)
+
+// FieldDoc describes a configuration key of a target.
+type FieldDoc struct {
+	Key  string
+	Type string
+	// Default holds the default value of the key, if it has one.
+	Default    string
+	HasDefault bool
+	// Required is true if Build fails when the key has no value.
+	Required bool
+	// Secret is true for Secret fields and fields tagged secret:"true".
+	Secret bool
+	// Usage holds the description of the key from its usage tag.
+	Usage string
+}
+
+// Describe returns the configuration keys of target, sorted by key. Describe
+// may be used to document a configuration or, with CompatCheck, to compare
+// versions of it.
+func Describe(target interface{}) ([]FieldDoc, error) {
+	return describe(target, defaultKeyStrategy{})
+}
+
+// Describe is like the Describe function, but derives the keys with the key
+// strategy of b.
+func (b *Builder) Describe(target interface{}) ([]FieldDoc, error) {
+	return describe(target, b.keyStrategy())
+}
+
+func describe(target interface{}, keys KeyStrategy) ([]FieldDoc, error) {
+	if err := validateIsPointerToStruct(target); err != nil {
+		return nil, err
+	}
+
+	target = reflect.New(reflect.TypeOf(target).Elem()).Interface()
+
+	knownFields, err := configFields(target, true, keys)
+	if err != nil {
+		return nil, err
+	}
+
+	defaults, _, err := defaultValues(target, knownFields, keys)
+	if err != nil {
+		return nil, err
+	}
+
+	docs := make([]FieldDoc, 0, len(knownFields))
+	for key, field := range knownFields {
+		docs = append(docs, fieldDoc(key, field, defaults))
+	}
+
+	sort.Slice(docs, func(i, j int) bool {
+		return docs[i].Key < docs[j].Key
+	})
+
+	return docs, nil
+}
+
+func fieldDoc(key string, field configField, defaults Map) FieldDoc {
+	doc := FieldDoc{Key: key, Type: field.value.Type().String()}
+	doc.Default, doc.HasDefault = defaults.Lookup(key)
+	if !doc.HasDefault && field.field.Tag.Get(_presenceTag) == `true` {
+		doc.Default, doc.HasDefault = `false`, true
+	}
+	doc.Required = !doc.HasDefault && !field.optional()
+	doc.Secret = isSecretField(field)
+	doc.Usage = field.field.Tag.Get(_usageTag)
+	return doc
+}
+
+// ChangeKind tells how a configuration key changed between versions.
+type ChangeKind string
+
+const (
+	ChangeRemoved  ChangeKind = "removed"
+	ChangeType     ChangeKind = "type"
+	ChangeRequired ChangeKind = "required"
+)
+
+// BreakingChange describes a change to a configuration key that may break
+// existing configurations.
+type BreakingChange struct {
+	Key  string
+	Kind ChangeKind
+	Old  *FieldDoc
+	New  *FieldDoc
+}
+
+func (c BreakingChange) String() string {
+	switch c.Kind {
+	case ChangeRemoved:
+		return fmt.Sprintf("key %s was removed", c.Key)
+	case ChangeType:
+		return fmt.Sprintf("key %s changed type from %s to %s", c.Key, c.Old.Type, c.New.Type)
+	case ChangeRequired:
+		return fmt.Sprintf("key %s is newly required", c.Key)
+	default:
+		return fmt.Sprintf("key %s changed", c.Key)
+	}
+}
+
+// CompatCheck compares the descriptions of two versions of a configuration, as
+// returned by Describe, and reports the changes that may break configurations
+// written for the old version: removed keys, keys that changed type, and keys
+// that are required but weren't before. Changes are sorted by key.
+func CompatCheck(oldDesc, newDesc []FieldDoc) []BreakingChange {
+	olds := make(map[string]*FieldDoc, len(oldDesc))
+	for i := range oldDesc {
+		olds[normalizeKey(oldDesc[i].Key)] = &oldDesc[i]
+	}
+
+	news := make(map[string]*FieldDoc, len(newDesc))
+	for i := range newDesc {
+		news[normalizeKey(newDesc[i].Key)] = &newDesc[i]
+	}
+
+	changes := []BreakingChange{}
+
+	for key, o := range olds {
+		n, ok := news[key]
+		switch {
+		case !ok:
+			changes = append(changes, BreakingChange{Key: o.Key, Kind: ChangeRemoved, Old: o})
+		case o.Type != n.Type:
+			changes = append(changes, BreakingChange{Key: n.Key, Kind: ChangeType, Old: o, New: n})
+		case n.Required && !o.Required:
+			changes = append(changes, BreakingChange{Key: n.Key, Kind: ChangeRequired, Old: o, New: n})
+		}
+	}
+
+	for key, n := range news {
+		if _, ok := olds[key]; !ok && n.Required {
+			changes = append(changes, BreakingChange{Key: n.Key, Kind: ChangeRequired, New: n})
+		}
+	}
+
+	sort.Slice(changes, func(i, j int) bool {
+		return changes[i].Key < changes[j].Key
+	})
+
+	return changes
+}
+
+// ExtendSchema returns the union of a base schema and the description of a
+// configuration extending it, sorted by key, e.g. to publish the schema of a
+// service whose configuration extends that of another. Keys in both must have
+// the same type; the description of additions wins otherwise.
+func ExtendSchema(base, additions []FieldDoc) ([]FieldDoc, error) {
+	docs := make(map[string]FieldDoc, len(base)+len(additions))
+	for _, doc := range base {
+		docs[normalizeKey(doc.Key)] = doc
+	}
+
+	for _, doc := range additions {
+		key := normalizeKey(doc.Key)
+		if b, ok := docs[key]; ok && b.Type != doc.Type {
+			return nil, fmt.Errorf("configuration key \"%s\": type %s doesn't match type %s of the base schema", key, doc.Type, b.Type)
+		}
+
+		docs[key] = doc
+	}
+
+	union := make([]FieldDoc, 0, len(docs))
+	for _, doc := range docs {
+		union = append(union, doc)
+	}
+
+	sort.Slice(union, func(i, j int) bool {
+		return union[i].Key < union[j].Key
+	})
+
+	return union, nil
+}
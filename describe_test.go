@@ -0,0 +1,181 @@
+package readconf_test
+
+import (
+	"bytes"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/tetratom/readconf"
+)
+
+func TestDescribe(t *testing.T) {
+	var conf struct {
+		Name    string
+		Timeout time.Duration `default:"5s"`
+		DB      struct {
+			Port int `default:"5432"`
+		}
+	}
+
+	docs, err := readconf.Describe(&conf)
+	require.NoError(t, err)
+	require.Equal(t, []readconf.FieldDoc{
+		{Key: `DB__PORT`, Type: `int`, Default: `5432`, HasDefault: true},
+		{Key: `NAME`, Type: `string`, Required: true},
+		{Key: `TIMEOUT`, Type: `time.Duration`, Default: `5s`, HasDefault: true},
+	}, docs)
+}
+
+func TestCompatCheck(t *testing.T) {
+	var v1 struct {
+		Name    string
+		Port    int    `default:"80"`
+		Mode    string `default:"fast"`
+		Retries int    `default:"3"`
+	}
+
+	var v2 struct {
+		Name    string
+		Port    string `default:"80"`
+		Mode    string
+		Verbose bool `default:"false"`
+		Region  string
+	}
+
+	oldDesc, err := readconf.Describe(&v1)
+	require.NoError(t, err)
+
+	newDesc, err := readconf.Describe(&v2)
+	require.NoError(t, err)
+
+	changes := readconf.CompatCheck(oldDesc, newDesc)
+
+	messages := []string{}
+	for _, c := range changes {
+		messages = append(messages, c.String())
+	}
+
+	require.Equal(t, []string{
+		`key MODE is newly required`,
+		`key PORT changed type from int to string`,
+		`key REGION is newly required`,
+		`key RETRIES was removed`,
+	}, messages)
+
+	require.Empty(t, readconf.CompatCheck(newDesc, newDesc))
+}
+
+func TestExtendSchema(t *testing.T) {
+	var a struct {
+		Name string
+		Port int `default:"80"`
+	}
+
+	var b struct {
+		Port  int `default:"8080"`
+		Queue string
+	}
+
+	base, err := readconf.Describe(&a)
+	require.NoError(t, err)
+
+	additions, err := readconf.Describe(&b)
+	require.NoError(t, err)
+
+	union, err := readconf.ExtendSchema(base, additions)
+	require.NoError(t, err)
+	require.Equal(t, []readconf.FieldDoc{
+		{Key: `NAME`, Type: `string`, Required: true},
+		{Key: `PORT`, Type: `int`, Default: `8080`, HasDefault: true},
+		{Key: `QUEUE`, Type: `string`, Required: true},
+	}, union)
+
+	_, err = readconf.ExtendSchema(base, []readconf.FieldDoc{{Key: `port`, Type: `string`}})
+	require.EqualError(t, err, `configuration key "PORT": type string doesn't match type int of the base schema`)
+}
+
+func TestBuilder_Extends(t *testing.T) {
+	base := []readconf.FieldDoc{
+		{Key: `NAME`, Type: `string`, Required: true},
+		{Key: `REGION`, Type: `string`, Required: true},
+		{Key: `PORT`, Type: `int`, Default: `80`, HasDefault: true},
+	}
+
+	type config struct {
+		Name  string
+		Queue string
+	}
+
+	var conf config
+	report, err := readconf.NewBuilder().
+		Extends(base).
+		Strict().
+		Set(`NAME`, `worker`).
+		Set(`REGION`, `eu`).
+		Set(`QUEUE`, `jobs`).
+		BuildReport(&conf)
+	require.NoError(t, err)
+	require.Equal(t, config{Name: `worker`, Queue: `jobs`}, conf)
+	require.Equal(t, `80`, report.Values.Get(`PORT`))
+	require.Equal(t, `eu`, report.Values.Get(`REGION`))
+
+	err = readconf.NewBuilder().Extends(base).Build(&config{})
+	require.EqualError(t, err, `missing 3 configuration keys: NAME, QUEUE, REGION`)
+
+	err = readconf.NewBuilder().
+		Extends([]readconf.FieldDoc{{Key: `NAME`, Type: `int`}}).
+		Set(`NAME`, `worker`).
+		Set(`QUEUE`, `jobs`).
+		Build(&config{})
+	require.EqualError(t, err, `configuration key "NAME": type string doesn't match type int of the extended schema`)
+}
+
+func TestWriteDescribe(t *testing.T) {
+	var conf struct {
+		Name     string          `usage:"name of the service"`
+		Greeting string          `default:""`
+		Token    readconf.Secret `default:"x"`
+		DB       struct {
+			Port int `default:"5432"`
+		}
+	}
+
+	docs, err := readconf.Describe(&conf)
+	require.NoError(t, err)
+
+	t.Run("table", func(t *testing.T) {
+		var buf bytes.Buffer
+		require.NoError(t, readconf.WriteDescribe(&buf, docs, readconf.FormatTable))
+		require.Equal(t, ""+
+			"KEY       TYPE             DEFAULT       REQUIRED  SECRET  USAGE\n"+
+			"DB__PORT  int              \"5432\"        false     false   -\n"+
+			"GREETING  string           \"\"            false     false   -\n"+
+			"NAME      string           -             true      false   name of the service\n"+
+			"TOKEN     readconf.Secret  \"[redacted]\"  false     true    -\n",
+			buf.String())
+	})
+
+	t.Run("json", func(t *testing.T) {
+		var buf bytes.Buffer
+		require.NoError(t, readconf.WriteDescribe(&buf, docs, readconf.FormatJSON))
+		require.JSONEq(t, `[
+			{"key": "DB__PORT", "type": "int", "default": "5432", "required": false},
+			{"key": "GREETING", "type": "string", "default": "", "required": false},
+			{"key": "NAME", "type": "string", "required": true, "usage": "name of the service"},
+			{"key": "TOKEN", "type": "readconf.Secret", "default": "[redacted]", "required": false, "secret": true}
+		]`, buf.String())
+	})
+
+	t.Run("registered", func(t *testing.T) {
+		var buf bytes.Buffer
+		require.NoError(t, readconf.WriteDescribe(&buf, docs[:1], `colon`))
+		require.JSONEq(t, `[{"key": "DB__PORT", "type": "int", "default": "5432", "required": false}]`, buf.String())
+	})
+
+	t.Run("unknown", func(t *testing.T) {
+		var buf bytes.Buffer
+		require.EqualError(t, readconf.WriteDescribe(&buf, docs, `xml`), `unknown format "xml"`)
+	})
+}
@@ -0,0 +1,40 @@
+//go:build go1.21
+// +build go1.21
+
+package readconf
+
+// Provide returns a constructor of the configuration built by the builder
+// returned by newBuilder, for dependency injection frameworks:
+//
+//	fx.Provide(readconf.Provide[Config](newBuilder))
+//
+// google/wire needs a declared provider function, which can call the
+// constructor:
+//
+//	func provideConfig() (*Config, error) {
+//		return readconf.Provide[Config](newBuilder)()
+//	}
+func Provide[T any](newBuilder func() *Builder) func() (*T, error) {
+	return func() (*T, error) {
+		var conf T
+		if err := newBuilder().Build(&conf); err != nil {
+			return nil, err
+		}
+
+		return &conf, nil
+	}
+}
+
+// ProvidePrefix is like Provide, but builds T from the keys under prefix, as
+// if it was a field of a configuration struct at that path. Keys outside of
+// prefix may be missing.
+func ProvidePrefix[T any](newBuilder func() *Builder, prefix string) func() (*T, error) {
+	return func() (*T, error) {
+		var conf T
+		if err := newBuilder().BuildPrefix(prefix, &conf); err != nil {
+			return nil, err
+		}
+
+		return &conf, nil
+	}
+}
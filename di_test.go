@@ -0,0 +1,57 @@
+//go:build go1.21
+// +build go1.21
+
+package readconf_test
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/tetratom/readconf"
+)
+
+func TestProvide(t *testing.T) {
+	type server struct {
+		Host     string
+		MaxConns int `default:"10"`
+	}
+
+	type config struct {
+		Name       string
+		HTTPServer server
+	}
+
+	newBuilder := func() *readconf.Builder {
+		return readconf.NewBuilder().
+			Set(`HTTP_SERVER__HOST`, `localhost`).
+			Set(`ADMIN__HTTP_SERVER__HOST`, `admin`)
+	}
+
+	t.Run("config", func(t *testing.T) {
+		_, err := readconf.Provide[config](newBuilder)()
+		require.EqualError(t, err, `missing 1 configuration key: NAME`)
+
+		conf, err := readconf.Provide[config](func() *readconf.Builder {
+			return newBuilder().Set(`NAME`, `app`)
+		})()
+		require.NoError(t, err)
+		require.Equal(t, &config{Name: `app`, HTTPServer: server{Host: `localhost`, MaxConns: 10}}, conf)
+	})
+
+	t.Run("prefix", func(t *testing.T) {
+		conf, err := readconf.ProvidePrefix[server](newBuilder, `http_server`)()
+		require.NoError(t, err)
+		require.Equal(t, &server{Host: `localhost`, MaxConns: 10}, conf)
+
+		conf, err = readconf.ProvidePrefix[server](newBuilder, `ADMIN__HTTP_SERVER`)()
+		require.NoError(t, err)
+		require.Equal(t, &server{Host: `admin`, MaxConns: 10}, conf)
+
+		_, err = readconf.ProvidePrefix[server](newBuilder, `DB`)()
+		require.EqualError(t, err, `missing 1 configuration key: DB__HOST`)
+
+		_, err = readconf.ProvidePrefix[server](newBuilder, `__`)()
+		require.EqualError(t, err, `invalid prefix __`)
+	})
+}
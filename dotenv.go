@@ -0,0 +1,183 @@
+package readconf
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// MergeDotenv merges the values of a .env file's contents, following common
+// dotenv semantics:
+//
+//   - lines may start with export;
+//   - values may be enclosed in single quotes, taken literally, or in double
+//     quotes, which interpret the escape sequences \n, \r, \t, \" and \\;
+//     quoted values may span several lines;
+//   - a # preceded by whitespace starts a comment after unquoted values.
+//
+// References such as ${KEY} are resolved by Build, like those of other
+// sources.
+func (b *Builder) MergeDotenv(data []byte) *Builder {
+	return b.MergeSource(DotenvSource(data))
+}
+
+// MergeDotenvReader merges the values read from r, like MergeDotenv.
+func (b *Builder) MergeDotenvReader(r io.Reader) *Builder {
+	return b.MergeSource(ReaderSource(r, DotenvSource))
+}
+
+// MergeDotenvFile merges the values of a .env file, like MergeDotenv.
+func (b *Builder) MergeDotenvFile(filename string) *Builder {
+	return b.MergeSource(DotenvFileSource(filename))
+}
+
+// DotenvSource returns a Source parsing data like MergeDotenv.
+func DotenvSource(data []byte) Source {
+	return dotenvSource(data)
+}
+
+type dotenvSource []byte
+
+func (s dotenvSource) Load(ctx context.Context) (Map, error) {
+	return parseDotenv(s)
+}
+
+func (s dotenvSource) String() string {
+	return `dotenv`
+}
+
+// DotenvFileSource returns a Source reading a .env file, like
+// MergeDotenvFile.
+func DotenvFileSource(filename string) Source {
+	return fileSource{filename: filename, format: `dotenv`, parse: DotenvSource}
+}
+
+func parseDotenv(data []byte) (Map, error) {
+	m := Map{}
+	data = bytes.Replace(data, []byte("\r\n"), []byte("\n"), -1)
+
+	for line := 1; len(data) > 0; line++ {
+		text, next := data, []byte{}
+		if end := bytes.IndexByte(data, '\n'); end >= 0 {
+			text, next = data[:end], data[end+1:]
+		}
+
+		text = bytes.TrimSpace(text)
+		if len(text) == 0 || text[0] == '#' {
+			data = next
+			continue
+		}
+
+		if bytes.HasPrefix(text, []byte(`export `)) || bytes.HasPrefix(text, []byte("export\t")) {
+			text = bytes.TrimSpace(text[len(`export`):])
+		}
+
+		eq := bytes.IndexByte(text, '=')
+		if eq < 0 {
+			return nil, fmt.Errorf(`missing = on line %d`, line)
+		}
+
+		key := string(bytes.TrimSpace(text[:eq]))
+		if key == `` || strings.ContainsAny(key, " \t\"'") {
+			return nil, fmt.Errorf(`invalid key %q on line %d`, key, line)
+		}
+
+		// the value starts after = and may continue on following lines
+		start := bytes.IndexByte(data, '=') + 1
+		rest := bytes.TrimLeft(data[start:], " \t")
+
+		value, n, lines, err := parseDotenvValue(rest)
+		if err != nil {
+			return nil, fmt.Errorf(`%s on line %d`, err, line)
+		}
+
+		m.Set(key, value)
+
+		data = rest[n:]
+		line += lines
+	}
+
+	return m, nil
+}
+
+// Parses the value at the start of data and the rest of its line. Returns the
+// number of bytes consumed, including the line break, and the number of line
+// breaks within quotes.
+func parseDotenvValue(data []byte) (value string, n int, lines int, err error) {
+	if len(data) == 0 || (data[0] != '"' && data[0] != '\'') {
+		end := bytes.IndexByte(data, '\n')
+		if end < 0 {
+			end = len(data)
+			n = end
+		} else {
+			n = end + 1
+		}
+
+		value = string(data[:end])
+		for i := 0; i < len(value); i++ {
+			if value[i] == '#' && (i == 0 || value[i-1] == ' ' || value[i-1] == '\t') {
+				value = value[:i]
+				break
+			}
+		}
+
+		return strings.TrimSpace(value), n, 0, nil
+	}
+
+	quote := data[0]
+	var sb strings.Builder
+
+	i := 1
+	for ; ; i++ {
+		if i >= len(data) {
+			return ``, 0, 0, fmt.Errorf(`unterminated quoted value`)
+		}
+
+		c := data[i]
+		if c == quote {
+			break
+		}
+
+		if c == '\n' {
+			lines++
+		}
+
+		if c != '\\' || quote == '\'' || i+1 >= len(data) {
+			sb.WriteByte(c)
+			continue
+		}
+
+		i++
+		switch data[i] {
+		case 'n':
+			sb.WriteByte('\n')
+		case 'r':
+			sb.WriteByte('\r')
+		case 't':
+			sb.WriteByte('\t')
+		case '"', '\\':
+			sb.WriteByte(data[i])
+		default:
+			sb.WriteByte('\\')
+			sb.WriteByte(data[i])
+		}
+	}
+
+	// only whitespace and a comment may follow the closing quote
+	rest := data[i+1:]
+	end := bytes.IndexByte(rest, '\n')
+	if end < 0 {
+		end = len(rest)
+		n = i + 1 + end
+	} else {
+		n = i + 1 + end + 1
+	}
+
+	if trailing := bytes.TrimSpace(rest[:end]); len(trailing) > 0 && trailing[0] != '#' {
+		return ``, 0, 0, fmt.Errorf(`unexpected characters after quoted value`)
+	}
+
+	return sb.String(), n, lines, nil
+}
@@ -0,0 +1,244 @@
+package readconf
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// MissingKeysError is returned by Build when keys have no value.
+type MissingKeysError struct {
+	Keys []string
+	// Suggestions maps missing keys to similar keys that were given, but
+	// aren't keys of the target.
+	Suggestions map[string]string
+}
+
+func (e *MissingKeysError) Error() string {
+	plural := ""
+	if len(e.Keys) > 1 {
+		plural = "s"
+	}
+
+	return fmt.Sprintf("missing %d configuration key%s: %s",
+		len(e.Keys), plural,
+		joinSuggestions(e.Keys, e.Suggestions))
+}
+
+// UnknownKeysError is returned by Build in strict mode when values are given
+// for keys that aren't keys of the target.
+type UnknownKeysError struct {
+	Keys []string
+	// Suggestions maps unknown keys to similar keys of the target.
+	Suggestions map[string]string
+}
+
+func (e *UnknownKeysError) Error() string {
+	plural := ""
+	if len(e.Keys) > 1 {
+		plural = "s"
+	}
+
+	return fmt.Sprintf("unknown %d configuration key%s: %s",
+		len(e.Keys), plural,
+		joinSuggestions(e.Keys, e.Suggestions))
+}
+
+// NoSourceError is returned by Build when none of the sources required by
+// RequireAtLeastOneOf provided keys.
+type NoSourceError struct {
+	Sources []string
+}
+
+func (e *NoSourceError) Error() string {
+	return fmt.Sprintf("no keys from any of the sources %s", strings.Join(e.Sources, `, `))
+}
+
+func joinSuggestions(keys []string, suggestions map[string]string) string {
+	ss := make([]string, len(keys))
+	for i, key := range keys {
+		ss[i] = key
+		if s, ok := suggestions[key]; ok {
+			ss[i] += ` (did you mean ` + s + `?)`
+		}
+	}
+
+	return strings.Join(ss, `, `)
+}
+
+// UnmarshalError is returned by Build when the value of a key cannot be
+// unmarshaled into its field.
+type UnmarshalError struct {
+	Key string
+	Err error
+}
+
+func (e *UnmarshalError) Error() string {
+	return fmt.Sprintf("unmarshal value: configuration key \"%s\": %s", e.Key, e.Err)
+}
+
+// Unwrap returns the error of the field.
+func (e *UnmarshalError) Unwrap() error {
+	return e.Err
+}
+
+// ValidationError is returned by Build when fields fail validation, see
+// Validator.
+type ValidationError struct {
+	// Fields are sorted by key.
+	Fields []ValidationField
+}
+
+// ValidationField is a field that failed a validation rule, e.g. the rule
+// "min" with the param "1".
+type ValidationField struct {
+	Key   string
+	Rule  string
+	Param string
+}
+
+func (e *ValidationError) Error() string {
+	keys := make([]string, len(e.Fields))
+	for i := range e.Fields {
+		keys[i] = e.Fields[i].Key
+	}
+
+	return `validation failed: ` + strings.Join(keys, `, `)
+}
+
+// WriteError writes an error returned by Build to w for humans, listing the
+// keys or sources at fault one per line. Keys are highlighted in red and
+// suggested keys in green, if colors are enabled.
+func WriteError(w io.Writer, err error, opts ...WriteOption) error {
+	color := useColor(w, opts)
+
+	var head string
+	var lines []string
+
+	keyLines := func(keys []string, suggestions map[string]string) {
+		for _, key := range keys {
+			line := paint(color, _colorRed, key)
+			if s, ok := suggestions[key]; ok {
+				line += ` (did you mean ` + paint(color, _colorGreen, s) + `?)`
+			}
+
+			lines = append(lines, line)
+		}
+	}
+
+	switch err := err.(type) {
+	case *MissingKeysError:
+		head = strings.SplitN(err.Error(), `:`, 2)[0]
+		keyLines(err.Keys, err.Suggestions)
+	case *UnknownKeysError:
+		head = strings.SplitN(err.Error(), `:`, 2)[0]
+		keyLines(err.Keys, err.Suggestions)
+	case *ValidationError:
+		head = `validation failed`
+		for _, f := range err.Fields {
+			rule := f.Rule
+			if f.Param != `` {
+				rule += `=` + f.Param
+			}
+
+			lines = append(lines, paint(color, _colorRed, f.Key)+`: `+rule)
+		}
+	case SourceErrors:
+		head = `1 source failed`
+		if len(err) > 1 {
+			head = fmt.Sprintf("%d sources failed", len(err))
+		}
+
+		for _, se := range err {
+			lines = append(lines, paint(color, _colorRed, se.Source)+`: `+se.Err.Error())
+		}
+	default:
+		head = err.Error()
+	}
+
+	out := head + "\n"
+	if len(lines) > 0 {
+		out = head + ":\n  " + strings.Join(lines, "\n  ") + "\n"
+	}
+
+	_, werr := io.WriteString(w, out)
+	return werr
+}
+
+type jsonError struct {
+	Kind    string         `json:"kind"`
+	Message string         `json:"message"`
+	Keys    []jsonKeyError `json:"keys,omitempty"`
+}
+
+type jsonKeyError struct {
+	Key     string `json:"key,omitempty"`
+	Source  string `json:"source,omitempty"`
+	Problem string `json:"problem"`
+	// similar key, for missing and unknown keys
+	Suggestion string `json:"suggestion,omitempty"`
+	Rule       string `json:"rule,omitempty"`
+	Param      string `json:"param,omitempty"`
+}
+
+// ErrorsAsJSON renders an error returned by Build as a JSON object, e.g. for
+// dashboards to show per-key guidance:
+//
+//	{"kind": "validation", "message": "validation failed: PORT",
+//	 "keys": [{"key": "PORT", "problem": "failed rule min=1", "rule": "min", "param": "1"}]}
+//
+// The kind is one of missing_keys, unknown_keys, unmarshal, validation, policy,
+// no_source, sources or other. Keys are listed for all kinds but other; for
+// no_source and sources they name the sources instead. It returns nil if err is nil.
+func ErrorsAsJSON(err error) []byte {
+	if err == nil {
+		return nil
+	}
+
+	out := jsonError{Kind: `other`, Message: err.Error()}
+
+	switch err := err.(type) {
+	case *MissingKeysError:
+		out.Kind = `missing_keys`
+		for _, key := range err.Keys {
+			out.Keys = append(out.Keys, jsonKeyError{Key: key, Problem: `missing`, Suggestion: err.Suggestions[key]})
+		}
+	case *UnknownKeysError:
+		out.Kind = `unknown_keys`
+		for _, key := range err.Keys {
+			out.Keys = append(out.Keys, jsonKeyError{Key: key, Problem: `unknown`, Suggestion: err.Suggestions[key]})
+		}
+	case *UnmarshalError:
+		out.Kind = `unmarshal`
+		out.Keys = []jsonKeyError{{Key: err.Key, Problem: err.Err.Error()}}
+	case *ValidationError:
+		out.Kind = `validation`
+		for _, f := range err.Fields {
+			problem := `failed rule ` + f.Rule
+			if f.Param != `` {
+				problem += `=` + f.Param
+			}
+
+			out.Keys = append(out.Keys, jsonKeyError{Key: f.Key, Problem: problem, Rule: f.Rule, Param: f.Param})
+		}
+	case *PolicyError:
+		out.Kind = `policy`
+		for _, v := range err.Violations {
+			out.Keys = append(out.Keys, jsonKeyError{Problem: v})
+		}
+	case *NoSourceError:
+		out.Kind = `no_source`
+		for _, source := range err.Sources {
+			out.Keys = append(out.Keys, jsonKeyError{Source: source, Problem: `no keys`})
+		}
+	case SourceErrors:
+		out.Kind = `sources`
+		for _, se := range err {
+			out.Keys = append(out.Keys, jsonKeyError{Source: se.Source, Problem: se.Err.Error()})
+		}
+	}
+
+	data, _ := json.Marshal(out)
+	return data
+}
@@ -0,0 +1,194 @@
+// Package etcdsupport loads configuration values from etcd, in a module of its
+// own, so that readconf doesn't include remote sources. It talks to etcd v3
+// through its JSON gateway, so that no etcd client is needed.
+//
+//	err := readconf.NewBuilder().
+//		MergeSourceContext(ctx, etcdsupport.NewSource("http://localhost:2379", "/myapp/")).
+//		Build(&conf)
+package etcdsupport
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/tetratom/readconf"
+)
+
+// Source loads the keys under a prefix from etcd. The rest of a key after the
+// prefix is the configuration key, with / separating struct fields, so
+// /myapp/db/host sets DB__HOST under the prefix /myapp/, with the default key
+// strategy. Authenticated
+// clusters take the token of the Authorization header, set with
+// readconf.WithHeader.
+type Source struct {
+	endpoint string
+	prefix   string
+	client   *http.Client
+	header   http.Header
+
+	mu       sync.Mutex
+	revision int64
+}
+
+// NewSource returns a source of the keys under prefix of the etcd cluster at
+// endpoint, e.g. http://localhost:2379.
+func NewSource(endpoint, prefix string, opts ...readconf.URLOption) *Source {
+	client, header := readconf.HTTPOptions(opts...)
+
+	return &Source{
+		endpoint: strings.TrimSuffix(endpoint, `/`),
+		prefix:   prefix,
+		client:   client,
+		header:   header,
+	}
+}
+
+type keyValue struct {
+	Key   []byte `json:"key"`
+	Value []byte `json:"value"`
+}
+
+type header struct {
+	Revision int64 `json:"revision,string"`
+}
+
+type rangeResponse struct {
+	Header header     `json:"header"`
+	Kvs    []keyValue `json:"kvs"`
+}
+
+func (s *Source) Load(ctx context.Context) (readconf.Map, error) {
+	m, _, err := s.LoadVersion(ctx)
+	return m, err
+}
+
+// LoadVersion returns the revision of the cluster as the version.
+func (s *Source) LoadVersion(ctx context.Context) (readconf.Map, string, error) {
+	var resp rangeResponse
+	if err := s.post(ctx, s.client, `/v3/kv/range`, map[string][]byte{
+		`key`:       []byte(s.prefix),
+		`range_end`: prefixRangeEnd(s.prefix),
+	}, func(dec *json.Decoder) error {
+		return dec.Decode(&resp)
+	}); err != nil {
+		return nil, ``, err
+	}
+
+	keys := readconf.ContextKeyStrategy(ctx)
+
+	m := make(readconf.Map, len(resp.Kvs))
+	for _, kv := range resp.Kvs {
+		key := strings.TrimLeft(strings.TrimPrefix(string(kv.Key), s.prefix), `/`)
+		m.Set(keys.Join(strings.Split(key, `/`)...), string(kv.Value))
+	}
+
+	s.mu.Lock()
+	s.revision = resp.Header.Revision
+	s.mu.Unlock()
+
+	return m, strconv.FormatInt(resp.Header.Revision, 10), nil
+}
+
+// Watch calls f whenever keys under the prefix change after the revision last
+// loaded, e.g. to reload an App, until ctx is done or the watch fails.
+func (s *Source) Watch(ctx context.Context, f func()) error {
+	s.mu.Lock()
+	revision := s.revision
+	s.mu.Unlock()
+
+	req := map[string]interface{}{
+		`key`:       []byte(s.prefix),
+		`range_end`: prefixRangeEnd(s.prefix),
+	}
+	if revision > 0 {
+		req[`start_revision`] = strconv.FormatInt(revision+1, 10)
+	}
+
+	// the timeout of requests would end the watch
+	client := *s.client
+	client.Timeout = 0
+
+	err := s.post(ctx, &client, `/v3/watch`, map[string]interface{}{`create_request`: req}, func(dec *json.Decoder) error {
+		for {
+			var resp struct {
+				Result struct {
+					Events []json.RawMessage `json:"events"`
+				} `json:"result"`
+				Error *struct {
+					Message string `json:"message"`
+				} `json:"error"`
+			}
+
+			if err := dec.Decode(&resp); err != nil {
+				return err
+			}
+
+			if resp.Error != nil {
+				return fmt.Errorf("%s", resp.Error.Message)
+			}
+
+			if len(resp.Result.Events) > 0 {
+				f()
+			}
+		}
+	})
+	if ctx.Err() != nil {
+		return ctx.Err()
+	}
+
+	return err
+}
+
+func (s *Source) String() string {
+	return `etcd ` + s.prefix
+}
+
+// Posts body as JSON to path and decodes the response with decode.
+func (s *Source) post(ctx context.Context, client *http.Client, path string, body interface{}, decode func(dec *json.Decoder) error) error {
+	data, err := json.Marshal(body)
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequest(http.MethodPost, s.endpoint+path, bytes.NewReader(data))
+	if err != nil {
+		return err
+	}
+
+	for key, values := range s.header {
+		req.Header[key] = values
+	}
+	req.Header.Set(`Content-Type`, `application/json`)
+
+	resp, err := client.Do(req.WithContext(ctx))
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return fmt.Errorf("unexpected status %s", resp.Status)
+	}
+
+	return decode(json.NewDecoder(resp.Body))
+}
+
+// Returns the end of the range of keys starting with prefix, all keys for an
+// empty prefix.
+func prefixRangeEnd(prefix string) []byte {
+	end := []byte(prefix)
+	for i := len(end) - 1; i >= 0; i-- {
+		if end[i] < 0xff {
+			end[i]++
+			return end[:i+1]
+		}
+	}
+
+	return []byte{0}
+}
@@ -0,0 +1,83 @@
+package etcdsupport_test
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/tetratom/readconf"
+	"github.com/tetratom/readconf/etcdsupport"
+)
+
+func TestSource(t *testing.T) {
+	type request struct {
+		Key           []byte `json:"key"`
+		RangeEnd      []byte `json:"range_end"`
+		StartRevision string `json:"start_revision"`
+	}
+
+	watches := make(chan request, 1)
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case `/v3/kv/range`:
+			var req request
+			require.NoError(t, json.NewDecoder(r.Body).Decode(&req))
+			require.Equal(t, `/app/`, string(req.Key))
+			require.Equal(t, `/app0`, string(req.RangeEnd))
+
+			json.NewEncoder(w).Encode(map[string]interface{}{
+				`header`: map[string]string{`revision`: `42`},
+				`kvs`: []map[string][]byte{
+					{`key`: []byte(`/app/name`), `value`: []byte(`etcd`)},
+					{`key`: []byte(`/app/db/host`), `value`: []byte(`localhost`)},
+				},
+			})
+		case `/v3/watch`:
+			var req struct {
+				CreateRequest request `json:"create_request"`
+			}
+			require.NoError(t, json.NewDecoder(r.Body).Decode(&req))
+			watches <- req.CreateRequest
+
+			fmt.Fprintln(w, `{"result": {"created": true}}`)
+			fmt.Fprintln(w, `{"result": {"events": [{"type": "PUT"}]}}`)
+			w.(http.Flusher).Flush()
+			<-r.Context().Done()
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer server.Close()
+
+	var conf struct {
+		Name string
+		DB   struct {
+			Host string
+		}
+	}
+
+	source := etcdsupport.NewSource(server.URL, `/app/`)
+	lock, err := readconf.NewBuilder().MergeSource(source).Lock(&conf)
+	require.NoError(t, err)
+	require.Equal(t, readconf.Map{`NAME`: `etcd`, `DB__HOST`: `localhost`}, lock.Values)
+	require.Equal(t, []readconf.LockedSource{{Name: `etcd /app/`, Version: `42`}}, lock.Sources)
+
+	require.NoError(t, readconf.NewBuilder().MergeSourceContext(context.Background(), etcdsupport.NewSource(server.URL, `/app/`)).Build(&conf))
+	require.Equal(t, `localhost`, conf.DB.Host)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	err = source.Watch(ctx, cancel)
+	require.Equal(t, context.Canceled, err)
+	require.Equal(t, `43`, (<-watches).StartRevision)
+
+	err = readconf.NewBuilder().MergeSource(etcdsupport.NewSource(server.URL+`/missing`, `/app/`)).Build(&conf)
+	require.EqualError(t, err, `etcd /app/: unexpected status 404 Not Found`)
+}
@@ -0,0 +1,185 @@
+package readconf
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+)
+
+// marks values stored in files by LargeValues, followed by the path
+const _externalPrefix = "\x00readconf-external:"
+
+var _readerType = reflect.TypeOf(new(io.Reader)).Elem()
+
+func init() {
+	_leaves[_readerType] = func(s string) (interface{}, error) {
+		return strings.NewReader(s), nil
+	}
+}
+
+// LargeValues stores values merged afterwards that are longer than threshold
+// bytes in files in dir, instead of in memory, e.g. for large certificate
+// bundles or schemas. Fields of type io.Reader read such values from their
+// files, and fields of other types read them into memory when they are built.
+// Values of io.Reader fields that aren't stored in files are read from memory.
+// Files are named by the hashes of their contents, so values that don't change
+// between builders, e.g. on reloads of an App, reuse their files. Files are
+// only readable by their owner and are not removed, so dir should be a
+// directory the caller removes when the configuration is no longer used, e.g.
+// one created by ioutil.TempDir.
+//
+// Values stored in files are seen by transforms, policies and reports as
+// references to their files. Only keys whose values the builder stored are
+// read from files, so values given by sources are never taken as references.
+func (b *Builder) LargeValues(threshold int, dir string) *Builder {
+	if b.hasError() {
+		return b
+	}
+
+	b.largeThreshold = threshold
+	b.largeDir = dir
+	return b
+}
+
+// Returns the value to merge for key, a reference to a file holding value if
+// it is large.
+func (b *Builder) storeValue(key, value string) (string, error) {
+	key = normalizeKey(key)
+	if b.largeDir == `` || len(value) <= b.largeThreshold {
+		delete(b.largeFiles, key)
+		return value, nil
+	}
+
+	sum := sha256.Sum256([]byte(value))
+	filename := filepath.Join(b.largeDir, `readconf-`+hex.EncodeToString(sum[:]))
+
+	if _, err := os.Stat(filename); os.IsNotExist(err) {
+		if err := writeExternalFile(filename, value); err != nil {
+			return ``, err
+		}
+	} else if err != nil {
+		return ``, err
+	}
+
+	if b.largeFiles == nil {
+		b.largeFiles = map[string]string{}
+	}
+
+	b.largeFiles[key] = filename
+	return _externalPrefix + filename, nil
+}
+
+// Writes value to a new file at filename, readable only by its owner. The
+// file is written next to filename and renamed, so that it is either complete
+// or missing.
+func writeExternalFile(filename, value string) error {
+	f, err := ioutil.TempFile(filepath.Dir(filename), `readconf-`)
+	if err != nil {
+		return err
+	}
+
+	if _, err := f.WriteString(value); err != nil {
+		f.Close()
+		os.Remove(f.Name())
+		return err
+	}
+
+	if err := f.Close(); err != nil {
+		os.Remove(f.Name())
+		return err
+	}
+
+	if err := os.Rename(f.Name(), filename); err != nil {
+		os.Remove(f.Name())
+		return err
+	}
+
+	return nil
+}
+
+// Returns the file holding the value of key, if it was stored by LargeValues
+// and value still refers to it.
+func externalFile(files map[string]string, key, value string) (string, bool) {
+	filename, ok := files[normalizeKey(key)]
+	if !ok || value != _externalPrefix+filename {
+		return ``, false
+	}
+
+	return filename, true
+}
+
+// Unmarshals the contents of a file into vv. io.Reader values read the file
+// when they are read.
+func unmarshalFile(filename string, vv reflect.Value) error {
+	if vv.Type() == _readerType {
+		vv.Set(reflect.ValueOf(&externalReader{filename: filename}))
+		return nil
+	}
+
+	data, err := ioutil.ReadFile(filename)
+	if err != nil {
+		return err
+	}
+
+	return unmarshalValue(string(data), vv)
+}
+
+// Returns the contents of the io.Reader in v without consuming it. Only
+// readers of files and of values in memory, e.g. those Build sets, can be read
+// again, other readers are rejected.
+func marshalReader(v reflect.Value) (string, error) {
+	if v.IsNil() {
+		return ``, nil
+	}
+
+	switch r := v.Interface().(type) {
+	case *externalReader:
+		data, err := ioutil.ReadFile(r.filename)
+		return string(data), err
+	case interface {
+		io.ReaderAt
+		Size() int64
+	}:
+		data, err := ioutil.ReadAll(io.NewSectionReader(r, 0, r.Size()))
+		return string(data), err
+	default:
+		return ``, fmt.Errorf("can't read io.Reader of type %T without consuming it", r)
+	}
+}
+
+// Reads a file, opening it on the first read and closing it at its end.
+type externalReader struct {
+	filename string
+	f        *os.File
+	done     bool
+}
+
+func (r *externalReader) Read(p []byte) (int, error) {
+	if r.done {
+		return 0, io.EOF
+	}
+
+	if r.f == nil {
+		f, err := os.Open(r.filename)
+		if err != nil {
+			return 0, err
+		}
+
+		r.f = f
+	}
+
+	n, err := r.f.Read(p)
+	if err != nil {
+		r.f.Close()
+		r.f = nil
+		r.done = err == io.EOF
+	}
+
+	return n, err
+}
@@ -0,0 +1,53 @@
+package readconf
+
+import (
+	"os"
+	"runtime"
+	"strconv"
+	"strings"
+)
+
+// prefix of the keys of host facts
+const _factPrefix = `SYS.`
+
+// HostFacts returns facts about the host the process runs on: SYS.HOSTNAME,
+// SYS.PID, SYS.NUM_CPU, SYS.OS and SYS.ARCH. Values may reference them, e.g.
+// ${sys.hostname}, unless a value is set for the same key.
+func HostFacts() Map {
+	hostname, _ := os.Hostname()
+
+	return Map{
+		`SYS.HOSTNAME`: hostname,
+		`SYS.PID`:      strconv.Itoa(os.Getpid()),
+		`SYS.NUM_CPU`:  strconv.Itoa(runtime.NumCPU()),
+		`SYS.OS`:       runtime.GOOS,
+		`SYS.ARCH`:     runtime.GOARCH,
+	}
+}
+
+// Returns the host fact of a reference, if it is one.
+func lookupFact(ref string) (string, bool) {
+	if !strings.HasPrefix(normalizeKey(ref), _factPrefix) {
+		return ``, false
+	}
+
+	return HostFacts().Lookup(ref)
+}
+
+// Replaces references to host facts in s.
+func expandFacts(s string) string {
+	if !strings.Contains(s, `${`) {
+		return s
+	}
+
+	refs, _ := parseReferences(s)
+
+	facts := Map{}
+	for _, ref := range refs {
+		if value, ok := lookupFact(ref); ok {
+			facts[ref] = value
+		}
+	}
+
+	return replaceReferences(s, facts)
+}
@@ -0,0 +1,19 @@
+//go:build js
+// +build js
+
+package readconf
+
+import (
+	"os"
+	"syscall"
+)
+
+// Reports whether err tells that files can't be accessed at all, e.g. in
+// browsers, where the file system functions fail with ENOSYS.
+func isNoFileAccess(err error) bool {
+	if pe, ok := err.(*os.PathError); ok {
+		err = pe.Err
+	}
+
+	return err == syscall.ENOSYS
+}
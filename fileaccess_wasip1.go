@@ -0,0 +1,20 @@
+//go:build wasip1
+// +build wasip1
+
+package readconf
+
+import (
+	"os"
+	"syscall"
+)
+
+// Reports whether err tells that files can't be accessed at all, e.g. paths
+// outside of the directories preopened by the host, which fail with EBADF or
+// ENOTCAPABLE.
+func isNoFileAccess(err error) bool {
+	if pe, ok := err.(*os.PathError); ok {
+		err = pe.Err
+	}
+
+	return err == syscall.EBADF || err == syscall.ENOTCAPABLE
+}
@@ -0,0 +1,80 @@
+package readconf
+
+import (
+	"strings"
+	"sync"
+)
+
+var (
+	_formatsMu sync.RWMutex
+	_formats   []FileFormat
+)
+
+// FileFormat is a format of configuration files provided by another package,
+// such as YAML by package yamlsupport, so that this package doesn't depend on
+// its parser.
+type FileFormat struct {
+	// Name of the format, which names the sources of its files and selects it
+	// in WriteDescribe and Report.Write, e.g. yaml.
+	Name string
+	// Extensions of the files in the format, e.g. .yaml and .yml.
+	Extensions []string
+	// MediaTypes of responses in the format, e.g. application/yaml.
+	MediaTypes []string
+	// Parse returns a Source parsing data in the format.
+	Parse func(data []byte) Source
+	// Marshal, if set, encodes the output of WriteDescribe and Report.Write.
+	Marshal func(v interface{}) ([]byte, error)
+}
+
+// RegisterFormat registers a format of configuration files. Files with its
+// extensions are parsed in the format by MergeFS and MergeURL, as are
+// responses with its media types, and the format may be written by
+// WriteDescribe and Report.Write if it has a Marshal function. Formats are
+// usually registered by importing the packages providing them.
+func RegisterFormat(f FileFormat) {
+	_formatsMu.Lock()
+	defer _formatsMu.Unlock()
+
+	_formats = append(_formats, f)
+}
+
+// Returns the registered format matching match.
+func lookupFormat(match func(f FileFormat) bool) (FileFormat, bool) {
+	_formatsMu.RLock()
+	defer _formatsMu.RUnlock()
+
+	for _, f := range _formats {
+		if match(f) {
+			return f, true
+		}
+	}
+
+	return FileFormat{}, false
+}
+
+func lookupFormatByExtension(ext string) (FileFormat, bool) {
+	return lookupFormat(func(f FileFormat) bool {
+		for _, e := range f.Extensions {
+			if strings.EqualFold(e, ext) {
+				return true
+			}
+		}
+
+		return false
+	})
+}
+
+func lookupFormatByMediaType(mediaType string) (FileFormat, bool) {
+	return lookupFormat(func(f FileFormat) bool {
+		return containsString(f.MediaTypes, mediaType)
+	})
+}
+
+// FormatFileSource returns a Source reading a file in format, parsed with the
+// source returned by parse, which must not keep the data, e.g. for formats of
+// other packages. Like the sources of files of this package, it is named
+// "FORMAT file FILENAME" and its version is the SHA-256 hash of the file.
+func FormatFileSource(filename, format string, parse func(data []byte) Source) Source {
+	return fileSource{filename: filename, format: format, parse: parse}
+}
@@ -0,0 +1,134 @@
+package readconf
+
+import (
+	"flag"
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// MergeFlags merges the flags of fs that were set on the command line. Flag
+// names are turned into keys by replacing - with _ and . with the struct
+// separator, so -db.max-conns sets DB__MAX_CONNS.
+//
+// Flag sets of other packages can be merged the same way, e.g. those of a
+// cobra command:
+//
+//	cmd.Flags().Visit(func(f *pflag.Flag) {
+//		b.Set(readconf.FlagKey(f.Name), f.Value.String())
+//	})
+func (b *Builder) MergeFlags(fs *flag.FlagSet) *Builder {
+	if b.hasError() {
+		return b
+	}
+
+	m := Map{}
+	fs.Visit(func(f *flag.Flag) {
+		m.Set(FlagKey(f.Name), f.Value.String())
+	})
+
+	return b.MergeMap(m)
+}
+
+// FlagKey returns the configuration key of a command line flag.
+func FlagKey(name string) string {
+	name = stringReplaceAll(name, `-`, `_`)
+	name = stringReplaceAll(name, `.`, _separator)
+	return normalizeKey(name)
+}
+
+// DefineFlags defines a string flag on fs for every configuration key of
+// target, named by FlagName, so that MergeFlags merges those given on the
+// command line. The usage of a flag is taken from the usage tag of its field,
+// followed by its type. Merge the flags last to give them precedence over
+// files and the environment:
+//
+//	fs := flag.NewFlagSet(os.Args[0], flag.ExitOnError)
+//	if err := readconf.DefineFlags(fs, &conf); err != nil {
+//		...
+//	}
+//	fs.Parse(os.Args[1:])
+//
+//	err := readconf.NewBuilder().
+//		MergeFile("app.conf").
+//		MergeEnviron("APP_", os.Environ()).
+//		MergeFlags(fs).
+//		Build(&conf)
+//
+// Other command line packages, such as urfave/cli, can define
+// flags from Describe the same way:
+//
+//	for _, doc := range docs {
+//		flags = append(flags, &cli.StringFlag{Name: readconf.FlagName(doc.Key), Value: doc.Default})
+//	}
+func DefineFlags(fs *flag.FlagSet, target interface{}) error {
+	docs, err := Describe(target)
+	if err != nil {
+		return err
+	}
+
+	for _, doc := range docs {
+		usage := doc.Type
+		if doc.Required {
+			usage += ", required"
+		}
+
+		if doc.Usage != `` {
+			usage = doc.Usage + ` (` + usage + `)`
+		}
+
+		fs.String(FlagName(doc.Key), doc.Default, usage)
+	}
+
+	return nil
+}
+
+// FlagName returns the name of the command line flag of a configuration key,
+// the inverse of FlagKey.
+func FlagName(key string) string {
+	key = strings.ToLower(normalizeKey(key))
+	key = stringReplaceAll(key, _separator, `.`)
+	key = stringReplaceAll(key, `_`, `-`)
+	return key
+}
+
+// Nested returns the values of m as nested maps, split at the struct
+// separator and with lower case keys, as used by packages such as viper:
+//
+//	m, err := readconf.Marshal(&conf)
+//	...
+//	nested, err := m.Nested()
+//	...
+//	v.MergeConfigMap(nested)
+func (m Map) Nested() (map[string]interface{}, error) {
+	keys := make([]string, 0, len(m))
+	for key := range m {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	out := map[string]interface{}{}
+	for _, key := range keys {
+		parts := strings.Split(strings.ToLower(key), _separator)
+
+		node := out
+		for i, part := range parts[:len(parts)-1] {
+			switch child := node[part].(type) {
+			case nil:
+				next := map[string]interface{}{}
+				node[part] = next
+				node = next
+			case map[string]interface{}:
+				node = child
+			default:
+				return nil, fmt.Errorf("key %s conflicts with %s", key, normalizeKey(strings.Join(parts[:i+1], _separator)))
+			}
+		}
+
+		// keys are sorted, so a value is always set before the values nested
+		// below it and conflicts are found above
+		node[parts[len(parts)-1]] = m[key]
+	}
+
+	return out, nil
+}
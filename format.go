@@ -0,0 +1,155 @@
+package readconf
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"strconv"
+	"text/tabwriter"
+	"time"
+)
+
+// Format selects how WriteDescribe and Report.Write render their output.
+type Format string
+
+const (
+	// FormatTable is an aligned text table for humans.
+	FormatTable Format = `table`
+	FormatJSON  Format = `json`
+	// FormatYAML needs the YAML format of package yamlsupport, see
+	// RegisterFormat. Other registered formats can be written by their names.
+	FormatYAML Format = `yaml`
+)
+
+type describeRow struct {
+	Key      string  `json:"key" yaml:"key"`
+	Type     string  `json:"type" yaml:"type"`
+	Default  *string `json:"default,omitempty" yaml:"default,omitempty"`
+	Required bool    `json:"required" yaml:"required"`
+	Secret   bool    `json:"secret,omitempty" yaml:"secret,omitempty"`
+	Usage    string  `json:"usage,omitempty" yaml:"usage,omitempty"`
+}
+
+// WriteDescribe writes the keys returned by Describe to w in format. Defaults
+// of secret keys are redacted. Tables highlight required keys in yellow and
+// secret keys in magenta, if colors are enabled.
+func WriteDescribe(w io.Writer, docs []FieldDoc, format Format, opts ...WriteOption) error {
+	rows := make([]describeRow, len(docs))
+	for i, doc := range docs {
+		rows[i] = describeRow{Key: doc.Key, Type: doc.Type, Required: doc.Required, Secret: doc.Secret, Usage: doc.Usage}
+		if doc.HasDefault {
+			def := doc.Default
+			if doc.Secret {
+				def = _redacted
+			}
+
+			rows[i].Default = &def
+		}
+	}
+
+	return writeFormat(w, format, rows, func(tw *tabwriter.Writer) {
+		color := useColor(w, opts)
+
+		writeRow(tw, color, ``, `KEY`, `TYPE`, `DEFAULT`, `REQUIRED`, `SECRET`, `USAGE`)
+		for _, row := range rows {
+			def := `-`
+			if row.Default != nil {
+				def = strconv.Quote(*row.Default)
+			}
+
+			usage := `-`
+			if row.Usage != `` {
+				usage = row.Usage
+			}
+
+			highlight := ``
+			switch {
+			case row.Secret:
+				highlight = _colorMagenta
+			case row.Required:
+				highlight = _colorYellow
+			}
+
+			writeRow(tw, color, highlight, row.Key, row.Type, def, strconv.FormatBool(row.Required), strconv.FormatBool(row.Secret), usage)
+		}
+	})
+}
+
+type reportRow struct {
+	Key     string     `json:"key" yaml:"key"`
+	Origin  Origin     `json:"origin,omitempty" yaml:"origin,omitempty"`
+	Value   string     `json:"value" yaml:"value"`
+	Expires *time.Time `json:"expires,omitempty" yaml:"expires,omitempty"`
+}
+
+// Write writes the keys of the target, with their origins, values and expiry
+// times, to w in format. Values of secret fields and of keys that look
+// sensitive, such as passwords and tokens, are redacted. Tables highlight
+// values returned by OnMissing callbacks in red, overridden values in yellow
+// and redacted values in magenta, if colors are enabled.
+func (r *Report) Write(w io.Writer, format Format, opts ...WriteOption) error {
+	rows := make([]reportRow, len(r.Keys))
+	for i, key := range r.Keys {
+		rows[i] = reportRow{
+			Key:    key,
+			Origin: r.Origins[key],
+			Value:  redactValue(key, r.Values[key], r.Docs[key].Secret),
+		}
+
+		if t, ok := r.Expires[key]; ok {
+			rows[i].Expires = &t
+		}
+	}
+
+	return writeFormat(w, format, rows, func(tw *tabwriter.Writer) {
+		color := useColor(w, opts)
+
+		writeRow(tw, color, ``, `KEY`, `ORIGIN`, `VALUE`, `EXPIRES`)
+		for _, row := range rows {
+			expires := `-`
+			if row.Expires != nil {
+				expires = row.Expires.Format(time.RFC3339)
+			}
+
+			highlight := ``
+			switch {
+			case row.Origin == OriginMissing:
+				highlight = _colorRed
+			case row.Origin == OriginOverride:
+				highlight = _colorYellow
+			case row.Value == _redacted:
+				highlight = _colorMagenta
+			}
+
+			writeRow(tw, color, highlight, row.Key, string(row.Origin), strconv.Quote(row.Value), expires)
+		}
+	})
+}
+
+func writeFormat(w io.Writer, format Format, v interface{}, table func(tw *tabwriter.Writer)) error {
+	switch format {
+	case FormatTable:
+		tw := tabwriter.NewWriter(w, 0, 4, 2, ' ', 0)
+		table(tw)
+		return tw.Flush()
+	case FormatJSON:
+		enc := json.NewEncoder(w)
+		enc.SetIndent(``, `  `)
+		return enc.Encode(v)
+	default:
+		f, ok := lookupFormat(func(f FileFormat) bool {
+			return Format(f.Name) == format && f.Marshal != nil
+		})
+		if !ok {
+			return fmt.Errorf("unknown format %q", format)
+		}
+
+		data, err := f.Marshal(v)
+		if err != nil {
+			return err
+		}
+
+		_, err = w.Write(data)
+		return err
+	}
+}
@@ -0,0 +1,52 @@
+package readconf
+
+import (
+	"fmt"
+	"time"
+)
+
+// FreezeWindow is a daily window during which App doesn't reload its
+// configuration, given as offsets from midnight in local time. A window may
+// extend past midnight, e.g. from 22h to 2h.
+type FreezeWindow struct {
+	From time.Duration
+	To   time.Duration
+}
+
+// Returns when the window containing t ends, if it does.
+func (w FreezeWindow) end(t time.Time) (time.Time, bool) {
+	midnight := time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, t.Location())
+	offset := t.Sub(midnight)
+
+	switch {
+	case w.From <= w.To && offset >= w.From && offset < w.To:
+		return midnight.Add(w.To), true
+	case w.From > w.To && offset >= w.From:
+		return midnight.AddDate(0, 0, 1).Add(w.To), true
+	case w.From > w.To && offset < w.To:
+		return midnight.Add(w.To), true
+	}
+
+	return time.Time{}, false
+}
+
+// FrozenError is returned by App.Reload during a freeze window.
+type FrozenError struct {
+	Until time.Time
+}
+
+func (e *FrozenError) Error() string {
+	return fmt.Sprintf("configuration is frozen until %s", e.Until.Format(time.Kitchen))
+}
+
+// Returns when the freeze windows of the app containing t end, if any does.
+func (a *App) frozenUntil(t time.Time) (time.Time, bool) {
+	var until time.Time
+	for _, w := range a.Freeze {
+		if end, ok := w.end(t); ok && end.After(until) {
+			until = end
+		}
+	}
+
+	return until, !until.IsZero()
+}
@@ -0,0 +1,86 @@
+//go:build go1.16
+// +build go1.16
+
+package readconf
+
+import (
+	"context"
+	"crypto/sha256"
+	"fmt"
+	"io/fs"
+	"sort"
+)
+
+// MergeFS merges the files of fsys matching patterns, as matched by fs.Glob,
+// e.g. files embedded with go:embed. The files matching each pattern are
+// merged in lexical order. Files are parsed by their extension: .json, .toml
+// and .ini files and those of registered formats, such as .yaml files, in
+// their formats, other files as KEY=value lines. A pattern that matches no files fails the build.
+func (b *Builder) MergeFS(fsys fs.FS, patterns ...string) *Builder {
+	for _, pattern := range patterns {
+		if b.hasError() {
+			return b
+		}
+
+		names, err := fs.Glob(fsys, pattern)
+		if err != nil {
+			b.addSourceError(`fs `+pattern, err)
+			continue
+		}
+
+		if len(names) == 0 {
+			b.addSourceError(`fs `+pattern, fmt.Errorf("no files match pattern"))
+			continue
+		}
+
+		sort.Strings(names)
+
+		for _, name := range names {
+			b.MergeSource(FSFileSource(fsys, name))
+		}
+	}
+
+	return b
+}
+
+// FSFileSource returns a Source reading the file name of fsys, parsed by its
+// extension like MergeFS.
+func FSFileSource(fsys fs.FS, name string) Source {
+	format, parse := formatByExtension(name)
+	return fsFileSource{fsys: fsys, name: name, format: format, parse: parse}
+}
+
+type fsFileSource struct {
+	fsys   fs.FS
+	name   string
+	format string
+	parse  func(data []byte) Source
+}
+
+func (s fsFileSource) Load(ctx context.Context) (Map, error) {
+	m, _, err := s.LoadVersion(ctx)
+	return m, err
+}
+
+// LoadVersion returns the SHA-256 hash of the file as its version.
+func (s fsFileSource) LoadVersion(ctx context.Context) (Map, string, error) {
+	data, err := fs.ReadFile(s.fsys, s.name)
+	if err != nil {
+		return nil, ``, err
+	}
+
+	m, err := s.parse(data).Load(ctx)
+	if err != nil {
+		return nil, ``, err
+	}
+
+	return m, fmt.Sprintf("sha256:%x", sha256.Sum256(data)), nil
+}
+
+func (s fsFileSource) String() string {
+	if s.format == `` {
+		return `fs file ` + s.name
+	}
+
+	return s.format + ` fs file ` + s.name
+}
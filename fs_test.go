@@ -0,0 +1,54 @@
+//go:build go1.16
+// +build go1.16
+
+package readconf_test
+
+import (
+	"testing"
+	"testing/fstest"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestBuilder_MergeFS(t *testing.T) {
+	fsys := fstest.MapFS{
+		`config/10-base.env`:      {Data: []byte("NAME=base\nPORT=80")},
+		`config/20-app.colon`:     {Data: []byte("name: app\ndatabase__host: db")},
+		`config/30-local.json`:    {Data: []byte(`{"port": 8080}`)},
+		`config/README.md`:        {Data: []byte("# not config")},
+		`overrides/prod.toml`:     {Data: []byte("[database]\nhost = 'prod-db'")},
+		`overrides/invalid.colon`: {Data: []byte("- a")},
+	}
+
+	var conf struct {
+		Name     string
+		Port     int
+		Database struct {
+			Host string
+		}
+	}
+
+	t.Run("ordered", func(t *testing.T) {
+		err := b().MergeFS(fsys, `config/*-*.*`, `overrides/*.toml`).Build(&conf)
+		require.NoError(t, err)
+		require.Equal(t, `app`, conf.Name)
+		require.Equal(t, 8080, conf.Port)
+		require.Equal(t, `prod-db`, conf.Database.Host)
+	})
+
+	t.Run("errors", func(t *testing.T) {
+		err := b().MergeFS(fsys, `missing/*`, `overrides/*.colon`, `[`).Error()
+		require.EqualError(t, err, `3 sources failed: `+
+			`fs missing/*: no files match pattern; `+
+			`colon fs file overrides/invalid.colon: expected key: value, got "- a"; `+
+			`fs [: syntax error in pattern`)
+	})
+
+	t.Run("lock", func(t *testing.T) {
+		lock, err := b().MergeFS(fsys, `config/10-base.env`).Set(`DATABASE__HOST`, `db`).Lock(&conf)
+		require.NoError(t, err)
+		require.Len(t, lock.Sources, 1)
+		require.Equal(t, `fs file config/10-base.env`, lock.Sources[0].Name)
+		require.NotEmpty(t, lock.Sources[0].Version)
+	})
+}
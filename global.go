@@ -0,0 +1,62 @@
+//go:build go1.21
+// +build go1.21
+
+package readconf
+
+import (
+	"sync"
+)
+
+// Global is a lazily built, process-wide configuration of type T. It is safe
+// for concurrent use. The first call to Get builds the configuration and later
+// calls return the same result until Reset is called.
+type Global[T any] struct {
+	newBuilder func() *Builder
+
+	mu    sync.Mutex
+	done  bool
+	value *T
+	err   error
+}
+
+// NewGlobal returns a Global that builds T from the builder returned by
+// newBuilder.
+func NewGlobal[T any](newBuilder func() *Builder) *Global[T] {
+	return &Global[T]{newBuilder: newBuilder}
+}
+
+func (g *Global[T]) Get() (*T, error) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	if !g.done {
+		value := new(T)
+		if err := g.newBuilder().Build(value); err != nil {
+			g.value, g.err = nil, err
+		} else {
+			g.value, g.err = value, nil
+		}
+
+		g.done = true
+	}
+
+	return g.value, g.err
+}
+
+func (g *Global[T]) MustGet() *T {
+	value, err := g.Get()
+	if err != nil {
+		panic(err)
+	}
+
+	return value
+}
+
+// Reset discards the built configuration so that the next call to Get builds
+// it again. It is intended for tests.
+func (g *Global[T]) Reset() {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	g.done, g.value, g.err = false, nil, nil
+}
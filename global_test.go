@@ -0,0 +1,66 @@
+//go:build go1.21
+// +build go1.21
+
+package readconf_test
+
+import (
+	"sync"
+	"sync/atomic"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/tetratom/readconf"
+)
+
+func TestGlobal(t *testing.T) {
+	type config struct {
+		Foo string
+	}
+
+	var builds int32
+	value := `foo`
+
+	g := readconf.NewGlobal[config](func() *readconf.Builder {
+		atomic.AddInt32(&builds, 1)
+		return b().Set(`FOO`, value)
+	})
+
+	results := make([]*config, 10)
+
+	var wg sync.WaitGroup
+	for i := range results {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			results[i] = g.MustGet()
+		}(i)
+	}
+	wg.Wait()
+
+	for _, result := range results {
+		require.Same(t, results[0], result)
+	}
+	require.EqualValues(t, 1, builds)
+
+	require.Equal(t, `foo`, results[0].Foo)
+
+	value = `bar`
+	require.Equal(t, `foo`, g.MustGet().Foo)
+
+	g.Reset()
+	require.Equal(t, `bar`, g.MustGet().Foo)
+	require.EqualValues(t, 2, builds)
+}
+
+func TestGlobal_Error(t *testing.T) {
+	type config struct {
+		Foo string
+	}
+
+	g := readconf.NewGlobal[config](readconf.NewBuilder)
+
+	_, err := g.Get()
+	require.EqualError(t, err, `missing 1 configuration key: FOO`)
+	require.Panics(t, func() { g.MustGet() })
+}
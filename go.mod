@@ -3,7 +3,6 @@ module github.com/tetratom/readconf
 go 1.13
 
 require (
-	github.com/go-playground/validator/v10 v10.1.0
 	github.com/stretchr/objx v0.2.0 // indirect
 	github.com/stretchr/testify v1.4.0
 	gopkg.in/yaml.v2 v2.2.8 // indirect
@@ -0,0 +1,54 @@
+//go:build go1.21
+// +build go1.21
+
+package readconf
+
+import (
+	"sync/atomic"
+)
+
+// Handle holds the current configuration of type T. Load is lock-free, so
+// request handlers can read the configuration on every request while reloads
+// replace it in the background. The value returned by Load must not be
+// modified.
+type Handle[T any] struct {
+	value atomic.Pointer[T]
+}
+
+// NewHandle returns a Handle holding value.
+func NewHandle[T any](value *T) *Handle[T] {
+	h := &Handle[T]{}
+	h.value.Store(value)
+	return h
+}
+
+// LoadHandle loads the configuration of app into a new T and returns a Handle
+// that is updated after every successful reload of app.
+func LoadHandle[T any](app *App) (*Handle[T], error) {
+	// registered first, so that no reload after Load is missed
+	h := &Handle[T]{}
+	app.OnReload(func(config interface{}, err error) {
+		if err == nil {
+			h.Store(config.(*T))
+		}
+	})
+
+	value := new(T)
+	if err := app.Load(value); err != nil {
+		return nil, err
+	}
+
+	// unless a reload stored a newer configuration already
+	h.value.CompareAndSwap(nil, value)
+	return h, nil
+}
+
+// Load returns the current configuration.
+func (h *Handle[T]) Load() *T {
+	return h.value.Load()
+}
+
+// Store replaces the current configuration with value.
+func (h *Handle[T]) Store(value *T) {
+	h.value.Store(value)
+}
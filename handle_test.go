@@ -0,0 +1,65 @@
+//go:build go1.21
+// +build go1.21
+
+package readconf_test
+
+import (
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/tetratom/readconf"
+)
+
+func TestHandle(t *testing.T) {
+	type config struct {
+		Port int
+	}
+
+	values := readconf.Map{`PORT`: `80`}
+
+	app := readconf.NewApp(`handle-app`)
+	app.Dirs = nil
+	app.Configure = func(b *readconf.Builder) {
+		b.MergeMap(values)
+	}
+	defer app.Close()
+
+	h, err := readconf.LoadHandle[config](app)
+	require.NoError(t, err)
+	require.Equal(t, &config{Port: 80}, h.Load())
+	require.Equal(t, app.Config(), h.Load())
+
+	t.Run("reload", func(t *testing.T) {
+		values[`PORT`] = `8080`
+		_, err := app.Reload()
+		require.NoError(t, err)
+		require.Equal(t, &config{Port: 8080}, h.Load())
+	})
+
+	t.Run("failed reload", func(t *testing.T) {
+		values[`PORT`] = `port`
+		_, err := app.Reload()
+		require.Error(t, err)
+		require.Equal(t, &config{Port: 8080}, h.Load())
+	})
+
+	t.Run("concurrent", func(t *testing.T) {
+		h := readconf.NewHandle(&config{Port: 1})
+
+		var wg sync.WaitGroup
+		for i := 0; i < 10; i++ {
+			wg.Add(2)
+			go func(i int) {
+				defer wg.Done()
+				h.Store(&config{Port: i})
+			}(i)
+			go func() {
+				defer wg.Done()
+				require.NotNil(t, h.Load())
+			}()
+		}
+		wg.Wait()
+	})
+}
@@ -0,0 +1,71 @@
+package readconf
+
+import (
+	"context"
+	"fmt"
+	"hash"
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+)
+
+const _includeDirective = `@include `
+
+// key of the context value of the hash.Hash that included files are written
+// to, so that the version of the including file changes with them
+type includeHashKey struct{}
+
+// Parses the KEY=value lines of a file, resolving its include directives.
+type includeSource struct {
+	data     []byte
+	filename string
+}
+
+func (s includeSource) Load(ctx context.Context) (Map, error) {
+	m, err := parseIncludes(ctx, s.data, s.filename, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	return m.Map(), nil
+}
+
+func (s includeSource) String() string {
+	return `data`
+}
+
+// Parses data of filename, which is included by the files of stack.
+func parseIncludes(ctx context.Context, data []byte, filename string, stack []string) (*OrderedMap, error) {
+	abs, err := filepath.Abs(filename)
+	if err != nil {
+		return nil, err
+	}
+
+	for i, other := range stack {
+		if other == abs {
+			cycle := append(append([]string{}, stack[i:]...), abs)
+			return nil, fmt.Errorf(`include cycle: %s`, strings.Join(cycle, ` -> `))
+		}
+	}
+
+	stack = append(stack[:len(stack):len(stack)], abs)
+
+	return parseData(data, func(path string) (*OrderedMap, error) {
+		if !filepath.IsAbs(path) {
+			path = filepath.Join(filepath.Dir(abs), path)
+		}
+
+		recordFile(ctx, path)
+
+		data, err := ioutil.ReadFile(path)
+		if err != nil {
+			return nil, err
+		}
+
+		if h, ok := ctx.Value(includeHashKey{}).(hash.Hash); ok {
+			h.Write(data)
+		}
+
+		return parseIncludes(ctx, data, path, stack)
+	})
+}
@@ -0,0 +1,107 @@
+package readconf
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// MergeINI merges the values of an INI document. Keys of a section are joined
+// to its name by the key strategy of the builder, e.g. host in [database]
+// sets DATABASE__HOST by default, and dots in section names separate nested prefixes,
+// e.g. [database.pool]. Keys before the first section have no prefix.
+//
+// Keys and values are separated by = or :, and lines starting with ; or #
+// are comments. Values enclosed in double or single quotes are unquoted,
+// without interpreting escape sequences.
+func (b *Builder) MergeINI(data []byte) *Builder {
+	return b.MergeSource(INISource(data))
+}
+
+// MergeINIReader merges the values read from r, like MergeINI.
+func (b *Builder) MergeINIReader(r io.Reader) *Builder {
+	return b.MergeSource(ReaderSource(r, INISource))
+}
+
+// MergeINIFile merges the values of an INI file, like MergeINI.
+func (b *Builder) MergeINIFile(filename string) *Builder {
+	return b.MergeSource(INIFileSource(filename))
+}
+
+// INISource returns a Source parsing the INI document in data, like MergeINI.
+func INISource(data []byte) Source {
+	return iniSource(data)
+}
+
+type iniSource []byte
+
+func (s iniSource) Load(ctx context.Context) (Map, error) {
+	return parseINI(s, ContextKeyStrategy(ctx))
+}
+
+func (s iniSource) String() string {
+	return `ini`
+}
+
+// INIFileSource returns a Source reading an INI file, like MergeINIFile.
+func INIFileSource(filename string) Source {
+	return fileSource{filename: filename, format: `ini`, parse: INISource}
+}
+
+func parseINI(data []byte, keys KeyStrategy) (Map, error) {
+	m := Map{}
+	section := []string{}
+
+	err := eachLine(data, func(i int, line []byte) error {
+		line = bytes.TrimSpace(line)
+
+		switch {
+		case len(line) == 0, line[0] == ';', line[0] == '#':
+			return nil
+		case line[0] == '[':
+			end := bytes.IndexByte(line, ']')
+			if end < 0 {
+				return fmt.Errorf(`invalid section on line %d`, i+1)
+			}
+
+			section = section[:0]
+			for _, name := range strings.Split(string(line[1:end]), `.`) {
+				if name = strings.TrimSpace(name); name == `` {
+					return fmt.Errorf(`invalid section on line %d`, i+1)
+				}
+
+				section = append(section, name)
+			}
+
+			return nil
+		}
+
+		key, value := line, []byte{}
+		if sep := bytes.IndexAny(line, `=:`); sep >= 0 {
+			key, value = line[:sep], line[sep+1:]
+		}
+
+		key = bytes.TrimSpace(key)
+		if len(key) == 0 {
+			return fmt.Errorf(`invalid empty key on line %d`, i+1)
+		}
+
+		m.Set(keys.Join(copyAppend(section, string(key))...), unquoteINI(string(bytes.TrimSpace(value))))
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return m, nil
+}
+
+func unquoteINI(s string) string {
+	if len(s) >= 2 && (s[0] == '"' || s[0] == '\'') && s[len(s)-1] == s[0] {
+		return s[1 : len(s)-1]
+	}
+
+	return s
+}
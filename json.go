@@ -0,0 +1,151 @@
+package readconf
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// MergeJSON merges the values of a JSON object. Keys of nested objects are
+// joined by the key strategy of the builder, e.g. {"database": {"host": "x"}}
+// sets DATABASE__HOST by default, and arrays are kept as JSON, which slice fields unmarshal.
+// Numbers keep their literal form and booleans become true or false.
+func (b *Builder) MergeJSON(data []byte) *Builder {
+	return b.MergeSource(JSONSource(data))
+}
+
+// MergeJSONReader merges the values read from r, like MergeJSON.
+func (b *Builder) MergeJSONReader(r io.Reader) *Builder {
+	return b.MergeSource(ReaderSource(r, JSONSource))
+}
+
+// MergeJSONFile merges the values of a JSON file, like MergeJSON.
+func (b *Builder) MergeJSONFile(filename string) *Builder {
+	return b.MergeSource(JSONFileSource(filename))
+}
+
+// JSONSource returns a Source flattening the JSON object in data, like
+// MergeJSON.
+func JSONSource(data []byte) Source {
+	return jsonSource(data)
+}
+
+type jsonSource []byte
+
+func (s jsonSource) Load(ctx context.Context) (Map, error) {
+	m := Map{}
+	if err := flattenJSON(``, s, m, ContextKeyStrategy(ctx)); err != nil {
+		return nil, err
+	}
+
+	return m, nil
+}
+
+func (s jsonSource) String() string {
+	return `json`
+}
+
+// JSONFileSource returns a Source reading a JSON file, like MergeJSONFile.
+func JSONFileSource(filename string) Source {
+	return fileSource{filename: filename, format: `json`, parse: JSONSource}
+}
+
+func isJSONObject(s string) bool {
+	return strings.HasPrefix(strings.TrimSpace(s), `{`)
+}
+
+// Flattens the JSON object in data into m. Nested objects are joined with the
+// key separator, arrays are kept as JSON and scalars are stringified.
+func flattenJSON(prefix string, data []byte, m Map, keys KeyStrategy) error {
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.UseNumber()
+
+	var obj map[string]interface{}
+	if err := dec.Decode(&obj); err != nil {
+		return wrapError(err, "invalid JSON")
+	}
+
+	return flattenValue(prefix, obj, m, keys)
+}
+
+func flattenValue(key string, v interface{}, m Map, keys KeyStrategy) error {
+	switch v := v.(type) {
+	case map[string]interface{}:
+		for k, v := range v {
+			if key != "" {
+				k = keys.Join(key, k)
+			}
+
+			if err := flattenValue(k, v, m, keys); err != nil {
+				return err
+			}
+		}
+	case []interface{}:
+		data, err := json.Marshal(v)
+		if err != nil {
+			return err
+		}
+
+		m.Set(key, string(data))
+	case nil:
+		m.Set(key, ``)
+	case string:
+		m.Set(key, v)
+	case json.Number, bool:
+		m.Set(key, fmt.Sprint(v))
+	default:
+		return fmt.Errorf("unexpected JSON value of type %T", v)
+	}
+
+	return nil
+}
+
+// Splits a list value, given either as a JSON array or separated by commas.
+// Items of a JSON array that aren't strings are kept as JSON.
+func splitList(s string) ([]string, error) {
+	s = strings.TrimSpace(s)
+
+	switch {
+	case s == ``:
+		return []string{}, nil
+	case !strings.HasPrefix(s, `[`):
+		items := strings.Split(s, `,`)
+		for i := range items {
+			items[i] = strings.TrimSpace(items[i])
+		}
+
+		return items, nil
+	}
+
+	dec := json.NewDecoder(strings.NewReader(s))
+	dec.UseNumber()
+
+	var raw []interface{}
+	if err := dec.Decode(&raw); err != nil {
+		return nil, wrapError(err, "invalid JSON")
+	}
+
+	items := make([]string, len(raw))
+	for i, v := range raw {
+		switch v := v.(type) {
+		case string:
+			items[i] = v
+		case nil:
+			items[i] = ``
+		case json.Number, bool:
+			items[i] = fmt.Sprint(v)
+		default:
+			data, err := json.Marshal(v)
+			if err != nil {
+				return nil, err
+			}
+
+			items[i] = string(data)
+		}
+	}
+
+	return items, nil
+}
@@ -0,0 +1,117 @@
+package readconf
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// link to the current data of Kubernetes volumes, swapped atomically on
+// updates
+const _kubernetesDataLink = `..data`
+
+// attempts to read a directory consistently while it is being updated
+const _keyPerFileAttempts = 3
+
+// MergeKeyPerFile merges a directory with a file per key, such as Kubernetes
+// ConfigMap and Secret volumes, see KeyPerFileSource.
+func (b *Builder) MergeKeyPerFile(dir string) *Builder {
+	return b.MergeSource(KeyPerFileSource(dir))
+}
+
+// KeyPerFileSource returns a source of a directory with a file per key, whose
+// contents are the value, taken as is. File names are turned into keys like
+// flag names by FlagKey, so db.max-conns sets DB__MAX_CONNS. Hidden files and
+// directories are skipped, including the entries Kubernetes uses to update
+// volumes atomically. If a volume is updated while it is read, it is read
+// again.
+func KeyPerFileSource(dir string) Source {
+	return keyPerFileSource(dir)
+}
+
+type keyPerFileSource string
+
+func (s keyPerFileSource) Load(ctx context.Context) (Map, error) {
+	m, _, err := s.LoadVersion(ctx)
+	return m, err
+}
+
+// LoadVersion returns the directory the ..data link of Kubernetes volumes
+// points to as the version.
+func (s keyPerFileSource) LoadVersion(ctx context.Context) (Map, string, error) {
+	dir := string(s)
+
+	var err error
+	for i := 0; i < _keyPerFileAttempts; i++ {
+		before, _ := os.Readlink(filepath.Join(dir, _kubernetesDataLink))
+
+		var m Map
+		m, err = readKeyPerFile(ctx, dir)
+
+		after, _ := os.Readlink(filepath.Join(dir, _kubernetesDataLink))
+		if before != after {
+			err = fmt.Errorf("directory changed while reading")
+			continue
+		}
+
+		if err == nil {
+			return m, before, nil
+		}
+
+		// files may disappear when the link is swapped between reading the
+		// links before and after
+		if !isNotExist(err) {
+			break
+		}
+	}
+
+	return nil, ``, err
+}
+
+func (s keyPerFileSource) String() string {
+	return `directory ` + string(s)
+}
+
+func readKeyPerFile(ctx context.Context, dir string) (Map, error) {
+	// watched for files that are added or removed, and for the links of
+	// Kubernetes volumes, which are swapped on updates
+	recordFile(ctx, dir)
+
+	infos, err := ioutil.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+
+	m := make(Map, len(infos))
+	for _, info := range infos {
+		name := info.Name()
+		if strings.HasPrefix(name, `.`) {
+			continue
+		}
+
+		filename := filepath.Join(dir, name)
+
+		// follows the links of Kubernetes volumes
+		if info, err = os.Stat(filename); err != nil {
+			return nil, err
+		}
+
+		if info.IsDir() {
+			continue
+		}
+
+		recordFile(ctx, filename)
+
+		data, err := ioutil.ReadFile(filename)
+		if err != nil {
+			return nil, err
+		}
+
+		m.Set(FlagKey(name), string(data))
+	}
+
+	return m, nil
+}
@@ -0,0 +1,117 @@
+package readconf
+
+import (
+	"context"
+	"strings"
+)
+
+// KeyStrategy decides how configuration keys are derived from struct fields
+// and how keys given by sources are normalized. Keys are always compared
+// case-insensitively, a strategy decides everything else, such as word
+// separators and the separator between nested structs.
+type KeyStrategy interface {
+	// FieldKey returns the key of a struct field with the given name, without
+	// its parent structs. Names given by config tags are keys already.
+	FieldKey(name string) string
+	// Join returns the key of a nested field from the keys of its parents.
+	Join(keys ...string) string
+	// Normalize returns the normalized form of a key given by a source.
+	Normalize(key string) string
+}
+
+// DefaultKeyStrategy returns the default key strategy: field names are split
+// into upper case words joined by _, e.g. MaxConns becomes MAX_CONNS, and
+// nested fields are joined by __.
+func DefaultKeyStrategy() KeyStrategy {
+	return defaultKeyStrategy{}
+}
+
+type defaultKeyStrategy struct{}
+
+func (defaultKeyStrategy) FieldKey(name string) string {
+	return transformStructKey(name)
+}
+
+func (defaultKeyStrategy) Join(keys ...string) string {
+	return strings.Join(keys, _separator)
+}
+
+func (defaultKeyStrategy) Normalize(key string) string {
+	return normalizeKey(key)
+}
+
+// WithKeyStrategy sets the strategy used to derive configuration keys from the
+// fields of the target and to normalize the keys of merged values. Sources of
+// nested values, such as JSON, join their keys with the strategy of the
+// builder merging them, so it must be set before they are merged.
+func (b *Builder) WithKeyStrategy(s KeyStrategy) *Builder {
+	if b.hasError() {
+		return b
+	}
+
+	b.keys = s
+	return b
+}
+
+func (b *Builder) keyStrategy() KeyStrategy {
+	if b.keys == nil {
+		return defaultKeyStrategy{}
+	}
+
+	return b.keys
+}
+
+// key of the context value of the key strategy of the builder loading a source
+type keyStrategyKey struct{}
+
+// ContextKeyStrategy returns the key strategy of the builder loading a source
+// with ctx, or the default one, for sources joining the keys of nested values,
+// e.g. of JSON objects.
+func ContextKeyStrategy(ctx context.Context) KeyStrategy {
+	if keys, ok := ctx.Value(keyStrategyKey{}).(KeyStrategy); ok {
+		return keys
+	}
+
+	return defaultKeyStrategy{}
+}
+
+// StructKey returns the configuration key of the field at path, a list of
+// struct field names, with the default key strategy, e.g. DB__MAX_CONNS for
+// DB, MaxConns. The same key is used in files, prefixed in the environment,
+// see EnvName, and as a flag, see FlagName. Names returns the keys of fields
+// named by config tags too.
+func StructKey(path ...string) string {
+	return structKey(defaultKeyStrategy{}, path)
+}
+
+// EnvName returns the environment variable of key merged by MergeEnviron
+// with prefix.
+func EnvName(prefix, key string) string {
+	return prefix + normalizeKey(key)
+}
+
+// KeyNames holds the names of a configuration key in each kind of source.
+type KeyNames struct {
+	// Key is the key in files and maps.
+	Key string
+	// Env is the environment variable, see EnvName.
+	Env string
+	// Flag is the command line flag, see FlagName.
+	Flag string
+}
+
+// Names returns the names of the configuration keys of target, sorted by key,
+// e.g. to document them or for tools that generate configuration.
+func Names(target interface{}, envPrefix string) ([]KeyNames, error) {
+	docs, err := Describe(target)
+	if err != nil {
+		return nil, err
+	}
+
+	names := make([]KeyNames, len(docs))
+	for i, doc := range docs {
+		names[i] = KeyNames{Key: doc.Key, Env: EnvName(envPrefix, doc.Key), Flag: FlagName(doc.Key)}
+	}
+
+	return names, nil
+}
@@ -0,0 +1,131 @@
+package readconf
+
+import (
+	"fmt"
+	"net/url"
+	"os"
+	"reflect"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// DecodeFunc decodes a configuration value. It returns a value of the
+// registered type, or a pointer to one.
+type DecodeFunc func(s string) (interface{}, error)
+
+var (
+	_leavesMu sync.RWMutex
+	_leaves   = map[reflect.Type]DecodeFunc{}
+
+	// encoders for leaves that don't format themselves as they are decoded
+	_leafEncoders = map[reflect.Type]func(v interface{}) string{
+		reflect.TypeOf(os.FileMode(0)): func(v interface{}) string {
+			return formatFileMode(v.(os.FileMode))
+		},
+		reflect.TypeOf(Secret{}): func(v interface{}) string {
+			value, _ := v.(Secret).Reveal()
+			return value
+		},
+	}
+)
+
+func init() {
+	RegisterLeaf(url.URL{}, func(s string) (interface{}, error) {
+		return url.Parse(s)
+	})
+
+	RegisterLeaf(time.Duration(0), func(s string) (interface{}, error) {
+		return time.ParseDuration(s)
+	})
+
+	RegisterLeaf(os.FileMode(0), func(s string) (interface{}, error) {
+		return parseFileMode(s)
+	})
+
+	RegisterLeaf(Secret{}, func(s string) (interface{}, error) {
+		return NewSecret([]byte(s))
+	})
+}
+
+// unix mode bits that os.FileMode represents differently
+var _fileModeBits = []struct {
+	unix uint64
+	mode os.FileMode
+}{
+	{04000, os.ModeSetuid},
+	{02000, os.ModeSetgid},
+	{01000, os.ModeSticky},
+}
+
+// Parses a file mode given in octal, like chmod takes it, e.g. 0640 or 640.
+func parseFileMode(s string) (os.FileMode, error) {
+	digits := strings.TrimPrefix(strings.TrimPrefix(s, `0o`), `0O`)
+
+	u, err := strconv.ParseUint(digits, 8, 32)
+	if err != nil || u > 07777 {
+		return 0, fmt.Errorf("invalid file mode %s", s)
+	}
+
+	mode := os.FileMode(u) & os.ModePerm
+	for _, bit := range _fileModeBits {
+		if u&bit.unix != 0 {
+			mode |= bit.mode
+		}
+	}
+
+	return mode, nil
+}
+
+func formatFileMode(mode os.FileMode) string {
+	u := uint64(mode & os.ModePerm)
+	for _, bit := range _fileModeBits {
+		if mode&bit.mode != 0 {
+			u |= bit.unix
+		}
+	}
+
+	return fmt.Sprintf("%04o", u)
+}
+
+// RegisterLeaf registers the type of v as a leaf. Fields of a leaf type are
+// decoded from a single value with decode, even when the type is a struct.
+//
+// Types implementing Unmarshaler or encoding.TextUnmarshaler, such as
+// time.Time, are leaves without registration.
+func RegisterLeaf(v interface{}, decode DecodeFunc) {
+	_leavesMu.Lock()
+	defer _leavesMu.Unlock()
+
+	_leaves[reflect.TypeOf(v)] = decode
+}
+
+func lookupLeaf(t reflect.Type) (DecodeFunc, bool) {
+	_leavesMu.RLock()
+	defer _leavesMu.RUnlock()
+
+	decode, ok := _leaves[t]
+	return decode, ok
+}
+
+func decodeLeaf(decode DecodeFunc, value string, vv reflect.Value) error {
+	x, err := decode(value)
+	if err != nil {
+		return err
+	}
+
+	xv := reflect.ValueOf(x)
+	switch {
+	case xv.Type() == vv.Type():
+		vv.Set(xv)
+	case xv.Kind() == reflect.Ptr && xv.Type().Elem() == vv.Type():
+		vv.Set(xv.Elem())
+	case vv.Kind() == reflect.Interface && xv.Type().Implements(vv.Type()):
+		vv.Set(xv)
+	default:
+		return fmt.Errorf("decoder for %s returned %s", vv.Type(), xv.Type())
+	}
+
+	return nil
+}
@@ -0,0 +1,245 @@
+package readconf
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"sort"
+	"time"
+)
+
+const _lockfileVersion = 1
+
+// Lockfile captures the resolved values of a configuration and the versions
+// of the sources they came from, so that the configuration can be reproduced
+// later with MergeLockfile, e.g. to debug an incident. Lockfiles hold values
+// in the clear, including secrets.
+type Lockfile struct {
+	Version int       `json:"version"`
+	Created time.Time `json:"created"`
+	// Values holds the resolved values of all keys.
+	Values  Map            `json:"values"`
+	Sources []LockedSource `json:"sources"`
+}
+
+// LockedSource is a source merged into a locked configuration.
+type LockedSource struct {
+	Name string `json:"name"`
+	// Version is set for sources implementing VersionedSource and for
+	// providers returning versions.
+	Version string `json:"version,omitempty"`
+}
+
+// Lock builds the configuration like DryRun, and returns a Lockfile of it.
+// Values stored in files by LargeValues are locked with their contents.
+func (b *Builder) Lock(target interface{}) (*Lockfile, error) {
+	report, err := b.DryRun(target)
+	if err != nil {
+		return nil, err
+	}
+
+	lock := &Lockfile{
+		Version: _lockfileVersion,
+		Created: time.Now().UTC(),
+		Values:  make(Map, len(report.Values)),
+		Sources: make([]LockedSource, 0, len(b.sources)),
+	}
+
+	for key, value := range report.Values {
+		// values stored by LargeValues are locked with their contents, as
+		// their files may be gone when the lockfile is merged
+		if filename, ok := externalFile(b.largeFiles, key, value); ok {
+			data, err := ioutil.ReadFile(filename)
+			if err != nil {
+				return nil, wrapError(err, "configuration key \"%s\"", key)
+			}
+
+			value = string(data)
+		}
+
+		lock.Values[key] = value
+	}
+
+	for _, source := range b.sources {
+		lock.Sources = append(lock.Sources, LockedSource{Name: source.name, Version: source.version})
+	}
+
+	return lock, nil
+}
+
+// WriteFile writes the lockfile as JSON to filename, readable only by its
+// owner.
+func (l *Lockfile) WriteFile(filename string) error {
+	data, err := json.MarshalIndent(l, ``, `  `)
+	if err != nil {
+		return err
+	}
+
+	return ioutil.WriteFile(filename, append(data, '\n'), 0600)
+}
+
+// ReadLockfile reads a lockfile written by Lockfile.WriteFile.
+func ReadLockfile(filename string) (*Lockfile, error) {
+	data, err := ioutil.ReadFile(filename)
+	if err != nil {
+		return nil, err
+	}
+
+	var lock Lockfile
+	if err := json.Unmarshal(data, &lock); err != nil {
+		return nil, wrapError(err, "invalid lockfile")
+	}
+
+	if lock.Version != _lockfileVersion {
+		return nil, fmt.Errorf("unsupported lockfile version %d", lock.Version)
+	}
+
+	return &lock, nil
+}
+
+// MergeLockfile merges the values of a lockfile written by Lockfile.WriteFile.
+func (b *Builder) MergeLockfile(filename string) *Builder {
+	return b.MergeSource(LockfileSource(filename))
+}
+
+// LockfileSource returns a Source reading a lockfile, like MergeLockfile.
+func LockfileSource(filename string) Source {
+	return lockfileSource(filename)
+}
+
+type lockfileSource string
+
+func (s lockfileSource) Load(ctx context.Context) (Map, error) {
+	lock, err := ReadLockfile(string(s))
+	if err != nil {
+		return nil, err
+	}
+
+	return lock.Values, nil
+}
+
+func (s lockfileSource) String() string {
+	return `lockfile ` + string(s)
+}
+
+// Drift lists the differences between a lockfile and the live configuration.
+type Drift struct {
+	// Values lists the keys whose values differ, sorted.
+	Values []ValueDrift
+	// Sources lists the sources whose versions differ, or that were merged in
+	// only one of the configurations, in the order of the lockfile.
+	Sources []SourceDrift
+}
+
+// ValueDrift is a key whose value differs. Values hold secrets in the clear.
+type ValueDrift struct {
+	Key    string
+	Locked string
+	Live   string
+	// InLock and InLive tell whether the key has a value in the lockfile and
+	// in the live configuration.
+	InLock, InLive bool
+}
+
+// SourceDrift is a source whose version differs. Empty versions mean that
+// the source wasn't merged, or has no version.
+type SourceDrift struct {
+	Name           string
+	Locked, Live   string
+	InLock, InLive bool
+}
+
+// IsZero returns true if nothing drifted.
+func (d *Drift) IsZero() bool {
+	return len(d.Values) == 0 && len(d.Sources) == 0
+}
+
+// Replay builds target from the lockfile at filename, with the key strategy
+// and validator of the builder, and returns how the configuration the builder
+// builds from its live sources drifted since the lockfile was written.
+func (b *Builder) Replay(filename string, target interface{}) (*Drift, error) {
+	if err := b.Error(); err != nil {
+		return nil, err
+	}
+
+	lock, err := ReadLockfile(filename)
+	if err != nil {
+		return nil, err
+	}
+
+	replay := NewBuilder().MergeMap(lock.Values)
+	replay.keys = b.keys
+	replay.validate = b.validate
+
+	if err := replay.Build(target); err != nil {
+		return nil, wrapError(err, "replay")
+	}
+
+	live, err := b.Lock(target)
+	if err != nil {
+		return nil, wrapError(err, "live")
+	}
+
+	return lock.Drift(live), nil
+}
+
+// Drift returns how other drifted from l.
+func (l *Lockfile) Drift(other *Lockfile) *Drift {
+	d := &Drift{Values: []ValueDrift{}, Sources: []SourceDrift{}}
+
+	keys := make(map[string]struct{}, len(l.Values))
+	for key := range l.Values {
+		keys[key] = struct{}{}
+	}
+	for key := range other.Values {
+		keys[key] = struct{}{}
+	}
+
+	for key := range keys {
+		locked, inLock := l.Values[key]
+		live, inLive := other.Values[key]
+
+		if inLock != inLive || locked != live {
+			d.Values = append(d.Values, ValueDrift{
+				Key:    key,
+				Locked: locked,
+				Live:   live,
+				InLock: inLock,
+				InLive: inLive,
+			})
+		}
+	}
+
+	sort.Slice(d.Values, func(i, j int) bool {
+		return d.Values[i].Key < d.Values[j].Key
+	})
+
+	liveSources := make(map[string]string, len(other.Sources))
+	for _, s := range other.Sources {
+		liveSources[s.Name] = s.Version
+	}
+
+	for _, s := range l.Sources {
+		version, ok := liveSources[s.Name]
+		delete(liveSources, s.Name)
+
+		if !ok || version != s.Version {
+			d.Sources = append(d.Sources, SourceDrift{
+				Name:   s.Name,
+				Locked: s.Version,
+				Live:   version,
+				InLock: true,
+				InLive: ok,
+			})
+		}
+	}
+
+	for _, s := range other.Sources {
+		if _, ok := liveSources[s.Name]; ok {
+			d.Sources = append(d.Sources, SourceDrift{Name: s.Name, Live: s.Version, InLive: true})
+		}
+	}
+
+	return d
+}
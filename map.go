@@ -2,9 +2,11 @@ package readconf
 
 import (
 	"encoding"
+	"encoding/json"
 	"fmt"
 	"reflect"
 	"strconv"
+	"strings"
 )
 
 type Map map[string]string
@@ -25,54 +27,229 @@ func (m Map) Set(key, value string) {
 	m[key] = value
 }
 
-func (m Map) Unmarshal(key string, v interface{}) (err error) {
-	defer func() {
-		err = wrapError(err, "configuration key \"%s\"", key)
-	}()
-
+func (m Map) Unmarshal(key string, v interface{}) error {
 	vt := reflect.TypeOf(v)
 	if vt.Kind() != reflect.Ptr {
-		return fmt.Errorf("expected pointer to value")
+		return wrapError(fmt.Errorf("expected pointer to value"), "configuration key \"%s\"", key)
 	}
 
-	vv, vt := reflect.ValueOf(v).Elem(), vt.Elem()
+	return wrapError(m.unmarshalKey(key, v, nil), "configuration key \"%s\"", key)
+}
 
+// Like Unmarshal, but errors are not wrapped with the key and v must be a
+// pointer. Values of keys in files, as stored by LargeValues, are read from
+// their files.
+func (m Map) unmarshalKey(key string, v interface{}, files map[string]string) error {
 	value, ok := m.Lookup(key)
 	if !ok {
 		return fmt.Errorf("not found")
 	}
 
+	if filename, ok := externalFile(files, key, value); ok {
+		return unmarshalFile(filename, reflect.ValueOf(v).Elem())
+	}
+
+	return unmarshalValue(value, reflect.ValueOf(v).Elem())
+}
+
+func unmarshalValue(value string, vv reflect.Value) error {
+	vt := vv.Type()
+
+	if vt.Kind() == reflect.Ptr && vv.IsNil() {
+		vv.Set(reflect.New(vt.Elem()))
+	}
+
+	if decode, ok := lookupLeaf(vt); ok {
+		return decodeLeaf(decode, value, vv)
+	}
+
+	if vt == _namedFilesType {
+		value = strings.TrimPrefix(value, _namedFilesPrefix)
+	}
+
 	switch {
 	case vt.Implements(_unmarshalerType):
 		return vv.Interface().(Unmarshaler).UnmarshalConfig(value)
 	case vt.Implements(_textUnmarshalerType):
 		return vv.Interface().(encoding.TextUnmarshaler).UnmarshalText([]byte(value))
-	default:
-		switch vt.Kind() {
-		case reflect.String:
-			vv.SetString(value)
+	case vv.CanAddr() && reflect.PtrTo(vt).Implements(_unmarshalerType):
+		return vv.Addr().Interface().(Unmarshaler).UnmarshalConfig(value)
+	case vv.CanAddr() && reflect.PtrTo(vt).Implements(_textUnmarshalerType):
+		return vv.Addr().Interface().(encoding.TextUnmarshaler).UnmarshalText([]byte(value))
+	}
+
+	switch vt.Kind() {
+	case reflect.String:
+		vv.SetString(value)
+		return nil
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		iv, err := parseInt(value, vt.Bits())
+		if err != nil {
+			return err
+		}
+
+		vv.SetInt(iv)
+		return nil
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		uv, err := parseUint(value, vt.Bits())
+		if err != nil {
+			return err
+		}
+
+		vv.SetUint(uv)
+		return nil
+	case reflect.Float32, reflect.Float64:
+		fv, err := strconv.ParseFloat(value, vt.Bits())
+		if err != nil {
+			return err
+		}
+
+		vv.SetFloat(fv)
+		return nil
+	case reflect.Bool:
+		bv, err := strconv.ParseBool(value)
+		if err != nil {
+			return err
+		}
+
+		vv.SetBool(bv)
+		return nil
+	case reflect.Slice:
+		if vt.Elem().Kind() == reflect.Uint8 {
+			vv.SetBytes([]byte(value))
 			return nil
-		case reflect.Int, reflect.Int64:
-			var iv int64
-			iv, err = strconv.ParseInt(value, 10, 64)
-			if err != nil {
-				return err
+		}
+
+		items, err := splitList(value)
+		if err != nil {
+			return err
+		}
+
+		sv := reflect.MakeSlice(vt, len(items), len(items))
+		for i, item := range items {
+			if err := unmarshalValue(item, sv.Index(i)); err != nil {
+				return wrapError(err, "item %d", i)
 			}
+		}
 
-			vv.SetInt(iv)
-			return nil
-		case reflect.Bool:
-			var bv bool
-			bv, err = strconv.ParseBool(value)
+		vv.Set(sv)
+		return nil
+	case reflect.Ptr:
+		return unmarshalValue(value, vv.Elem())
+	case reflect.Interface:
+		if vt.NumMethod() > 0 {
+			return fmt.Errorf("unsupported type %s", vt)
+		}
+
+		vv.Set(reflect.ValueOf(value))
+		return nil
+	default:
+		return fmt.Errorf("unsupported type %s", vt)
+	}
+}
+
+// Marshal returns the configuration values of the struct pointed to by v,
+// keyed like Build would read them. io.Reader fields are marshaled as their
+// contents, if they can be read without consuming them, and fields of types
+// that can't be marshaled as text return an error.
+func Marshal(v interface{}) (Map, error) {
+	return marshal(v, defaultKeyStrategy{})
+}
+
+// Marshal is like the Marshal function, but derives the keys with the key
+// strategy of b.
+func (b *Builder) Marshal(v interface{}) (Map, error) {
+	return marshal(v, b.keyStrategy())
+}
+
+func marshal(v interface{}, keys KeyStrategy) (Map, error) {
+	if err := validateIsPointerToStruct(v); err != nil {
+		return nil, err
+	}
+
+	fields, err := configFields(v, false, keys)
+	if err != nil {
+		return nil, err
+	}
+
+	m := make(Map, len(fields))
+	for key, field := range fields {
+		if field.value.Kind() == reflect.Ptr && field.value.IsNil() {
+			continue
+		}
+
+		// false presence fields are absent, any value would make them true
+		if field.presence() && !field.value.Bool() {
+			continue
+		}
+
+		value, err := marshalValue(field.value)
+		if err != nil {
+			return nil, wrapError(err, "configuration key \"%s\"", key)
+		}
+
+		m[key] = value
+	}
+
+	return m, nil
+}
+
+func marshalValue(v reflect.Value) (string, error) {
+	for v.Kind() == reflect.Ptr {
+		v = v.Elem()
+	}
+
+	if v.Type() == _readerType {
+		return marshalReader(v)
+	}
+
+	if encode, ok := _leafEncoders[v.Type()]; ok {
+		return encode(v.Interface()), nil
+	}
+
+	x := v.Interface()
+	if v.CanAddr() {
+		x = v.Addr().Interface()
+	}
+
+	switch x := x.(type) {
+	case encoding.TextMarshaler:
+		text, err := x.MarshalText()
+		return string(text), err
+	case fmt.Stringer:
+		return x.String(), nil
+	}
+
+	switch v.Kind() {
+	case reflect.String:
+		return v.String(), nil
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return strconv.FormatInt(v.Int(), 10), nil
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		return strconv.FormatUint(v.Uint(), 10), nil
+	case reflect.Float32, reflect.Float64:
+		return strconv.FormatFloat(v.Float(), 'g', -1, v.Type().Bits()), nil
+	case reflect.Bool:
+		return strconv.FormatBool(v.Bool()), nil
+	case reflect.Slice:
+		if v.Type().Elem().Kind() == reflect.Uint8 {
+			return string(v.Bytes()), nil
+		}
+
+		items := make([]string, v.Len())
+		for i := range items {
+			item, err := marshalValue(v.Index(i))
 			if err != nil {
-				return err
+				return ``, err
 			}
 
-			vv.SetBool(bv)
-			return nil
-		default:
-			panic(fmt.Sprintf("reflection of kind %d not implemented", vt.Kind()))
+			items[i] = item
 		}
+
+		data, err := json.Marshal(items)
+		return string(data), err
+	default:
+		return ``, fmt.Errorf("unsupported type %s", v.Type())
 	}
 }
 
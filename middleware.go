@@ -0,0 +1,73 @@
+//go:build go1.21
+// +build go1.21
+
+package readconf
+
+import (
+	"net/http"
+	"reflect"
+	"strings"
+	"sync"
+)
+
+// OverrideMiddleware makes the configuration available to next with
+// FromContext. If verify finds overrides in a request, next sees the current
+// configuration derived with them by DeriveWith and b, the builder it is built
+// with, instead, e.g. to A/B test behaviour. The values of the current
+// configuration are marshaled once, when it changes, and not for every
+// request. T may be a struct or a pointer to one. Requests overriding keys
+// that aren't allowed or with overrides that fail to verify are rejected with
+// 403, those with invalid values with 400.
+func OverrideMiddleware[T any](b *Builder, current func() T, allowed []string, verify OverrideVerifier, next http.Handler) http.Handler {
+	// the builder deriving copies of parent, the last configuration overridden
+	var mu sync.Mutex
+	var parent T
+	var base *Builder
+
+	baseOf := func(conf T) (*Builder, error) {
+		mu.Lock()
+		defer mu.Unlock()
+
+		if base != nil && reflect.DeepEqual(parent, conf) {
+			return base, nil
+		}
+
+		derive, err := deriveBuilder(b, conf)
+		if err != nil {
+			return nil, err
+		}
+
+		parent, base = conf, derive
+		return base, nil
+	}
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		conf := current()
+
+		overrides, err := verify(r)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusForbidden)
+			return
+		}
+
+		if len(overrides) > 0 {
+			if keys := disallowedKeys(overrides, allowed); len(keys) > 0 {
+				http.Error(w, "overrides not allowed: "+strings.Join(keys, `, `), http.StatusForbidden)
+				return
+			}
+
+			base, err := baseOf(conf)
+			if err != nil {
+				http.Error(w, err.Error(), http.StatusInternalServerError)
+				return
+			}
+
+			if conf, err = deriveFrom[T](base, overrides); err != nil {
+				http.Error(w, err.Error(), http.StatusBadRequest)
+				return
+			}
+		}
+
+		next.ServeHTTP(w, r.WithContext(NewContext(r.Context(), conf)))
+	})
+}
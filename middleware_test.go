@@ -0,0 +1,160 @@
+//go:build go1.21
+// +build go1.21
+
+package readconf_test
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/tetratom/readconf"
+)
+
+func TestOverrideMiddleware(t *testing.T) {
+	type config struct {
+		Variant string
+		Limit   int
+	}
+
+	key := []byte(`secret`)
+	builder := readconf.NewBuilder().WithValidator(readconf.ValidatorFunc(func(s interface{}) error {
+		if s.(*config).Variant == `c` {
+			return fmt.Errorf("variant c is retired")
+		}
+
+		return nil
+	}))
+
+	limit := 10
+	handler := readconf.OverrideMiddleware(
+		builder,
+		func() config { return config{Variant: `a`, Limit: limit} },
+		[]string{`variant`},
+		readconf.SignedHeader(`X-Config-Overrides`, key),
+		http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			conf, _ := readconf.FromContext[config](r.Context())
+			fmt.Fprintf(w, "%s %d", conf.Variant, conf.Limit)
+		}))
+
+	serve := func(header string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodGet, `/`, nil)
+		if header != `` {
+			req.Header.Set(`X-Config-Overrides`, header)
+		}
+
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, req)
+		return rec
+	}
+
+	sign := func(m readconf.Map) string {
+		value, err := readconf.SignOverrides(key, m, time.Minute)
+		require.NoError(t, err)
+		return value
+	}
+
+	t.Run("no overrides", func(t *testing.T) {
+		rec := serve(``)
+		require.Equal(t, http.StatusOK, rec.Code)
+		require.Equal(t, `a 10`, rec.Body.String())
+	})
+
+	t.Run("overrides", func(t *testing.T) {
+		rec := serve(sign(readconf.Map{`variant`: `b`}))
+		require.Equal(t, http.StatusOK, rec.Code)
+		require.Equal(t, `b 10`, rec.Body.String())
+	})
+
+	t.Run("invalid", func(t *testing.T) {
+		rec := serve(sign(readconf.Map{`variant`: `c`}))
+		require.Equal(t, http.StatusBadRequest, rec.Code)
+		require.Contains(t, rec.Body.String(), `variant c is retired`)
+	})
+
+	t.Run("not allowed", func(t *testing.T) {
+		rec := serve(sign(readconf.Map{`limit`: `1000`}))
+		require.Equal(t, http.StatusForbidden, rec.Code)
+		require.Contains(t, rec.Body.String(), `overrides not allowed: LIMIT`)
+	})
+
+	t.Run("bad signature", func(t *testing.T) {
+		value, err := readconf.SignOverrides([]byte(`other`), readconf.Map{`variant`: `b`}, time.Minute)
+		require.NoError(t, err)
+
+		rec := serve(value)
+		require.Equal(t, http.StatusForbidden, rec.Code)
+		require.Contains(t, rec.Body.String(), `invalid signature in header X-Config-Overrides`)
+	})
+
+	t.Run("expired", func(t *testing.T) {
+		value, err := readconf.SignOverrides(key, readconf.Map{`variant`: `b`}, -time.Second)
+		require.NoError(t, err)
+
+		rec := serve(value)
+		require.Equal(t, http.StatusForbidden, rec.Code)
+		require.Contains(t, rec.Body.String(), `expired header X-Config-Overrides`)
+	})
+
+	t.Run("reused", func(t *testing.T) {
+		value := sign(readconf.Map{`variant`: `b`})
+		require.Equal(t, http.StatusOK, serve(value).Code)
+
+		rec := serve(value)
+		require.Equal(t, http.StatusOK, rec.Code)
+		require.Equal(t, `b 10`, rec.Body.String())
+	})
+
+	t.Run("changed", func(t *testing.T) {
+		limit = 20
+		defer func() { limit = 10 }()
+
+		rec := serve(sign(readconf.Map{`variant`: `b`}))
+		require.Equal(t, http.StatusOK, rec.Code)
+		require.Equal(t, `b 20`, rec.Body.String())
+	})
+
+	t.Run("replayed", func(t *testing.T) {
+		// instances sharing a store
+		nonces := readconf.NewNonceStore()
+		first := readconf.SignedHeaderOnce(`X-Config-Overrides`, key, nonces)
+		second := readconf.SignedHeaderOnce(`X-Config-Overrides`, key, nonces)
+
+		req := httptest.NewRequest(http.MethodGet, `/`, nil)
+		req.Header.Set(`X-Config-Overrides`, sign(readconf.Map{`variant`: `b`}))
+
+		overrides, err := first(req)
+		require.NoError(t, err)
+		require.Equal(t, readconf.Map{`variant`: `b`}, overrides)
+
+		_, err = first(req)
+		require.EqualError(t, err, `reused header X-Config-Overrides`)
+
+		_, err = second(req)
+		require.EqualError(t, err, `reused header X-Config-Overrides`)
+	})
+
+	t.Run("pointer", func(t *testing.T) {
+		handler := readconf.OverrideMiddleware(
+			builder,
+			func() *config { return &config{Variant: `a`, Limit: 10} },
+			[]string{`variant`},
+			readconf.SignedHeader(`X-Config-Overrides`, key),
+			http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				conf, _ := readconf.FromContext[*config](r.Context())
+				fmt.Fprintf(w, "%s %d", conf.Variant, conf.Limit)
+			}))
+
+		req := httptest.NewRequest(http.MethodGet, `/`, nil)
+		req.Header.Set(`X-Config-Overrides`, sign(readconf.Map{`variant`: `b`}))
+
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, req)
+		require.Equal(t, http.StatusOK, rec.Code)
+		require.Equal(t, `b 10`, rec.Body.String())
+	})
+}
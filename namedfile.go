@@ -0,0 +1,149 @@
+package readconf
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strings"
+)
+
+// marks the expanded values of []NamedFile fields, followed by a JSON list of
+// the files, so that they are told apart from lists of patterns
+const _namedFilesPrefix = "\x00readconf-files:"
+
+var _namedFilesType = reflect.TypeOf([]NamedFile(nil))
+
+func init() {
+	// marshaled as their paths, which unmarshal like the patterns they match
+	_leafEncoders[reflect.TypeOf(NamedFile{})] = func(v interface{}) string {
+		return v.(NamedFile).Path
+	}
+}
+
+// NamedFile is a file read into memory, e.g. a certificate of a bundle.
+//
+// The value of a []NamedFile field is a comma separated or JSON list of glob
+// patterns, e.g. /etc/app/certs/*.pem, that are expanded when values are
+// resolved. The expanded value lists the matching regular files in lexical
+// order with the hashes of their contents, so that changes to the files show
+// in the changes between reports.
+type NamedFile struct {
+	// Name is the base name of the file.
+	Name string
+	Path string
+	// Hash is the SHA-256 of Data, like sha256:HEX.
+	Hash string
+	Data []byte
+}
+
+type namedFileRef struct {
+	Path string `json:"path"`
+	Hash string `json:"hash"`
+}
+
+// UnmarshalConfig reads the file at a path, or of an expanded value.
+func (f *NamedFile) UnmarshalConfig(s string) error {
+	path := s
+	if strings.HasPrefix(s, `{`) {
+		var ref namedFileRef
+		if err := json.Unmarshal([]byte(s), &ref); err != nil {
+			return wrapError(err, "invalid JSON")
+		}
+
+		path = ref.Path
+	}
+
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return err
+	}
+
+	*f = NamedFile{
+		Name: filepath.Base(path),
+		Path: path,
+		Hash: fileHash(data),
+		Data: data,
+	}
+
+	return nil
+}
+
+func fileHash(data []byte) string {
+	sum := sha256.Sum256(data)
+	return `sha256:` + hex.EncodeToString(sum[:])
+}
+
+// Expands the patterns of []NamedFile fields into the files they match.
+func expandNamedFiles(values Map, fields map[string]configField) error {
+	for key, field := range fields {
+		if field.value.Type() != _namedFilesType {
+			continue
+		}
+
+		value, ok := values.Lookup(key)
+		if !ok || strings.HasPrefix(value, _namedFilesPrefix) {
+			continue
+		}
+
+		refs, err := globFiles(value)
+		if err != nil {
+			return wrapError(err, "configuration key \"%s\"", key)
+		}
+
+		data, err := json.Marshal(refs)
+		if err != nil {
+			return err
+		}
+
+		values.Set(key, _namedFilesPrefix+string(data))
+	}
+
+	return nil
+}
+
+func globFiles(patterns string) ([]namedFileRef, error) {
+	refs := []namedFileRef{}
+	seen := map[string]bool{}
+
+	items, err := splitList(patterns)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, pattern := range items {
+		if pattern == `` {
+			continue
+		}
+
+		paths, err := filepath.Glob(pattern)
+		if err != nil {
+			return nil, wrapError(err, "pattern %s", pattern)
+		}
+		sort.Strings(paths)
+
+		for _, path := range paths {
+			if seen[path] {
+				continue
+			}
+
+			if info, err := os.Stat(path); err != nil || !info.Mode().IsRegular() {
+				continue
+			}
+
+			data, err := ioutil.ReadFile(path)
+			if err != nil {
+				return nil, err
+			}
+
+			seen[path] = true
+			refs = append(refs, namedFileRef{Path: path, Hash: fileHash(data)})
+		}
+	}
+
+	return refs, nil
+}
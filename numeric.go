@@ -0,0 +1,296 @@
+package readconf
+
+import (
+	"fmt"
+	"math/big"
+	"reflect"
+	"strconv"
+	"strings"
+)
+
+// RangeError is returned when a number does not fit the size of its field.
+type RangeError struct {
+	Value    string
+	Bits     int
+	Unsigned bool
+}
+
+func (e *RangeError) Error() string {
+	kind := "integer"
+	if e.Unsigned {
+		kind = "unsigned integer"
+	}
+
+	return fmt.Sprintf("value %s out of range for %d-bit %s", e.Value, e.Bits, kind)
+}
+
+// Parses integers written in decimal, or in hexadecimal, octal or binary with
+// a 0x, 0o or 0b prefix. Digits may be separated by underscores. A leading
+// zero without a prefix does not make a number octal.
+func parseInt(s string, bits int) (int64, error) {
+	i, err := parseIntDigits(s, bits)
+	if isRangeError(err) {
+		return 0, &RangeError{Value: s, Bits: bits}
+	}
+
+	return i, err
+}
+
+func parseUint(s string, bits int) (uint64, error) {
+	u, err := parseUintDigits(s, bits)
+	if isRangeError(err) {
+		return 0, &RangeError{Value: s, Bits: bits, Unsigned: true}
+	}
+
+	return u, err
+}
+
+func isRangeError(err error) bool {
+	ne, ok := err.(*strconv.NumError)
+	return ok && ne.Err == strconv.ErrRange
+}
+
+// Splits the integer literal s into its sign and digits, and returns the base
+// given by its prefix.
+func splitIntLiteral(s string) (sign string, digits string, base int) {
+	if strings.HasPrefix(s, `-`) || strings.HasPrefix(s, `+`) {
+		sign, s = s[:1], s[1:]
+	}
+
+	base = 10
+	if len(s) > 2 && s[0] == '0' {
+		switch s[1] {
+		case 'x', 'X':
+			base = 16
+		case 'o', 'O':
+			base = 8
+		case 'b', 'B':
+			base = 2
+		}
+	}
+
+	if base != 10 {
+		// like in Go, an underscore may follow the prefix
+		s = strings.TrimPrefix(s[2:], `_`)
+	}
+
+	return sign, s, base
+}
+
+// Removes underscores separating digits, failing on misplaced ones.
+func removeUnderscores(s string) (string, bool) {
+	if !strings.Contains(s, `_`) {
+		return s, true
+	}
+
+	if strings.HasPrefix(s, `_`) || strings.HasSuffix(s, `_`) || strings.Contains(s, `__`) {
+		return s, false
+	}
+
+	return stringReplaceAll(s, `_`, ``), true
+}
+
+func parseIntDigits(s string, bits int) (int64, error) {
+	sign, digits, base := splitIntLiteral(s)
+
+	digits, ok := removeUnderscores(digits)
+	if !ok {
+		return 0, &strconv.NumError{Func: "ParseInt", Num: s, Err: strconv.ErrSyntax}
+	}
+
+	i, err := strconv.ParseInt(sign+digits, base, bits)
+	if ne, ok := err.(*strconv.NumError); ok {
+		ne.Num = s
+	}
+
+	return i, err
+}
+
+func parseUintDigits(s string, bits int) (uint64, error) {
+	sign, digits, base := splitIntLiteral(s)
+
+	digits, ok := removeUnderscores(digits)
+	if !ok || sign != `` {
+		return 0, &strconv.NumError{Func: "ParseUint", Num: s, Err: strconv.ErrSyntax}
+	}
+
+	u, err := strconv.ParseUint(digits, base, bits)
+	if ne, ok := err.(*strconv.NumError); ok {
+		ne.Num = s
+	}
+
+	return u, err
+}
+
+// Converts s to the unit of a unit tag. Values in percent may be given with or
+// without a percent sign, ratios may be given as a fraction or in percent.
+// The conversion is exact: the result is a decimal if possible, and for
+// non-float fields a fraction otherwise.
+func convertUnit(s string, unit string, float bool) (string, error) {
+	s = strings.TrimSpace(s)
+	percent := strings.HasSuffix(s, `%`)
+
+	digits := strings.TrimSpace(strings.TrimSuffix(s, `%`))
+
+	r, ok := new(big.Rat).SetString(digits)
+	if !ok {
+		return ``, fmt.Errorf("invalid number %s", s)
+	}
+
+	switch unit {
+	case `percent`:
+	case `ratio`:
+		if percent {
+			r.Quo(r, big.NewRat(100, 1))
+		}
+	default:
+		return ``, fmt.Errorf("unknown unit %q", unit)
+	}
+
+	if n, ok := decimalDigits(r); ok {
+		return r.FloatString(n), nil
+	}
+
+	if float {
+		f, _ := r.Float64()
+		return strconv.FormatFloat(f, 'g', -1, 64), nil
+	}
+
+	return r.RatString(), nil
+}
+
+// Returns the number of fractional digits needed to write r as a decimal, if
+// it has a finite decimal representation.
+func decimalDigits(r *big.Rat) (int, bool) {
+	d := new(big.Int).Set(r.Denom())
+	twos, fives := 0, 0
+
+	for m := new(big.Int); ; twos++ {
+		if q, _ := new(big.Int).QuoRem(d, big.NewInt(2), m); m.Sign() == 0 {
+			d = q
+		} else {
+			break
+		}
+	}
+
+	for m := new(big.Int); ; fives++ {
+		if q, _ := new(big.Int).QuoRem(d, big.NewInt(5), m); m.Sign() == 0 {
+			d = q
+		} else {
+			break
+		}
+	}
+
+	if d.Cmp(big.NewInt(1)) != 0 {
+		return 0, false
+	}
+
+	if twos > fives {
+		return twos, true
+	}
+
+	return fives, true
+}
+
+// Returns true for fields holding plain numbers.
+func isNumberType(t reflect.Type) bool {
+	for t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+
+	if _, ok := lookupLeaf(t); ok {
+		return false
+	}
+
+	switch {
+	case t.Implements(_unmarshalerType), reflect.PtrTo(t).Implements(_unmarshalerType):
+		return false
+	case t.Implements(_textUnmarshalerType), reflect.PtrTo(t).Implements(_textUnmarshalerType):
+		return false
+	}
+
+	switch t.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64,
+		reflect.Float32, reflect.Float64:
+		return true
+	default:
+		return false
+	}
+}
+
+func isFloatType(t reflect.Type) bool {
+	for t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+
+	return t.Kind() == reflect.Float32 || t.Kind() == reflect.Float64
+}
+
+// Rewrites a number written with locale specific separators, such as 1.234,5
+// or 1'234.5, to the form understood by strconv. When both a comma and a dot
+// appear, the last one is the decimal separator; otherwise a single comma or
+// dot is a decimal separator in floats and a thousands separator in integers.
+// Thousands separators must separate groups of three digits. Numbers that
+// don't follow these rules are returned as given.
+func normalizeLocaleNumber(s string, float bool) string {
+	given := s
+
+	s = strings.TrimSpace(s)
+	for _, sep := range []string{` `, "\u00a0", "\u202f", `'`} {
+		s = stringReplaceAll(s, sep, ``)
+	}
+
+	if _, _, base := splitIntLiteral(s); base != 10 {
+		return given
+	}
+
+	dots, commas := strings.Count(s, `.`), strings.Count(s, `,`)
+
+	decimal := ``
+	switch {
+	case dots > 0 && commas > 0:
+		decimal = `.`
+		if strings.LastIndex(s, `,`) > strings.LastIndex(s, `.`) {
+			decimal = `,`
+		}
+	case float && commas == 1:
+		decimal = `,`
+	case float && dots == 1:
+		decimal = `.`
+	}
+
+	whole, fraction := s, ``
+	if decimal != `` {
+		i := strings.LastIndex(s, decimal)
+		whole, fraction = s[:i], s[i+1:]
+
+		if strings.ContainsAny(fraction, `.,`) {
+			return given
+		}
+	}
+
+	if strings.ContainsAny(whole, `.,`) {
+		groups := strings.FieldsFunc(whole, func(r rune) bool {
+			return r == '.' || r == ','
+		})
+
+		if len(groups) != strings.Count(whole, `.`)+strings.Count(whole, `,`)+1 {
+			return given
+		}
+
+		for _, group := range groups[1:] {
+			if len(group) != 3 {
+				return given
+			}
+		}
+
+		whole = strings.Join(groups, ``)
+	}
+
+	if decimal == `` {
+		return whole
+	}
+
+	return whole + `.` + fraction
+}
@@ -0,0 +1,193 @@
+package readconf
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"sort"
+)
+
+// OrderedMap is a Map that remembers the order its keys were first set in,
+// e.g. to write values in the order of the file they were read from.
+type OrderedMap struct {
+	keys   []string
+	values Map
+}
+
+// NewOrderedMap returns an empty OrderedMap.
+func NewOrderedMap() *OrderedMap {
+	return &OrderedMap{values: Map{}}
+}
+
+func (m *OrderedMap) Lookup(key string) (string, bool) {
+	return m.values.Lookup(key)
+}
+
+func (m *OrderedMap) Get(key string) string {
+	return m.values.Get(key)
+}
+
+// Set sets the value of key. Keys that are already set keep their position.
+func (m *OrderedMap) Set(key, value string) {
+	if m.values == nil {
+		m.values = Map{}
+	}
+
+	if _, ok := m.values.Lookup(key); !ok {
+		m.keys = append(m.keys, normalizeKey(key))
+	}
+
+	m.values.Set(key, value)
+}
+
+// Delete removes key.
+func (m *OrderedMap) Delete(key string) {
+	key = normalizeKey(key)
+	if _, ok := m.values[key]; !ok {
+		return
+	}
+
+	delete(m.values, key)
+	for i := range m.keys {
+		if m.keys[i] == key {
+			m.keys = append(m.keys[:i], m.keys[i+1:]...)
+			break
+		}
+	}
+}
+
+// Keys returns the keys in order.
+func (m *OrderedMap) Keys() []string {
+	return append([]string{}, m.keys...)
+}
+
+// Len returns the number of keys.
+func (m *OrderedMap) Len() int {
+	return len(m.keys)
+}
+
+// Map returns the values as a Map.
+func (m *OrderedMap) Map() Map {
+	out := make(Map, len(m.values))
+	out.Merge(m.values)
+	return out
+}
+
+// WriteTo writes the values as KEY=value lines, in order.
+func (m *OrderedMap) WriteTo(w io.Writer) (int64, error) {
+	buf := getBuffer()
+	defer putBuffer(buf)
+
+	for _, key := range m.keys {
+		buf.WriteString(key)
+		buf.WriteByte('=')
+		buf.WriteString(m.values[key])
+		buf.WriteByte('\n')
+	}
+
+	return buf.WriteTo(w)
+}
+
+// ParseData parses a configuration file of KEY=value lines, as merged by
+// Builder.MergeData, keeping the order of its keys. Include directives are
+// only supported in files, see FileSource.
+func ParseData(data []byte) (*OrderedMap, error) {
+	return parseData(data, nil)
+}
+
+// Parses KEY=value lines, calling include for the path of each include
+// directive.
+func parseData(data []byte, include func(path string) (*OrderedMap, error)) (*OrderedMap, error) {
+	m := NewOrderedMap()
+
+	err := eachLine(data, func(i int, line []byte) error {
+		line = bytes.TrimSpace(line)
+
+		switch {
+		case len(line) == 0:
+			return nil
+		case line[0] == '#':
+			return nil
+		case bytes.HasPrefix(line, []byte(_includeDirective)):
+			path := string(bytes.TrimSpace(line[len(_includeDirective):]))
+			if path == `` {
+				return fmt.Errorf(`missing path of include on line %d`, i+1)
+			}
+
+			if include == nil {
+				return fmt.Errorf(`include %s on line %d: includes are only supported in files`, path, i+1)
+			}
+
+			included, err := include(path)
+			if err != nil {
+				// not wrapped, so that Optional doesn't skip a file whose
+				// include is missing
+				return fmt.Errorf("include %s on line %d: %s", path, i+1, err)
+			}
+
+			for _, key := range included.keys {
+				m.Set(key, included.values[key])
+			}
+
+			return nil
+		}
+
+		key, value := line, []byte{}
+		if eq := bytes.IndexByte(line, '='); eq >= 0 {
+			key, value = line[:eq], line[eq+1:]
+		}
+
+		key = bytes.TrimSpace(key)
+		if len(key) == 0 {
+			return fmt.Errorf(`invalid empty key on line %d`, i+1)
+		}
+
+		m.Set(string(key), string(bytes.TrimSpace(value)))
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return m, nil
+}
+
+// MarshalOrdered is like Marshal, but keeps the keys in the order of the
+// fields of v.
+func MarshalOrdered(v interface{}) (*OrderedMap, error) {
+	return marshalOrdered(v, defaultKeyStrategy{})
+}
+
+// MarshalOrdered is like the MarshalOrdered function, but derives the keys
+// with the key strategy of b.
+func (b *Builder) MarshalOrdered(v interface{}) (*OrderedMap, error) {
+	return marshalOrdered(v, b.keyStrategy())
+}
+
+func marshalOrdered(v interface{}, strategy KeyStrategy) (*OrderedMap, error) {
+	values, err := marshal(v, strategy)
+	if err != nil {
+		return nil, err
+	}
+
+	fields, err := configFields(v, false, strategy)
+	if err != nil {
+		return nil, err
+	}
+
+	keys := make([]string, 0, len(values))
+	for key := range values {
+		keys = append(keys, key)
+	}
+
+	sort.Slice(keys, func(i, j int) bool {
+		return fields[keys[i]].order < fields[keys[j]].order
+	})
+
+	m := NewOrderedMap()
+	for _, key := range keys {
+		m.Set(key, values[key])
+	}
+
+	return m, nil
+}
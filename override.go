@@ -0,0 +1,174 @@
+package readconf
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// OverrideVerifier returns the verified configuration overrides carried by a
+// request, or nil if it carries none. Overrides taken from a JWT claim can be
+// used by verifying the token with a JWT package in an OverrideVerifier.
+type OverrideVerifier func(r *http.Request) (Map, error)
+
+// signed overrides, encoded as JSON in headers
+type signedOverrides struct {
+	Overrides Map       `json:"overrides"`
+	Expires   time.Time `json:"expires"`
+	Nonce     string    `json:"nonce"`
+}
+
+// SignedHeader returns an OverrideVerifier that reads overrides from the
+// header name, signed with key by SignOverrides. Expired headers are
+// rejected. A header may be used until it expires, e.g. by all requests of a
+// cohort; use SignedHeaderOnce to reject replayed headers.
+func SignedHeader(name string, key []byte) OverrideVerifier {
+	return SignedHeaderOnce(name, key, nil)
+}
+
+// SignedHeaderOnce is like SignedHeader, but rejects headers whose nonces were
+// used before, as recorded by nonces, so that captured headers can't be
+// replayed. Replay protection holds across the instances sharing nonces. A
+// nil store doesn't record nonces, like SignedHeader.
+func SignedHeaderOnce(name string, key []byte, nonces NonceStore) OverrideVerifier {
+	return func(r *http.Request) (Map, error) {
+		value := r.Header.Get(name)
+		if value == `` {
+			return nil, nil
+		}
+
+		parts := strings.SplitN(value, `.`, 2)
+		if len(parts) != 2 {
+			return nil, fmt.Errorf("malformed header %s", name)
+		}
+
+		sig, err := base64.RawURLEncoding.DecodeString(parts[1])
+		if err != nil || !hmac.Equal(sig, signOverrides(key, parts[0])) {
+			return nil, fmt.Errorf("invalid signature in header %s", name)
+		}
+
+		data, err := base64.RawURLEncoding.DecodeString(parts[0])
+		if err != nil {
+			return nil, wrapError(err, "malformed header %s", name)
+		}
+
+		var signed signedOverrides
+		dec := json.NewDecoder(bytes.NewReader(data))
+		if err := dec.Decode(&signed); err != nil {
+			return nil, wrapError(err, "malformed header %s", name)
+		}
+
+		if !time.Now().Before(signed.Expires) {
+			return nil, fmt.Errorf("expired header %s", name)
+		}
+
+		if nonces != nil {
+			ok, err := nonces.Use(r.Context(), signed.Nonce, signed.Expires)
+			if err != nil {
+				return nil, wrapError(err, "check nonce of header %s", name)
+			}
+
+			if !ok {
+				return nil, fmt.Errorf("reused header %s", name)
+			}
+		}
+
+		return signed.Overrides, nil
+	}
+}
+
+// NonceStore records the nonces of the headers verified by SignedHeaderOnce.
+// Stores shared by the instances of a service, e.g. in a database, protect
+// them all from replayed headers.
+type NonceStore interface {
+	// Use records nonce as used until expires, when its header expires, and
+	// returns false if it was used before.
+	Use(ctx context.Context, nonce string, expires time.Time) (bool, error)
+}
+
+// NewNonceStore returns a NonceStore holding nonces in memory, which only
+// protects the process it is used in.
+func NewNonceStore() NonceStore {
+	return &memoryNonces{used: map[string]time.Time{}}
+}
+
+type memoryNonces struct {
+	mu sync.Mutex
+	// expiry times of the nonces used
+	used map[string]time.Time
+}
+
+func (s *memoryNonces) Use(ctx context.Context, nonce string, expires time.Time) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := time.Now()
+	for used, t := range s.used {
+		if !now.Before(t) {
+			delete(s.used, used)
+		}
+	}
+
+	if _, ok := s.used[nonce]; ok {
+		return false, nil
+	}
+
+	s.used[nonce] = expires
+	return true, nil
+}
+
+// SignOverrides returns the value of a header carrying overrides, signed with
+// key, for SignedHeader. The header expires after ttl, and can be used once if
+// it is verified by SignedHeaderOnce.
+func SignOverrides(key []byte, overrides Map, ttl time.Duration) (string, error) {
+	nonce := make([]byte, 16)
+	if _, err := rand.Read(nonce); err != nil {
+		return ``, err
+	}
+
+	data, err := json.Marshal(signedOverrides{
+		Overrides: overrides,
+		Expires:   time.Now().Add(ttl),
+		Nonce:     base64.RawURLEncoding.EncodeToString(nonce),
+	})
+	if err != nil {
+		return ``, err
+	}
+
+	payload := base64.RawURLEncoding.EncodeToString(data)
+	return payload + `.` + base64.RawURLEncoding.EncodeToString(signOverrides(key, payload)), nil
+}
+
+func signOverrides(key []byte, payload string) []byte {
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(payload))
+	return mac.Sum(nil)
+}
+
+// Returns the keys of overrides that aren't allowed, sorted.
+func disallowedKeys(overrides Map, allowed []string) []string {
+	allow := make(map[string]bool, len(allowed))
+	for _, key := range allowed {
+		allow[normalizeKey(key)] = true
+	}
+
+	keys := []string{}
+	for key := range overrides {
+		if !allow[normalizeKey(key)] {
+			keys = append(keys, normalizeKey(key))
+		}
+	}
+	sort.Strings(keys)
+
+	return keys
+}
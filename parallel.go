@@ -0,0 +1,55 @@
+package readconf
+
+import "sync"
+
+// Parallel makes Build unmarshal fields with up to workers goroutines, which
+// can shorten builds of very large configurations. Decode functions registered
+// with RegisterLeaf and unmarshal methods of field types must then be safe for
+// concurrent use.
+func (b *Builder) Parallel(workers int) *Builder {
+	if b.hasError() {
+		return b
+	}
+
+	b.workers = workers
+	return b
+}
+
+// Unmarshals the values of keys into their fields, with up to workers
+// goroutines. If several fields fail, the error of the first key is returned.
+func unmarshalParallel(values Map, keys []string, fields map[string]configField, files map[string]string, workers int) error {
+	if workers > len(keys) {
+		workers = len(keys)
+	}
+
+	errs := make([]error, len(keys))
+	next := make(chan int)
+
+	var wg sync.WaitGroup
+	for w := 0; w < workers; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+
+			for i := range next {
+				if err := values.unmarshalKey(keys[i], fields[keys[i]].value.Addr().Interface(), files); err != nil {
+					errs[i] = &UnmarshalError{Key: keys[i], Err: err}
+				}
+			}
+		}()
+	}
+
+	for i := range keys {
+		next <- i
+	}
+	close(next)
+	wg.Wait()
+
+	for _, err := range errs {
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
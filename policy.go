@@ -0,0 +1,74 @@
+package readconf
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Policy decides whether a resolved configuration is acceptable. It returns a
+// description of every rule the values violate.
+//
+// Policies are a natural place to evaluate centrally managed rules, such as
+// an OPA/rego query prepared by the application with the values as its input:
+//
+//	readconf.PolicyFunc(func(m readconf.Map) ([]string, error) {
+//		rs, err := query.Eval(ctx, rego.EvalInput(m))
+//		...
+//	})
+type Policy interface {
+	Violations(m Map) ([]string, error)
+}
+
+// PolicyFunc adapts a function to the Policy interface.
+type PolicyFunc func(m Map) ([]string, error)
+
+func (f PolicyFunc) Violations(m Map) ([]string, error) {
+	return f(m)
+}
+
+// PolicyError is returned by Build when values violate a policy.
+type PolicyError struct {
+	Violations []string
+}
+
+func (e *PolicyError) Error() string {
+	plural := ""
+	if len(e.Violations) > 1 {
+		plural = "s"
+	}
+
+	return fmt.Sprintf("%d policy violation%s: %s",
+		len(e.Violations), plural,
+		strings.Join(e.Violations, "; "))
+}
+
+// AddPolicy registers a policy evaluated against the values after transforms
+// ran and before they are unmarshaled. Violations of all policies are reported
+// together.
+func (b *Builder) AddPolicy(p Policy) *Builder {
+	if b.hasError() {
+		return b
+	}
+
+	b.policies = append(b.policies, p)
+	return b
+}
+
+func (b *Builder) checkPolicies(m Map) error {
+	violations := []string{}
+
+	for _, p := range b.policies {
+		vs, err := p.Violations(m)
+		if err != nil {
+			return wrapError(err, "evaluate policy")
+		}
+
+		violations = append(violations, vs...)
+	}
+
+	if len(violations) > 0 {
+		return &PolicyError{Violations: violations}
+	}
+
+	return nil
+}
@@ -0,0 +1,228 @@
+package readconf
+
+import (
+	"context"
+	"math/rand"
+	"sync"
+	"time"
+)
+
+const (
+	_defaultPollTTL = time.Minute
+	// first delay of polls after failed polls, doubled after every failure
+	_pollRetry = time.Second
+	// fraction of delays by which polls are randomly moved
+	_pollJitter = 0.1
+)
+
+// Poller polls a source for changes, e.g. a remote store or an HTTP endpoint,
+// and calls onChange when its values or version change. Polls are spread by
+// jitter, so that instances of an application don't poll in lockstep, and
+// failed polls are retried after exponentially increasing delays, up to the
+// TTL. Polls time out after the TTL.
+type Poller struct {
+	source   Source
+	ttl      time.Duration
+	onChange func()
+
+	mu sync.Mutex
+	// state of the values last loaded, if known
+	state string
+	known bool
+	// values of the poll that found the last change, until a build takes them
+	changed *polledValues
+	// key strategy of the builds, which polls load the source with
+	keys KeyStrategy
+
+	ctx     context.Context
+	cancel  context.CancelFunc
+	once    sync.Once
+	started sync.Once
+	done    chan struct{}
+}
+
+type polledValues struct {
+	values  Map
+	version string
+}
+
+// NewPoller starts polling source every ttl, a minute if ttl is 0. The first
+// poll loads source without blocking the caller. onChange is called if later
+// polls load different values or a different version, or if the first poll
+// failed and a later one succeeds.
+func NewPoller(source Source, ttl time.Duration, onChange func()) *Poller {
+	p := newPoller(source, ttl, onChange)
+	p.start()
+	return p
+}
+
+// Returns a poller that polls once started. If the values of source are
+// loaded by a polledSource before, it only polls after the TTL.
+func newPoller(source Source, ttl time.Duration, onChange func()) *Poller {
+	if ttl <= 0 {
+		ttl = _defaultPollTTL
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+
+	return &Poller{
+		source:   source,
+		ttl:      ttl,
+		onChange: onChange,
+		ctx:      ctx,
+		cancel:   cancel,
+		done:     make(chan struct{}),
+	}
+}
+
+func (p *Poller) start() {
+	p.started.Do(func() {
+		go p.run()
+	})
+}
+
+// Close stops polling and waits for a running call of onChange to return.
+func (p *Poller) Close() {
+	p.once.Do(p.cancel)
+
+	// a poller that never started has nothing to wait for
+	p.started.Do(func() {
+		close(p.done)
+	})
+
+	<-p.done
+}
+
+func (p *Poller) run() {
+	defer close(p.done)
+
+	failures := 0
+
+	for polls := 0; ; polls++ {
+		p.mu.Lock()
+		known := p.known
+		p.mu.Unlock()
+
+		if polls > 0 || known {
+			delay := p.ttl
+			if failures > 0 {
+				delay = pollBackoff(failures, p.ttl)
+			}
+
+			timer := time.NewTimer(jitter(delay))
+
+			select {
+			case <-p.ctx.Done():
+				timer.Stop()
+				return
+			case <-timer.C:
+			}
+		}
+
+		m, version, err := p.poll()
+		if err != nil {
+			if p.ctx.Err() != nil {
+				return
+			}
+
+			failures++
+			continue
+		}
+
+		failures = 0
+		state := pollState(m, version)
+
+		p.mu.Lock()
+		changed := (p.known && state != p.state) || (!p.known && polls > 0)
+		p.state, p.known = state, true
+		if changed {
+			p.changed = &polledValues{values: m, version: version}
+		}
+		p.mu.Unlock()
+
+		if changed {
+			p.onChange()
+		}
+	}
+}
+
+// Loads the values of the source, failing after the TTL.
+func (p *Poller) poll() (Map, string, error) {
+	ctx, cancel := context.WithTimeout(p.ctx, p.ttl)
+	defer cancel()
+
+	p.mu.Lock()
+	if p.keys != nil {
+		ctx = context.WithValue(ctx, keyStrategyKey{}, p.keys)
+	}
+	p.mu.Unlock()
+
+	return loadSource(ctx, p.source)
+}
+
+// Returns the version of polled values, or their fingerprint if they have
+// none.
+func pollState(m Map, version string) string {
+	if version != `` {
+		return `version ` + version
+	}
+
+	return (&Report{Values: m}).Fingerprint()
+}
+
+// Source of the builds of App for a source it polls. It gives the values of
+// the poll that found a change, rather than loading the source again, and
+// records the values it loads, so that the poller compares its polls with
+// them.
+type polledSource struct {
+	p *Poller
+}
+
+func (s polledSource) Load(ctx context.Context) (Map, error) {
+	m, _, err := s.LoadVersion(ctx)
+	return m, err
+}
+
+func (s polledSource) LoadVersion(ctx context.Context) (Map, string, error) {
+	s.p.mu.Lock()
+	changed := s.p.changed
+	s.p.changed = nil
+	s.p.keys = ContextKeyStrategy(ctx)
+	s.p.mu.Unlock()
+
+	if changed != nil {
+		return changed.values, changed.version, nil
+	}
+
+	m, version, err := loadSource(ctx, s.p.source)
+	if err != nil {
+		return nil, ``, err
+	}
+
+	s.p.mu.Lock()
+	s.p.state, s.p.known = pollState(m, version), true
+	s.p.mu.Unlock()
+
+	return m, version, nil
+}
+
+func (s polledSource) String() string {
+	return sourceName(s.p.source)
+}
+
+func pollBackoff(failures int, max time.Duration) time.Duration {
+	d := _pollRetry
+	for i := 1; i < failures && d < max; i++ {
+		d *= 2
+	}
+
+	if d > max {
+		d = max
+	}
+
+	return d
+}
+
+func jitter(d time.Duration) time.Duration {
+	return d + time.Duration((rand.Float64()*2-1)*_pollJitter*float64(d))
+}
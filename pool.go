@@ -0,0 +1,47 @@
+package readconf
+
+import (
+	"bytes"
+	"sync"
+)
+
+// buffers larger than this aren't kept in the pool, so that a single large
+// file doesn't hold on to memory
+const _maxPooledBuffer = 1 << 20
+
+var _buffers = sync.Pool{
+	New: func() interface{} {
+		return new(bytes.Buffer)
+	},
+}
+
+func getBuffer() *bytes.Buffer {
+	return _buffers.Get().(*bytes.Buffer)
+}
+
+func putBuffer(buf *bytes.Buffer) {
+	if buf.Cap() > _maxPooledBuffer {
+		return
+	}
+
+	buf.Reset()
+	_buffers.Put(buf)
+}
+
+// Calls f with each line of data, without the line break.
+func eachLine(data []byte, f func(i int, line []byte) error) error {
+	for i := 0; len(data) > 0; i++ {
+		line := data
+		if end := bytes.IndexByte(data, '\n'); end >= 0 {
+			line, data = data[:end], data[end+1:]
+		} else {
+			data = nil
+		}
+
+		if err := f(i, line); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
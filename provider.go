@@ -0,0 +1,148 @@
+package readconf
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"os/exec"
+	"strings"
+	"time"
+)
+
+// prefix of the executables of providers looked up in $PATH
+const _providerPrefix = `readconf-provider-`
+
+// time a provider may run unless the context of the build ends sooner
+const _providerTimeout = time.Minute
+
+// ProviderProtocolVersion is the version of the provider protocol.
+//
+// Providers are executables, e.g. readconf-provider-vault for a provider
+// named vault, that the builder starts with the arguments given to
+// MergeProvider. The builder writes a ProviderRequest as JSON to the stdin of
+// the provider, and the provider writes a ProviderResponse as JSON to its
+// stdout and exits with status 0. Anything written to stderr is included in
+// error messages.
+const ProviderProtocolVersion = 1
+
+// ProviderRequest is the request written to the stdin of a provider.
+type ProviderRequest struct {
+	// Version is the protocol version, ProviderProtocolVersion.
+	Version int      `json:"version"`
+	Args    []string `json:"args"`
+}
+
+// ProviderResponse is the response a provider writes to its stdout.
+type ProviderResponse struct {
+	// Protocol is the protocol version of the response. Responses of other
+	// versions than ProviderProtocolVersion are rejected, and responses
+	// without a version are taken to be of version 1.
+	Protocol int    `json:"protocol,omitempty"`
+	Values   Map    `json:"values"`
+	Error    string `json:"error,omitempty"`
+	// TTL optionally holds the number of seconds after which values expire.
+	TTL map[string]int `json:"ttl,omitempty"`
+	// Version optionally identifies the version of the values, e.g. of the
+	// parameters in a store, and is recorded in lockfiles.
+	Version string `json:"version,omitempty"`
+}
+
+// MergeProvider merges the values returned by the named provider, see
+// ProviderProtocolVersion. A name containing a path separator is used as the
+// path of the executable. Providers are killed after a minute; use
+// MergeSourceContext with ProviderSource to limit them to a context.
+func (b *Builder) MergeProvider(name string, args ...string) *Builder {
+	return b.MergeSource(ProviderSource(name, args...))
+}
+
+// ProviderSource returns a Source running the named provider, like
+// MergeProvider. The provider is killed when the context of the build ends.
+func ProviderSource(name string, args ...string) Source {
+	return providerSource{name: name, args: args}
+}
+
+type providerSource struct {
+	name string
+	args []string
+}
+
+func (s providerSource) Load(ctx context.Context) (Map, error) {
+	m, _, err := s.LoadVersion(ctx)
+	return m, err
+}
+
+// LoadVersion returns the version of the response as the version of the
+// values.
+func (s providerSource) LoadVersion(ctx context.Context) (Map, string, error) {
+	ctx, cancel := context.WithTimeout(ctx, _providerTimeout)
+	defer cancel()
+
+	resp, err := runProvider(ctx, s.name, s.args)
+	if err != nil {
+		return nil, ``, err
+	}
+
+	now := time.Now()
+	for key, ttl := range resp.TTL {
+		recordExpiry(ctx, key, now.Add(time.Duration(ttl)*time.Second))
+	}
+
+	return resp.Values, resp.Version, nil
+}
+
+func (s providerSource) String() string {
+	return `provider ` + s.name
+}
+
+func runProvider(ctx context.Context, name string, args []string) (*ProviderResponse, error) {
+	path := name
+	if !strings.ContainsAny(name, `/\`) {
+		var err error
+		if path, err = exec.LookPath(_providerPrefix + name); err != nil {
+			return nil, err
+		}
+	}
+
+	req, err := json.Marshal(ProviderRequest{
+		Version: ProviderProtocolVersion,
+		Args:    args,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	var stdout, stderr bytes.Buffer
+
+	cmd := exec.CommandContext(ctx, path, args...)
+	cmd.Stdin = bytes.NewReader(req)
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+
+	if err := cmd.Run(); err != nil {
+		if ctx.Err() != nil {
+			return nil, ctx.Err()
+		}
+
+		if msg := strings.TrimSpace(stderr.String()); msg != `` {
+			return nil, fmt.Errorf("%v: %s", err, msg)
+		}
+
+		return nil, err
+	}
+
+	var resp ProviderResponse
+	if err := json.Unmarshal(stdout.Bytes(), &resp); err != nil {
+		return nil, wrapError(err, "invalid response")
+	}
+
+	if resp.Protocol != 0 && resp.Protocol != ProviderProtocolVersion {
+		return nil, fmt.Errorf("unsupported protocol version %d", resp.Protocol)
+	}
+
+	if resp.Error != `` {
+		return nil, fmt.Errorf("%s", resp.Error)
+	}
+
+	return &resp, nil
+}
@@ -0,0 +1,87 @@
+package readconftest
+
+import (
+	"fmt"
+	"math/rand"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/tetratom/readconf"
+)
+
+// Chaos is a source for testing how an application copes with bad
+// configuration pushes during reloads. Every time it is merged it may be
+// delayed, fail, merge only some of its values or merge its flapping values
+// instead, at the configured rates between 0 and 1. Use it as the source of a
+// reloading configuration, e.g. as App.Configure.
+type Chaos struct {
+	// Values are merged when nothing goes wrong.
+	Values readconf.Map
+	// Flap are the values merged instead of Values when the source flaps.
+	Flap readconf.Map
+
+	// MaxDelay is the longest random delay of a merge.
+	MaxDelay time.Duration
+	FailRate float64
+	// PartialRate is the rate of merges of a random subset of Values.
+	PartialRate float64
+	FlapRate    float64
+
+	// Rand is the source of randomness, a fixed seed by default.
+	Rand *rand.Rand
+
+	mu    sync.Mutex
+	merge int
+}
+
+// Merge merges the values of the source into b.
+func (c *Chaos) Merge(b *readconf.Builder) {
+	c.mu.Lock()
+	if c.Rand == nil {
+		c.Rand = rand.New(rand.NewSource(1))
+	}
+
+	c.merge++
+	n := c.merge
+
+	var delay time.Duration
+	if c.MaxDelay > 0 {
+		delay = time.Duration(c.Rand.Int63n(int64(c.MaxDelay)))
+	}
+
+	fail := c.Rand.Float64() < c.FailRate
+	partial := c.Rand.Float64() < c.PartialRate
+	flap := c.Rand.Float64() < c.FlapRate
+
+	values := readconf.Map{}
+	switch {
+	case flap:
+		values.Merge(c.Flap)
+	case partial:
+		// in order, so that the same seed drops the same keys
+		keys := make([]string, 0, len(c.Values))
+		for key := range c.Values {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+
+		for _, key := range keys {
+			if c.Rand.Intn(2) == 0 {
+				values[key] = c.Values[key]
+			}
+		}
+	default:
+		values.Merge(c.Values)
+	}
+	c.mu.Unlock()
+
+	time.Sleep(delay)
+
+	if fail {
+		b.Fail(fmt.Errorf("chaos: merge %d failed", n))
+		return
+	}
+
+	b.MergeMap(values)
+}
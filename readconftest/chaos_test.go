@@ -0,0 +1,89 @@
+package readconftest_test
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/tetratom/readconf"
+	"github.com/tetratom/readconf/readconftest"
+)
+
+func TestChaos(t *testing.T) {
+	type config struct {
+		Host string `validate:"required"`
+		Port int    `validate:"min=1"`
+	}
+
+	chaos := &readconftest.Chaos{
+		Values:      readconf.Map{`HOST`: `localhost`, `PORT`: `8080`},
+		Flap:        readconf.Map{`HOST`: `localhost`, `PORT`: `0`},
+		MaxDelay:    time.Millisecond,
+		FailRate:    0.2,
+		PartialRate: 0.2,
+		FlapRate:    0.2,
+	}
+
+	app := readconf.NewApp(`chaos`)
+	app.Dirs = nil
+	app.Configure = func(b *readconf.Builder) {
+		chaos.Merge(b)
+		b.WithValidator(readconf.ValidatorFunc(func(s interface{}) error {
+			if s.(*config).Port < 1 {
+				return &readconf.ValidationError{Fields: []readconf.ValidationField{{Key: `Port`, Rule: `min`, Param: `1`}}}
+			}
+
+			return nil
+		}))
+	}
+	defer app.Close()
+
+	var conf config
+	for app.Load(&conf) != nil {
+	}
+
+	failures := 0
+	for i := 0; i < 100; i++ {
+		if _, err := app.Reload(); err != nil {
+			failures++
+		}
+
+		conf := app.Config().(*config)
+		require.Equal(t, `localhost`, conf.Host)
+		require.Equal(t, 8080, conf.Port)
+	}
+
+	require.True(t, failures > 20 && failures < 80, failures)
+}
+
+func TestChaos_Seed(t *testing.T) {
+	values := readconf.Map{}
+	for i := 0; i < 20; i++ {
+		values[fmt.Sprintf(`KEY%d`, i)] = `x`
+	}
+
+	merged := func() []readconf.Map {
+		chaos := &readconftest.Chaos{Values: values, PartialRate: 1}
+
+		var maps []readconf.Map
+		for i := 0; i < 5; i++ {
+			b := readconf.NewBuilder()
+			chaos.Merge(b)
+
+			var conf struct{}
+			err := b.AddTransform(func(m readconf.Map) error {
+				merged := readconf.Map{}
+				merged.Merge(m)
+				maps = append(maps, merged)
+				return nil
+			}).Build(&conf)
+			require.NoError(t, err)
+		}
+
+		return maps
+	}
+
+	require.Equal(t, merged(), merged())
+}
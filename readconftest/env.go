@@ -0,0 +1,81 @@
+package readconftest
+
+import (
+	"os"
+	"sort"
+	"strings"
+	"testing"
+
+	"github.com/tetratom/readconf"
+)
+
+// Setenv sets the environment variables PREFIX+KEY to the values of vars and
+// unsets the other variables starting with prefix, so that variables of the
+// developer's shell don't leak into the test. It returns a function restoring
+// the environment, to be deferred:
+//
+//	defer readconftest.Setenv(t, "APP_", readconf.Map{"PORT": "80"})()
+//
+// Like t.Setenv, Setenv changes the environment of the process and must not be
+// used by parallel tests; pass Environ to Builder.MergeEnviron instead.
+func Setenv(t testing.TB, prefix string, vars readconf.Map) func() {
+	t.Helper()
+
+	saved := map[string]*string{}
+	save := func(key string) {
+		if _, ok := saved[key]; ok {
+			return
+		}
+
+		if v, ok := os.LookupEnv(key); ok {
+			saved[key] = &v
+		} else {
+			saved[key] = nil
+		}
+	}
+
+	restore := func() {
+		for key, v := range saved {
+			if v == nil {
+				os.Unsetenv(key)
+			} else {
+				os.Setenv(key, *v)
+			}
+		}
+	}
+
+	for _, kv := range os.Environ() {
+		key := strings.SplitN(kv, `=`, 2)[0]
+		if strings.HasPrefix(key, prefix) {
+			save(key)
+			if err := os.Unsetenv(key); err != nil {
+				restore()
+				t.Fatalf("unset %s: %s", key, err)
+			}
+		}
+	}
+
+	for key, value := range vars {
+		save(prefix + key)
+		if err := os.Setenv(prefix+key, value); err != nil {
+			restore()
+			t.Fatalf("set %s: %s", prefix+key, err)
+		}
+	}
+
+	return restore
+}
+
+// Environ returns the environment variables PREFIX+KEY with the values of vars
+// in the format of os.Environ, sorted, for Builder.MergeEnviron. Unlike Setenv,
+// it doesn't change the environment of the process, so it is safe for parallel
+// tests.
+func Environ(prefix string, vars readconf.Map) []string {
+	env := make([]string, 0, len(vars))
+	for key, value := range vars {
+		env = append(env, prefix+key+`=`+value)
+	}
+
+	sort.Strings(env)
+	return env
+}
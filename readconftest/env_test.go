@@ -0,0 +1,56 @@
+package readconftest_test
+
+import (
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/tetratom/readconf"
+	"github.com/tetratom/readconf/readconftest"
+)
+
+func TestSetenv(t *testing.T) {
+	var conf struct {
+		Name string `default:"default"`
+		Port int
+	}
+
+	defer os.Unsetenv(`ENVTEST_NAME`)
+	defer os.Unsetenv(`ENVTEST_OTHER`)
+	require.NoError(t, os.Setenv(`ENVTEST_NAME`, `shell`))
+	require.NoError(t, os.Setenv(`ENVTEST_OTHER`, `other`))
+
+	restore := readconftest.Setenv(t, `ENVTEST_`, readconf.Map{`PORT`: `80`})
+
+	err := readconf.NewBuilder().MergeEnviron(`ENVTEST_`, os.Environ()).Build(&conf)
+	require.NoError(t, err)
+	require.Equal(t, `default`, conf.Name)
+	require.Equal(t, 80, conf.Port)
+
+	_, ok := os.LookupEnv(`ENVTEST_OTHER`)
+	require.False(t, ok)
+
+	restore()
+
+	require.Equal(t, `shell`, os.Getenv(`ENVTEST_NAME`))
+	require.Equal(t, `other`, os.Getenv(`ENVTEST_OTHER`))
+	_, ok = os.LookupEnv(`ENVTEST_PORT`)
+	require.False(t, ok)
+}
+
+func TestEnviron(t *testing.T) {
+	t.Parallel()
+
+	env := readconftest.Environ(`APP_`, readconf.Map{`PORT`: `80`, `NAME`: `app`})
+	require.Equal(t, []string{`APP_NAME=app`, `APP_PORT=80`}, env)
+
+	var conf struct {
+		Name string
+		Port int
+	}
+
+	require.NoError(t, readconf.NewBuilder().MergeEnviron(`APP_`, env).Build(&conf))
+	require.Equal(t, `app`, conf.Name)
+	require.Equal(t, 80, conf.Port)
+}
@@ -0,0 +1,176 @@
+package readconftest
+
+import (
+	"fmt"
+	"math"
+	"math/rand"
+	"net/url"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/tetratom/readconf"
+)
+
+// attempts to generate a valid configuration before giving up
+const _generateAttempts = 100
+
+// Generate returns random values for the configuration of target, a pointer
+// to a struct, for property-based tests. Values respect the common validate
+// tags of go-playground/validator where feasible: required, min, max, len,
+// gt, gte, lt, lte and oneof. Generate retries until the values build into
+// target, and returns the last build error if they don't.
+func Generate(r *rand.Rand, target interface{}) (readconf.Map, error) {
+	t := reflect.TypeOf(target)
+	if t.Kind() != reflect.Ptr || t.Elem().Kind() != reflect.Struct {
+		return nil, fmt.Errorf("expected pointer to struct")
+	}
+
+	var err error
+	for i := 0; i < _generateAttempts; i++ {
+		v := reflect.New(t.Elem())
+		generateStruct(r, v.Elem())
+
+		var m readconf.Map
+		if m, err = readconf.Marshal(v.Interface()); err != nil {
+			return nil, err
+		}
+
+		if err = readconf.NewBuilder().MergeMap(m).Build(reflect.New(t.Elem()).Interface()); err == nil {
+			return m, nil
+		}
+	}
+
+	return nil, err
+}
+
+func generateStruct(r *rand.Rand, v reflect.Value) {
+	for i := 0; i < v.NumField(); i++ {
+		f := v.Type().Field(i)
+		if !v.Field(i).CanSet() || f.Tag.Get(`config`) == `-` {
+			continue
+		}
+
+		generateValue(r, v.Field(i), parseRules(f.Tag.Get(`validate`)))
+	}
+}
+
+type rules struct {
+	min, max *float64
+	oneof    []string
+}
+
+func parseRules(tag string) rules {
+	var rs rules
+
+	for _, rule := range strings.Split(tag, `,`) {
+		kv := strings.SplitN(rule, `=`, 2)
+		if len(kv) != 2 {
+			continue
+		}
+
+		if kv[0] == `oneof` {
+			rs.oneof = strings.Fields(kv[1])
+			continue
+		}
+
+		n, err := strconv.ParseFloat(kv[1], 64)
+		if err != nil {
+			continue
+		}
+
+		switch kv[0] {
+		case `min`, `gte`:
+			rs.min = &n
+		case `gt`:
+			n++
+			rs.min = &n
+		case `max`, `lte`:
+			rs.max = &n
+		case `lt`:
+			n--
+			rs.max = &n
+		case `len`:
+			rs.min, rs.max = &n, &n
+		}
+	}
+
+	return rs
+}
+
+// Returns a random number within the rules, and within lo and hi.
+func (rs rules) number(r *rand.Rand, lo, hi float64) float64 {
+	if rs.min != nil && *rs.min > lo {
+		lo = *rs.min
+	}
+
+	if rs.max != nil && *rs.max < hi {
+		hi = *rs.max
+	}
+
+	if hi <= lo {
+		return lo
+	}
+
+	return lo + r.Float64()*(hi-lo)
+}
+
+func generateValue(r *rand.Rand, v reflect.Value, rs rules) {
+	switch v.Interface().(type) {
+	case time.Duration:
+		v.SetInt(int64(rs.number(r, 0, float64(time.Hour))))
+		return
+	case url.URL:
+		v.Set(reflect.ValueOf(url.URL{Scheme: `https`, Host: randomString(r, 3+r.Intn(10)) + `.example`}))
+		return
+	}
+
+	if len(rs.oneof) > 0 && v.Kind() != reflect.Slice {
+		m := readconf.Map{`V`: rs.oneof[r.Intn(len(rs.oneof))]}
+		if err := m.Unmarshal(`V`, v.Addr().Interface()); err == nil {
+			return
+		}
+	}
+
+	switch v.Kind() {
+	case reflect.String:
+		v.SetString(randomString(r, int(rs.number(r, 1, 16))))
+	case reflect.Bool:
+		v.SetBool(r.Intn(2) == 1)
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		bits := float64(v.Type().Bits())
+		limit := math.Min(math.Pow(2, bits-1)-1, 1e6)
+		v.SetInt(int64(math.Round(rs.number(r, -limit, limit))))
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		bits := float64(v.Type().Bits())
+		limit := math.Min(math.Pow(2, bits)-1, 1e6)
+		v.SetUint(uint64(math.Round(rs.number(r, 0, limit))))
+	case reflect.Float32, reflect.Float64:
+		v.SetFloat(rs.number(r, -1e6, 1e6))
+	case reflect.Slice:
+		n := int(rs.number(r, 0, 5))
+		s := reflect.MakeSlice(v.Type(), n, n)
+		for i := 0; i < n; i++ {
+			generateValue(r, s.Index(i), rules{})
+		}
+		v.Set(s)
+	case reflect.Ptr:
+		v.Set(reflect.New(v.Type().Elem()))
+		generateValue(r, v.Elem(), rs)
+	case reflect.Struct:
+		generateStruct(r, v)
+	}
+}
+
+const _letters = `abcdefghijklmnopqrstuvwxyz0123456789`
+
+// Returns a random string of n letters.
+func randomString(r *rand.Rand, n int) string {
+	b := make([]byte, n)
+	for i := range b {
+		b[i] = _letters[r.Intn(len(_letters))]
+	}
+
+	return string(b)
+}
@@ -0,0 +1,62 @@
+package readconftest_test
+
+import (
+	"math/rand"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/tetratom/readconf"
+	"github.com/tetratom/readconf/readconftest"
+)
+
+func TestGenerate(t *testing.T) {
+	type config struct {
+		Name    string  `validate:"required,min=3,max=8"`
+		Mode    string  `validate:"oneof=fast safe"`
+		Port    uint16  `validate:"gte=1024"`
+		Ratio   float64 `validate:"gte=0,lte=1"`
+		Retries int8    `validate:"min=0,max=5"`
+		Timeout time.Duration
+		Tags    []string
+		Debug   *bool
+		DB      struct {
+			Host string `validate:"required"`
+			Pool int    `validate:"gt=0,lt=100"`
+		}
+	}
+
+	r := rand.New(rand.NewSource(1))
+	for i := 0; i < 100; i++ {
+		m, err := readconftest.Generate(r, &config{})
+		require.NoError(t, err)
+
+		var conf config
+		require.NoError(t, readconf.NewBuilder().MergeMap(m).Build(&conf))
+		require.Contains(t, []string{`fast`, `safe`}, conf.Mode)
+		require.True(t, conf.Port >= 1024)
+		require.True(t, conf.Ratio >= 0 && conf.Ratio <= 1)
+		require.True(t, conf.DB.Pool > 0 && conf.DB.Pool < 100)
+		require.NotNil(t, conf.Debug)
+	}
+
+	_, err := readconftest.Generate(r, config{})
+	require.EqualError(t, err, `expected pointer to struct`)
+
+	t.Run("unexported embedded struct", func(t *testing.T) {
+		type limits struct {
+			Burst int
+		}
+
+		type config struct {
+			limits
+			Name string `validate:"required"`
+		}
+
+		m, err := readconftest.Generate(r, &config{})
+		require.NoError(t, err)
+		require.Len(t, m, 1)
+		require.NotEmpty(t, m.Get(`NAME`))
+	})
+}
@@ -0,0 +1,105 @@
+// Package readconftest provides helpers for testing code using readconf.
+package readconftest
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"reflect"
+	"sort"
+	"strings"
+	"testing"
+
+	"github.com/tetratom/readconf"
+)
+
+// UpdateEnv is the environment variable that makes Golden write golden files
+// instead of checking them, e.g. READCONF_UPDATE_GOLDEN=1 go test ./...
+const UpdateEnv = `READCONF_UPDATE_GOLDEN`
+
+// Golden builds the golden configuration file filename into a new value of
+// the type of want, a pointer to a struct, and fails the test with a diff if
+// it doesn't equal want. Keys of the file that the struct no longer has are
+// reported too, so renaming or removing keys by accident breaks the test.
+func Golden(t testing.TB, filename string, want interface{}) {
+	t.Helper()
+
+	if os.Getenv(UpdateEnv) != `` {
+		m, err := readconf.MarshalOrdered(want)
+		if err != nil {
+			t.Fatalf("golden config %s: %v", filename, err)
+		}
+
+		var buf bytes.Buffer
+		m.WriteTo(&buf)
+
+		if err := ioutil.WriteFile(filename, buf.Bytes(), 0644); err != nil {
+			t.Fatalf("golden config %s: %v", filename, err)
+		}
+
+		return
+	}
+
+	got := reflect.New(reflect.TypeOf(want).Elem()).Interface()
+
+	report, err := readconf.NewBuilder().MergeFile(filename).BuildReport(got)
+	if err != nil {
+		t.Fatalf("golden config %s: %v", filename, err)
+	}
+
+	diff, err := Diff(want, got)
+	if err != nil {
+		t.Fatalf("golden config %s: %v", filename, err)
+	}
+
+	for key := range report.Extra(``) {
+		diff = append(diff, fmt.Sprintf("unknown key %s", key))
+	}
+	sort.Strings(diff)
+
+	if len(diff) > 0 {
+		t.Errorf("golden config %s doesn't match (- want, + got):\n%s", filename, strings.Join(diff, "\n"))
+	}
+}
+
+// Diff compares two configurations by their marshaled values, and returns a
+// line for every key that differs.
+func Diff(want, got interface{}) ([]string, error) {
+	wantValues, err := readconf.Marshal(want)
+	if err != nil {
+		return nil, err
+	}
+
+	gotValues, err := readconf.Marshal(got)
+	if err != nil {
+		return nil, err
+	}
+
+	keys := map[string]bool{}
+	for key := range wantValues {
+		keys[key] = true
+	}
+	for key := range gotValues {
+		keys[key] = true
+	}
+
+	diff := []string{}
+	for key := range keys {
+		w, wok := wantValues.Lookup(key)
+		g, gok := gotValues.Lookup(key)
+
+		switch {
+		case wok && gok && w == g:
+		case !gok:
+			diff = append(diff, fmt.Sprintf("- %s=%s", key, w))
+		case !wok:
+			diff = append(diff, fmt.Sprintf("+ %s=%s", key, g))
+		default:
+			diff = append(diff, fmt.Sprintf("- %s=%s\n+ %s=%s", key, w, key, g))
+		}
+	}
+	sort.Strings(diff)
+
+	return diff, nil
+}
@@ -0,0 +1,85 @@
+package readconftest_test
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/tetratom/readconf/readconftest"
+)
+
+type config struct {
+	Name string
+	Port int
+	DB   struct {
+		Host string
+	}
+}
+
+// records failures instead of failing the test
+type recorder struct {
+	testing.TB
+	errors []string
+	fatal  bool
+}
+
+func (r *recorder) Helper() {}
+
+func (r *recorder) Errorf(format string, args ...interface{}) {
+	r.errors = append(r.errors, fmt.Sprintf(format, args...))
+}
+
+func (r *recorder) Fatalf(format string, args ...interface{}) {
+	r.Errorf(format, args...)
+	r.fatal = true
+}
+
+func TestGolden(t *testing.T) {
+	want := config{Name: `app`, Port: 8080}
+	want.DB.Host = `localhost`
+
+	t.Run("match", func(t *testing.T) {
+		readconftest.Golden(t, `testdata/golden.env`, &want)
+	})
+
+	t.Run("mismatch", func(t *testing.T) {
+		var changed struct {
+			Name   string
+			Port   int
+			DBHost string `config:"DATABASE_HOST" default:"localhost"`
+		}
+		changed.Name = `app`
+		changed.Port = 80
+		changed.DBHost = `localhost`
+
+		r := &recorder{}
+		readconftest.Golden(r, `testdata/golden.env`, &changed)
+		require.Equal(t, []string{
+			"golden config testdata/golden.env doesn't match (- want, + got):\n" +
+				"- PORT=80\n+ PORT=8080\n" +
+				"unknown key DB__HOST",
+		}, r.errors)
+	})
+
+	t.Run("update", func(t *testing.T) {
+		dir, err := ioutil.TempDir(``, `readconftest`)
+		require.NoError(t, err)
+		defer os.RemoveAll(dir)
+
+		filename := filepath.Join(dir, `golden.env`)
+
+		require.NoError(t, os.Setenv(readconftest.UpdateEnv, `1`))
+		readconftest.Golden(t, filename, &want)
+		require.NoError(t, os.Unsetenv(readconftest.UpdateEnv))
+
+		data, err := ioutil.ReadFile(filename)
+		require.NoError(t, err)
+		require.Equal(t, "NAME=app\nPORT=8080\nDB__HOST=localhost\n", string(data))
+
+		readconftest.Golden(t, filename, &want)
+	})
+}
@@ -0,0 +1,253 @@
+package readconf
+
+import (
+	"crypto/sha256"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Report describes the configuration resolved for a target. Reports, like Map,
+// can be encoded with encoding/gob, e.g. to hand resolved configuration from a
+// parent process to its workers.
+type Report struct {
+	// Keys lists the configuration keys of the target, sorted.
+	Keys []string
+	// Values holds the resolved values of all merged keys. It must not be
+	// modified.
+	Values Map
+	// Origins tells where the value of each key of the target came from.
+	Origins map[string]Origin
+	// Expires holds the expiry times of values that expire.
+	Expires map[string]time.Time
+	// Refresh is the time override sources are due to be read again, zero if
+	// there are none.
+	Refresh time.Time
+	// Warnings lists failures of best-effort sources.
+	Warnings []string
+	// Layers holds the layer selected by each Canary rollout.
+	Layers map[string]string
+	// Docs describes the field of each key of the target.
+	Docs map[string]FieldDoc
+	// Sources names the sources merged, in order.
+	Sources []string
+	// Files lists the local files and directories sources read or tried to
+	// read, in order, including included files and those of skipped sources.
+	// App watches them for changes.
+	Files []string
+}
+
+// Lookup returns the resolved value of key, which doesn't need to be a key of
+// the target.
+func (r *Report) Lookup(key string) (string, bool) {
+	return r.Values.Lookup(key)
+}
+
+// Extra returns a copy of the resolved values under prefix whose keys aren't
+// keys of the target, with prefix removed from their keys. With an empty
+// prefix, all such values are returned.
+func (r *Report) Extra(prefix string) Map {
+	prefix = normalizeKey(prefix)
+	if prefix != `` {
+		prefix += _separator
+	}
+
+	m := Map{}
+	for key, value := range r.Values {
+		if !strings.HasPrefix(key, prefix) {
+			continue
+		}
+
+		if i := sort.SearchStrings(r.Keys, key); i < len(r.Keys) && r.Keys[i] == key {
+			continue
+		}
+
+		m[strings.TrimPrefix(key, prefix)] = value
+	}
+
+	return m
+}
+
+// Fingerprint returns a short hash of the resolved values, to tell at a glance
+// whether instances run the same configuration.
+func (r *Report) Fingerprint() string {
+	keys := make([]string, 0, len(r.Values))
+	for key := range r.Values {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	h := sha256.New()
+	for _, key := range keys {
+		fmt.Fprintf(h, "%s=%q\n", key, r.Values[key])
+	}
+
+	return fmt.Sprintf("%x", h.Sum(nil))[:12]
+}
+
+// Banner returns a one-line summary of the configuration of the named
+// application to log at startup, e.g.:
+//
+//	myapp: profile production, configuration 3f2a9c1b7d4e, 12 keys from 3 sources, 1 warning
+func (r *Report) Banner(name, profile string) string {
+	var sb strings.Builder
+	sb.WriteString(name)
+	sb.WriteString(`: `)
+
+	if profile != `` {
+		fmt.Fprintf(&sb, "profile %s, ", profile)
+	}
+
+	fmt.Fprintf(&sb, "configuration %s, %s from %s, %s",
+		r.Fingerprint(),
+		plural(len(r.Keys), `key`),
+		plural(len(r.Sources), `source`),
+		plural(len(r.Warnings), `warning`))
+
+	return sb.String()
+}
+
+// Returns n and the noun, in plural unless n is 1.
+func plural(n int, noun string) string {
+	if n == 1 {
+		return `1 ` + noun
+	}
+
+	return strconv.Itoa(n) + ` ` + noun + `s`
+}
+
+// KeyChange is a change of the value of a key between two configurations.
+type KeyChange struct {
+	Key      string
+	Old, New string
+	// HadOld and HasNew tell whether the key had a value before the change
+	// and has one after it.
+	HadOld, HasNew bool
+}
+
+// Changes returns the changes of values from r to next, sorted by key.
+func (r *Report) Changes(next *Report) []KeyChange {
+	changes := []KeyChange{}
+	for key, old := range r.Values {
+		if value, ok := next.Values[key]; !ok || value != old {
+			changes = append(changes, KeyChange{Key: key, Old: old, New: value, HadOld: true, HasNew: ok})
+		}
+	}
+
+	for key, value := range next.Values {
+		if _, ok := r.Values[key]; !ok {
+			changes = append(changes, KeyChange{Key: key, New: value, HasNew: true})
+		}
+	}
+
+	sort.Slice(changes, func(i, j int) bool {
+		return changes[i].Key < changes[j].Key
+	})
+
+	return changes
+}
+
+// NextExpiry returns the earliest expiry time of any value, or the time
+// override sources are read again if that is earlier.
+func (r *Report) NextExpiry() (time.Time, bool) {
+	next := r.Refresh
+	for _, t := range r.Expires {
+		if next.IsZero() || t.Before(next) {
+			next = t
+		}
+	}
+
+	return next, !next.IsZero()
+}
+
+// Origin tells where the value of a configuration key came from.
+type Origin string
+
+const (
+	// OriginDefault is a value from a default tag or DefaultConfig.
+	OriginDefault Origin = `default`
+	// OriginSet is a value merged into the builder.
+	OriginSet Origin = `set`
+	// OriginMissing is a value returned by an OnMissing callback.
+	OriginMissing Origin = `missing`
+	// OriginTransform is a value added by a transform.
+	OriginTransform Origin = `transform`
+	// OriginOverride is a value of an override source, which takes precedence
+	// over all other sources.
+	OriginOverride Origin = `override`
+)
+
+// KeyUsage counts how often configuration keys are set by something other
+// than their defaults, to find keys that are no longer used. It is safe for
+// concurrent use, and implements expvar.Var so it can be published.
+type KeyUsage struct {
+	mu     sync.Mutex
+	builds int
+	counts map[string]int
+}
+
+// Observe records the origins of the keys in r.
+func (u *KeyUsage) Observe(r *Report) {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+
+	if u.counts == nil {
+		u.counts = make(map[string]int, len(r.Keys))
+	}
+
+	u.builds++
+	for _, key := range r.Keys {
+		n := u.counts[key]
+		if origin, ok := r.Origins[key]; ok && origin != OriginDefault {
+			n++
+		}
+
+		u.counts[key] = n
+	}
+}
+
+// Counts returns the number of observed builds, and for every observed key the
+// number of builds in which it was not set to its default.
+func (u *KeyUsage) Counts() (builds int, counts map[string]int) {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+
+	counts = make(map[string]int, len(u.counts))
+	for k, n := range u.counts {
+		counts[k] = n
+	}
+
+	return u.builds, counts
+}
+
+// Unused returns the observed keys that were never set to anything but their
+// defaults, sorted.
+func (u *KeyUsage) Unused() []string {
+	_, counts := u.Counts()
+
+	keys := []string{}
+	for k, n := range counts {
+		if n == 0 {
+			keys = append(keys, k)
+		}
+	}
+	sort.Strings(keys)
+
+	return keys
+}
+
+// String returns the counts as JSON.
+func (u *KeyUsage) String() string {
+	builds, counts := u.Counts()
+
+	data, _ := json.Marshal(struct {
+		Builds int            `json:"builds"`
+		Keys   map[string]int `json:"keys"`
+	}{builds, counts})
+
+	return string(data)
+}
@@ -0,0 +1,84 @@
+package readconf
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"os"
+)
+
+// RenameRule renames the key From to To.
+type RenameRule struct {
+	From string
+	To   string
+}
+
+// Rewrite reads the configuration file in, renames its keys according to
+// rules and writes the result to out, which may be the same file. Comments,
+// blank lines and values are left as they are.
+func Rewrite(rules []RenameRule, in, out string) error {
+	data, err := ioutil.ReadFile(in)
+	if err != nil {
+		return err
+	}
+
+	data, err = rewriteData(rules, data)
+	if err != nil {
+		return wrapError(err, "rewrite %s", in)
+	}
+
+	mode := os.FileMode(0644)
+	if fi, err := os.Stat(in); err == nil {
+		mode = fi.Mode().Perm()
+	}
+
+	return ioutil.WriteFile(out, data, mode)
+}
+
+func rewriteData(rules []RenameRule, data []byte) ([]byte, error) {
+	renames := make(map[string]string, len(rules))
+	for _, rule := range rules {
+		renames[normalizeKey(rule.From)] = rule.To
+	}
+
+	lines := bytes.Split(data, []byte("\n"))
+	// renaming a key onto one that is already set would change which value
+	// wins, so such conflicts are rejected.
+	seen := map[string]int{}
+	renamed := map[string]bool{}
+
+	for i, line := range lines {
+		trimmed := bytes.TrimSpace(line)
+		if len(trimmed) == 0 || trimmed[0] == '#' {
+			continue
+		}
+
+		end := bytes.IndexByte(line, '=')
+		if end < 0 {
+			end = len(line)
+		}
+
+		start := len(line) - len(bytes.TrimLeft(line, " \t"))
+		key := string(bytes.TrimSpace(line[start:end]))
+		if key == `` {
+			return nil, fmt.Errorf(`invalid empty key on line %d`, i+1)
+		}
+
+		to, rename := renames[normalizeKey(key)]
+		if rename {
+			rest := line[start+len(key):]
+			lines[i] = append(append(append([]byte{}, line[:start]...), to...), rest...)
+			key = to
+		}
+
+		k := normalizeKey(key)
+		if prev, ok := seen[k]; ok && (rename || renamed[k]) {
+			return nil, fmt.Errorf(`key %s on line %d is already set on line %d`, key, i+1, prev)
+		}
+
+		seen[k] = i + 1
+		renamed[k] = renamed[k] || rename
+	}
+
+	return bytes.Join(lines, []byte("\n")), nil
+}
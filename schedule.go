@@ -0,0 +1,66 @@
+package readconf
+
+import (
+	"fmt"
+	"strings"
+	"time"
+)
+
+// layouts of the activation times of scheduled values
+var _scheduleLayouts = []string{
+	time.RFC3339,
+	`2006-01-02T15:04Z07:00`,
+	`2006-01-02`,
+}
+
+// Returns values with the scheduled values, given as KEY@TIME=value, removed,
+// and those whose time has passed at now set as the value of their key, the
+// latest one winning. Also returns, by key, the time the next scheduled value
+// becomes active.
+func applySchedule(values Map, now time.Time) (Map, map[string]time.Time, error) {
+	out := make(Map, len(values))
+	active := map[string]time.Time{}
+	next := map[string]time.Time{}
+
+	for k, v := range values {
+		i := strings.LastIndexByte(k, '@')
+		if i < 0 {
+			if _, ok := active[k]; !ok {
+				out[k] = v
+			}
+			continue
+		}
+
+		key := k[:i]
+		t, err := parseActivationTime(k[i+1:])
+		if err != nil {
+			return nil, nil, fmt.Errorf("invalid activation time of key %s", k)
+		}
+
+		if t.After(now) {
+			if n, ok := next[key]; !ok || t.Before(n) {
+				next[key] = t
+			}
+			continue
+		}
+
+		if a, ok := active[key]; !ok || t.After(a) {
+			active[key] = t
+			out[key] = v
+		}
+	}
+
+	return out, next, nil
+}
+
+func parseActivationTime(s string) (time.Time, error) {
+	var err error
+	for _, layout := range _scheduleLayouts {
+		var t time.Time
+		if t, err = time.Parse(layout, s); err == nil {
+			return t, nil
+		}
+	}
+
+	return time.Time{}, err
+}
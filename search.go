@@ -0,0 +1,107 @@
+package readconf
+
+import (
+	"path"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// KeyInfo describes a configuration key found by Search.
+type KeyInfo struct {
+	Key   string `json:"key"`
+	Value string `json:"value,omitempty"`
+	// Origin tells where the value came from, for keys of the target.
+	Origin Origin `json:"origin,omitempty"`
+	// Doc describes the field of the key, for keys of the target.
+	Doc *FieldDoc `json:"doc,omitempty"`
+}
+
+// Search returns the keys matching pattern, sorted. A pattern enclosed in
+// slashes, e.g. /^DB__/, is a regular expression; other patterns are globs as
+// matched by path.Match, e.g. DB__*, or, without wildcards, substrings of keys.
+// Patterns are matched regardless of case.
+func (m Map) Search(pattern string) ([]KeyInfo, error) {
+	match, err := compileSearch(pattern)
+	if err != nil {
+		return nil, err
+	}
+
+	infos := []KeyInfo{}
+	for key, value := range m {
+		if match(key) {
+			infos = append(infos, KeyInfo{Key: key, Value: value})
+		}
+	}
+
+	sort.Slice(infos, func(i, j int) bool {
+		return infos[i].Key < infos[j].Key
+	})
+
+	return infos, nil
+}
+
+// Search returns the keys of the target and other merged keys matching
+// pattern, as matched by Map.Search, with their origins and field docs.
+func (r *Report) Search(pattern string) ([]KeyInfo, error) {
+	match, err := compileSearch(pattern)
+	if err != nil {
+		return nil, err
+	}
+
+	keys := make(map[string]struct{}, len(r.Keys)+len(r.Values))
+	for _, key := range r.Keys {
+		keys[key] = struct{}{}
+	}
+	for key := range r.Values {
+		keys[key] = struct{}{}
+	}
+
+	infos := []KeyInfo{}
+	for key := range keys {
+		if !match(key) {
+			continue
+		}
+
+		info := KeyInfo{Key: key, Value: r.Values[key], Origin: r.Origins[key]}
+		if doc, ok := r.Docs[key]; ok {
+			info.Doc = &doc
+		}
+
+		infos = append(infos, info)
+	}
+
+	sort.Slice(infos, func(i, j int) bool {
+		return infos[i].Key < infos[j].Key
+	})
+
+	return infos, nil
+}
+
+func compileSearch(pattern string) (func(key string) bool, error) {
+	if len(pattern) >= 2 && strings.HasPrefix(pattern, `/`) && strings.HasSuffix(pattern, `/`) {
+		re, err := regexp.Compile(`(?i)` + pattern[1:len(pattern)-1])
+		if err != nil {
+			return nil, wrapError(err, "invalid search pattern")
+		}
+
+		return re.MatchString, nil
+	}
+
+	pattern = normalizeKey(pattern)
+
+	if !strings.ContainsAny(pattern, `*?[\`) {
+		return func(key string) bool {
+			return strings.Contains(key, pattern)
+		}, nil
+	}
+
+	if _, err := path.Match(pattern, ``); err != nil {
+		return nil, wrapError(err, "invalid search pattern")
+	}
+
+	return func(key string) bool {
+		ok, _ := path.Match(pattern, key)
+		return ok
+	}, nil
+}
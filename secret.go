@@ -0,0 +1,197 @@
+package readconf
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"fmt"
+	"io"
+	"reflect"
+	"strconv"
+	"sync"
+)
+
+var (
+	// key of the in-memory encryption of secrets, generated per process
+	_secretAEAD     cipher.AEAD
+	_secretAEADErr  error
+	_secretAEADOnce sync.Once
+)
+
+func secretAEAD() (cipher.AEAD, error) {
+	_secretAEADOnce.Do(func() {
+		key := make([]byte, 32)
+		if _, err := io.ReadFull(rand.Reader, key); err != nil {
+			_secretAEADErr = wrapError(err, "generate secret key")
+			return
+		}
+
+		block, err := aes.NewCipher(key)
+		if err != nil {
+			_secretAEADErr = err
+			return
+		}
+
+		_secretAEAD, _secretAEADErr = cipher.NewGCM(block)
+	})
+
+	return _secretAEAD, _secretAEADErr
+}
+
+// Secret holds a configuration value encrypted in memory, with a key that is
+// generated per process, so that it doesn't show up in plain text in memory
+// dumps or logs. The value is only decrypted when it is used. Note that the
+// plain text is still held by the builder and the build report, so references
+// to those shouldn't be kept.
+type Secret struct {
+	sealed []byte
+}
+
+// NewSecret returns a Secret holding value.
+func NewSecret(value []byte) (Secret, error) {
+	aead, err := secretAEAD()
+	if err != nil {
+		return Secret{}, err
+	}
+
+	nonce := make([]byte, aead.NonceSize(), aead.NonceSize()+len(value)+aead.Overhead())
+	if _, err := io.ReadFull(rand.Reader, nonce); err != nil {
+		return Secret{}, wrapError(err, "generate nonce")
+	}
+
+	return Secret{sealed: aead.Seal(nonce, nonce, value, nil)}, nil
+}
+
+// Use calls f with the decrypted value, which is wiped when f returns. f must
+// not keep a reference to it.
+func (s Secret) Use(f func(value []byte)) error {
+	if len(s.sealed) == 0 {
+		f(nil)
+		return nil
+	}
+
+	aead, err := secretAEAD()
+	if err != nil {
+		return err
+	}
+
+	n := aead.NonceSize()
+	value, err := aead.Open(nil, s.sealed[:n], s.sealed[n:], nil)
+	if err != nil {
+		return wrapError(err, "decrypt secret")
+	}
+
+	defer func() {
+		for i := range value {
+			value[i] = 0
+		}
+	}()
+
+	f(value)
+	return nil
+}
+
+// Reveal returns the decrypted value as a string, which can't be wiped.
+func (s Secret) Reveal() (string, error) {
+	var value string
+	err := s.Use(func(b []byte) {
+		value = string(b)
+	})
+
+	return value, err
+}
+
+// IsZero returns true if the secret holds no value.
+func (s Secret) IsZero() bool {
+	return len(s.sealed) == 0
+}
+
+// String returns a placeholder, never the value.
+func (s Secret) String() string {
+	return `[secret]`
+}
+
+// GoString returns a placeholder, never the value.
+func (s Secret) GoString() string {
+	return `readconf.Secret{[secret]}`
+}
+
+// Format formats a placeholder, never the value.
+func (s Secret) Format(f fmt.State, verb rune) {
+	if verb == 'v' && f.Flag('#') {
+		io.WriteString(f, s.GoString())
+		return
+	}
+
+	io.WriteString(f, s.String())
+}
+
+// Zeroize wipes the secret fields of target, those of type Secret and those
+// tagged secret:"true". The contents of []byte fields and of secrets are
+// overwritten with zeros. Go strings are immutable and may share memory with
+// other strings, so string fields are only cleared; keep values that must be
+// wiped in []byte or Secret fields.
+func Zeroize(target interface{}) error {
+	return zeroize(target, defaultKeyStrategy{})
+}
+
+// Zeroize is like the Zeroize function, but finds the fields of target with
+// the key strategy of b, like Build does.
+func (b *Builder) Zeroize(target interface{}) error {
+	return zeroize(target, b.keyStrategy())
+}
+
+func zeroize(target interface{}, keys KeyStrategy) error {
+	if err := validateIsPointerToStruct(target); err != nil {
+		return err
+	}
+
+	fields, err := configFields(target, false, keys)
+	if err != nil {
+		return err
+	}
+
+	for key, field := range fields {
+		v := field.value
+		if v.Kind() == reflect.Ptr {
+			if v.IsNil() {
+				continue
+			}
+
+			v = v.Elem()
+		}
+
+		if s, ok := v.Addr().Interface().(*Secret); ok {
+			s.wipe()
+			continue
+		}
+
+		if secret, _ := strconv.ParseBool(field.field.Tag.Get(_secretTag)); !secret {
+			continue
+		}
+
+		switch {
+		case v.Kind() == reflect.String:
+			v.SetString(``)
+		case v.Kind() == reflect.Slice && v.Type().Elem().Kind() == reflect.Uint8:
+			b := v.Bytes()
+			for i := range b {
+				b[i] = 0
+			}
+
+			v.SetBytes(nil)
+		default:
+			return fmt.Errorf("configuration key \"%s\": can't zeroize %s", key, v.Type())
+		}
+	}
+
+	return nil
+}
+
+func (s *Secret) wipe() {
+	for i := range s.sealed {
+		s.sealed[i] = 0
+	}
+
+	s.sealed = nil
+}
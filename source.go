@@ -0,0 +1,357 @@
+package readconf
+
+import (
+	"context"
+	"crypto/sha256"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// Source provides configuration values, e.g. from a file, a database or a
+// remote service. Sources may implement fmt.Stringer to name themselves in
+// errors and reports.
+type Source interface {
+	Load(ctx context.Context) (Map, error)
+}
+
+// VersionedSource is a Source that tells the version of the values it loaded,
+// e.g. a hash of a file or the version of a parameter in a store. Versions are
+// recorded in lockfiles and debug bundles.
+type VersionedSource interface {
+	Source
+	LoadVersion(ctx context.Context) (Map, string, error)
+}
+
+// SourceFunc adapts a function to the Source interface.
+type SourceFunc func(ctx context.Context) (Map, error)
+
+func (f SourceFunc) Load(ctx context.Context) (Map, error) {
+	return f(ctx)
+}
+
+// MergeSource loads sources in order and merges their values. If sources fail,
+// the others are still merged, and Build fails with SourceErrors.
+func (b *Builder) MergeSource(sources ...Source) *Builder {
+	return b.MergeSourceContext(context.Background(), sources...)
+}
+
+// MergeSourceContext is like MergeSource, but passes ctx to the sources.
+func (b *Builder) MergeSourceContext(ctx context.Context, sources ...Source) *Builder {
+	for _, source := range sources {
+		if b.hasError() {
+			return b
+		}
+
+		start := time.Now()
+
+		var m Map
+		var version string
+		var err error
+
+		var files []string
+		var expires map[string]time.Time
+		sourceCtx := context.WithValue(ctx, filesKey{}, &files)
+		sourceCtx = context.WithValue(sourceCtx, expiresKey{}, &expires)
+		sourceCtx = context.WithValue(sourceCtx, keyStrategyKey{}, b.keyStrategy())
+		m, version, err = loadSource(sourceCtx, source)
+
+		b.files = append(b.files, files...)
+
+		if err != nil {
+			b.addSourceError(sourceName(source), err)
+			continue
+		}
+
+		b.MergeMap(m)
+		b.timeSource(sourceName(source), version, len(m), start)
+
+		for key, t := range expires {
+			b.Expire(t, key)
+		}
+	}
+
+	return b
+}
+
+// Loads source, and its version if it is a VersionedSource.
+func loadSource(ctx context.Context, source Source) (Map, string, error) {
+	if vs, ok := source.(VersionedSource); ok {
+		return vs.LoadVersion(ctx)
+	}
+
+	m, err := source.Load(ctx)
+	return m, ``, err
+}
+
+// key of the context value of sources recording the files they read
+type filesKey struct{}
+
+// Records that a source read, or tried to read, the local file or directory
+// path, see Report.Files.
+func recordFile(ctx context.Context, path string) {
+	if files, ok := ctx.Value(filesKey{}).(*[]string); ok {
+		*files = append(*files, path)
+	}
+}
+
+// key of the context value of sources recording when their values expire
+type expiresKey struct{}
+
+// Records that the value of key loaded by a source expires at t, like
+// Builder.Expire.
+func recordExpiry(ctx context.Context, key string, t time.Time) {
+	if expires, ok := ctx.Value(expiresKey{}).(*map[string]time.Time); ok {
+		if *expires == nil {
+			*expires = map[string]time.Time{}
+		}
+
+		(*expires)[key] = t
+	}
+}
+
+func sourceName(source Source) string {
+	if s, ok := source.(fmt.Stringer); ok {
+		return s.String()
+	}
+
+	return fmt.Sprintf("%T", source)
+}
+
+// FileSource returns a Source reading a file of KEY=value lines. A line
+// "@include PATH" merges the file at PATH, relative to the including file, at
+// that point, so that later lines override its values.
+func FileSource(filename string) Source {
+	return fileSource{filename: filename, parse: func(data []byte) Source {
+		return includeSource{data: data, filename: filename}
+	}}
+}
+
+// Reads a file and parses it with the source returned by parse, which must
+// not keep the data.
+type fileSource struct {
+	filename string
+	// format of the file, empty for KEY=value lines
+	format string
+	parse  func(data []byte) Source
+}
+
+func (s fileSource) Load(ctx context.Context) (Map, error) {
+	m, _, err := s.LoadVersion(ctx)
+	return m, err
+}
+
+// LoadVersion returns the SHA-256 hash of the file as its version, and of the
+// files it includes, if any.
+func (s fileSource) LoadVersion(ctx context.Context) (Map, string, error) {
+	recordFile(ctx, s.filename)
+
+	f, err := os.Open(s.filename)
+	if err != nil {
+		return nil, ``, err
+	}
+	defer f.Close()
+
+	buf := getBuffer()
+	defer putBuffer(buf)
+
+	if _, err := buf.ReadFrom(f); err != nil {
+		return nil, ``, err
+	}
+
+	h := sha256.New()
+	h.Write(buf.Bytes())
+
+	m, err := s.parse(buf.Bytes()).Load(context.WithValue(ctx, includeHashKey{}, h))
+	if err != nil {
+		return nil, ``, err
+	}
+
+	return m, fmt.Sprintf("sha256:%x", h.Sum(nil)), nil
+}
+
+// Returns the format of a file by its extension, and the source parsing it:
+// .json, .toml and .ini files and those of registered formats are parsed in
+// their formats, other files as KEY=value lines.
+func formatByExtension(filename string) (string, func(data []byte) Source) {
+	ext := strings.ToLower(filepath.Ext(filename))
+	if f, ok := lookupFormatByExtension(ext); ok {
+		return f.Name, f.Parse
+	}
+
+	switch ext {
+	case `.json`:
+		return `json`, JSONSource
+	case `.toml`:
+		return `toml`, TOMLSource
+	case `.ini`:
+		return `ini`, INISource
+	default:
+		return ``, DataSource
+	}
+}
+
+func (s fileSource) String() string {
+	if s.format == `` {
+		return `file ` + s.filename
+	}
+
+	return s.format + ` file ` + s.filename
+}
+
+// ReaderSource returns a Source reading r to its end and parsing the data with
+// the source returned by parse, e.g. DataSource or JSONSource, which must not
+// keep the data. The source can be loaded once.
+func ReaderSource(r io.Reader, parse func(data []byte) Source) Source {
+	return readerSource{r: r, parse: parse}
+}
+
+type readerSource struct {
+	r     io.Reader
+	parse func(data []byte) Source
+}
+
+func (s readerSource) Load(ctx context.Context) (Map, error) {
+	m, _, err := s.LoadVersion(ctx)
+	return m, err
+}
+
+// LoadVersion returns the SHA-256 hash of the data as its version.
+func (s readerSource) LoadVersion(ctx context.Context) (Map, string, error) {
+	buf := getBuffer()
+	defer putBuffer(buf)
+
+	if _, err := buf.ReadFrom(s.r); err != nil {
+		return nil, ``, err
+	}
+
+	m, err := s.parse(buf.Bytes()).Load(ctx)
+	if err != nil {
+		return nil, ``, err
+	}
+
+	return m, fmt.Sprintf("sha256:%x", sha256.Sum256(buf.Bytes())), nil
+}
+
+func (s readerSource) String() string {
+	return sourceName(s.parse(nil)) + ` reader`
+}
+
+// DataSource returns a Source parsing data as KEY=value lines.
+func DataSource(data []byte) Source {
+	return dataSource(data)
+}
+
+type dataSource []byte
+
+func (s dataSource) Load(ctx context.Context) (Map, error) {
+	m, err := ParseData(s)
+	if err != nil {
+		return nil, err
+	}
+
+	return m.Map(), nil
+}
+
+func (s dataSource) String() string {
+	return `data`
+}
+
+// EnvironSource returns a Source taking the variables of env, as returned by
+// os.Environ, that start with prefix, without the prefix.
+func EnvironSource(prefix string, env []string) Source {
+	return environSource{prefix: prefix, env: env}
+}
+
+type environSource struct {
+	prefix string
+	env    []string
+}
+
+func (s environSource) Load(ctx context.Context) (Map, error) {
+	m := make(Map)
+
+	for _, x := range s.env {
+		kvp := strings.SplitN(x, "=", 2)
+		key := kvp[0]
+
+		if !strings.HasPrefix(key, s.prefix) {
+			continue
+		}
+
+		key = strings.TrimPrefix(key, s.prefix)
+
+		if len(kvp) == 1 {
+			m[key] = ""
+		} else {
+			m[key] = kvp[1]
+		}
+	}
+
+	return m, nil
+}
+
+func (s environSource) String() string {
+	return `environment ` + s.prefix
+}
+
+// SourceError is the error of a source that failed to merge.
+type SourceError struct {
+	// Source names the source, e.g. file config.env.
+	Source string
+	Err    error
+}
+
+func (e *SourceError) Error() string {
+	return e.Source + `: ` + e.Err.Error()
+}
+
+// Unwrap returns the error of the source.
+func (e *SourceError) Unwrap() error {
+	return e.Err
+}
+
+// SourceErrors is returned by Build when sources failed to merge, in the order
+// they were merged.
+type SourceErrors []*SourceError
+
+func (e SourceErrors) Error() string {
+	if len(e) == 1 {
+		return e[0].Error()
+	}
+
+	msgs := make([]string, len(e))
+	for i := range e {
+		msgs[i] = e[i].Error()
+	}
+
+	return fmt.Sprintf("%d sources failed: %s", len(e), strings.Join(msgs, `; `))
+}
+
+// Unwrap returns the error of the source if only one source failed, so that
+// e.g. errors.Is(err, os.ErrNotExist) tells whether a file was missing.
+func (e SourceErrors) Unwrap() error {
+	if len(e) != 1 {
+		return nil
+	}
+
+	return e[0]
+}
+
+// Is returns true if the error of any of the sources is target.
+func (e SourceErrors) Is(target error) bool {
+	for _, se := range e {
+		if errorIs(se, target) {
+			return true
+		}
+	}
+
+	return false
+}
+
+func (b *Builder) addSourceError(source string, err error) {
+	b.sourceErrs = append(b.sourceErrs, &SourceError{Source: source, Err: err})
+}
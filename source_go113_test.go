@@ -0,0 +1,32 @@
+//go:build go1.13
+// +build go1.13
+
+package readconf_test
+
+import (
+	"errors"
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/tetratom/readconf"
+)
+
+func TestSourceErrors_Is(t *testing.T) {
+	var conf struct {
+		Name string
+	}
+
+	err := b().MergeSource(readconf.FileSource(`testdata/does-not-exist`)).Build(&conf)
+	require.True(t, errors.Is(err, os.ErrNotExist))
+
+	err = b().
+		MergeData([]byte("=80")).
+		MergeFile(`testdata/does-not-exist`).
+		Build(&conf)
+	require.True(t, errors.Is(err, os.ErrNotExist))
+
+	err = b().MergeData([]byte("=80")).Build(&conf)
+	require.False(t, errors.Is(err, os.ErrNotExist))
+}
@@ -0,0 +1,70 @@
+package readconf
+
+// Returns the closest of candidates to each of keys, for keys that have one
+// within the distance of a typo or two.
+func suggestKeys(keys []string, candidates []string) map[string]string {
+	suggestions := map[string]string{}
+
+	for _, key := range keys {
+		best, bestDist := ``, maxSuggestDistance(key)+1
+
+		for _, c := range candidates {
+			if d := editDistance(key, c); d < bestDist || (d == bestDist && best != `` && c < best) {
+				best, bestDist = c, d
+			}
+		}
+
+		if best != `` {
+			suggestions[key] = best
+		}
+	}
+
+	return suggestions
+}
+
+func maxSuggestDistance(key string) int {
+	if d := len(key) / 4; d < 2 {
+		return d
+	}
+
+	return 2
+}
+
+// Returns the Levenshtein distance of a and b.
+func editDistance(a, b string) int {
+	prev := make([]int, len(b)+1)
+	curr := make([]int, len(b)+1)
+
+	for j := range prev {
+		prev[j] = j
+	}
+
+	for i := 1; i <= len(a); i++ {
+		curr[0] = i
+
+		for j := 1; j <= len(b); j++ {
+			cost := 1
+			if a[i-1] == b[j-1] {
+				cost = 0
+			}
+
+			curr[j] = min3(prev[j]+1, curr[j-1]+1, prev[j-1]+cost)
+		}
+
+		prev, curr = curr, prev
+	}
+
+	return prev[len(b)]
+}
+
+func min3(a, b, c int) int {
+	if b < a {
+		a = b
+	}
+
+	if c < a {
+		a = c
+	}
+
+	return a
+}
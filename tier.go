@@ -0,0 +1,125 @@
+package readconf
+
+import (
+	"sort"
+	"time"
+)
+
+// Optional merges the sources added by f, skipping those that don't exist,
+// such as files that aren't there, while the others are still merged. Files
+// are also skipped on platforms without file access, such as browsers with
+// GOOS=js, so that App works there with sources added by Configure. Other
+// failures fail the build.
+func (b *Builder) Optional(f func(b *Builder)) *Builder {
+	return b.mergeTier(f, true, func(err error) bool {
+		if se, ok := err.(*SourceError); ok {
+			err = se.Err
+		}
+
+		return isNotExist(err) || isNoFileAccess(err)
+	})
+}
+
+// BestEffort merges the sources added by f. If any of them fail, the failures
+// are reported as warnings and the build continues without them.
+func (b *Builder) BestEffort(f func(b *Builder)) *Builder {
+	return b.mergeTier(f, false, func(err error) bool {
+		b.warnings = append(b.warnings, err)
+		return true
+	})
+}
+
+// Merges the builder prepared by f, ignoring the errors for which ignore
+// returns true. If partial is false, nothing is merged if any source failed.
+func (b *Builder) mergeTier(f func(b *Builder), partial bool, ignore func(err error) bool) *Builder {
+	if b.hasError() {
+		return b
+	}
+
+	child := NewBuilder()
+	f(child)
+
+	// files that are skipped are watched too, for when they are created
+	b.files = append(b.files, child.files...)
+	child.files = nil
+
+	if child.hasError() {
+		if !ignore(child.err) {
+			b.err = child.err
+		}
+
+		return b
+	}
+
+	failed := false
+	for _, err := range child.sourceErrs {
+		if !ignore(err) {
+			b.sourceErrs = append(b.sourceErrs, err)
+		}
+
+		failed = true
+	}
+
+	if failed && !partial {
+		return b
+	}
+
+	child.sourceErrs = nil
+	return b.MergeBuilder(child)
+}
+
+type override struct {
+	ttl time.Duration
+	f   func(b *Builder)
+}
+
+// Override registers an override source for emergency toggles, such as kill
+// switches. The sources added by f are merged on every build rather than once,
+// and their values take precedence over those of all other sources regardless
+// of the order they were merged in. Their origin is reported as
+// OriginOverride, and they are reported as expiring after ttl so that
+// reloading configurations poll them. If the sources fail, the failure is
+// reported as a warning and the build continues without them. Either way, the
+// sources are polled again after ttl, see Report.Refresh.
+func (b *Builder) Override(ttl time.Duration, f func(b *Builder)) *Builder {
+	if b.hasError() {
+		return b
+	}
+
+	b.overrides = append(b.overrides, override{ttl: ttl, f: f})
+	return b
+}
+
+func (b *Builder) applyOverrides(values Map, report *Report) {
+	keys := b.keyStrategy()
+
+	for _, o := range b.overrides {
+		// sources that give no values or fail are polled again too
+		expires := time.Now().Add(o.ttl)
+		if report.Refresh.IsZero() || expires.Before(report.Refresh) {
+			report.Refresh = expires
+		}
+
+		child := NewBuilder()
+		o.f(child)
+
+		if err := child.Error(); err != nil {
+			report.Warnings = append(report.Warnings, wrapError(err, "override").Error())
+			continue
+		}
+
+		for k, v := range child.values {
+			key := normalizeKey(keys.Normalize(k))
+			values.Set(key, v)
+
+			if i := sort.SearchStrings(report.Keys, key); i < len(report.Keys) && report.Keys[i] == key {
+				report.Origins[key] = OriginOverride
+			}
+
+			report.Expires[key] = expires
+			if t, ok := child.expires[normalizeKey(k)]; ok && t.Before(expires) {
+				report.Expires[key] = t
+			}
+		}
+	}
+}
@@ -0,0 +1,235 @@
+// Package tinyconf builds configurations without reflection, for TinyGo and
+// firmware projects where the readconf package is too large or doesn't
+// compile. It depends on the standard library only.
+//
+// Targets list their fields and keys with ConfigFields. The method may be
+// written by hand, or generated from a struct tagged for readconf with the gen
+// command of cmd/readconf, so that the same struct can be built by readconf on
+// servers:
+//
+//	//go:generate readconf gen -o config_fields.go config.go Config
+//
+// Keys are derived like readconf derives them, and default and config tags,
+// including the optional option, are honored. Other tags, such as validate,
+// are not.
+package tinyconf
+
+import (
+	"errors"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Field binds a configuration key to a field of a target.
+type Field struct {
+	Key string
+	// Value points to the field. Supported are pointers to strings, bools,
+	// integers, floats, time.Duration and []string, which is given as a comma
+	// separated list, and Unmarshalers.
+	Value interface{}
+	// Default holds the default value of the key, if HasDefault is true.
+	Default    string
+	HasDefault bool
+	// Optional fields may have no value; they are left as they are.
+	Optional bool
+}
+
+// Target is a configuration that lists its fields.
+type Target interface {
+	ConfigFields() []Field
+}
+
+// Unmarshaler is implemented by types that decode their values themselves,
+// like readconf.Unmarshaler.
+type Unmarshaler interface {
+	UnmarshalConfig(s string) error
+}
+
+// Build unmarshals values into the fields of target. Keys are matched case
+// insensitively, and keys of fields without values and without defaults fail
+// the build unless the fields are optional.
+func Build(target Target, values map[string]string) error {
+	normalized := make(map[string]string, len(values))
+	for k, v := range values {
+		normalized[normalizeKey(k)] = v
+	}
+
+	fields := target.ConfigFields()
+
+	var missing []string
+	for _, f := range fields {
+		if _, ok := normalized[normalizeKey(f.Key)]; !ok && !f.HasDefault && !f.Optional {
+			missing = append(missing, normalizeKey(f.Key))
+		}
+	}
+
+	if len(missing) > 0 {
+		sort.Strings(missing)
+
+		plural := ``
+		if len(missing) > 1 {
+			plural = `s`
+		}
+
+		return errors.New(`missing ` + strconv.Itoa(len(missing)) + ` configuration key` + plural + `: ` + strings.Join(missing, `, `))
+	}
+
+	for _, f := range fields {
+		value, ok := normalized[normalizeKey(f.Key)]
+		if !ok {
+			if !f.HasDefault {
+				continue
+			}
+
+			value = f.Default
+		}
+
+		if err := unmarshal(value, f.Value); err != nil {
+			return errors.New(`unmarshal value: configuration key "` + normalizeKey(f.Key) + `": ` + err.Error())
+		}
+	}
+
+	return nil
+}
+
+func unmarshal(s string, v interface{}) error {
+	var err error
+
+	switch v := v.(type) {
+	case Unmarshaler:
+		return v.UnmarshalConfig(s)
+	case *string:
+		*v = s
+	case *bool:
+		*v, err = strconv.ParseBool(s)
+	case *int:
+		var i int64
+		i, err = strconv.ParseInt(s, 0, strconv.IntSize)
+		*v = int(i)
+	case *int8:
+		var i int64
+		i, err = strconv.ParseInt(s, 0, 8)
+		*v = int8(i)
+	case *int16:
+		var i int64
+		i, err = strconv.ParseInt(s, 0, 16)
+		*v = int16(i)
+	case *int32:
+		var i int64
+		i, err = strconv.ParseInt(s, 0, 32)
+		*v = int32(i)
+	case *int64:
+		*v, err = strconv.ParseInt(s, 0, 64)
+	case *uint:
+		var u uint64
+		u, err = strconv.ParseUint(s, 0, strconv.IntSize)
+		*v = uint(u)
+	case *uint8:
+		var u uint64
+		u, err = strconv.ParseUint(s, 0, 8)
+		*v = uint8(u)
+	case *uint16:
+		var u uint64
+		u, err = strconv.ParseUint(s, 0, 16)
+		*v = uint16(u)
+	case *uint32:
+		var u uint64
+		u, err = strconv.ParseUint(s, 0, 32)
+		*v = uint32(u)
+	case *uint64:
+		*v, err = strconv.ParseUint(s, 0, 64)
+	case *float32:
+		var f float64
+		f, err = strconv.ParseFloat(s, 32)
+		*v = float32(f)
+	case *float64:
+		*v, err = strconv.ParseFloat(s, 64)
+	case *time.Duration:
+		*v, err = time.ParseDuration(s)
+	case *[]string:
+		*v = splitList(s)
+	default:
+		return errors.New(`unsupported field`)
+	}
+
+	return err
+}
+
+func splitList(s string) []string {
+	s = strings.TrimSpace(s)
+	if s == `` {
+		return []string{}
+	}
+
+	items := strings.Split(s, `,`)
+	for i := range items {
+		items[i] = strings.TrimSpace(items[i])
+	}
+
+	return items
+}
+
+// ParseData parses KEY=value lines, like readconf.ParseData, but without
+// include directives. Empty lines and lines starting with # are skipped.
+func ParseData(data []byte) (map[string]string, error) {
+	values := map[string]string{}
+
+	for i, line := range strings.Split(string(data), "\n") {
+		line = strings.TrimSpace(line)
+		if line == `` || line[0] == '#' {
+			continue
+		}
+
+		key, value := line, ``
+		if eq := strings.IndexByte(line, '='); eq >= 0 {
+			key, value = line[:eq], line[eq+1:]
+		}
+
+		key = strings.TrimSpace(key)
+		if key == `` {
+			return nil, errors.New(`invalid empty key on line ` + strconv.Itoa(i+1))
+		}
+
+		values[normalizeKey(key)] = strings.TrimSpace(value)
+	}
+
+	return values, nil
+}
+
+// Environ returns the values of the variables of env starting with prefix,
+// keyed without the prefix, like readconf.Builder.MergeEnviron.
+func Environ(prefix string, env []string) map[string]string {
+	values := map[string]string{}
+
+	for _, kv := range env {
+		key, value := kv, ``
+		if eq := strings.IndexByte(kv, '='); eq >= 0 {
+			key, value = kv[:eq], kv[eq+1:]
+		}
+
+		if strings.HasPrefix(key, prefix) {
+			values[normalizeKey(key[len(prefix):])] = value
+		}
+	}
+
+	return values
+}
+
+// Merge returns the union of maps, where values of later maps override those
+// of earlier ones.
+func Merge(maps ...map[string]string) map[string]string {
+	values := map[string]string{}
+	for _, m := range maps {
+		for k, v := range m {
+			values[normalizeKey(k)] = v
+		}
+	}
+
+	return values
+}
+
+func normalizeKey(key string) string {
+	return strings.ToUpper(strings.TrimSpace(key))
+}
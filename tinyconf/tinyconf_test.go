@@ -0,0 +1,83 @@
+package tinyconf_test
+
+import (
+	"sort"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/tetratom/readconf"
+	"github.com/tetratom/readconf/tinyconf"
+)
+
+type config struct {
+	Name     string
+	Interval time.Duration `default:"1s"`
+	WiFi     struct {
+		SSID     string
+		Password string `config:",optional"`
+	}
+	Sensor struct {
+		Pins     []string `config:",optional"`
+		MaxCount int      `default:"10"`
+	}
+}
+
+// as generated by readconf gen
+func (c *config) ConfigFields() []tinyconf.Field {
+	return []tinyconf.Field{
+		{Key: "NAME", Value: &c.Name},
+		{Key: "INTERVAL", Value: &c.Interval, Default: "1s", HasDefault: true},
+		{Key: "WI_FI__SSID", Value: &c.WiFi.SSID},
+		{Key: "WI_FI__PASSWORD", Value: &c.WiFi.Password, Optional: true},
+		{Key: "SENSOR__PINS", Value: &c.Sensor.Pins, Optional: true},
+		{Key: "SENSOR__MAX_COUNT", Value: &c.Sensor.MaxCount, Default: "10", HasDefault: true},
+	}
+}
+
+func TestBuild(t *testing.T) {
+	values, err := tinyconf.ParseData([]byte("# device\nname=sensor-1\nWI_FI__SSID = home\n\nSENSOR__PINS=2, 3"))
+	require.NoError(t, err)
+
+	values = tinyconf.Merge(values, tinyconf.Environ(`FW_`, []string{`FW_SENSOR__MAX_COUNT=0x20`, `OTHER=1`}))
+
+	var conf config
+	require.NoError(t, tinyconf.Build(&conf, values))
+
+	expected := config{Name: `sensor-1`, Interval: time.Second}
+	expected.WiFi.SSID = `home`
+	expected.Sensor.Pins = []string{`2`, `3`}
+	expected.Sensor.MaxCount = 32
+	require.Equal(t, expected, conf)
+
+	t.Run("same as readconf", func(t *testing.T) {
+		var other config
+		require.NoError(t, readconf.NewBuilder().MergeMap(readconf.Map(values)).Build(&other))
+		require.Equal(t, conf, other)
+
+		docs, err := readconf.Describe(&config{})
+		require.NoError(t, err)
+
+		var keys, tinyKeys []string
+		for _, doc := range docs {
+			keys = append(keys, doc.Key)
+		}
+		for _, f := range (&config{}).ConfigFields() {
+			tinyKeys = append(tinyKeys, f.Key)
+		}
+		sort.Strings(tinyKeys)
+		require.Equal(t, keys, tinyKeys)
+	})
+
+	t.Run("errors", func(t *testing.T) {
+		require.EqualError(t, tinyconf.Build(&config{}, nil),
+			`missing 2 configuration keys: NAME, WI_FI__SSID`)
+
+		require.EqualError(t, tinyconf.Build(&config{}, map[string]string{`NAME`: `x`, `WI_FI__SSID`: `y`, `INTERVAL`: `soon`}),
+			`unmarshal value: configuration key "INTERVAL": time: invalid duration "soon"`)
+
+		_, err := tinyconf.ParseData([]byte("A=1\n=2"))
+		require.EqualError(t, err, `invalid empty key on line 2`)
+	})
+}
@@ -0,0 +1,650 @@
+package readconf
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+// MergeTOML merges the values of a TOML document. Keys of tables are joined by
+// the key strategy of the builder, e.g. host in [database] sets
+// DATABASE__HOST by default, and arrays are kept as JSON arrays, which slice
+// fields unmarshal. Arrays of tables become JSON arrays of objects. Offset
+// date-times are given in RFC 3339 format, as are local date-times, which are
+// taken to be in UTC; local dates and times are kept as written.
+func (b *Builder) MergeTOML(data []byte) *Builder {
+	return b.MergeSource(TOMLSource(data))
+}
+
+// MergeTOMLReader merges the values read from r, like MergeTOML.
+func (b *Builder) MergeTOMLReader(r io.Reader) *Builder {
+	return b.MergeSource(ReaderSource(r, TOMLSource))
+}
+
+// MergeTOMLFile merges the values of a TOML file, like MergeTOML.
+func (b *Builder) MergeTOMLFile(filename string) *Builder {
+	return b.MergeSource(TOMLFileSource(filename))
+}
+
+// TOMLSource returns a Source flattening the TOML document in data, like
+// MergeTOML.
+func TOMLSource(data []byte) Source {
+	return tomlSource(data)
+}
+
+type tomlSource []byte
+
+func (s tomlSource) Load(ctx context.Context) (Map, error) {
+	doc, err := parseTOML(s)
+	if err != nil {
+		return nil, err
+	}
+
+	m := Map{}
+	if err := flattenValue(``, doc, m, ContextKeyStrategy(ctx)); err != nil {
+		return nil, err
+	}
+
+	return m, nil
+}
+
+func (s tomlSource) String() string {
+	return `toml`
+}
+
+// TOMLFileSource returns a Source reading a TOML file, like MergeTOMLFile.
+func TOMLFileSource(filename string) Source {
+	return fileSource{filename: filename, format: `toml`, parse: TOMLSource}
+}
+
+// Parses a TOML document into the types decoded from JSON, which flattenValue
+// expects. Dates and times are returned as strings.
+func parseTOML(data []byte) (map[string]interface{}, error) {
+	p := &tomlParser{data: data, root: map[string]interface{}{}}
+	p.table = p.root
+
+	if err := p.parse(); err != nil {
+		return nil, fmt.Errorf("%s on line %d", err, 1+bytes.Count(data[:p.pos], []byte{'\n'}))
+	}
+
+	return p.root, nil
+}
+
+type tomlParser struct {
+	data []byte
+	pos  int
+	root map[string]interface{}
+	// table that key/value pairs are added to
+	table map[string]interface{}
+}
+
+func (p *tomlParser) parse() error {
+	for {
+		p.skipSpace(true)
+		if p.eof() {
+			return nil
+		}
+
+		var err error
+		switch {
+		case p.consume(`[[`):
+			err = p.parseArrayTable()
+		case p.consume(`[`):
+			err = p.parseTable()
+		default:
+			err = p.parseKeyValue(p.table)
+		}
+
+		if err != nil {
+			return err
+		}
+
+		if err := p.endLine(); err != nil {
+			return err
+		}
+	}
+}
+
+func (p *tomlParser) parseTable() error {
+	key, err := p.parseKey()
+	if err != nil {
+		return err
+	}
+
+	if !p.consume(`]`) {
+		return fmt.Errorf("expected ] after table name")
+	}
+
+	p.table, err = p.descend(p.root, key)
+	return err
+}
+
+func (p *tomlParser) parseArrayTable() error {
+	key, err := p.parseKey()
+	if err != nil {
+		return err
+	}
+
+	if !p.consume(`]]`) {
+		return fmt.Errorf("expected ]] after table name")
+	}
+
+	parent, err := p.descend(p.root, key[:len(key)-1])
+	if err != nil {
+		return err
+	}
+
+	name := key[len(key)-1]
+	table := map[string]interface{}{}
+
+	switch v := parent[name].(type) {
+	case nil:
+		parent[name] = []interface{}{table}
+	case []interface{}:
+		parent[name] = append(v, table)
+	default:
+		return fmt.Errorf("key %s is not an array of tables", name)
+	}
+
+	p.table = table
+	return nil
+}
+
+// Returns the table at key under table, creating missing tables. Arrays of
+// tables resolve to their last table.
+func (p *tomlParser) descend(table map[string]interface{}, key []string) (map[string]interface{}, error) {
+	for _, name := range key {
+		switch v := table[name].(type) {
+		case nil:
+			t := map[string]interface{}{}
+			table[name] = t
+			table = t
+		case map[string]interface{}:
+			table = v
+		case []interface{}:
+			var t map[string]interface{}
+			if len(v) > 0 {
+				t, _ = v[len(v)-1].(map[string]interface{})
+			}
+
+			if t == nil {
+				return nil, fmt.Errorf("key %s is not a table", name)
+			}
+
+			table = t
+		default:
+			return nil, fmt.Errorf("key %s is not a table", name)
+		}
+	}
+
+	return table, nil
+}
+
+func (p *tomlParser) parseKeyValue(table map[string]interface{}) error {
+	key, err := p.parseKey()
+	if err != nil {
+		return err
+	}
+
+	if !p.consume(`=`) {
+		return fmt.Errorf("expected = after key")
+	}
+
+	p.skipSpace(false)
+
+	value, err := p.parseValue()
+	if err != nil {
+		return err
+	}
+
+	table, err = p.descend(table, key[:len(key)-1])
+	if err != nil {
+		return err
+	}
+
+	name := key[len(key)-1]
+	if _, ok := table[name]; ok {
+		return fmt.Errorf("duplicate key %s", name)
+	}
+
+	table[name] = value
+	return nil
+}
+
+// Parses a dotted key and the whitespace following it.
+func (p *tomlParser) parseKey() ([]string, error) {
+	key := []string{}
+
+	for {
+		p.skipSpace(false)
+
+		var part string
+		var err error
+
+		switch {
+		case p.consume(`"`):
+			part, err = p.parseBasicString()
+		case p.consume(`'`):
+			part, err = p.parseLiteralString()
+		default:
+			start := p.pos
+			for !p.eof() && isBareKeyChar(p.data[p.pos]) {
+				p.pos++
+			}
+
+			part = string(p.data[start:p.pos])
+			if part == `` {
+				err = fmt.Errorf("invalid key")
+			}
+		}
+
+		if err != nil {
+			return nil, err
+		}
+
+		key = append(key, part)
+
+		p.skipSpace(false)
+		if !p.consume(`.`) {
+			return key, nil
+		}
+	}
+}
+
+func isBareKeyChar(c byte) bool {
+	return c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9' || c == '_' || c == '-'
+}
+
+func (p *tomlParser) parseValue() (interface{}, error) {
+	switch {
+	case p.consume(`"""`):
+		return p.parseMultilineString(`"""`)
+	case p.consume(`'''`):
+		return p.parseMultilineString(`'''`)
+	case p.consume(`"`):
+		return p.parseBasicString()
+	case p.consume(`'`):
+		return p.parseLiteralString()
+	case p.consume(`[`):
+		return p.parseArray()
+	case p.consume(`{`):
+		return p.parseInlineTable()
+	}
+
+	start := p.pos
+	for !p.eof() && isScalarChar(p.data[p.pos]) {
+		p.pos++
+	}
+
+	// the date and time of a date-time may be separated by a space
+	if p.pos-start == 10 && p.pos+1 < len(p.data) && p.data[p.pos] == ' ' && isDigit(p.data[p.pos+1]) {
+		p.pos++
+		for !p.eof() && isScalarChar(p.data[p.pos]) {
+			p.pos++
+		}
+	}
+
+	s := string(p.data[start:p.pos])
+	switch s {
+	case ``:
+		return nil, fmt.Errorf("expected value")
+	case `true`, `false`:
+		return s == `true`, nil
+	}
+
+	if v, ok := parseTOMLDateTime(s); ok {
+		return v, nil
+	}
+
+	if v, ok := parseTOMLNumber(s); ok {
+		return v, nil
+	}
+
+	return nil, fmt.Errorf("invalid value %s", s)
+}
+
+func isScalarChar(c byte) bool {
+	return isBareKeyChar(c) || c == '.' || c == ':' || c == '+'
+}
+
+func isDigit(c byte) bool {
+	return c >= '0' && c <= '9'
+}
+
+// Returns date-times in RFC 3339 format, and local dates and times as given.
+func parseTOMLDateTime(s string) (string, bool) {
+	if len(s) < 8 || !isDigit(s[0]) || !isDigit(s[1]) {
+		return ``, false
+	}
+
+	if s[2] == ':' {
+		_, err := time.Parse(`15:04:05.999999999`, s)
+		return s, err == nil
+	}
+
+	if len(s) == 10 {
+		_, err := time.Parse(`2006-01-02`, s)
+		return s, err == nil
+	}
+
+	if len(s) < 19 || s[4] != '-' {
+		return ``, false
+	}
+
+	s = strings.ToUpper(s[:10]) + `T` + strings.ToUpper(s[11:])
+
+	if t, err := time.Parse(time.RFC3339Nano, s); err == nil {
+		return t.Format(time.RFC3339Nano), true
+	}
+
+	if t, err := time.Parse(`2006-01-02T15:04:05.999999999`, s); err == nil {
+		return t.Format(time.RFC3339Nano), true
+	}
+
+	return ``, false
+}
+
+// Returns integers and finite floats as json.Number, and infinite floats and
+// NaN as strings that strconv parses.
+func parseTOMLNumber(s string) (interface{}, bool) {
+	switch strings.TrimLeft(s, `+-`) {
+	case `inf`, `nan`:
+		f, _ := strconv.ParseFloat(s, 64)
+		return strconv.FormatFloat(f, 'g', -1, 64), true
+	}
+
+	if strings.HasPrefix(s, `_`) || strings.HasSuffix(s, `_`) || strings.Contains(s, `__`) {
+		return nil, false
+	}
+
+	digits := strings.Replace(s, `_`, ``, -1)
+
+	if len(digits) > 2 && digits[0] == '0' {
+		base := 0
+		switch digits[1] {
+		case 'x':
+			base = 16
+		case 'o':
+			base = 8
+		case 'b':
+			base = 2
+		}
+
+		if base != 0 {
+			u, err := strconv.ParseUint(digits[2:], base, 64)
+			if err != nil {
+				return nil, false
+			}
+
+			return json.Number(strconv.FormatUint(u, 10)), true
+		}
+	}
+
+	digits = strings.TrimPrefix(digits, `+`)
+	unsigned := strings.TrimPrefix(digits, `-`)
+
+	// leading zeros aren't allowed
+	if len(unsigned) > 1 && unsigned[0] == '0' && isDigit(unsigned[1]) {
+		return nil, false
+	}
+
+	if strings.ContainsAny(digits, `.eE`) {
+		if _, err := strconv.ParseFloat(digits, 64); err != nil {
+			return nil, false
+		}
+
+		return json.Number(digits), true
+	}
+
+	if _, err := strconv.ParseInt(digits, 10, 64); err != nil {
+		return nil, false
+	}
+
+	return json.Number(digits), true
+}
+
+func (p *tomlParser) parseArray() (interface{}, error) {
+	arr := []interface{}{}
+
+	for {
+		p.skipSpace(true)
+
+		if p.consume(`]`) {
+			return arr, nil
+		}
+
+		v, err := p.parseValue()
+		if err != nil {
+			return nil, err
+		}
+
+		arr = append(arr, v)
+
+		p.skipSpace(true)
+		if p.consume(`]`) {
+			return arr, nil
+		}
+
+		if !p.consume(`,`) {
+			return nil, fmt.Errorf("expected , or ] in array")
+		}
+	}
+}
+
+func (p *tomlParser) parseInlineTable() (interface{}, error) {
+	table := map[string]interface{}{}
+
+	p.skipSpace(false)
+	if p.consume(`}`) {
+		return table, nil
+	}
+
+	for {
+		if err := p.parseKeyValue(table); err != nil {
+			return nil, err
+		}
+
+		p.skipSpace(false)
+		if p.consume(`}`) {
+			return table, nil
+		}
+
+		if !p.consume(`,`) {
+			return nil, fmt.Errorf("expected , or } in inline table")
+		}
+	}
+}
+
+// Parses a basic string after its opening quote.
+func (p *tomlParser) parseBasicString() (string, error) {
+	var sb strings.Builder
+
+	for {
+		if p.eof() || p.data[p.pos] == '\n' {
+			return ``, fmt.Errorf("unterminated string")
+		}
+
+		c := p.data[p.pos]
+		p.pos++
+
+		switch c {
+		case '"':
+			return sb.String(), nil
+		case '\\':
+			if err := p.parseEscape(&sb); err != nil {
+				return ``, err
+			}
+		default:
+			sb.WriteByte(c)
+		}
+	}
+}
+
+// Parses a literal string after its opening quote.
+func (p *tomlParser) parseLiteralString() (string, error) {
+	start := p.pos
+
+	for !p.eof() && p.data[p.pos] != '\'' {
+		if p.data[p.pos] == '\n' {
+			return ``, fmt.Errorf("unterminated string")
+		}
+
+		p.pos++
+	}
+
+	if p.eof() {
+		return ``, fmt.Errorf("unterminated string")
+	}
+
+	s := string(p.data[start:p.pos])
+	p.pos++
+	return s, nil
+}
+
+// Parses a multi-line basic or literal string after its opening delimiter.
+func (p *tomlParser) parseMultilineString(delim string) (string, error) {
+	var sb strings.Builder
+
+	// a newline right after the delimiter is trimmed
+	if !p.consume("\r\n") {
+		p.consume("\n")
+	}
+
+	for {
+		if p.eof() {
+			return ``, fmt.Errorf("unterminated string")
+		}
+
+		if p.consume(delim) {
+			// up to two quotes may precede the closing delimiter
+			for i := 0; i < 2 && p.consume(delim[:1]); i++ {
+				sb.WriteByte(delim[0])
+			}
+
+			return sb.String(), nil
+		}
+
+		c := p.data[p.pos]
+		p.pos++
+
+		if c != '\\' || delim == `'''` {
+			sb.WriteByte(c)
+			continue
+		}
+
+		// a backslash at the end of a line trims the following whitespace
+		rest := p.pos
+		for rest < len(p.data) && (p.data[rest] == ' ' || p.data[rest] == '\t' || p.data[rest] == '\r') {
+			rest++
+		}
+
+		if rest < len(p.data) && p.data[rest] == '\n' {
+			p.pos = rest
+			p.skipSpace(true)
+			continue
+		}
+
+		if err := p.parseEscape(&sb); err != nil {
+			return ``, err
+		}
+	}
+}
+
+// Parses an escape sequence after its backslash.
+func (p *tomlParser) parseEscape(sb *strings.Builder) error {
+	if p.eof() {
+		return fmt.Errorf("unterminated string")
+	}
+
+	c := p.data[p.pos]
+	p.pos++
+
+	switch c {
+	case 'b':
+		sb.WriteByte('\b')
+	case 't':
+		sb.WriteByte('\t')
+	case 'n':
+		sb.WriteByte('\n')
+	case 'f':
+		sb.WriteByte('\f')
+	case 'r':
+		sb.WriteByte('\r')
+	case 'e':
+		sb.WriteByte('\x1b')
+	case '"', '\\':
+		sb.WriteByte(c)
+	case 'u', 'U':
+		n := 4
+		if c == 'U' {
+			n = 8
+		}
+
+		if p.pos+n > len(p.data) {
+			return fmt.Errorf("invalid escape sequence")
+		}
+
+		r, err := strconv.ParseUint(string(p.data[p.pos:p.pos+n]), 16, 32)
+		if err != nil || !utf8.ValidRune(rune(r)) {
+			return fmt.Errorf("invalid escape sequence")
+		}
+
+		p.pos += n
+		sb.WriteRune(rune(r))
+	default:
+		return fmt.Errorf("invalid escape sequence \\%c", c)
+	}
+
+	return nil
+}
+
+// Skips spaces, tabs and comments, and newlines if newlines is true.
+func (p *tomlParser) skipSpace(newlines bool) {
+	for !p.eof() {
+		switch p.data[p.pos] {
+		case ' ', '\t':
+			p.pos++
+		case '\r', '\n':
+			if !newlines {
+				return
+			}
+
+			p.pos++
+		case '#':
+			for !p.eof() && p.data[p.pos] != '\n' {
+				p.pos++
+			}
+		default:
+			return
+		}
+	}
+}
+
+// Expects the end of a line, after optional whitespace and a comment.
+func (p *tomlParser) endLine() error {
+	p.skipSpace(false)
+	if p.eof() || p.consume("\n") || p.consume("\r\n") {
+		return nil
+	}
+
+	return fmt.Errorf("expected end of line")
+}
+
+func (p *tomlParser) consume(s string) bool {
+	if bytes.HasPrefix(p.data[p.pos:], []byte(s)) {
+		p.pos += len(s)
+		return true
+	}
+
+	return false
+}
+
+func (p *tomlParser) eof() bool {
+	return p.pos >= len(p.data)
+}
@@ -9,6 +9,21 @@ type DefaultConfig interface {
 	DefaultConfig() Map
 }
 
+// Validator validates a built configuration struct. To report the fields that
+// failed, validators return a *ValidationError keyed by the paths of the
+// fields below the struct, their names joined by dots, e.g. DB.MaxConns, which
+// Build replaces with their configuration keys.
+type Validator interface {
+	Struct(s interface{}) error
+}
+
+// ValidatorFunc adapts a function to the Validator interface.
+type ValidatorFunc func(s interface{}) error
+
+func (f ValidatorFunc) Struct(s interface{}) error {
+	return f(s)
+}
+
 type Unmarshaler interface {
 	UnmarshalConfig(s string) error
 }
@@ -17,6 +32,7 @@ var (
 	_defaultConfigType   = reflect.TypeOf(new(DefaultConfig)).Elem()
 	_unmarshalerType     = reflect.TypeOf(new(Unmarshaler)).Elem()
 	_textUnmarshalerType = reflect.TypeOf(new(encoding.TextUnmarshaler)).Elem()
+	_textMarshalerType   = reflect.TypeOf(new(encoding.TextMarshaler)).Elem()
 )
 
 type InspectorStage int
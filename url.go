@@ -0,0 +1,225 @@
+package readconf
+
+import (
+	"context"
+	"crypto/sha256"
+	"crypto/tls"
+	"fmt"
+	"mime"
+	"net/http"
+	"net/url"
+	"path"
+	"strings"
+	"time"
+)
+
+// URLOption configures MergeURL and URLSource.
+type URLOption func(o *urlOptions)
+
+// WithHeader adds a header to requests, e.g. for authorization.
+func WithHeader(key, value string) URLOption {
+	return func(o *urlOptions) {
+		o.header.Add(key, value)
+	}
+}
+
+// WithTimeout sets the timeout of requests, 30 seconds by default.
+func WithTimeout(d time.Duration) URLOption {
+	return func(o *urlOptions) {
+		o.timeout = d
+	}
+}
+
+// WithTLSConfig sets the TLS configuration of requests, e.g. to trust an
+// internal certificate authority or to present a client certificate.
+func WithTLSConfig(config *tls.Config) URLOption {
+	return func(o *urlOptions) {
+		o.tls = config
+	}
+}
+
+// WithHTTPClient sets the client making requests, which replaces the timeout
+// and TLS configuration.
+func WithHTTPClient(client *http.Client) URLOption {
+	return func(o *urlOptions) {
+		o.client = client
+	}
+}
+
+// WithChecksum pins the content fetched by MergeURL to a checksum, given as
+// sha256: followed by the hex encoded SHA-256 hash, e.g. as printed by
+// sha256sum. The source fails if the content doesn't match.
+func WithChecksum(checksum string) URLOption {
+	return func(o *urlOptions) {
+		o.checksum = checksum
+	}
+}
+
+type urlOptions struct {
+	header   http.Header
+	timeout  time.Duration
+	tls      *tls.Config
+	client   *http.Client
+	checksum string
+}
+
+// MergeURL merges the values fetched from url with a GET request. The response
+// is parsed by its content type: JSON, TOML and registered formats, such as
+// YAML, are recognized, as are the extensions of the path of url, and anything
+// else is parsed as KEY=value lines. Responses other than 2xx fail the source.
+func (b *Builder) MergeURL(ctx context.Context, url string, opts ...URLOption) *Builder {
+	return b.MergeSourceContext(ctx, URLSource(url, opts...))
+}
+
+// URLSource returns a Source fetching url, like MergeURL.
+func URLSource(url string, opts ...URLOption) Source {
+	return urlSource{url: url, options: newURLOptions(opts)}
+}
+
+// HTTPOptions returns the client and the headers of requests configured by
+// opts, for the sources of other packages making HTTP requests, such as
+// etcdsupport and vaultsupport.
+func HTTPOptions(opts ...URLOption) (*http.Client, http.Header) {
+	o := newURLOptions(opts)
+	return o.client, o.header
+}
+
+func newURLOptions(opts []URLOption) urlOptions {
+	o := urlOptions{header: http.Header{}, timeout: 30 * time.Second}
+	for _, opt := range opts {
+		opt(&o)
+	}
+
+	if o.client == nil {
+		transport := http.DefaultTransport
+		if o.tls != nil {
+			transport = &http.Transport{
+				Proxy:           http.ProxyFromEnvironment,
+				TLSClientConfig: o.tls,
+			}
+		}
+
+		o.client = &http.Client{Timeout: o.timeout, Transport: transport}
+	}
+
+	return o
+}
+
+func (o urlOptions) setHeader(req *http.Request) {
+	for key, values := range o.header {
+		req.Header[key] = values
+	}
+}
+
+type urlSource struct {
+	url     string
+	options urlOptions
+}
+
+func (s urlSource) Load(ctx context.Context) (Map, error) {
+	m, _, err := s.LoadVersion(ctx)
+	return m, err
+}
+
+// LoadVersion returns the ETag of the response as its version, or the SHA-256
+// hash of its body.
+func (s urlSource) LoadVersion(ctx context.Context) (Map, string, error) {
+	req, err := http.NewRequest(http.MethodGet, s.url, nil)
+	if err != nil {
+		return nil, ``, redactURLError(err)
+	}
+
+	s.options.setHeader(req)
+
+	resp, err := s.options.client.Do(req.WithContext(ctx))
+	if err != nil {
+		return nil, ``, redactURLError(err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return nil, ``, fmt.Errorf("unexpected status %s", resp.Status)
+	}
+
+	buf := getBuffer()
+	defer putBuffer(buf)
+
+	if _, err := buf.ReadFrom(resp.Body); err != nil {
+		return nil, ``, err
+	}
+
+	sum := fmt.Sprintf("sha256:%x", sha256.Sum256(buf.Bytes()))
+
+	if s.options.checksum != `` && !strings.EqualFold(s.options.checksum, sum) {
+		if !strings.HasPrefix(s.options.checksum, `sha256:`) {
+			return nil, ``, fmt.Errorf("unsupported checksum %s", s.options.checksum)
+		}
+
+		return nil, ``, fmt.Errorf("checksum mismatch: expected %s, got %s", s.options.checksum, sum)
+	}
+
+	m, err := formatByContentType(resp.Header.Get(`Content-Type`), req.URL.Path)(buf.Bytes()).Load(ctx)
+	if err != nil {
+		return nil, ``, err
+	}
+
+	version := resp.Header.Get(`ETag`)
+	if version == `` {
+		version = sum
+	}
+
+	return m, version, nil
+}
+
+// String returns the URL without credentials and query, which may hold
+// secrets.
+func (s urlSource) String() string {
+	u := withoutCredentials(s.url)
+	if u == `` {
+		return `url`
+	}
+
+	return `url ` + u
+}
+
+// Returns rawURL without credentials and query, or nothing if it isn't a URL.
+func withoutCredentials(rawURL string) string {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return ``
+	}
+
+	u.User = nil
+	u.RawQuery = ``
+	return u.String()
+}
+
+// Removes credentials and query from the URL of err, if it is a *url.Error as
+// returned by http.Client.
+func redactURLError(err error) error {
+	if urlErr, ok := err.(*url.Error); ok {
+		return &url.Error{Op: urlErr.Op, URL: withoutCredentials(urlErr.URL), Err: urlErr.Err}
+	}
+
+	return err
+}
+
+// Returns the source parsing responses of contentType, or by the extension
+// of the path if the content type isn't known.
+func formatByContentType(contentType, urlPath string) func(data []byte) Source {
+	mediaType, _, _ := mime.ParseMediaType(contentType)
+
+	if f, ok := lookupFormatByMediaType(mediaType); ok {
+		return f.Parse
+	}
+
+	switch mediaType {
+	case `application/json`:
+		return JSONSource
+	case `application/toml`:
+		return TOMLSource
+	}
+
+	_, parse := formatByExtension(path.Base(urlPath))
+	return parse
+}
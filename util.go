@@ -2,16 +2,21 @@ package readconf
 
 import (
 	"fmt"
+	"os"
 	"reflect"
 	"regexp"
 	"sort"
 	"strings"
+	"sync"
 )
 
 var (
 	_capital1  = regexp.MustCompile(`[A-Z][a-z]+`)
 	_capital2  = regexp.MustCompile(`[A-Z][A-Z]+`)
 	_reference = regexp.MustCompile(`\$\{([^}]+)(?:\:-[^}]*)?\}`)
+
+	// keys of struct field names, which are looked up on every build
+	_structKeys sync.Map
 )
 
 func parseReferences(v string) (refs []string, defaults map[string]string) {
@@ -49,7 +54,38 @@ func replaceReferences(s string, data Map) string {
 	})
 }
 
+// Applies the comma-separated directives of a transform tag to s.
+func transformValue(s string, tag string) (string, error) {
+	for _, directive := range strings.Split(tag, ",") {
+		switch strings.TrimSpace(directive) {
+		case ``:
+		case `trim`:
+			s = strings.TrimSpace(s)
+		case `lower`:
+			s = strings.ToLower(s)
+		case `upper`:
+			s = strings.ToUpper(s)
+		case `expandenv`:
+			s = os.ExpandEnv(s)
+		default:
+			return ``, fmt.Errorf("unknown transform %q", directive)
+		}
+	}
+
+	return s, nil
+}
+
 func transformStructKey(v string) string {
+	if key, ok := _structKeys.Load(v); ok {
+		return key.(string)
+	}
+
+	key := transformStructKeyUncached(v)
+	_structKeys.Store(v, key)
+	return key
+}
+
+func transformStructKeyUncached(v string) string {
 	v = _capital2.ReplaceAllString(v, `_$0`)
 	v = _capital1.ReplaceAllStringFunc(v, func(s string) string {
 		return "_" + strings.ToUpper(s)
@@ -71,6 +107,16 @@ func copyAppend(in []string, ss ...string) []string {
 	return out
 }
 
+func containsString(ss []string, s string) bool {
+	for i := range ss {
+		if ss[i] == s {
+			return true
+		}
+	}
+
+	return false
+}
+
 func validateIsPointerToStruct(v interface{}) error {
 	switch {
 	case v == nil:
@@ -109,6 +155,10 @@ func resolveValueMap(m Map) error {
 			return false, nil
 		}
 
+		if !strings.Contains(value, `${`) {
+			return true, nil
+		}
+
 		valueRefs, valueDefs := parseReferences(value)
 		resolved := make(Map, len(valueRefs))
 
@@ -118,6 +168,11 @@ func resolveValueMap(m Map) error {
 			case err != nil:
 				return false, err
 			case !ok:
+				if v, ok := lookupFact(ref); ok {
+					resolved[ref] = v
+					continue
+				}
+
 				v, ok := valueDefs[ref]
 				if !ok {
 					return false, fmt.Errorf(`key %s referenced by %s not found`, ref, key)
@@ -169,11 +224,23 @@ func walkStruct(
 		return fmt.Errorf("expected struct")
 	}
 
-	var walk func(vv reflect.Value, f reflect.StructField, prefix []string) error
+	var walk func(vv reflect.Value, f reflect.StructField, prefix []string, types []reflect.Type) error
 
-	walk = func(vv reflect.Value, f reflect.StructField, prefix []string) error {
+	walk = func(vv reflect.Value, f reflect.StructField, prefix []string, types []reflect.Type) error {
 		vt := vv.Type()
 
+		for _, t := range types {
+			if t == vt {
+				return fmt.Errorf("cyclic struct type %s at %s", vt, strings.Join(prefix, "."))
+			}
+		}
+
+		if len(types) >= _maxDepth {
+			return fmt.Errorf("maximum struct depth of %d exceeded at %s", _maxDepth, strings.Join(prefix, "."))
+		}
+
+		types = append(types, vt)
+
 		for i := 0; i < vt.NumField(); i++ {
 			fv, ft := vv.Field(i), vt.Field(i)
 
@@ -188,8 +255,13 @@ func walkStruct(
 				continue
 			}
 
-			if ft.Type.Kind() == reflect.Struct {
-				if err := walk(fv, ft, path); err != nil {
+			switch {
+			case ft.Type.Kind() == reflect.Struct:
+				if err := walk(fv, ft, path, types); err != nil {
+					return err
+				}
+			case isStructPointer(ft.Type) && !fv.IsNil():
+				if err := walk(fv.Elem(), ft, path, types); err != nil {
 					return err
 				}
 			}
@@ -214,7 +286,11 @@ func walkStruct(
 		return nil
 	}
 
-	return walk(xv, wrapper, nil)
+	return walk(xv, wrapper, nil, nil)
+}
+
+func isStructPointer(t reflect.Type) bool {
+	return t.Kind() == reflect.Ptr && t.Elem().Kind() == reflect.Struct
 }
 
 // Returns true when the given value is something we can
@@ -222,24 +298,150 @@ func walkStruct(
 func canUnmarshalDirectly(v reflect.Value) bool {
 	t := v.Type()
 
+	if _, ok := lookupLeaf(t); ok {
+		return true
+	}
+
+	if t.Kind() == reflect.Ptr {
+		if _, ok := lookupLeaf(t.Elem()); ok {
+			return true
+		}
+	}
+
 	switch {
-	case t.Implements(_unmarshalerType):
+	case t.Implements(_unmarshalerType), t.Implements(_textUnmarshalerType):
 		return true
-	case t.Kind() == reflect.Struct:
+	case reflect.PtrTo(t).Implements(_unmarshalerType), reflect.PtrTo(t).Implements(_textUnmarshalerType):
+		return true
+	case t.Kind() == reflect.Struct, isStructPointer(t):
 		return false
 	default:
 		return true
 	}
 }
 
-func structKey(path []string) string {
+// Splits a config tag into the key it names, if any, and whether the field is
+// optional, e.g. NAME,optional.
+func parseConfigTag(tag string) (name string, optional bool, err error) {
+	parts := strings.Split(tag, `,`)
+	for _, option := range parts[1:] {
+		switch option {
+		case `optional`:
+			optional = true
+		default:
+			return ``, false, fmt.Errorf("unknown option %s of config tag", option)
+		}
+	}
+
+	return parts[0], optional, nil
+}
+
+func (f configField) optional() bool {
+	_, optional, _ := parseConfigTag(f.field.Tag.Get(_configTag))
+	return optional
+}
+
+func (f configField) presence() bool {
+	return f.field.Tag.Get(_presenceTag) == `true` && f.value.Kind() == reflect.Bool
+}
+
+type configField struct {
+	field reflect.StructField
+	value reflect.Value
+	// position of the field in the struct, counting nested fields
+	order int
+}
+
+// Returns the fields of target that configuration values are unmarshaled
+// into, keyed by their configuration key. If alloc is true, nil pointers to
+// structs are allocated so that their fields are included.
+func configFields(target interface{}, alloc bool, keys KeyStrategy) (map[string]configField, error) {
+	fields := map[string]configField{}
+	fieldKeys := newFieldKeys(keys)
+
+	if err := walkStruct(
+		target,
+		func(path []string, f reflect.StructField, v reflect.Value) (bool, error) {
+			if !v.CanSet() {
+				return false, nil
+			}
+
+			name, _, err := parseConfigTag(f.Tag.Get(_configTag))
+			if err != nil {
+				return false, wrapError(err, "field %s", f.Name)
+			}
+
+			if name == `-` {
+				return false, nil
+			}
+
+			key := fieldKeys.key(path, f, name)
+
+			if canUnmarshalDirectly(v) {
+				fields[key] = configField{field: f, value: v, order: len(fields)}
+				return false, nil
+			}
+
+			if alloc && isStructPointer(v.Type()) && v.IsNil() {
+				v.Set(reflect.New(v.Type().Elem()))
+			}
+
+			return true, nil
+		},
+	); err != nil {
+		return nil, err
+	}
+
+	return fields, nil
+}
+
+// Derives the keys of the fields visited by walkStruct from their paths.
+// Names given by config tags are used as keys as they are, also as prefixes of
+// the keys of nested fields.
+type fieldKeys struct {
+	keys KeyStrategy
+	// keys of the fields visited, by their paths
+	prefixes map[string]string
+}
+
+func newFieldKeys(keys KeyStrategy) *fieldKeys {
+	return &fieldKeys{keys: keys, prefixes: map[string]string{}}
+}
+
+// Returns the key of field f at path, or of name if the config tag of f names
+// it. Embedded fields have the keys of the structs embedding them. Parents
+// must be visited before the fields nested in them.
+func (k *fieldKeys) key(path []string, f reflect.StructField, name string) string {
+	if f.Anonymous || len(path) == 0 {
+		return k.prefixes[strings.Join(path, `.`)]
+	}
+
+	key := k.keys.FieldKey(path[len(path)-1])
+	if name != `` {
+		key = name
+	}
+
+	if parent := k.prefixes[strings.Join(path[:len(path)-1], `.`)]; parent != `` {
+		key = k.keys.Join(parent, key)
+	}
+
+	key = k.keys.Normalize(key)
+	k.prefixes[strings.Join(path, `.`)] = key
+	return key
+}
+
+func structKey(keys KeyStrategy, path []string) string {
+	if len(path) == 1 {
+		return keys.Normalize(keys.FieldKey(path[0]))
+	}
+
 	ss := make([]string, len(path))
 	for i := range path {
-		ss[i] = transformStructKey(path[i])
+		ss[i] = keys.FieldKey(path[i])
 	}
 
-	key := strings.Join(ss, _separator)
-	key = normalizeKey(key)
+	key := keys.Join(ss...)
+	key = keys.Normalize(key)
 
 	return key
 }
@@ -1,8 +1,13 @@
 package readconf
 
 import (
+	"bytes"
+	"encoding/json"
+	"os"
 	"reflect"
+	"strconv"
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/require"
 )
@@ -72,7 +77,7 @@ func TestWalkStruct(t *testing.T) {
 				return false, nil
 			}
 
-			key := structKey(path)
+			key := structKey(defaultKeyStrategy{}, path)
 			keys = append(keys, key)
 			return true, nil
 		})
@@ -135,3 +140,446 @@ func TestResolveValueMap(t *testing.T) {
 		require.EqualError(t, err, `cyclic reference: BAR, BAX, BAR`)
 	})
 }
+
+type cyclicNode struct {
+	Name string
+	Next *cyclicNode
+}
+
+func TestWalkStruct_Pointers(t *testing.T) {
+	t.Run("nested", func(t *testing.T) {
+		var s struct {
+			Nested *struct {
+				Foo string
+			}
+		}
+
+		fields, err := configFields(&s, true, defaultKeyStrategy{})
+		require.NoError(t, err)
+		require.NotNil(t, s.Nested)
+		require.Contains(t, fields, `NESTED__FOO`)
+	})
+
+	t.Run("cycle", func(t *testing.T) {
+		var s struct {
+			Root cyclicNode
+		}
+
+		_, err := configFields(&s, true, defaultKeyStrategy{})
+		require.EqualError(t, err, `cyclic struct type readconf.cyclicNode at Root.Next`)
+	})
+
+	t.Run("depth", func(t *testing.T) {
+		t1 := reflect.TypeOf(struct{ Foo string }{})
+		for i := 0; i < _maxDepth; i++ {
+			t1 = reflect.StructOf([]reflect.StructField{{Name: "Inner", Type: t1}})
+		}
+
+		_, err := configFields(reflect.New(t1).Interface(), true, defaultKeyStrategy{})
+		require.Error(t, err)
+		require.Contains(t, err.Error(), `maximum struct depth of 32 exceeded`)
+	})
+}
+
+func TestTransformValue(t *testing.T) {
+	require.NoError(t, os.Setenv(`READCONF_TEST_HOME`, `/home/test`))
+	defer os.Unsetenv(`READCONF_TEST_HOME`)
+
+	tests := []struct {
+		in, tag, out string
+	}{
+		{` Foo `, `trim`, `Foo`},
+		{` Foo `, `trim,lower`, `foo`},
+		{` Foo `, `upper, trim`, `FOO`},
+		{`$READCONF_TEST_HOME/x`, `expandenv`, `/home/test/x`},
+		{` x `, ``, ` x `},
+	}
+
+	for _, test := range tests {
+		out, err := transformValue(test.in, test.tag)
+		require.NoError(t, err)
+		require.Equal(t, test.out, out)
+	}
+
+	_, err := transformValue(`x`, `trim,reverse`)
+	require.EqualError(t, err, `unknown transform "reverse"`)
+}
+
+func TestParseInt(t *testing.T) {
+	tests := []struct {
+		in   string
+		bits int
+		out  int64
+	}{
+		{`42`, 64, 42},
+		{`-42`, 64, -42},
+		{`0755`, 64, 755},
+		{`1_000_000`, 64, 1000000},
+		{`0x1F`, 64, 31},
+		{`-0x1f`, 64, -31},
+		{`0o755`, 64, 493},
+		{`0b101`, 64, 5},
+		{`0x_ff`, 64, 255},
+		{`127`, 8, 127},
+		{`-128`, 8, -128},
+	}
+
+	for _, test := range tests {
+		out, err := parseInt(test.in, test.bits)
+		require.NoError(t, err, test.in)
+		require.Equal(t, test.out, out, test.in)
+	}
+
+	for _, in := range []string{``, `_1`, `1_`, `1__0`, `0x`, `0o8`, `1e3`} {
+		_, err := parseInt(in, 64)
+		require.Error(t, err, in)
+		require.IsType(t, &strconv.NumError{}, err, in)
+	}
+
+	_, err := parseInt(`128`, 8)
+	require.Equal(t, &RangeError{Value: `128`, Bits: 8}, err)
+	require.EqualError(t, err, `value 128 out of range for 8-bit integer`)
+}
+
+func TestParseUint(t *testing.T) {
+	out, err := parseUint(`0xFFFF_FFFF`, 32)
+	require.NoError(t, err)
+	require.Equal(t, uint64(1<<32-1), out)
+
+	_, err = parseUint(`-1`, 32)
+	require.IsType(t, &strconv.NumError{}, err)
+
+	_, err = parseUint(`0x1_0000_0000`, 32)
+	require.EqualError(t, err, `value 0x1_0000_0000 out of range for 32-bit unsigned integer`)
+}
+
+func TestParseFileMode(t *testing.T) {
+	tests := []struct {
+		in   string
+		mode os.FileMode
+		out  string
+	}{
+		{`0640`, 0640, `0640`},
+		{`640`, 0640, `0640`},
+		{`0o755`, 0755, `0755`},
+		{`4755`, os.ModeSetuid | 0755, `4755`},
+		{`1777`, os.ModeSticky | 0777, `1777`},
+		{`0`, 0, `0000`},
+	}
+
+	for _, test := range tests {
+		mode, err := parseFileMode(test.in)
+		require.NoError(t, err, test.in)
+		require.Equal(t, test.mode, mode, test.in)
+		require.Equal(t, test.out, formatFileMode(mode), test.in)
+	}
+
+	for _, in := range []string{``, `rw-r--r--`, `0x1ff`, `0800`, `10000`} {
+		_, err := parseFileMode(in)
+		require.EqualError(t, err, `invalid file mode `+in)
+	}
+}
+
+func TestConvertUnit(t *testing.T) {
+	tests := []struct {
+		in, unit string
+		float    bool
+		out      string
+	}{
+		{`75%`, `percent`, true, `75`},
+		{`75`, `percent`, true, `75`},
+		{`0.5 %`, `percent`, true, `0.5`},
+		{`75%`, `ratio`, true, `0.75`},
+		{`0.75`, `ratio`, true, `0.75`},
+		{`100%`, `ratio`, true, `1`},
+		{`12.5%`, `ratio`, false, `0.125`},
+		{`1/3`, `ratio`, true, `0.3333333333333333`},
+		{`1/3`, `ratio`, false, `1/3`},
+		{`100/3%`, `ratio`, false, `1/3`},
+	}
+
+	for _, test := range tests {
+		out, err := convertUnit(test.in, test.unit, test.float)
+		require.NoError(t, err, test.in)
+		require.Equal(t, test.out, out, test.in)
+	}
+
+	_, err := convertUnit(`75%`, `permille`, true)
+	require.EqualError(t, err, `unknown unit "permille"`)
+
+	_, err = convertUnit(`many`, `ratio`, true)
+	require.EqualError(t, err, `invalid number many`)
+}
+
+func TestNormalizeLocaleNumber(t *testing.T) {
+	tests := []struct {
+		in    string
+		float bool
+		out   string
+	}{
+		{`1234`, false, `1234`},
+		{`1.234`, false, `1234`},
+		{`1,234`, false, `1234`},
+		{`1,234,567`, false, `1234567`},
+		{`1 234 567`, false, `1234567`},
+		{"1\u00a0234", false, `1234`},
+		{`1'234'567`, false, `1234567`},
+		{`-1.234`, false, `-1234`},
+		{`1.5`, false, `1.5`},
+		{`1,23`, false, `1,23`},
+		{`0x1F`, false, `0x1F`},
+		{`1,5`, true, `1.5`},
+		{`1.5`, true, `1.5`},
+		{`1.234,5`, true, `1234.5`},
+		{`1,234.5`, true, `1234.5`},
+		{`1'234.5`, true, `1234.5`},
+		{`-1.234.567,89`, true, `-1234567.89`},
+		{`1,234,567`, true, `1234567`},
+		{`1.23.4,5`, true, `1.23.4,5`},
+		{`1,2.3,4`, true, `1,2.3,4`},
+	}
+
+	for _, test := range tests {
+		require.Equal(t, test.out, normalizeLocaleNumber(test.in, test.float), test.in)
+	}
+}
+
+func TestRewriteData(t *testing.T) {
+	rules := []RenameRule{
+		{From: `db_host`, To: `DATABASE__HOST`},
+		{From: `DB_PORT`, To: `DATABASE__PORT`},
+	}
+
+	t.Run("preserves comments and values", func(t *testing.T) {
+		data, err := rewriteData(rules, []byte("# database\nDB_HOST = localhost\n  db_port=5432 # default\n\nNAME=app\n"))
+		require.NoError(t, err)
+		require.Equal(t, "# database\nDATABASE__HOST = localhost\n  DATABASE__PORT=5432 # default\n\nNAME=app\n", string(data))
+	})
+
+	t.Run("conflict", func(t *testing.T) {
+		_, err := rewriteData(rules, []byte("DATABASE__HOST=a\nDB_HOST=b\n"))
+		require.EqualError(t, err, `key DATABASE__HOST on line 2 is already set on line 1`)
+	})
+
+	t.Run("duplicate keys without renames", func(t *testing.T) {
+		data, err := rewriteData(rules, []byte("NAME=a\nNAME=b"))
+		require.NoError(t, err)
+		require.Equal(t, "NAME=a\nNAME=b", string(data))
+	})
+}
+
+func TestMap_Nested(t *testing.T) {
+	nested, err := Map{`NAME`: `app`, `DB__HOST`: `localhost`, `DB__POOL__SIZE`: `4`}.Nested()
+	require.NoError(t, err)
+	require.Equal(t, map[string]interface{}{
+		`name`: `app`,
+		`db`: map[string]interface{}{
+			`host`: `localhost`,
+			`pool`: map[string]interface{}{`size`: `4`},
+		},
+	}, nested)
+
+	_, err = Map{`DB`: `x`, `DB__HOST`: `localhost`}.Nested()
+	require.EqualError(t, err, `key DB__HOST conflicts with DB`)
+}
+
+func TestFreezeWindow(t *testing.T) {
+	at := func(hour, min int) time.Time {
+		return time.Date(2020, 1, 1, hour, min, 0, 0, time.UTC)
+	}
+
+	peak := FreezeWindow{From: 9 * time.Hour, To: 17 * time.Hour}
+	night := FreezeWindow{From: 22 * time.Hour, To: 2 * time.Hour}
+
+	tests := []struct {
+		window FreezeWindow
+		t      time.Time
+		end    time.Time
+		ok     bool
+	}{
+		{peak, at(8, 59), time.Time{}, false},
+		{peak, at(9, 0), at(17, 0), true},
+		{peak, at(16, 59), at(17, 0), true},
+		{peak, at(17, 0), time.Time{}, false},
+		{night, at(21, 0), time.Time{}, false},
+		{night, at(23, 0), at(26, 0), true},
+		{night, at(1, 30), at(2, 0), true},
+		{night, at(2, 0), time.Time{}, false},
+	}
+
+	for _, test := range tests {
+		end, ok := test.window.end(test.t)
+		require.Equal(t, test.ok, ok, test.t)
+		require.Equal(t, test.end, end, test.t)
+	}
+}
+
+func TestOrderedMap(t *testing.T) {
+	m, err := ParseData([]byte("# comment\nzeta=1\nALPHA = 2\n\nmid=3\nzeta=4\n"))
+	require.NoError(t, err)
+	require.Equal(t, []string{`ZETA`, `ALPHA`, `MID`}, m.Keys())
+	require.Equal(t, `4`, m.Get(`zeta`))
+
+	m.Delete(`alpha`)
+	m.Set(`new`, `5`)
+
+	var buf bytes.Buffer
+	_, err = m.WriteTo(&buf)
+	require.NoError(t, err)
+	require.Equal(t, "ZETA=4\nMID=3\nNEW=5\n", buf.String())
+
+	_, err = ParseData([]byte("=1"))
+	require.EqualError(t, err, `invalid empty key on line 1`)
+}
+
+func TestMarshalOrdered(t *testing.T) {
+	var conf struct {
+		Zeta string
+		DB   struct {
+			Port int
+			Host string
+		}
+		Alpha bool
+	}
+
+	m, err := MarshalOrdered(&conf)
+	require.NoError(t, err)
+	require.Equal(t, []string{`ZETA`, `DB__PORT`, `DB__HOST`, `ALPHA`}, m.Keys())
+}
+
+func TestSuggestKeys(t *testing.T) {
+	require.Equal(t, 0, editDistance(`HOST`, `HOST`))
+	require.Equal(t, 1, editDistance(`DATABASE_HOST`, `DATABASE__HOST`))
+	require.Equal(t, 2, editDistance(`DATBASE__HOS`, `DATABASE__HOST`))
+	require.Equal(t, 4, editDistance(``, `HOST`))
+
+	require.Equal(t,
+		map[string]string{
+			`DATABASE_HOST`: `DATABASE__HOST`,
+			`DATABSE__PORT`: `DATABASE__PORT`,
+		},
+		suggestKeys(
+			[]string{`DATABASE_HOST`, `DATABSE__PORT`, `CACHE__HOST`, `ID`},
+			[]string{`DATABASE__HOST`, `DATABASE__PORT`, `IP`}))
+}
+
+func TestParseTOML(t *testing.T) {
+	doc, err := parseTOML([]byte(`
+title = "TOML \"example\" \u00e9"
+literal = 'C:\Users\nodejs'
+multi = """
+Roses are red \
+  Violets are blue"""
+raw = '''
+first line
+second ''line'''''
+"quoted key" = 1
+site."google.com" = true
+inline = { x = 1, y.z = [1, 2.5, "three", [true]] }
+empty = {}
+hex = 0xDEAD_BEEF
+oct = 0o755
+bin = 0b11
+neg = -17
+exp = 6.626e-34
+pos = +1.5
+inf = -inf
+odt = 1979-05-27 07:32:00.5Z
+ldt = 1979-05-27T07:32:00
+ld = 1979-05-27
+lt = 07:32:00
+
+[a.b]  # comment
+c = 1
+[a]
+d = 2
+
+[[fruits]]
+name = "apple"
+[fruits.physical]
+color = "red"
+[[fruits]]
+name = "banana"
+`))
+	require.NoError(t, err)
+
+	require.Equal(t, `TOML "example" é`, doc[`title`])
+	require.Equal(t, `C:\Users\nodejs`, doc[`literal`])
+	require.Equal(t, `Roses are red Violets are blue`, doc[`multi`])
+	require.Equal(t, "first line\nsecond ''line''", doc[`raw`])
+	require.Equal(t, json.Number(`1`), doc[`quoted key`])
+	require.Equal(t, map[string]interface{}{`google.com`: true}, doc[`site`])
+	require.Equal(t, map[string]interface{}{
+		`x`: json.Number(`1`),
+		`y`: map[string]interface{}{
+			`z`: []interface{}{json.Number(`1`), json.Number(`2.5`), `three`, []interface{}{true}},
+		},
+	}, doc[`inline`])
+	require.Equal(t, map[string]interface{}{}, doc[`empty`])
+	require.Equal(t, json.Number(`3735928559`), doc[`hex`])
+	require.Equal(t, json.Number(`493`), doc[`oct`])
+	require.Equal(t, json.Number(`3`), doc[`bin`])
+	require.Equal(t, json.Number(`-17`), doc[`neg`])
+	require.Equal(t, json.Number(`6.626e-34`), doc[`exp`])
+	require.Equal(t, json.Number(`1.5`), doc[`pos`])
+	require.Equal(t, `-Inf`, doc[`inf`])
+	require.Equal(t, `1979-05-27T07:32:00.5Z`, doc[`odt`])
+	require.Equal(t, `1979-05-27T07:32:00Z`, doc[`ldt`])
+	require.Equal(t, `1979-05-27`, doc[`ld`])
+	require.Equal(t, `07:32:00`, doc[`lt`])
+	require.Equal(t, map[string]interface{}{
+		`b`: map[string]interface{}{`c`: json.Number(`1`)},
+		`d`: json.Number(`2`),
+	}, doc[`a`])
+	require.Equal(t, []interface{}{
+		map[string]interface{}{
+			`name`:     `apple`,
+			`physical`: map[string]interface{}{`color`: `red`},
+		},
+		map[string]interface{}{`name`: `banana`},
+	}, doc[`fruits`])
+
+	for _, tt := range []struct {
+		in  string
+		err string
+	}{
+		{"a = 1\na = 2", `duplicate key a on line 2`},
+		{"a = 1\n[a]", `key a is not a table on line 2`},
+		{"a = \"x", `unterminated string on line 1`},
+		{"a = 01", `invalid value 01 on line 1`},
+		{"a = 1_", `invalid value 1_ on line 1`},
+		{"a = [1 2]", `expected , or ] in array on line 1`},
+		{"a = 1 b = 2", `expected end of line on line 1`},
+		{"= 1", `invalid key on line 1`},
+		{"[a", `expected ] after table name on line 1`},
+		{`a = "\q"`, `invalid escape sequence \q on line 1`},
+	} {
+		_, err := parseTOML([]byte(tt.in))
+		require.EqualError(t, err, tt.err, tt.in)
+	}
+}
+
+func TestUseColor(t *testing.T) {
+	var buf bytes.Buffer
+	require.False(t, useColor(&buf, nil))
+	require.True(t, useColor(&buf, []WriteOption{WithColor(ColorAlways)}))
+
+	defer os.Unsetenv(`NO_COLOR`)
+	require.NoError(t, os.Setenv(`NO_COLOR`, `1`))
+	require.False(t, useColor(os.Stdout, nil))
+	require.True(t, useColor(os.Stdout, []WriteOption{WithColor(ColorAlways)}))
+	require.False(t, useColor(os.Stdout, []WriteOption{WithColor(ColorNever)}))
+}
+
+func TestPollBackoff(t *testing.T) {
+	require.Equal(t, time.Second, pollBackoff(1, time.Minute))
+	require.Equal(t, 4*time.Second, pollBackoff(3, time.Minute))
+	require.Equal(t, time.Minute, pollBackoff(10, time.Minute))
+	require.Equal(t, time.Minute, pollBackoff(1000, time.Minute))
+	require.Equal(t, 10*time.Millisecond, pollBackoff(1, 10*time.Millisecond))
+
+	for i := 0; i < 100; i++ {
+		d := jitter(time.Second)
+		require.True(t, d >= 900*time.Millisecond && d <= 1100*time.Millisecond, d)
+	}
+}
@@ -0,0 +1,109 @@
+package readconf
+
+import (
+	"reflect"
+	"sort"
+	"strings"
+)
+
+// Validator returns the validator set by WithValidator, or nil if the builder
+// doesn't validate targets.
+func (b *Builder) Validator() Validator {
+	return b.validate
+}
+
+// MapValidator replaces the validator of the builder with the one f returns,
+// passing it the current one, nil if none is set.
+//
+// Deprecated: MapValidator took a go-playground validator, which the package
+// no longer depends on. Configure the validator before passing it to
+// WithValidator, e.g. with validatorsupport.Wrap.
+func (b *Builder) MapValidator(f func(v Validator) Validator) *Builder {
+	if b.hasError() {
+		return b
+	}
+
+	b.validate = f(b.validate)
+	return b
+}
+
+func (b *Builder) validateTarget(target interface{}) error {
+	if b.validate == nil {
+		return nil
+	}
+
+	if err := b.validate.Struct(target); err != nil {
+		if verr, ok := err.(*ValidationError); ok {
+			strategy := b.keyStrategy()
+			t := reflect.TypeOf(target)
+			fields := make([]ValidationField, len(verr.Fields))
+
+			// validators name fields by their paths, which are replaced by
+			// their keys
+			for i, field := range verr.Fields {
+				key := validationKey(t, strategy, field.Key)
+				if key == `` {
+					key = structKey(strategy, strings.Split(field.Key, `.`))
+				}
+
+				fields[i] = ValidationField{Key: key, Rule: field.Rule, Param: field.Param}
+			}
+
+			sort.SliceStable(fields, func(i, j int) bool {
+				return fields[i].Key < fields[j].Key
+			})
+
+			return &ValidationError{Fields: fields}
+		}
+
+		return wrapError(err, "validation failed")
+	}
+
+	return nil
+}
+
+// Returns the configuration key of the field of t at namespace, the names of
+// the fields below t joined by dots, e.g. DB.MaxConns. Keys are derived like those of configFields, so that they
+// match the keys of reports. Elements of slices and maps have the key of the
+// field holding them. Returns an empty key if t has no such field.
+func validationKey(t reflect.Type, keys KeyStrategy, namespace string) string {
+	fieldKeys := newFieldKeys(keys)
+
+	var path []string
+	key := ``
+
+	for _, name := range strings.Split(namespace, `.`) {
+		index := strings.IndexByte(name, '[')
+		if index >= 0 {
+			name = name[:index]
+		}
+
+		for t.Kind() == reflect.Ptr {
+			t = t.Elem()
+		}
+
+		if t.Kind() != reflect.Struct {
+			return ``
+		}
+
+		f, ok := t.FieldByName(name)
+		if !ok {
+			return ``
+		}
+
+		if !f.Anonymous {
+			path = copyAppend(path, f.Name)
+		}
+
+		tag, _, _ := parseConfigTag(f.Tag.Get(_configTag))
+		key = fieldKeys.key(path, f, tag)
+
+		if index >= 0 {
+			break
+		}
+
+		t = f.Type
+	}
+
+	return key
+}
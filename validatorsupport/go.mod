@@ -0,0 +1,11 @@
+module github.com/tetratom/readconf/validatorsupport
+
+go 1.13
+
+require (
+	github.com/go-playground/validator/v10 v10.1.0
+	github.com/stretchr/testify v1.4.0
+	github.com/tetratom/readconf v0.0.0
+)
+
+replace github.com/tetratom/readconf => ../
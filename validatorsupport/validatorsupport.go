@@ -0,0 +1,84 @@
+// Package validatorsupport validates configurations with the validate tags of
+// github.com/go-playground/validator, in a module of its own, so that readconf
+// doesn't depend on it. Builders don't validate targets unless given a
+// validator:
+//
+//	err := readconf.NewBuilder().
+//		MergeEnviron("APP_", os.Environ()).
+//		WithValidator(validatorsupport.New()).
+//		Build(&conf)
+package validatorsupport
+
+import (
+	"reflect"
+	"strings"
+
+	"github.com/go-playground/validator/v10"
+
+	"github.com/tetratom/readconf"
+)
+
+// New returns a Validator checking validate tags with a new go-playground
+// validator.
+func New() readconf.Validator {
+	return Wrap(validator.New())
+}
+
+// Wrap returns a Validator checking validate tags with v, e.g. to register
+// custom validations with RegisterValidation. Fields failing rules are
+// reported as *readconf.ValidationError, keyed by their configuration keys.
+func Wrap(v *validator.Validate) readconf.Validator {
+	return wrapped{v}
+}
+
+// MapValidator calls f with the go-playground validator of b, setting a new
+// one if b has none or another kind of validator, like the MapValidator
+// method of earlier versions of readconf.
+func MapValidator(b *readconf.Builder, f func(v *validator.Validate)) *readconf.Builder {
+	return b.MapValidator(func(v readconf.Validator) readconf.Validator {
+		w, ok := v.(wrapped)
+		if !ok {
+			w = wrapped{validator.New()}
+		}
+
+		f(w.v)
+		return w
+	})
+}
+
+// Unwrap returns the go-playground validator of a Validator returned by New or
+// Wrap.
+func Unwrap(v readconf.Validator) (*validator.Validate, bool) {
+	w, ok := v.(wrapped)
+	return w.v, ok
+}
+
+type wrapped struct {
+	v *validator.Validate
+}
+
+func (w wrapped) Struct(s interface{}) error {
+	err := w.v.Struct(s)
+
+	errs, ok := err.(validator.ValidationErrors)
+	if !ok {
+		return err
+	}
+
+	// namespaces start with the name of the struct type, unless it's unnamed
+	root := ``
+	if name := reflect.Indirect(reflect.ValueOf(s)).Type().Name(); name != `` {
+		root = name + `.`
+	}
+
+	fields := make([]readconf.ValidationField, len(errs))
+	for i, err := range errs {
+		fields[i] = readconf.ValidationField{
+			Key:   strings.TrimPrefix(err.StructNamespace(), root),
+			Rule:  err.Tag(),
+			Param: err.Param(),
+		}
+	}
+
+	return &readconf.ValidationError{Fields: fields}
+}
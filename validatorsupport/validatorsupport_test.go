@@ -0,0 +1,205 @@
+package validatorsupport_test
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/go-playground/validator/v10"
+	"github.com/stretchr/testify/require"
+
+	"github.com/tetratom/readconf"
+	"github.com/tetratom/readconf/validatorsupport"
+)
+
+type config struct {
+	Foo string `default:"a" validate:"min=2"`
+	Bar string `default:"a" validate:"min=2"`
+}
+
+func TestNew(t *testing.T) {
+	t.Run("failure", func(t *testing.T) {
+		var conf config
+		err := readconf.NewBuilder().WithValidator(validatorsupport.New()).Build(&conf)
+		require.EqualError(t, err, `validation failed: BAR, FOO`)
+		require.Equal(t, []readconf.ValidationField{
+			{Key: `BAR`, Rule: `min`, Param: `2`},
+			{Key: `FOO`, Rule: `min`, Param: `2`},
+		}, err.(*readconf.ValidationError).Fields)
+	})
+
+	t.Run("success", func(t *testing.T) {
+		var conf config
+		err := readconf.NewBuilder().
+			Set(`FOO`, `foo`).
+			Set(`BAR`, `bar`).
+			WithValidator(validatorsupport.New()).
+			Build(&conf)
+		require.NoError(t, err)
+	})
+
+	t.Run("keys", func(t *testing.T) {
+		type Pool struct {
+			MaxConns int `default:"1000" validate:"max=100"`
+		}
+
+		var conf struct {
+			DB struct {
+				Pool
+				ReadTimeout time.Duration `default:"0s" validate:"gt=0"`
+			}
+			Cache *struct {
+				MaxEntries int `config:"SIZE" default:"0" validate:"min=1"`
+			}
+			Hosts []string `default:"[\"\"]" validate:"dive,required"`
+		}
+
+		err := readconf.NewBuilder().WithValidator(validatorsupport.New()).Build(&conf)
+		require.IsType(t, &readconf.ValidationError{}, err)
+		require.Equal(t, []readconf.ValidationField{
+			{Key: `CACHE__SIZE`, Rule: `min`, Param: `1`},
+			{Key: `DB__MAX_CONNS`, Rule: `max`, Param: `100`},
+			{Key: `DB__READ_TIMEOUT`, Rule: `gt`, Param: `0`},
+			{Key: `HOSTS`, Rule: `required`},
+		}, err.(*readconf.ValidationError).Fields)
+	})
+
+	t.Run("key strategy", func(t *testing.T) {
+		type named struct {
+			DB struct {
+				MaxConns int `validate:"max=100"`
+			}
+		}
+
+		var conf named
+		err := readconf.NewBuilder().
+			WithKeyStrategy(dottedKeys{}).
+			WithValidator(validatorsupport.New()).
+			MergeData([]byte("db.max-conns=1000")).
+			Build(&conf)
+		require.EqualError(t, err, `validation failed: DB.MAX_CONNS`)
+	})
+}
+
+func TestWrap(t *testing.T) {
+	var conf struct {
+		Foo string `default:"foo" validate:"is_bar"`
+	}
+
+	v := validator.New()
+	require.NoError(t, v.RegisterValidation(`is_bar`, func(fl validator.FieldLevel) bool {
+		return fl.Field().String() == `bar`
+	}))
+
+	builder := readconf.NewBuilder().WithValidator(validatorsupport.Wrap(v))
+
+	unwrapped, ok := validatorsupport.Unwrap(builder.Validator())
+	require.True(t, ok)
+	require.Same(t, v, unwrapped)
+
+	err := builder.Build(&conf)
+	require.EqualError(t, err, `validation failed: FOO`)
+	require.IsType(t, &readconf.ValidationError{}, err)
+}
+
+func TestMapValidator(t *testing.T) {
+	var conf struct {
+		Foo string `default:"foo" validate:"is_bar"`
+	}
+
+	builder := validatorsupport.MapValidator(readconf.NewBuilder(), func(v *validator.Validate) {
+		require.NoError(t, v.RegisterValidation(`is_bar`, func(fl validator.FieldLevel) bool {
+			return fl.Field().String() == `bar`
+		}))
+	})
+	require.EqualError(t, builder.Build(&conf), `validation failed: FOO`)
+
+	v, _ := validatorsupport.Unwrap(builder.Validator())
+	validatorsupport.MapValidator(builder, func(other *validator.Validate) {
+		require.Same(t, v, other)
+	})
+}
+
+// The validate tags of the configuration types of readconf.
+func TestTypes(t *testing.T) {
+	b := func() *readconf.Builder {
+		return readconf.NewBuilder().WithValidator(validatorsupport.New())
+	}
+
+	t.Run("composite", func(t *testing.T) {
+		var conf struct {
+			Limit   readconf.RateLimitConfig
+			Breaker readconf.CircuitBreakerConfig
+		}
+
+		err := b().
+			Set(`LIMIT__BURST`, `0`).
+			Set(`BREAKER__TIMEOUT`, `0s`).
+			Build(&conf)
+		require.IsType(t, &readconf.ValidationError{}, err)
+		require.Equal(t, []readconf.ValidationField{
+			{Key: `BREAKER__TIMEOUT`, Rule: `gt`, Param: `0`},
+			{Key: `LIMIT__BURST`, Rule: `gte`, Param: `1`},
+		}, err.(*readconf.ValidationError).Fields)
+	})
+
+	t.Run("http", func(t *testing.T) {
+		var conf struct {
+			Server readconf.HTTPServerConfig
+			Client readconf.HTTPClientConfig
+		}
+
+		err := b().
+			Set(`SERVER__ADDR`, ``).
+			Set(`CLIENT__PROXY`, `not a url`).
+			Build(&conf)
+		require.IsType(t, &readconf.ValidationError{}, err)
+		require.Equal(t, []readconf.ValidationField{
+			{Key: `CLIENT__PROXY`, Rule: `url`},
+			{Key: `SERVER__ADDR`, Rule: `required`},
+		}, err.(*readconf.ValidationError).Fields)
+	})
+
+	t.Run("grpc", func(t *testing.T) {
+		var conf struct {
+			Server  readconf.GRPCServerConfig
+			Backend readconf.GRPCClientConfig
+		}
+
+		err := b().
+			Set(`BACKEND__TARGET`, ``).
+			Build(&conf)
+		require.IsType(t, &readconf.ValidationError{}, err)
+		require.Equal(t, []readconf.ValidationField{
+			{Key: `BACKEND__TARGET`, Rule: `required`},
+		}, err.(*readconf.ValidationError).Fields)
+
+		err = b().
+			Set(`BACKEND__TARGET`, `backend:443`).
+			Set(`SERVER__TLS__CERT_FILE`, `server.pem`).
+			Build(&conf)
+		require.IsType(t, &readconf.ValidationError{}, err)
+		require.Equal(t, `required_with`, err.(*readconf.ValidationError).Fields[0].Rule)
+
+		err = b().
+			Set(`BACKEND__TARGET`, `backend:443`).
+			Set(`SERVER__TLS__CLIENT_AUTH`, `always`).
+			Build(&conf)
+		require.IsType(t, &readconf.ValidationError{}, err)
+		require.Equal(t, `oneof`, err.(*readconf.ValidationError).Fields[0].Rule)
+	})
+}
+
+type dottedKeys struct{}
+
+func (dottedKeys) FieldKey(name string) string {
+	return readconf.DefaultKeyStrategy().FieldKey(name)
+}
+
+func (dottedKeys) Join(keys ...string) string {
+	return strings.Join(keys, `.`)
+}
+
+func (dottedKeys) Normalize(key string) string {
+	return strings.ToUpper(strings.Replace(strings.TrimSpace(key), `-`, `_`, -1))
+}
@@ -0,0 +1,10 @@
+module github.com/tetratom/readconf/vaultsupport
+
+go 1.13
+
+require (
+	github.com/stretchr/testify v1.4.0
+	github.com/tetratom/readconf v0.0.0
+)
+
+replace github.com/tetratom/readconf => ../
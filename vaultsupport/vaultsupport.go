@@ -0,0 +1,209 @@
+// Package vaultsupport loads secrets from Vault, in a module of its own, so
+// that readconf doesn't include remote sources. It talks to Vault over its
+// HTTP API, so that secrets don't have to pass through the environment.
+//
+//	auth := vaultsupport.Auth{KubernetesRole: "myapp"}
+//	err := readconf.NewBuilder().
+//		MergeSourceContext(ctx, vaultsupport.NewSource("https://vault:8200", auth, []string{"secret/myapp/db"})).
+//		Build(&conf)
+package vaultsupport
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/tetratom/readconf"
+)
+
+const _serviceAccountToken = `/var/run/secrets/kubernetes.io/serviceaccount/token`
+
+// Auth configures how Source authenticates to Vault, with Token if set, or
+// else with the Kubernetes auth method using KubernetesRole.
+type Auth struct {
+	Token string
+	// KubernetesRole is the role to log in as with the token of the pod's
+	// service account.
+	KubernetesRole string
+	// KubernetesMount is the path the Kubernetes auth method is mounted at,
+	// kubernetes by default.
+	KubernetesMount string
+	// KubernetesTokenFile holds the token of the service account, the one
+	// mounted into pods by default.
+	KubernetesTokenFile string
+}
+
+// Source loads secrets from KV version 2 secrets engines of Vault. The fields
+// of the secrets are the configuration keys, merged in the order of the
+// paths.
+type Source struct {
+	addr   string
+	auth   Auth
+	paths  []string
+	client *http.Client
+	header http.Header
+}
+
+// NewSource returns a source of the secrets at paths in the Vault at addr,
+// e.g. https://vault:8200. Paths start with the mount of their secrets engine,
+// e.g. secret/myapp/db.
+func NewSource(addr string, auth Auth, paths []string, opts ...readconf.URLOption) *Source {
+	client, header := readconf.HTTPOptions(opts...)
+
+	return &Source{
+		addr:   strings.TrimSuffix(addr, `/`),
+		auth:   auth,
+		paths:  paths,
+		client: client,
+		header: header,
+	}
+}
+
+func (s *Source) Load(ctx context.Context) (readconf.Map, error) {
+	m, _, err := s.LoadVersion(ctx)
+	return m, err
+}
+
+// LoadVersion returns the versions of the secrets as the version, e.g.
+// secret/myapp/db@3.
+func (s *Source) LoadVersion(ctx context.Context) (readconf.Map, string, error) {
+	token, err := s.login(ctx)
+	if err != nil {
+		return nil, ``, fmt.Errorf("login: %v", err)
+	}
+
+	m := readconf.Map{}
+	versions := make([]string, 0, len(s.paths))
+
+	for _, path := range s.paths {
+		path = strings.Trim(path, `/`)
+
+		mount, rest := path, ``
+		if i := strings.IndexByte(path, '/'); i >= 0 {
+			mount, rest = path[:i], path[i+1:]
+		}
+
+		var resp struct {
+			Data struct {
+				Data     map[string]interface{} `json:"data"`
+				Metadata struct {
+					Version int `json:"version"`
+				} `json:"metadata"`
+			} `json:"data"`
+		}
+
+		if err := s.do(ctx, http.MethodGet, `/v1/`+mount+`/data/`+rest, token, nil, &resp); err != nil {
+			return nil, ``, fmt.Errorf("read %s: %v", path, err)
+		}
+
+		for key, value := range resp.Data.Data {
+			if s, ok := value.(string); ok {
+				m.Set(key, s)
+				continue
+			}
+
+			data, err := json.Marshal(value)
+			if err != nil {
+				return nil, ``, err
+			}
+
+			m.Set(key, string(data))
+		}
+
+		versions = append(versions, path+`@`+strconv.Itoa(resp.Data.Metadata.Version))
+	}
+
+	return m, strings.Join(versions, `,`), nil
+}
+
+func (s *Source) String() string {
+	return `vault ` + strings.Join(s.paths, `,`)
+}
+
+// Returns the token of requests.
+func (s *Source) login(ctx context.Context) (string, error) {
+	if s.auth.Token != `` {
+		return s.auth.Token, nil
+	}
+
+	if s.auth.KubernetesRole == `` {
+		return ``, fmt.Errorf("no token or kubernetes role")
+	}
+
+	mount, tokenFile := s.auth.KubernetesMount, s.auth.KubernetesTokenFile
+	if mount == `` {
+		mount = `kubernetes`
+	}
+	if tokenFile == `` {
+		tokenFile = _serviceAccountToken
+	}
+
+	jwt, err := ioutil.ReadFile(tokenFile)
+	if err != nil {
+		return ``, err
+	}
+
+	var resp struct {
+		Auth struct {
+			ClientToken string `json:"client_token"`
+		} `json:"auth"`
+	}
+
+	if err := s.do(ctx, http.MethodPost, `/v1/auth/`+strings.Trim(mount, `/`)+`/login`, ``, map[string]string{
+		`role`: s.auth.KubernetesRole,
+		`jwt`:  strings.TrimSpace(string(jwt)),
+	}, &resp); err != nil {
+		return ``, err
+	}
+
+	return resp.Auth.ClientToken, nil
+}
+
+// Sends a request with body encoded as JSON, if not nil, and decodes the
+// response into out.
+func (s *Source) do(ctx context.Context, method, path, token string, body, out interface{}) error {
+	var data []byte
+	if body != nil {
+		var err error
+		if data, err = json.Marshal(body); err != nil {
+			return err
+		}
+	}
+
+	req, err := http.NewRequest(method, s.addr+path, bytes.NewReader(data))
+	if err != nil {
+		return err
+	}
+
+	for key, values := range s.header {
+		req.Header[key] = values
+	}
+	if token != `` {
+		req.Header.Set(`X-Vault-Token`, token)
+	}
+
+	resp, err := s.client.Do(req.WithContext(ctx))
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		var vaultErr struct {
+			Errors []string `json:"errors"`
+		}
+
+		if json.NewDecoder(resp.Body).Decode(&vaultErr) == nil && len(vaultErr.Errors) > 0 {
+			return fmt.Errorf("unexpected status %s: %s", resp.Status, strings.Join(vaultErr.Errors, `; `))
+		}
+
+		return fmt.Errorf("unexpected status %s", resp.Status)
+	}
+
+	return json.NewDecoder(resp.Body).Decode(out)
+}
@@ -0,0 +1,90 @@
+package vaultsupport_test
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/tetratom/readconf"
+	"github.com/tetratom/readconf/vaultsupport"
+)
+
+func TestSource(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == `/v1/auth/k8s/login` {
+			var req map[string]string
+			require.NoError(t, json.NewDecoder(r.Body).Decode(&req))
+			require.Equal(t, map[string]string{`role`: `app`, `jwt`: `service-account`}, req)
+
+			fmt.Fprint(w, `{"auth": {"client_token": "k8s-token"}}`)
+			return
+		}
+
+		if token := r.Header.Get(`X-Vault-Token`); token != `token` && token != `k8s-token` {
+			w.WriteHeader(http.StatusForbidden)
+			fmt.Fprint(w, `{"errors": ["permission denied"]}`)
+			return
+		}
+
+		switch r.URL.Path {
+		case `/v1/secret/data/app/db`:
+			fmt.Fprint(w, `{"data": {"data": {"DB__PASSWORD": "hunter2", "DB__PORT": 5432}, "metadata": {"version": 3}}}`)
+		case `/v1/secret/data/app/api`:
+			fmt.Fprint(w, `{"data": {"data": {"API_KEY": "key"}, "metadata": {"version": 1}}}`)
+		default:
+			w.WriteHeader(http.StatusNotFound)
+			fmt.Fprint(w, `{"errors": []}`)
+		}
+	}))
+	defer server.Close()
+
+	paths := []string{`secret/app/db`, `/secret/app/api`}
+
+	t.Run("token", func(t *testing.T) {
+		source := vaultsupport.NewSource(server.URL, vaultsupport.Auth{Token: `token`}, paths)
+
+		var conf struct{}
+		lock, err := readconf.NewBuilder().MergeSource(source).Lock(&conf)
+		require.NoError(t, err)
+		require.Equal(t, readconf.Map{`DB__PASSWORD`: `hunter2`, `DB__PORT`: `5432`, `API_KEY`: `key`}, lock.Values)
+		require.Equal(t, []readconf.LockedSource{{
+			Name:    `vault secret/app/db,/secret/app/api`,
+			Version: `secret/app/db@3,secret/app/api@1`,
+		}}, lock.Sources)
+	})
+
+	t.Run("kubernetes", func(t *testing.T) {
+		f, err := ioutil.TempFile(``, `readconf`)
+		require.NoError(t, err)
+		defer os.Remove(f.Name())
+
+		_, err = f.WriteString("service-account\n")
+		require.NoError(t, err)
+		require.NoError(t, f.Close())
+
+		var conf struct {
+			APIKey string
+		}
+
+		auth := vaultsupport.Auth{KubernetesRole: `app`, KubernetesMount: `k8s`, KubernetesTokenFile: f.Name()}
+		require.NoError(t, readconf.NewBuilder().MergeSource(vaultsupport.NewSource(server.URL, auth, paths)).Build(&conf))
+		require.Equal(t, `key`, conf.APIKey)
+	})
+
+	t.Run("errors", func(t *testing.T) {
+		err := readconf.NewBuilder().MergeSource(vaultsupport.NewSource(server.URL, vaultsupport.Auth{Token: `other`}, paths)).Error()
+		require.EqualError(t, err, `vault secret/app/db,/secret/app/api: read secret/app/db: unexpected status 403 Forbidden: permission denied`)
+
+		err = readconf.NewBuilder().MergeSource(vaultsupport.NewSource(server.URL, vaultsupport.Auth{Token: `token`}, []string{`secret/missing`})).Error()
+		require.EqualError(t, err, `vault secret/missing: read secret/missing: unexpected status 404 Not Found`)
+
+		err = readconf.NewBuilder().MergeSource(vaultsupport.NewSource(server.URL, vaultsupport.Auth{}, paths)).Error()
+		require.EqualError(t, err, `vault secret/app/db,/secret/app/api: login: no token or kubernetes role`)
+	})
+}
@@ -0,0 +1,146 @@
+package readconf
+
+import (
+	"fmt"
+	"os"
+	"sync"
+	"time"
+)
+
+const (
+	_defaultWatchInterval = time.Second
+	_defaultWatchDebounce = 100 * time.Millisecond
+)
+
+// Watcher polls files for changes, e.g. to reload configuration when they
+// are written. Polling works on all platforms, on network file systems and
+// with the atomic updates of Kubernetes volumes, without depending on file
+// system notifications.
+//
+// Notifications, e.g. by fsnotify, aren't used: they would add a dependency to
+// the package, they aren't delivered for network file systems, and watches of
+// files are lost when editors and Kubernetes replace them by renames, so that
+// the directories would have to be watched and their events filtered.
+// Configuration files are few and rarely change, so polling them every second
+// costs little.
+type Watcher struct {
+	mu    sync.Mutex
+	files []string
+
+	interval time.Duration
+	debounce time.Duration
+	onChange func()
+
+	stop chan struct{}
+	once sync.Once
+	done chan struct{}
+}
+
+// NewWatcher starts watching files, which need not exist, and calls onChange
+// once files stay unchanged for debounce after they were changed, created or
+// removed, so that rapid writes cause a single call. Files are polled every
+// interval. The interval is a second and the debounce 100ms if they are 0.
+func NewWatcher(files []string, interval, debounce time.Duration, onChange func()) *Watcher {
+	if interval <= 0 {
+		interval = _defaultWatchInterval
+	}
+	if debounce <= 0 {
+		debounce = _defaultWatchDebounce
+	}
+
+	w := &Watcher{
+		files:    append([]string{}, files...),
+		interval: interval,
+		debounce: debounce,
+		onChange: onChange,
+		stop:     make(chan struct{}),
+		done:     make(chan struct{}),
+	}
+
+	// changes after NewWatcher returns must be seen
+	go w.run(w.state())
+	return w
+}
+
+// Close stops watching and waits for a running call of onChange to return.
+func (w *Watcher) Close() {
+	w.once.Do(func() {
+		close(w.stop)
+	})
+
+	<-w.done
+}
+
+func (w *Watcher) run(state map[string]string) {
+	defer close(w.done)
+
+	ticker := time.NewTicker(w.interval)
+	defer ticker.Stop()
+
+	pending := false
+	var changed time.Time
+
+	for {
+		select {
+		case <-w.stop:
+			return
+		case now := <-ticker.C:
+			s := w.state()
+			if stateChanged(state, s) {
+				state = s
+				pending = true
+				changed = now
+				continue
+			}
+
+			// takes the state of files added by setFiles
+			state = s
+
+			if pending && now.Sub(changed) >= w.debounce {
+				pending = false
+				w.onChange()
+			}
+		}
+	}
+}
+
+// Replaces the files watched, e.g. when configuration includes other files
+// after a reload.
+func (w *Watcher) setFiles(files []string) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	w.files = append([]string{}, files...)
+}
+
+// Returns the state of each file, which differs if it changed.
+func (w *Watcher) state() map[string]string {
+	w.mu.Lock()
+	files := w.files
+	w.mu.Unlock()
+
+	state := make(map[string]string, len(files))
+	for _, filename := range files {
+		info, err := os.Stat(filename)
+		if err != nil {
+			state[filename] = `-`
+			continue
+		}
+
+		state[filename] = fmt.Sprintf("%d %d %s", info.ModTime().UnixNano(), info.Size(), info.Mode())
+	}
+
+	return state
+}
+
+// Returns true if any of the files of both states changed. Files that are
+// only in one of them were added or removed by setFiles.
+func stateChanged(before, after map[string]string) bool {
+	for filename, s := range after {
+		if b, ok := before[filename]; ok && b != s {
+			return true
+		}
+	}
+
+	return false
+}
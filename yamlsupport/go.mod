@@ -0,0 +1,11 @@
+module github.com/tetratom/readconf/yamlsupport
+
+go 1.13
+
+require (
+	github.com/stretchr/testify v1.4.0
+	github.com/tetratom/readconf v0.0.0
+	gopkg.in/yaml.v2 v2.2.8
+)
+
+replace github.com/tetratom/readconf => ../
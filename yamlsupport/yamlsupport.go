@@ -0,0 +1,120 @@
+// Package yamlsupport adds YAML configuration files to readconf, in a module
+// of its own, so that readconf doesn't depend on gopkg.in/yaml.v2. Importing
+// the package registers the format: .yaml and .yml files are parsed by
+// readconf.MergeFS and readconf.MergeURL, as are YAML responses, and
+// readconf.FormatYAML can be written.
+//
+//	err := readconf.NewBuilder().
+//		MergeSource(yamlsupport.FileSource("app.yaml")).
+//		MergeEnviron("APP_", os.Environ()).
+//		Build(&conf)
+package yamlsupport
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strconv"
+
+	"gopkg.in/yaml.v2"
+
+	"github.com/tetratom/readconf"
+)
+
+func init() {
+	readconf.RegisterFormat(readconf.FileFormat{
+		Name:       `yaml`,
+		Extensions: []string{`.yaml`, `.yml`},
+		MediaTypes: []string{`application/yaml`, `application/x-yaml`, `text/yaml`, `text/x-yaml`},
+		Parse:      Source,
+		Marshal:    yaml.Marshal,
+	})
+}
+
+// Source returns a Source flattening the YAML document in data. Keys of nested
+// mappings are joined by the key strategy of the builder, e.g. database:
+// {host: x} sets DATABASE__HOST by default, and lists are kept as JSON arrays, which slice fields
+// unmarshal. Use readconf.ReaderSource to read YAML from an io.Reader.
+func Source(data []byte) readconf.Source {
+	return yamlSource(data)
+}
+
+// FileSource returns a Source reading a YAML file, like Source.
+func FileSource(filename string) readconf.Source {
+	return readconf.FormatFileSource(filename, `yaml`, Source)
+}
+
+type yamlSource []byte
+
+func (s yamlSource) Load(ctx context.Context) (readconf.Map, error) {
+	var doc interface{}
+	if err := yaml.Unmarshal(s, &doc); err != nil {
+		return nil, err
+	}
+
+	switch doc := doc.(type) {
+	case nil:
+		return readconf.Map{}, nil
+	case map[interface{}]interface{}:
+		v, err := yamlToJSON(doc)
+		if err != nil {
+			return nil, err
+		}
+
+		// flattened like JSON, with the same keys and forms of values
+		data, err := json.Marshal(v)
+		if err != nil {
+			return nil, err
+		}
+
+		return readconf.JSONSource(data).Load(ctx)
+	default:
+		return nil, fmt.Errorf("expected YAML mapping, got %T", doc)
+	}
+}
+
+func (s yamlSource) String() string {
+	return `yaml`
+}
+
+// Converts a value decoded from YAML to the types decoded from JSON.
+func yamlToJSON(v interface{}) (interface{}, error) {
+	switch v := v.(type) {
+	case map[interface{}]interface{}:
+		obj := make(map[string]interface{}, len(v))
+		for k, item := range v {
+			item, err := yamlToJSON(item)
+			if err != nil {
+				return nil, err
+			}
+
+			obj[fmt.Sprint(k)] = item
+		}
+
+		return obj, nil
+	case []interface{}:
+		arr := make([]interface{}, len(v))
+		for i := range v {
+			item, err := yamlToJSON(v[i])
+			if err != nil {
+				return nil, err
+			}
+
+			arr[i] = item
+		}
+
+		return arr, nil
+	case int:
+		return json.Number(strconv.Itoa(v)), nil
+	case int64:
+		return json.Number(strconv.FormatInt(v, 10)), nil
+	case uint64:
+		return json.Number(strconv.FormatUint(v, 10)), nil
+	case float64:
+		return json.Number(strconv.FormatFloat(v, 'f', -1, 64)), nil
+	case nil, string, bool:
+		return v, nil
+	default:
+		return nil, fmt.Errorf("unexpected YAML value of type %T", v)
+	}
+}
@@ -0,0 +1,174 @@
+package yamlsupport_test
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/tetratom/readconf"
+	"github.com/tetratom/readconf/yamlsupport"
+)
+
+func TestSource(t *testing.T) {
+	var conf struct {
+		Name     string
+		Database struct {
+			Host string
+			Port int
+			Pool struct {
+				MaxIdle int
+			}
+		}
+		Ports []int
+		Tags  []string
+		Ratio float64
+		Debug bool
+	}
+
+	t.Run("file", func(t *testing.T) {
+		err := readconf.NewBuilder().MergeSource(yamlsupport.FileSource(`testdata/config.yaml`)).Build(&conf)
+		require.NoError(t, err)
+		require.Equal(t, `app`, conf.Name)
+		require.Equal(t, `db.local`, conf.Database.Host)
+		require.Equal(t, 5432, conf.Database.Port)
+		require.Equal(t, 2, conf.Database.Pool.MaxIdle)
+		require.Equal(t, []int{80, 443}, conf.Ports)
+		require.Equal(t, []string{`a`, `b`}, conf.Tags)
+		require.Equal(t, 0.5, conf.Ratio)
+		require.True(t, conf.Debug)
+	})
+
+	t.Run("keys", func(t *testing.T) {
+		report, err := readconf.NewBuilder().
+			MergeSource(yamlsupport.Source([]byte("database:\n  host: db.local\nempty:\n"))).
+			MergeData([]byte("DATABASE__PORT=1")).
+			DryRun(&struct {
+				Database struct {
+					Host string
+					Port int
+				}
+				Empty string
+			}{})
+		require.NoError(t, err)
+		require.Equal(t, `db.local`, report.Values.Get(`DATABASE__HOST`))
+		require.Equal(t, ``, report.Values.Get(`EMPTY`))
+	})
+
+	t.Run("key strategy", func(t *testing.T) {
+		var conf struct {
+			Database struct {
+				Host string
+			}
+		}
+
+		err := readconf.NewBuilder().
+			WithKeyStrategy(dottedKeys{}).
+			MergeSource(yamlsupport.Source([]byte("database:\n  host: db.local\n"))).
+			Build(&conf)
+		require.NoError(t, err)
+		require.Equal(t, `db.local`, conf.Database.Host)
+	})
+
+	t.Run("errors", func(t *testing.T) {
+		err := readconf.NewBuilder().MergeSource(yamlsupport.Source([]byte("- a\n- b"))).Error()
+		require.EqualError(t, err, `yaml: expected YAML mapping, got []interface {}`)
+
+		err = readconf.NewBuilder().MergeSource(yamlsupport.Source([]byte("a: ["))).Error()
+		require.Error(t, err)
+
+		err = readconf.NewBuilder().MergeSource(yamlsupport.FileSource(`testdata/missing.yaml`)).Error()
+		require.EqualError(t, err,
+			`yaml file testdata/missing.yaml: open testdata/missing.yaml: no such file or directory`)
+	})
+}
+
+func TestFormat(t *testing.T) {
+	t.Run("url", func(t *testing.T) {
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set(`Content-Type`, `application/yaml; charset=utf-8`)
+			fmt.Fprint(w, "name: yaml\nport: 81\n")
+		}))
+		defer server.Close()
+
+		var conf struct {
+			Name string
+			Port int
+		}
+
+		require.NoError(t, readconf.NewBuilder().MergeURL(context.Background(), server.URL+`/app`).Build(&conf))
+		require.Equal(t, `yaml`, conf.Name)
+		require.Equal(t, 81, conf.Port)
+	})
+
+	t.Run("reader", func(t *testing.T) {
+		err := readconf.NewBuilder().MergeSource(readconf.ReaderSource(strings.NewReader("- a"), yamlsupport.Source)).Error()
+		require.EqualError(t, err, `yaml reader: expected YAML mapping, got []interface {}`)
+	})
+
+	t.Run("describe", func(t *testing.T) {
+		var conf struct {
+			Name     string `usage:"name of the service"`
+			Greeting string `default:""`
+			DB       struct {
+				Port int `default:"5432"`
+			}
+		}
+
+		docs, err := readconf.Describe(&conf)
+		require.NoError(t, err)
+
+		var buf bytes.Buffer
+		require.NoError(t, readconf.WriteDescribe(&buf, docs, readconf.FormatYAML))
+		require.Equal(t, ""+
+			"- key: DB__PORT\n"+
+			"  type: int\n"+
+			"  default: \"5432\"\n"+
+			"  required: false\n"+
+			"- key: GREETING\n"+
+			"  type: string\n"+
+			"  default: \"\"\n"+
+			"  required: false\n"+
+			"- key: NAME\n"+
+			"  type: string\n"+
+			"  required: true\n"+
+			"  usage: name of the service\n",
+			buf.String())
+	})
+
+	t.Run("report", func(t *testing.T) {
+		var conf struct {
+			Name     string
+			Password string
+		}
+
+		report, err := readconf.NewBuilder().
+			MergeMap(readconf.Map{`NAME`: `app`, `PASSWORD`: `hunter2`}).
+			BuildReport(&conf)
+		require.NoError(t, err)
+
+		var buf bytes.Buffer
+		require.NoError(t, report.Write(&buf, readconf.FormatYAML))
+		require.Contains(t, buf.String(), "- key: NAME\n  origin: set\n  value: app\n")
+		require.NotContains(t, buf.String(), `hunter2`)
+	})
+}
+
+type dottedKeys struct{}
+
+func (dottedKeys) FieldKey(name string) string {
+	return readconf.DefaultKeyStrategy().FieldKey(name)
+}
+
+func (dottedKeys) Join(keys ...string) string {
+	return strings.Join(keys, `.`)
+}
+
+func (dottedKeys) Normalize(key string) string {
+	return strings.ToUpper(key)
+}